@@ -0,0 +1,166 @@
+#!/usr/bin/env python3
+"""
+TELOS Mode-Off Verification - Nothing is denied, events still flow
+
+Run against a daemon started with --mode off:
+
+    sudo ./bin/telos_daemon --mode off
+    sudo python3 benchmarks/mode_off_test.py
+
+The test taints its own PID CRITICAL (and then quarantines it), which
+would deny exec and sensitive opens in enforce mode, and checks that:
+  1. exec and open of an id_* file still succeed
+  2. the hooks still report them on a SUBSCRIBE stream (blocked=true,
+     i.e. "would have been denied")
+  3. taint updates and queries keep working
+"""
+
+import json
+import os
+import socket
+import subprocess
+import sys
+import tempfile
+import threading
+import time
+
+SOCKET_PATH = os.environ.get("TELOS_SOCKET", "/var/run/telos.sock")
+EVENT_WAIT = 3.0  # seconds to wait for events after the actions
+
+
+def request(command, data=None):
+    """Send one command on a fresh connection and return the response."""
+    with socket.socket(socket.AF_UNIX, socket.SOCK_STREAM) as sock:
+        sock.settimeout(5)
+        sock.connect(SOCKET_PATH)
+        sock.sendall(json.dumps({"command": command, "data": data or {}}).encode() + b"\n")
+        return json.loads(sock.makefile().readline())
+
+
+class EventCollector(threading.Thread):
+    """Collects events from a SUBSCRIBE stream."""
+
+    def __init__(self):
+        super().__init__(daemon=True)
+        self.events = []
+        self.ready = threading.Event()
+        self.sock = socket.socket(socket.AF_UNIX, socket.SOCK_STREAM)
+
+    def run(self):
+        self.sock.connect(SOCKET_PATH)
+        self.sock.sendall(b'{"command":"SUBSCRIBE"}\n')
+        stream = self.sock.makefile()
+        stream.readline()  # subscription ack
+        self.ready.set()
+        for line in stream:
+            try:
+                self.events.append(json.loads(line))
+            except ValueError:
+                pass
+
+    def close(self):
+        try:
+            self.sock.shutdown(socket.SHUT_RDWR)
+        except OSError:
+            pass
+        self.sock.close()
+
+
+def try_exec():
+    """Run /bin/true; returns (ok, child pid)."""
+    try:
+        proc = subprocess.Popen(["/bin/true"])
+        return proc.wait(timeout=5) == 0, proc.pid
+    except PermissionError:
+        return False, None
+
+
+def try_open(path):
+    try:
+        with open(path) as f:
+            f.read()
+        return True
+    except PermissionError:
+        return False
+
+
+def main():
+    print("╔═══════════════════════════════════════════════════════╗")
+    print("║         TELOS Mode-Off Verification                   ║")
+    print("╚═══════════════════════════════════════════════════════╝")
+    print()
+
+    pid = os.getpid()
+    resp = request("GET_CONFIG_KEY", {"key": 0})
+    if not resp.get("success"):
+        print(f"❌ Cannot read config: {resp.get('error')}")
+        return 1
+    mode = resp["data"]["config"].get("mode")
+    if mode != "off":
+        print(f"❌ Daemon is in mode {mode!r}; start it with --mode off")
+        return 1
+    print(f"PID: {pid}, daemon mode: {mode}")
+    print()
+
+    collector = EventCollector()
+    collector.start()
+    if not collector.ready.wait(5):
+        print("❌ SUBSCRIBE did not answer")
+        return 1
+
+    keyfile = tempfile.NamedTemporaryFile(prefix="id_telos_mode_off_", delete=False)
+    keyfile.write(b"not a key\n")
+    keyfile.close()
+
+    failures = 0
+    child_pids = set()
+    try:
+        for step, setup in (("CRITICAL taint", ("UPDATE_TAINT", {"pid": pid, "taint_level": 4})),
+                            ("quarantine", ("QUARANTINE_PID", {"pid": pid}))):
+            resp = request(*setup)
+            if not resp.get("success"):
+                print(f"  ❌ {setup[0]}: {resp.get('error')}")
+                failures += 1
+                continue
+
+            ok, child = try_exec()
+            if child:
+                child_pids.add(child)
+            print(f"  {'✅' if ok else '❌'} exec /bin/true under {step}")
+            failures += not ok
+
+            ok = try_open(keyfile.name)
+            print(f"  {'✅' if ok else '❌'} open {os.path.basename(keyfile.name)} under {step}")
+            failures += not ok
+
+        resp = request("GET_EFFECTIVE_POLICY", {"pid": pid})
+        ok = resp.get("success") and resp["data"].get("mode") == "off"
+        print(f"  {'✅' if ok else '❌'} GET_EFFECTIVE_POLICY answers (mode off)")
+        failures += not ok
+    finally:
+        request("UNQUARANTINE_PID", {"pid": pid})
+        request("CLEAR_TAINT", {"pid": pid})
+        os.unlink(keyfile.name)
+
+    time.sleep(EVENT_WAIT)
+    collector.close()
+
+    ours = [e for e in collector.events
+            if e.get("pid") == pid or e.get("pid") in child_pids]
+    for action in ("execve", "open"):
+        seen = [e for e in ours if e.get("action") == action and e.get("blocked")]
+        ok = len(seen) > 0
+        print(f"  {'✅' if ok else '❌'} {action} reported on the event stream ({len(seen)} events)")
+        failures += not ok
+
+    print()
+    print("=" * 50)
+    if failures:
+        print(f"❌ {failures} check(s) failed")
+        return 1
+    print("✅ Mode off: nothing denied, events still flowing")
+    return 0
+
+
+if __name__ == '__main__':
+    sys.exit(main())
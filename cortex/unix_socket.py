@@ -7,12 +7,16 @@ Protocol:
     - JSON messages terminated by newline
     - Commands: UPDATE_TAINT, CLEAR_TAINT, GET_STATE
     - Responses: {success: bool, error?: string, data?: object}
+    - With compress=True, large responses arrive gzipped
+      ({compressed: "gzip", size, payload}) and are inflated transparently
 """
 
+import base64
+import gzip
 import json
 import socket
 import logging
-from typing import Optional, Dict, Any
+from typing import Optional, Dict, Any, List
 
 log = logging.getLogger('telos.ipc')
 
@@ -30,8 +34,9 @@ class CoreIPCClient:
     to update BPF maps.
     """
     
-    def __init__(self, socket_path: str = DEFAULT_SOCKET_PATH):
+    def __init__(self, socket_path: str = DEFAULT_SOCKET_PATH, compress: bool = False):
         self.socket_path = socket_path
+        self.compress = compress
         self.sock: Optional[socket.socket] = None
         self.connected = False
     
@@ -48,7 +53,12 @@ class CoreIPCClient:
             self.sock.connect(self.socket_path)
             self.connected = True
             log.info(f"Connected to Core at {self.socket_path}")
-            return True
+            if self.compress:
+                # Per connection; an older Core just answers without it
+                response = self._send_command('SET_COMPRESSION', {'encoding': 'gzip'})
+                if not (response and response.get('success')):
+                    log.info("Core does not compress responses")
+            return self.connected
             
         except FileNotFoundError:
             log.warning(f"Core socket not found: {self.socket_path}")
@@ -116,6 +126,9 @@ class CoreIPCClient:
             
             if response_data:
                 response = json.loads(response_data.decode('utf-8').strip())
+                if 'compressed' in response:
+                    raw = gzip.decompress(base64.b64decode(response['payload']))
+                    response = json.loads(raw.decode('utf-8'))
                 log.debug(f"Received: {response}")
                 return response
             else:
@@ -196,21 +209,33 @@ class CoreIPCClient:
             log.error(f"Core: Failed to clear taint for PID {pid}: {error}")
             return False
     
-    def send_register_agent(self, pid: int, comm: str = "") -> bool:
+    def send_register_agent(self, pid: int, comm: str = "",
+                            initial_taint: Optional[int] = None,
+                            force_clean: bool = False) -> bool:
         """
         Register an agent process in the BPF map (for tracking).
         
         Args:
             pid: Agent process ID
             comm: Process command name (e.g., "python3")
+            initial_taint: Starting taint level (default CLEAN); never
+                lowers the taint of an already tracked PID
+            force_clean: Reset an already tracked PID's taint to
+                initial_taint instead of keeping it
             
         Returns:
             True if Core acknowledged
         """
-        response = self._send_command('REGISTER_AGENT', {
+        data = {
             'pid': pid,
-            'comm': comm[:15] if comm else ''  # BPF comm limit is 16 chars
-        })
+            # BPF comm holds 15 bytes; cut on a character boundary
+            'comm': comm.encode()[:15].decode('utf-8', 'ignore') if comm else ''
+        }
+        if initial_taint is not None:
+            data['initial_taint'] = initial_taint
+        if force_clean:
+            data['force_clean'] = True
+        response = self._send_command('REGISTER_AGENT', data)
         
         if response and response.get('success'):
             log.info(f"Core: Agent registered PID {pid}")
@@ -218,6 +243,51 @@ class CoreIPCClient:
         else:
             return False
     
+    def send_set_comm(self, pid: int, comm: Optional[str] = None) -> bool:
+        """
+        Relabel a tracked process (e.g. after it re-exec'd), keeping its
+        taint and flags.
+        
+        Args:
+            pid: Tracked process ID
+            comm: New name; None refreshes it from /proc
+            
+        Returns:
+            True if Core updated the entry
+        """
+        data: Dict[str, Any] = {'pid': pid}
+        if comm is not None:
+            data['comm'] = comm
+        response = self._send_command('SET_COMM', data)
+        
+        if response and response.get('success'):
+            log.info(f"Core: PID {pid} comm set to {response['data']['comm']!r}")
+            return True
+        else:
+            return False
+    
+    def simulate_taint(self, pid: int, taint_level: int) -> Optional[Dict[str, Any]]:
+        """
+        Ask Core what the hooks would decide for a PID at a taint level,
+        without changing anything.
+        
+        Args:
+            pid: Process ID to evaluate
+            taint_level: Hypothetical taint level (0-4)
+            
+        Returns:
+            Per-hook decisions ({'hooks': {'exec': {'decision': ...}, ...}})
+            or None
+        """
+        response = self._send_command('SIMULATE_TAINT', {
+            'pid': pid,
+            'taint_level': taint_level
+        })
+        
+        if response and response.get('success'):
+            return response.get('data', {})
+        return None
+    
     def get_state(self) -> Optional[Dict[str, Any]]:
         """
         Get current state from Core (for debugging).
@@ -231,6 +301,43 @@ class CoreIPCClient:
             return response.get('data', {})
         return None
     
+    def get_denials(self, pid: int, limit: int = 20,
+                    include_audit: bool = False) -> Optional[List[Dict[str, Any]]]:
+        """
+        Get the operations Core recently denied for a PID, newest first.
+        
+        Args:
+            pid: Process ID to look up
+            limit: Maximum number of denials returned
+            include_audit: Also list operations only audited (not enforcing)
+            
+        Returns:
+            List of {'hook', 'action', 'reason', 'explanation', ...} or None
+        """
+        response = self._send_command('GET_DENIALS', {
+            'pid': pid,
+            'limit': limit,
+            'include_audit': include_audit
+        })
+        
+        if response and response.get('success'):
+            return response.get('data', {}).get('denials', [])
+        return None
+    
+    def get_peer_state(self) -> Optional[Dict[str, Any]]:
+        """
+        Get other hosts' taint state from Core's state mirror.
+        
+        Returns:
+            {'host': <this host>, 'hosts': {host: [records]}} or None
+            (also None when Core runs without --state-mirror)
+        """
+        response = self._send_command('GET_PEER_STATE', {})
+        
+        if response and response.get('success'):
+            return response.get('data', {})
+        return None
+    
     def ping(self) -> bool:
         """Check if Core is responsive."""
         response = self._send_command('PING', {})
@@ -15,8 +15,9 @@
 struct process_info_t {
     __u32 pid;
     __u32 taint_level;     // Current infection level
-    __u32 is_sandboxed;    // 1 if running in Docker
+    __u32 is_sandboxed;    // 1 = thresholds tightened by sandbox_tighten
     char comm[16];         // Process name (e.g., "python3")
+    __u32 quarantined;     // 1 = hard deny everything, regardless of taint
 };
 
 // --- TELOS EDGE (XDP) MAPS ---
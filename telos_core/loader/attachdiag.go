@@ -0,0 +1,108 @@
+/*
+ * Telos Core - Attach Diagnostics
+ *
+ * A failed link.AttachLSM almost always has one of a few causes, none of
+ * which the bare errno explains:
+ *
+ *   - "bpf" missing from the active LSM list (boot parameter lsm=)
+ *   - kernel older than 5.7, or built without CONFIG_BPF_LSM
+ *   - kernel without BTF (CONFIG_DEBUG_INFO_BTF), which LSM programs need
+ *   - missing privileges (CAP_BPF / CAP_SYS_ADMIN / CAP_MAC_ADMIN)
+ *
+ * attachHints inspects the error and the host and returns one line of
+ * remediation per cause found, each naming the /proc or /sys value to
+ * check.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"syscall"
+
+	"github.com/cilium/ebpf"
+)
+
+const (
+	activeLSMPath = "/sys/kernel/security/lsm"
+	vmlinuxBTF    = "/sys/kernel/btf/vmlinux"
+	osReleasePath = "/proc/sys/kernel/osrelease"
+	enotsupp      = syscall.Errno(524) // kernel-internal ENOTSUPP
+)
+
+// minLSMKernel is the first kernel with BPF LSM programs
+var minLSMKernel = [2]int{5, 7}
+
+// attachHints returns remediation hints for an AttachLSM error
+func attachHints(err error) []string {
+	var hints []string
+
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EACCES) {
+		hints = append(hints, "permission denied: run as root or grant CAP_BPF, CAP_PERFMON and CAP_MAC_ADMIN "+
+			"(check CapEff in /proc/self/status)")
+	}
+
+	if release, major, minor, ok := kernelRelease(); ok &&
+		(major < minLSMKernel[0] || major == minLSMKernel[0] && minor < minLSMKernel[1]) {
+		hints = append(hints, fmt.Sprintf("kernel %s is too old: BPF LSM needs %d.%d+ (see %s)",
+			release, minLSMKernel[0], minLSMKernel[1], osReleasePath))
+	}
+
+	if lsms, err := os.ReadFile(activeLSMPath); err == nil {
+		if !containsLSM(string(lsms), "bpf") {
+			hints = append(hints, fmt.Sprintf("\"bpf\" is not an active LSM (%s: %s): "+
+				"add it to the lsm= boot parameter, e.g. lsm=%s,bpf, and reboot",
+				activeLSMPath, strings.TrimSpace(string(lsms)), strings.TrimSpace(string(lsms))))
+		}
+	} else if os.IsNotExist(err) {
+		hints = append(hints, fmt.Sprintf("%s not found: mount securityfs or check the kernel has CONFIG_SECURITY", activeLSMPath))
+	}
+
+	if _, err := os.Stat(vmlinuxBTF); os.IsNotExist(err) {
+		hints = append(hints, fmt.Sprintf("%s not found: the kernel lacks BTF (CONFIG_DEBUG_INFO_BTF=y), "+
+			"which LSM programs require", vmlinuxBTF))
+	}
+
+	if len(hints) == 0 && (errors.Is(err, ebpf.ErrNotSupported) || errors.Is(err, syscall.EOPNOTSUPP) ||
+		errors.Is(err, enotsupp) || errors.Is(err, syscall.EINVAL)) {
+		hints = append(hints, "kernel rejected the LSM attach: check CONFIG_BPF_LSM=y "+
+			"(grep BPF_LSM /boot/config-$(uname -r)) and that the object was built with BTF (clang -g)")
+	}
+
+	return hints
+}
+
+// logAttachHints logs the hints for an attach failure
+func logAttachHints(err error) {
+	for _, hint := range attachHints(err) {
+		log.Printf("  Hint: %s", hint)
+	}
+}
+
+// containsLSM reports whether name is in a comma-separated LSM list
+func containsLSM(list, name string) bool {
+	for _, lsm := range strings.Split(strings.TrimSpace(list), ",") {
+		if lsm == name {
+			return true
+		}
+	}
+	return false
+}
+
+// kernelRelease returns the running kernel's release and major.minor
+func kernelRelease() (string, int, int, bool) {
+	data, err := os.ReadFile(osReleasePath)
+	if err != nil {
+		return "", 0, 0, false
+	}
+	release := strings.TrimSpace(string(data))
+	var major, minor int
+	if _, err := fmt.Sscanf(release, "%d.%d", &major, &minor); err != nil {
+		return release, 0, 0, false
+	}
+	return release, major, minor, true
+}
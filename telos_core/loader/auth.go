@@ -0,0 +1,109 @@
+/*
+ * Telos Core - Peer Authentication
+ *
+ * The socket is group-accessible (0660), so anyone in the group can
+ * steer taint. Commands that could switch enforcement off entirely are
+ * additionally restricted by the caller's credentials as reported by
+ * the kernel (SO_PEERCRED): root, or a UID listed in --admin-uids.
+ *
+ * SHUTDOWN is such a command (native protocol only). It acknowledges,
+ * then sends the daemon SIGTERM so shutdown takes exactly the same path
+ * as a signal.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ErrPermissionDenied is returned to callers lacking the required UID
+const ErrPermissionDenied = "ERR_PERMISSION_DENIED"
+
+// peerCred returns the credentials of the process on the other end of
+// a Unix socket
+func peerCred(conn net.Conn) (*syscall.Ucred, error) {
+	if sc, ok := conn.(*syncConn); ok {
+		conn = sc.Conn
+	}
+	uc, ok := conn.(*net.UnixConn)
+	if !ok {
+		return nil, fmt.Errorf("not a Unix socket")
+	}
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err == nil {
+		err = credErr
+	}
+	return cred, err
+}
+
+// parseUIDs parses a comma-separated UID list
+func parseUIDs(list string) ([]uint32, error) {
+	var uids []uint32
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		uid, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid UID %q", s)
+		}
+		uids = append(uids, uint32(uid))
+	}
+	return uids, nil
+}
+
+// isAdmin reports whether the peer on conn may run admin commands
+func (d *TelosDaemon) isAdmin(conn net.Conn) (bool, *syscall.Ucred) {
+	cred, err := peerCred(conn)
+	if err != nil {
+		log.Printf("Warning: cannot read peer credentials: %v", err)
+		return false, nil
+	}
+	if cred.Uid == 0 {
+		return true, cred
+	}
+	for _, uid := range d.opts.AdminUIDs {
+		if cred.Uid == uid {
+			return true, cred
+		}
+	}
+	return false, cred
+}
+
+// handleShutdown serves SHUTDOWN on conn; it reports whether the
+// daemon is going down (so the connection should end)
+func (d *TelosDaemon) handleShutdown(conn net.Conn) bool {
+	ok, cred := d.isAdmin(conn)
+	if !ok {
+		uid := "unknown"
+		if cred != nil {
+			uid = strconv.FormatUint(uint64(cred.Uid), 10)
+		}
+		log.Printf("[SHUTDOWN] Refused for UID %s", uid)
+		d.sendResponse(conn, errorResponse(ErrPermissionDenied, "SHUTDOWN requires root or an --admin-uids UID"))
+		return false
+	}
+
+	log.Printf("[SHUTDOWN] Requested by PID %d (UID %d)", cred.Pid, cred.Uid)
+	d.sendResponse(conn, IPCResponse{Success: true, Data: "shutting down"})
+
+	// Same path as SIGTERM: the signal handler runs Stop() and exits
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	return true
+}
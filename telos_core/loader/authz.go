@@ -0,0 +1,169 @@
+/*
+ * Telos Core - Command Authorization
+ *
+ * With --authz-policy, each connection's peer UID (SO_PEERCRED, see
+ * auth.go) is checked against a policy file before any command runs:
+ *
+ *   {
+ *     "uids": {
+ *       "1000": ["GET_*", "HEALTH", "PING", "SUBSCRIBE"],
+ *       "1001": ["*"]
+ *     },
+ *     "default": ["PING"]
+ *   }
+ *
+ * An entry is a command name or a prefix ending in "*". UIDs not listed
+ * get "default" (nothing if absent). Root may run everything unless it
+ * is listed itself. Disallowed commands fail with ERR_FORBIDDEN.
+ *
+ * Without --authz-policy every socket client may run every command, as
+ * before. The policy only narrows access: SHUTDOWN still also requires
+ * root or an --admin-uids UID. The socket has no TLS listener, so
+ * identities are UIDs only.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ErrForbidden is returned for commands the caller's policy does not allow
+const ErrForbidden = "ERR_FORBIDDEN"
+
+// connCommands are handled by handleConnection rather than the registry
+var connCommands = map[string]bool{
+	"SHUTDOWN":        true,
+	"SUBSCRIBE":       true,
+	"SUBSCRIBE_STATE": true,
+	"SET_COMPRESSION": true,
+}
+
+// authzPolicy maps UIDs to allowed command patterns
+type authzPolicy struct {
+	uids     map[uint32][]string
+	fallback []string // for UIDs not listed
+}
+
+// authzFile is the on-disk policy format
+type authzFile struct {
+	UIDs    map[string][]string `json:"uids"`
+	Default []string            `json:"default"`
+}
+
+// knownCommand reports whether name is a command the daemon serves
+func knownCommand(name string) bool {
+	_, ok := lookupCommand(name)
+	return ok || connCommands[name]
+}
+
+// checkPatterns rejects entries that can never match, so a typo is not
+// silently a deny
+func checkPatterns(patterns []string) error {
+	for _, p := range patterns {
+		if strings.HasSuffix(p, "*") {
+			if strings.Contains(strings.TrimSuffix(p, "*"), "*") {
+				return fmt.Errorf("pattern %q: '*' is only allowed at the end", p)
+			}
+			continue
+		}
+		if !knownCommand(p) {
+			return fmt.Errorf("unknown command %q", p)
+		}
+	}
+	return nil
+}
+
+// loadAuthzPolicy reads and validates a policy file
+func loadAuthzPolicy(path string) (*authzPolicy, error) {
+	if err := checkUserPath(path); err != nil {
+		return nil, err
+	}
+	raw, err := readFileNoFollow(path)
+	if err != nil {
+		return nil, err
+	}
+	var f authzFile
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&f); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	p := &authzPolicy{uids: make(map[uint32][]string, len(f.UIDs)), fallback: f.Default}
+	if err := checkPatterns(f.Default); err != nil {
+		return nil, fmt.Errorf("%s: default: %w", path, err)
+	}
+	for s, patterns := range f.UIDs {
+		uid, err := strconv.ParseUint(s, 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid UID %q", path, s)
+		}
+		if err := checkPatterns(patterns); err != nil {
+			return nil, fmt.Errorf("%s: UID %d: %w", path, uid, err)
+		}
+		p.uids[uint32(uid)] = patterns
+	}
+	return p, nil
+}
+
+// allows reports whether uid may run command
+func (p *authzPolicy) allows(uid uint32, command string) bool {
+	patterns, ok := p.uids[uid]
+	if !ok {
+		if uid == 0 {
+			return true
+		}
+		patterns = p.fallback
+	}
+	for _, pat := range patterns {
+		if pat == command || (strings.HasSuffix(pat, "*") && strings.HasPrefix(command, strings.TrimSuffix(pat, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// summary describes the policy for the startup log
+func (p *authzPolicy) summary() string {
+	uids := make([]string, 0, len(p.uids))
+	for uid := range p.uids {
+		uids = append(uids, strconv.FormatUint(uint64(uid), 10))
+	}
+	sort.Strings(uids)
+	return fmt.Sprintf("UIDs [%s], default %v", strings.Join(uids, ","), p.fallback)
+}
+
+// connPeer returns the credentials to authorize, audit and log a
+// connection's commands with (nil when they cannot be read)
+func (d *TelosDaemon) connPeer(conn *syncConn) *syscall.Ucred {
+	cred, err := peerCred(conn)
+	if err != nil {
+		log.Printf("Warning: cannot read peer credentials: %v", err)
+		return nil
+	}
+	return cred
+}
+
+// authorize checks command against the policy for the peer
+func (d *TelosDaemon) authorize(command string, peer *syscall.Ucred) (IPCResponse, bool) {
+	if d.opts.Authz == nil {
+		return IPCResponse{}, true
+	}
+	if peer == nil {
+		return errorResponse(ErrForbidden, "%s refused: peer credentials unavailable", command), false
+	}
+	if !d.opts.Authz.allows(peer.Uid, command) {
+		metrics.CommandsForbidden.Add(1)
+		log.Printf("[AUTHZ] %s refused for UID %d (PID %d)", command, peer.Uid, peer.Pid)
+		return errorResponse(ErrForbidden, "%s not allowed for UID %d", command, peer.Uid), false
+	}
+	return IPCResponse{}, true
+}
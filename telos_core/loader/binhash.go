@@ -0,0 +1,225 @@
+/*
+ * Telos Core - Binary Change Detection
+ *
+ * A process assessed while running one binary may re-exec into another,
+ * or have its binary replaced on disk and re-exec it, and keep the old
+ * assessment. With --binary-change the daemon sets config.report_exec,
+ * the exec hook reports every successful exec of a tracked process
+ * ("binary" events, with the inode), and a worker hashes the new
+ * program through /proc/<pid>/exe (SHA-256):
+ *
+ *   first exec seen   recorded as the process's baseline
+ *   same hash         nothing
+ *   different hash    [BINARY] logged, a "binary_change" notification
+ *                     for SUBSCRIBE_STATE, and with --binary-change
+ *                     escalate the taint raised to --binary-change-taint
+ *
+ * Hashes are cached per (device, inode) and reused while size, mtime
+ * and ctime are unchanged, so re-execs of the same file cost a stat. A
+ * PID reused by a new process (different start time) starts a fresh
+ * baseline, as does one whose entry was cleared. "binary" events are
+ * consumed here and not forwarded to subscribers or sinks.
+ */
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+const (
+	binaryChangeOff      = "off"
+	binaryChangeAlert    = "alert"
+	binaryChangeEscalate = "escalate"
+
+	binaryAction     = "binary" // event action of a reported exec
+	binaryQueueSize  = 256
+	binaryCacheLimit = 4096
+)
+
+// binaryChangeModes are the accepted --binary-change values
+var binaryChangeModes = map[string]bool{binaryChangeOff: true, binaryChangeAlert: true, binaryChangeEscalate: true}
+
+// fileID identifies a file across paths
+type fileID struct{ dev, ino uint64 }
+
+// cachedHash is a file's hash and the attributes it was taken at
+type cachedHash struct {
+	size, mtime, ctime int64
+	hash               string
+}
+
+// binaryRecord is the binary a tracked process last exec'd
+type binaryRecord struct {
+	startTime uint64
+	path      string
+	hash      string
+}
+
+// binaryState tracks the binaries of tracked processes
+type binaryState struct {
+	queue chan Event
+
+	mu      sync.Mutex
+	cache   map[fileID]cachedHash
+	records map[uint32]binaryRecord
+}
+
+// reportExec is config.report_exec for the --binary-change mode
+func (d *TelosDaemon) reportExec() uint32 {
+	if d.opts.BinaryChange == binaryChangeOff {
+		return 0
+	}
+	return 1
+}
+
+// startBinaryHashing starts the hash worker
+func (d *TelosDaemon) startBinaryHashing() {
+	d.binaries.queue = make(chan Event, binaryQueueSize)
+	d.binaries.cache = make(map[fileID]cachedHash)
+	d.binaries.records = make(map[uint32]binaryRecord)
+	go d.hashBinaries()
+}
+
+// offerBinary queues a "binary" event without ever blocking the reader
+func (d *TelosDaemon) offerBinary(ev Event) {
+	if d.binaries.queue == nil {
+		return
+	}
+	select {
+	case d.binaries.queue <- ev:
+	default:
+		metrics.BinaryHashesDropped.Add(1)
+	}
+}
+
+// hashBinaries checks queued execs until shutdown
+func (d *TelosDaemon) hashBinaries() {
+	for {
+		select {
+		case <-d.done:
+			return
+		case ev := <-d.binaries.queue:
+			d.checkBinary(ev)
+		}
+	}
+}
+
+// checkBinary hashes the program ev's process exec'd and compares it
+// with the one recorded for the process
+func (d *TelosDaemon) checkBinary(ev Event) {
+	st, err := readProcStat(ev.PID)
+	if err != nil {
+		return // Exited meanwhile
+	}
+	path, hash, err := d.hashExe(ev.PID, ev.Inode)
+	if err != nil {
+		d.debugf("binary hash for PID %d: %v", ev.PID, err)
+		return
+	}
+
+	d.binaries.mu.Lock()
+	prev, seen := d.binaries.records[ev.PID]
+	if len(d.binaries.records) >= binaryCacheLimit && !seen {
+		d.pruneBinaryRecordsLocked()
+	}
+	d.binaries.records[ev.PID] = binaryRecord{startTime: st.StartTime, path: path, hash: hash}
+	d.binaries.mu.Unlock()
+
+	if !seen || prev.startTime != st.StartTime || prev.hash == hash {
+		return
+	}
+
+	metrics.BinaryChanges.Add(1)
+	log.Printf("[BINARY] PID %d (%s) changed binary: %s (%.12s) -> %s (%.12s)",
+		ev.PID, ev.Comm, prev.path, prev.hash, path, hash)
+	d.stateSubs.publish(map[string]interface{}{
+		"notification":  "binary_change",
+		"pid":           ev.PID,
+		"previous_path": prev.path,
+		"previous_hash": prev.hash,
+		"path":          path,
+		"hash":          hash,
+		"action":        d.opts.BinaryChange,
+	})
+
+	if d.opts.BinaryChange == binaryChangeEscalate {
+		reason := fmt.Sprintf("binary changed to %s", path)
+		if _, err := d.raiseTaint(ev.PID, d.opts.BinaryChangeTaint, reason); err != nil {
+			log.Printf("Warning: binary change escalation for PID %d failed: %v", ev.PID, err)
+		}
+	}
+}
+
+// hashExe hashes pid's current executable, which must still be inode
+func (d *TelosDaemon) hashExe(pid uint32, inode uint64) (string, string, error) {
+	exe := "/proc/" + strconv.FormatUint(uint64(pid), 10) + "/exe"
+	path, err := os.Readlink(exe)
+	if err != nil {
+		return "", "", err
+	}
+	f, err := os.Open(exe)
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	var sb syscall.Stat_t
+	if err := syscall.Fstat(int(f.Fd()), &sb); err != nil {
+		return "", "", err
+	}
+	if sb.Ino != inode {
+		return "", "", fmt.Errorf("exec'd again (inode %d, reported %d)", sb.Ino, inode)
+	}
+
+	id := fileID{dev: uint64(sb.Dev), ino: sb.Ino}
+	attrs := cachedHash{size: sb.Size, mtime: sb.Mtim.Nano(), ctime: sb.Ctim.Nano()}
+	d.binaries.mu.Lock()
+	cached, ok := d.binaries.cache[id]
+	d.binaries.mu.Unlock()
+	if ok && cached.size == attrs.size && cached.mtime == attrs.mtime && cached.ctime == attrs.ctime {
+		return path, cached.hash, nil
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", "", err
+	}
+	attrs.hash = hex.EncodeToString(h.Sum(nil))
+	metrics.BinaryHashes.Add(1)
+
+	d.binaries.mu.Lock()
+	if len(d.binaries.cache) >= binaryCacheLimit {
+		for k := range d.binaries.cache {
+			delete(d.binaries.cache, k) // Evict an arbitrary entry
+			break
+		}
+	}
+	d.binaries.cache[id] = attrs
+	d.binaries.mu.Unlock()
+	return path, attrs.hash, nil
+}
+
+// pruneBinaryRecordsLocked drops records of processes that are gone
+func (d *TelosDaemon) pruneBinaryRecordsLocked() {
+	for pid := range d.binaries.records {
+		if !pidExists(pid) {
+			delete(d.binaries.records, pid)
+		}
+	}
+}
+
+// forgetBinary drops pid's record, so its next exec is a new baseline
+func (d *TelosDaemon) forgetBinary(pid uint32) {
+	d.binaries.mu.Lock()
+	delete(d.binaries.records, pid)
+	d.binaries.mu.Unlock()
+}
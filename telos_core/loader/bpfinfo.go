@@ -0,0 +1,82 @@
+/*
+ * Telos Core - BPF Object Info
+ *
+ * GET_BPF_INFO shows what the loaded object actually contains: every
+ * program and map by name (with kernel IDs), and for each expected LSM
+ * program whether it attached, failed, or is missing from the object.
+ * Missing programs are also listed under "warnings", which is the usual
+ * symptom of shipping a stale or wrongly built bpf_lsm.o. An object
+ * without the events map still enforces, but reports nothing
+ * ("events_available": false).
+ */
+
+package main
+
+import (
+	"sort"
+)
+
+// cmdGetBPFInfo handles GET_BPF_INFO
+func (d *TelosDaemon) cmdGetBPFInfo() IPCResponse {
+	d.bpfMu.Lock()
+	defer d.bpfMu.Unlock()
+
+	if d.coll == nil {
+		return IPCResponse{Success: false, Error: "BPF object not loaded"}
+	}
+
+	programs := make(map[string]interface{}, len(d.coll.Programs))
+	for name, prog := range d.coll.Programs {
+		entry := map[string]interface{}{"type": prog.Type().String()}
+		if info, err := prog.Info(); err == nil {
+			if id, ok := info.ID(); ok {
+				entry["id"] = id
+			}
+		}
+		programs[name] = entry
+	}
+
+	maps := make(map[string]interface{}, len(d.coll.Maps))
+	for name, m := range d.coll.Maps {
+		entry := map[string]interface{}{"type": m.Type().String()}
+		if info, err := m.Info(); err == nil {
+			if id, ok := info.ID(); ok {
+				entry["id"] = id
+			}
+		}
+		maps[name] = entry
+	}
+
+	hooks := make(map[string]interface{}, len(lsmHooks))
+	warnings := []string{}
+	for _, h := range lsmHooks {
+		status := d.attachReport[h.Program]
+		if status == "" {
+			status = "missing"
+		}
+		hooks[h.Program] = map[string]interface{}{
+			"hook":     "lsm/" + h.Hook,
+			"required": h.Required,
+			"status":   status,
+			"attached": d.links[h.Program] != nil,
+		}
+		if d.coll.Programs[h.Program] == nil {
+			warnings = append(warnings, "expected program "+h.Program+" (lsm/"+h.Hook+") not found in object")
+		}
+	}
+	eventsAvailable := d.coll.Maps["events"] != nil
+	if !eventsAvailable {
+		warnings = append(warnings, "events map not found in object: no event streaming")
+	}
+	sort.Strings(warnings)
+
+	return IPCResponse{Success: true, Data: map[string]interface{}{
+		"object":   d.bpfObjPath,
+		"programs": programs,
+		"maps":     maps,
+		"hooks":    hooks,
+		"warnings": warnings,
+
+		"events_available": eventsAvailable,
+	}}
+}
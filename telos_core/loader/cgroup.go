@@ -0,0 +1,147 @@
+/*
+ * Telos Core - Cgroup Resolver
+ *
+ * Turns cgroup v2 IDs into something a human can read: the container
+ * runtime and short container ID, or the systemd unit. Best-effort: when
+ * nothing matches, callers fall back to the raw cgroup ID.
+ *
+ * A cgroup v2 ID is the inode number of the cgroup's directory under
+ * /sys/fs/cgroup, so a PID's ID is found via /proc/<pid>/cgroup + stat.
+ */
+
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const (
+	cgroupRoot         = "/sys/fs/cgroup"
+	cgroupCacheEntries = 4096
+)
+
+// Runtime-specific path components, e.g.
+//
+//	/system.slice/docker-<id>.scope        (docker, systemd driver)
+//	/docker/<id>                           (docker, cgroupfs driver)
+//	/kubepods.slice/.../cri-containerd-<id>.scope
+//	/kubepods.slice/.../crio-<id>.scope
+var containerPatterns = []struct {
+	runtime string
+	re      *regexp.Regexp
+}{
+	{"docker", regexp.MustCompile(`^docker-([0-9a-f]{64})\.scope$`)},
+	{"docker", regexp.MustCompile(`^([0-9a-f]{64})$`)},
+	{"containerd", regexp.MustCompile(`^cri-containerd-([0-9a-f]{64})\.scope$`)},
+	{"cri-o", regexp.MustCompile(`^crio-([0-9a-f]{64})\.scope$`)},
+}
+
+// cgroupResolver caches cgroup ID -> display name
+type cgroupResolver struct {
+	mu    sync.Mutex
+	names map[uint64]string
+}
+
+var cgroups = &cgroupResolver{names: make(map[uint64]string)}
+
+// Name returns the cached display name for id, resolving through pid on
+// a miss. It returns "" if the cgroup can't be named.
+func (r *cgroupResolver) Name(id uint64, pid uint32) string {
+	if id == 0 {
+		return ""
+	}
+
+	r.mu.Lock()
+	name, ok := r.names[id]
+	r.mu.Unlock()
+	if ok {
+		return name
+	}
+
+	pidID, path, err := pidCgroup(pid)
+	if err != nil || pidID != id {
+		return "" // Process gone or moved; don't cache a guess
+	}
+	name = cgroupDisplayName(path)
+	r.store(id, name)
+	return name
+}
+
+// ForPID resolves a PID's cgroup ID and display name
+func (r *cgroupResolver) ForPID(pid uint32) (uint64, string) {
+	id, path, err := pidCgroup(pid)
+	if err != nil {
+		return 0, ""
+	}
+	name := cgroupDisplayName(path)
+	r.store(id, name)
+	return id, name
+}
+
+func (r *cgroupResolver) store(id uint64, name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Crude bound: cgroup churn is slow, so a full reset is rare
+	if len(r.names) >= cgroupCacheEntries {
+		r.names = make(map[uint64]string)
+	}
+	r.names[id] = name
+}
+
+// pidCgroup returns the cgroup v2 ID and path of a process
+func pidCgroup(pid uint32) (uint64, string, error) {
+	f, err := os.Open("/proc/" + strconv.FormatUint(uint64(pid), 10) + "/cgroup")
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+
+	path := ""
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// cgroup v2 unified hierarchy line: "0::/path"
+		if p, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			path = p
+			break
+		}
+	}
+	if path == "" {
+		return 0, "", os.ErrNotExist
+	}
+
+	var st syscall.Stat_t
+	if err := syscall.Stat(filepath.Join(cgroupRoot, path), &st); err != nil {
+		return 0, "", err
+	}
+	return st.Ino, path, nil
+}
+
+// cgroupDisplayName maps a cgroup path to "runtime:shortid" or a systemd unit
+func cgroupDisplayName(path string) string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	// Innermost component wins
+	for i := len(parts) - 1; i >= 0; i-- {
+		for _, p := range containerPatterns {
+			if m := p.re.FindStringSubmatch(parts[i]); m != nil {
+				return p.runtime + ":" + m[1][:12]
+			}
+		}
+	}
+
+	last := parts[len(parts)-1]
+	for _, suffix := range []string{".service", ".scope", ".slice"} {
+		if strings.HasSuffix(last, suffix) {
+			return last
+		}
+	}
+	return ""
+}
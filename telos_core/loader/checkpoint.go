@@ -0,0 +1,106 @@
+/*
+ * Telos Core - State Persistence
+ *
+ * With --state-file the daemon restores process_map from the file on
+ * start (unless the pinned map survived), saves it on shutdown, and with
+ * --checkpoint-interval also saves it periodically so a crash loses at
+ * most one interval of updates. The file uses the EXPORT_CSV format,
+ * signed when --state-key is set; a file that fails verification stops
+ * startup rather than restoring tampered taint.
+ *
+ * Every process_map write goes through touch()/forget(), which bump
+ * stateGen; a save is skipped when nothing changed since the last one,
+ * and stateMu keeps a checkpoint and the shutdown save from overlapping.
+ */
+
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"time"
+)
+
+// saveState writes process_map to the state file if it changed
+func (d *TelosDaemon) saveState() error {
+	d.stateMu.Lock()
+	defer d.stateMu.Unlock()
+
+	gen := d.stateGen.Load()
+	if gen == d.savedGen {
+		return nil
+	}
+
+	raw, count, err := d.encodeStateCSV()
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(d.opts.StateFile, d.sealState(raw, count), 0600); err != nil {
+		return err
+	}
+
+	d.savedGen = gen
+	log.Printf("[CHECKPOINT] %d processes -> %s", count, d.opts.StateFile)
+	return nil
+}
+
+// restoreState loads the state file into process_map, skipping PIDs that
+// exited or were reused by a different program since it was written
+func (d *TelosDaemon) restoreState() (int, error) {
+	raw, err := readFileNoFollow(d.opts.StateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	entries, err := d.parseSignedState(raw)
+	if err != nil {
+		return 0, err
+	}
+
+	d.mapMu.Lock()
+	defer d.mapMu.Unlock()
+
+	restored := 0
+	for _, info := range entries {
+		st, err := readProcStat(info.PID)
+		if err != nil {
+			continue // Exited
+		}
+		if comm := commString(info.Comm); comm != "" && !d.commMatches(comm, cleanComm(st.Comm)) {
+			continue // PID reused
+		}
+		if err := d.maps.ProcessMap.Put(info.PID, info); err != nil {
+			return restored, err
+		}
+		d.touch(info.PID)
+		restored++
+	}
+
+	// What was just loaded is already on disk
+	d.stateMu.Lock()
+	d.savedGen = d.stateGen.Load()
+	d.stateMu.Unlock()
+
+	return restored, nil
+}
+
+// runCheckpoints saves state every CheckpointInterval until Stop()
+func (d *TelosDaemon) runCheckpoints() {
+	ticker := time.NewTicker(d.opts.CheckpointInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+			if err := d.saveState(); err != nil {
+				log.Printf("Warning: checkpoint failed: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,246 @@
+/*
+ * Telos Core - Control Subcommands
+ *
+ * The binary doubles as its own control client:
+ *
+ *   telos_daemon [run] [flags]        run the daemon (default)
+ *   telos_daemon status [--socket S]  PING + HEALTH summary; exit 1 if unhealthy
+ *   telos_daemon reload [--socket S] [--bpf-obj P]
+ *                                     RELOAD_BPF, print the hook report
+ *   telos_daemon stop [--socket S]    SIGTERM the daemon serving the socket
+ *   telos_daemon bench [-n N]         time N execs and opens, print JSON
+ *                                     (run by GET_OVERHEAD, see overhead.go)
+ *
+ * Clients speak the native protocol. stop identifies the daemon by the
+ * socket's peer credentials (SO_PEERCRED), so it needs no shutdown
+ * command on the socket and works only for whoever may signal it.
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"syscall"
+	"time"
+)
+
+const (
+	clientTimeout     = 10 * time.Second
+	stopWaitTimeout   = 10 * time.Second
+	stopPollInterval  = 100 * time.Millisecond
+	clientExitOK      = 0
+	clientExitFailure = 1
+	clientExitUsage   = 2
+)
+
+// subcommands maps client subcommand names to their implementation
+var subcommands = map[string]func(args []string) int{
+	"status": cliStatus,
+	"reload": cliReload,
+	"stop":   cliStop,
+	"bench":  cliBench,
+}
+
+// controlClient is one connection to a running daemon
+type controlClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialDaemon(socketPath string) (*controlClient, error) {
+	conn, err := net.DialTimeout("unix", socketPath, clientTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", socketPath, err)
+	}
+	return &controlClient{conn: conn, r: bufio.NewReader(conn)}, nil
+}
+
+// call sends one native command and waits for its response
+func (c *controlClient) call(command string, data map[string]interface{}) (IPCResponse, error) {
+	var resp IPCResponse
+	line, err := json.Marshal(IPCCommand{Command: command, Data: data})
+	if err != nil {
+		return resp, err
+	}
+
+	c.conn.SetDeadline(time.Now().Add(clientTimeout))
+	if _, err := c.conn.Write(append(line, '\n')); err != nil {
+		return resp, err
+	}
+	reply, err := c.r.ReadBytes('\n')
+	if err != nil {
+		return resp, fmt.Errorf("read %s response: %w", command, err)
+	}
+	if err := json.Unmarshal(reply, &resp); err != nil {
+		return resp, fmt.Errorf("decode %s response: %w", command, err)
+	}
+	return resp, nil
+}
+
+func (c *controlClient) Close() error { return c.conn.Close() }
+
+// clientFlags parses the flags shared by all subcommands
+func clientFlags(name string, args []string, extra func(*flag.FlagSet)) (string, bool) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	socketPath := fs.String("socket", defaultSocketPath, "Unix socket path")
+	if extra != nil {
+		extra(fs)
+	}
+	if err := fs.Parse(args); err != nil {
+		return "", false
+	}
+	return *socketPath, true
+}
+
+// cliStatus handles "status"
+func cliStatus(args []string) int {
+	socketPath, ok := clientFlags("status", args, nil)
+	if !ok {
+		return clientExitUsage
+	}
+
+	c, err := dialDaemon(socketPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Not running: %v\n", err)
+		return clientExitFailure
+	}
+	defer c.Close()
+
+	if resp, err := c.call("PING", nil); err != nil || !resp.Success {
+		fmt.Fprintf(os.Stderr, "Daemon on %s not answering PING: %v %s\n", socketPath, err, resp.Error)
+		return clientExitFailure
+	}
+	resp, err := c.call("HEALTH", nil)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "HEALTH failed: %v\n", err)
+		return clientExitFailure
+	}
+
+	status, _ := resp.Data.(map[string]interface{})
+	state := "healthy"
+	if !resp.Success {
+		state = "UNHEALTHY"
+	}
+	fmt.Printf("Telos Core on %s: %s\n", socketPath, state)
+	fmt.Printf("  BPF loaded:    %v\n", status["bpf_loaded"])
+	lastEvent := status["last_event"]
+	if lastEvent == nil {
+		lastEvent = "never"
+	}
+	fmt.Printf("  Event reader:  %v (last event %v)\n", status["event_reader_running"], lastEvent)
+	fmt.Printf("  Map writable:  %v\n", status["map_writable"])
+	if hooks, ok := status["hooks"].(map[string]interface{}); ok {
+		names := make([]string, 0, len(hooks))
+		for name := range hooks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("  Hook %-20s attached=%v\n", name, hooks[name])
+		}
+	}
+	if problems, ok := status["problems"].([]interface{}); ok {
+		for _, p := range problems {
+			fmt.Printf("  Problem: %v\n", p)
+		}
+	}
+
+	if !resp.Success {
+		return clientExitFailure
+	}
+	return clientExitOK
+}
+
+// cliReload handles "reload"
+func cliReload(args []string) int {
+	var objPath *string
+	socketPath, ok := clientFlags("reload", args, func(fs *flag.FlagSet) {
+		objPath = fs.String("bpf-obj", "", "Object to load (default: the daemon's current object)")
+	})
+	if !ok {
+		return clientExitUsage
+	}
+
+	c, err := dialDaemon(socketPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Not running: %v\n", err)
+		return clientExitFailure
+	}
+	defer c.Close()
+
+	data := map[string]interface{}{}
+	if *objPath != "" {
+		data["path"] = *objPath
+	}
+	resp, err := c.call("RELOAD_BPF", data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "RELOAD_BPF failed: %v\n", err)
+		return clientExitFailure
+	}
+
+	result, _ := resp.Data.(map[string]interface{})
+	if resp.Success {
+		fmt.Printf("Reloaded %v\n", result["object"])
+	} else {
+		fmt.Printf("Reload failed, still running %v: %s\n", result["object"], resp.Error)
+	}
+	if hooks, ok := result["hooks"].(map[string]interface{}); ok {
+		names := make([]string, 0, len(hooks))
+		for name := range hooks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("  %-20s %v\n", name, hooks[name])
+		}
+	}
+
+	if !resp.Success {
+		return clientExitFailure
+	}
+	return clientExitOK
+}
+
+// cliStop handles "stop"
+func cliStop(args []string) int {
+	socketPath, ok := clientFlags("stop", args, nil)
+	if !ok {
+		return clientExitUsage
+	}
+
+	c, err := dialDaemon(socketPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Not running: %v\n", err)
+		return clientExitFailure
+	}
+	cred, err := peerCred(c.conn)
+	c.Close()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot identify daemon: %v\n", err)
+		return clientExitFailure
+	}
+	pid := cred.Pid
+
+	if err := syscall.Kill(int(pid), syscall.SIGTERM); err != nil {
+		fmt.Fprintf(os.Stderr, "Signal PID %d: %v\n", pid, err)
+		return clientExitFailure
+	}
+
+	// Stop removes the socket last, so its disappearance means done
+	deadline := time.Now().Add(stopWaitTimeout)
+	for time.Now().Before(deadline) {
+		if _, err := os.Stat(socketPath); os.IsNotExist(err) {
+			fmt.Printf("Stopped daemon PID %d\n", pid)
+			return clientExitOK
+		}
+		time.Sleep(stopPollInterval)
+	}
+	fmt.Fprintf(os.Stderr, "Sent SIGTERM to PID %d, still running after %s\n", pid, stopWaitTimeout)
+	return clientExitFailure
+}
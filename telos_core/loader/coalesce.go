@@ -0,0 +1,146 @@
+/*
+ * Telos Core - Update Coalescing
+ *
+ * Under bursty traffic every UPDATE_TAINT costs a map write syscall and
+ * a log line, most of them immediately overwritten. With
+ * --coalesce-window, UPDATE_TAINT only records the requested level as
+ * the PID's pending update and answers with "queued":true; every window
+ * the latest pending level per PID is written in one pass and one
+ * summary line is logged. Intermediate levels are never written.
+ *
+ * Ordering is "final value wins" per PID:
+ *   - CRITICAL is written at once (and supersedes anything pending)
+ *   - INCREMENT/DECREMENT_TAINT, escalations and quarantine changes
+ *     first write the PID's pending update, so they build on it
+ *   - CLEAR_TAINT and REGISTER_AGENT drop it, as they would overwrite it
+ *   - shutdown flushes everything before the final state save
+ *
+ * Readers (GET_STATE, the hooks) see a queued level up to one window
+ * late. Counters: telos_taint_updates_coalesced_total (updates never
+ * written because a later one replaced them), telos_coalesce_flushes_total.
+ */
+
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// updateCoalescer holds the pending UPDATE_TAINT level per PID
+type updateCoalescer struct {
+	mu      sync.Mutex
+	pending map[uint32]uint32
+}
+
+// queue records level as pid's pending update, reporting whether it
+// replaced an earlier one
+func (c *updateCoalescer) queue(pid, level uint32) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending == nil {
+		c.pending = make(map[uint32]uint32)
+	}
+	_, replaced := c.pending[pid]
+	c.pending[pid] = level
+	return replaced
+}
+
+// peek returns pid's pending level
+func (c *updateCoalescer) peek(pid uint32) (uint32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	level, ok := c.pending[pid]
+	return level, ok
+}
+
+// take removes and returns pid's pending level
+func (c *updateCoalescer) take(pid uint32) (uint32, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	level, ok := c.pending[pid]
+	delete(c.pending, pid)
+	return level, ok
+}
+
+// drain removes and returns every pending update
+func (c *updateCoalescer) drain() map[uint32]uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	pending := c.pending
+	c.pending = nil
+	return pending
+}
+
+// settleLocked writes pid's pending update before another change to
+// its entry. Caller holds mapMu.
+func (d *TelosDaemon) settleLocked(pid uint32) {
+	level, ok := d.coalesce.take(pid)
+	if !ok {
+		return
+	}
+	if err := d.writePendingLocked(pid, level); err != nil {
+		log.Printf("Warning: coalesced update of PID %d failed: %v", pid, err)
+	}
+}
+
+// discardPending drops pid's pending update (about to be overwritten)
+func (d *TelosDaemon) discardPending(pid uint32) {
+	if _, ok := d.coalesce.take(pid); ok {
+		metrics.UpdatesCoalesced.Add(1)
+	}
+}
+
+// writePendingLocked writes one coalesced update. Caller holds mapMu.
+func (d *TelosDaemon) writePendingLocked(pid, level uint32) error {
+	info, exists, err := d.trackedEntry(pid)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		info = ProcessInfo{PID: pid, TaintLevel: TaintClean}
+	}
+	if err := d.putTaintLocked(info, exists, level, "UPDATE_TAINT"); err != nil {
+		return err
+	}
+	d.auditTaint(info, info.TaintLevel, level, "UPDATE_TAINT (coalesced)", nil)
+	return nil
+}
+
+// flushCoalesced writes every pending update in one pass
+func (d *TelosDaemon) flushCoalesced() {
+	d.mapMu.Lock()
+	defer d.mapMu.Unlock()
+
+	pending := d.coalesce.drain()
+	if len(pending) == 0 {
+		return
+	}
+	written := 0
+	for pid, level := range pending {
+		if err := d.writePendingLocked(pid, level); err != nil {
+			log.Printf("Warning: coalesced update of PID %d failed: %v", pid, err)
+			continue
+		}
+		written++
+	}
+	metrics.CoalesceFlushes.Add(1)
+	log.Printf("[UPDATE] Flushed %d coalesced taint updates", written)
+}
+
+// runCoalescer flushes pending updates every CoalesceWindow until Stop()
+// (Stop flushes the rest)
+func (d *TelosDaemon) runCoalescer() {
+	ticker := time.NewTicker(d.opts.CoalesceWindow)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			d.flushCoalesced()
+		case <-d.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,131 @@
+/*
+ * Telos Core - Process Names
+ *
+ * The kernel keeps comm in a 16-byte, NUL-padded array (15 bytes of name)
+ * and truncates longer names at a byte boundary, which can split a
+ * multi-byte UTF-8 character. Every comm the daemon reads or writes goes
+ * through these helpers so JSON responses, logs and exports always carry
+ * valid UTF-8, and names written to the map are never cut mid-character.
+ *
+ * A tracked process that re-execs keeps the comm it was registered with.
+ * SET_COMM relabels it, leaving taint and flags alone; without "comm" the
+ * name is refreshed from /proc:
+ *
+ *   {"command":"SET_COMM","data":{"pid":4242,"comm":"agent-worker"}}
+ */
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxCommLen is the longest comm the kernel stores (TASK_COMM_LEN - 1)
+const maxCommLen = 15
+
+// commString converts a NUL-padded kernel comm to a valid UTF-8 string
+func commString(comm [16]byte) string {
+	raw := comm[:]
+	if i := bytes.IndexByte(raw, 0); i >= 0 {
+		raw = raw[:i]
+	}
+	return cleanComm(string(raw))
+}
+
+// cleanComm drops a character the kernel cut in half at the end and
+// replaces any other invalid byte with U+FFFD
+func cleanComm(s string) string {
+	for i := 1; i < utf8.UTFMax && i <= len(s); i++ {
+		// A rune start in the last UTFMax-1 bytes that doesn't decode
+		// completely is a truncation artifact
+		if utf8.RuneStart(s[len(s)-i]) {
+			if r, _ := utf8.DecodeRuneInString(s[len(s)-i:]); r == utf8.RuneError && !utf8.FullRuneInString(s[len(s)-i:]) {
+				s = s[:len(s)-i]
+			}
+			break
+		}
+	}
+	return strings.ToValidUTF8(s, "\uFFFD")
+}
+
+// commBytes encodes s for the map, truncating to maxCommLen bytes at a
+// character boundary
+func commBytes(s string) [16]byte {
+	var comm [16]byte
+	for len(s) > maxCommLen {
+		_, size := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-size]
+	}
+	copy(comm[:], s)
+	return comm
+}
+
+// commMatches compares two comms on their first --comm-match-len bytes
+func (d *TelosDaemon) commMatches(a, b string) bool {
+	n := d.opts.CommMatchLen
+	if n <= 0 || n > maxCommLen {
+		n = maxCommLen
+	}
+	if len(a) > n {
+		a = a[:n]
+	}
+	if len(b) > n {
+		b = b[:n]
+	}
+	return a == b
+}
+
+// cmdSetComm handles SET_COMM ({pid, comm?})
+func (d *TelosDaemon) cmdSetComm(data map[string]interface{}) IPCResponse {
+	pid, _, err := processArg(data)
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	var comm string
+	if _, ok := data["comm"]; ok {
+		if comm, err = stringArg(data, "comm"); err != nil {
+			return invalidArg("%v", err)
+		}
+		if comm == "" || !utf8.ValidString(comm) {
+			return invalidArg("Invalid 'comm': must be non-empty, valid UTF-8")
+		}
+	} else {
+		st, err := readProcStat(pid)
+		if err != nil {
+			return IPCResponse{Success: false, Error: fmt.Sprintf("PID %d: no 'comm' given and /proc unreadable: %v", pid, err)}
+		}
+		comm = st.Comm
+	}
+	encoded := commBytes(comm)
+
+	d.mapMu.Lock()
+	defer d.mapMu.Unlock()
+	d.settleLocked(pid)
+
+	info, exists, err := d.trackedEntry(pid)
+	if err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+	if !exists {
+		return IPCResponse{Success: false, Error: fmt.Sprintf("PID %d is not tracked", pid)}
+	}
+	previous := commString(info.Comm)
+	if info.Comm != encoded {
+		info.Comm = encoded
+		if err := d.maps.ProcessMap.Put(pid, info); err != nil {
+			return IPCResponse{Success: false, Error: err.Error()}
+		}
+		d.touch(pid)
+		log.Printf("[COMM] PID %d %q -> %q", pid, previous, commString(encoded))
+	}
+	return IPCResponse{Success: true, Data: map[string]interface{}{
+		"pid":       pid,
+		"comm":      commString(encoded),
+		"previous":  previous,
+		"truncated": len(comm) > maxCommLen,
+	}}
+}
@@ -0,0 +1,113 @@
+/*
+ * Telos Core - Response Compression
+ *
+ * GET_STATE, GET_FULL_POLICY and friends can answer with megabytes of
+ * JSON on a large process_map. A client that can inflate asks for it
+ * once per connection:
+ *
+ *   -> {"command":"SET_COMPRESSION","data":{"encoding":"gzip","min_bytes":65536}}
+ *   <- {"success":true,"data":{"encoding":"gzip","min_bytes":65536}}
+ *
+ * From then on every command response of at least min_bytes (default
+ * defaultCompressMinBytes) is sent as one line
+ *
+ *   {"compressed":"gzip","size":1843211,"payload":"<base64 gzip of the response line>"}
+ *
+ * which the client decodes back into the ordinary response; "size" is
+ * the uncompressed length. Smaller responses, event and notification
+ * frames are never compressed. "encoding":"none" turns it off again.
+ * Connections that never ask get plain JSON. Native protocol only.
+ */
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+)
+
+const (
+	compressGzip            = "gzip"
+	compressNone            = "none"
+	defaultCompressMinBytes = 64 << 10
+)
+
+// compressedFrame wraps a compressed response line
+type compressedFrame struct {
+	Compressed string `json:"compressed"`
+	Size       int    `json:"size"`
+	Payload    string `json:"payload"`
+}
+
+// setCompression handles SET_COMPRESSION ({encoding, min_bytes?}) and
+// returns the connection's new threshold (0 = off)
+func setCompression(data map[string]interface{}, current int) (int, IPCResponse) {
+	encoding, err := stringArg(data, "encoding")
+	if err != nil {
+		return current, invalidArg("%v", err)
+	}
+	switch encoding {
+	case compressNone:
+		return 0, IPCResponse{Success: true, Data: map[string]interface{}{"encoding": compressNone}}
+	case compressGzip:
+	default:
+		return current, invalidArg("Invalid 'encoding' %q (want %s or %s)", encoding, compressGzip, compressNone)
+	}
+
+	min := uint64(defaultCompressMinBytes)
+	if _, ok := data["min_bytes"]; ok {
+		if min, err = uintArg(data, "min_bytes", math.MaxInt32); err != nil {
+			return current, invalidArg("%v", err)
+		}
+		if min == 0 {
+			min = 1
+		}
+	}
+	return int(min), IPCResponse{Success: true, Data: map[string]interface{}{
+		"encoding":  compressGzip,
+		"min_bytes": min,
+	}}
+}
+
+// sendResponseCompressed sends resp, gzipped if it is at least minBytes
+// long (0 = never)
+func (d *TelosDaemon) sendResponseCompressed(conn net.Conn, resp IPCResponse, minBytes int) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		data, _ = json.Marshal(errorResponse(ErrInternal, "Encode response: %v", err))
+	}
+	if minBytes == 0 || len(data) < minBytes {
+		return d.writeLine(conn, data)
+	}
+
+	frame, err := compressLine(data)
+	if err != nil {
+		d.debugf("Sending response uncompressed: %v", err)
+		return d.writeLine(conn, data)
+	}
+	metrics.ResponsesCompressed.Add(1)
+	metrics.CompressedBytesSaved.Add(uint64(max(len(data)-len(frame), 0)))
+	return d.writeLine(conn, frame)
+}
+
+// compressLine renders data as a compressedFrame line
+func compressLine(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		return nil, fmt.Errorf("gzip: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("gzip: %w", err)
+	}
+	return json.Marshal(compressedFrame{
+		Compressed: compressGzip,
+		Size:       len(data),
+		Payload:    base64.StdEncoding.EncodeToString(buf.Bytes()),
+	})
+}
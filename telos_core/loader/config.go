@@ -0,0 +1,261 @@
+/*
+ * Telos Core - Runtime Config
+ *
+ * SET_CONFIG changes any subset of the live config_map fields in one
+ * step; omitted fields keep their current value, unknown fields are
+ * rejected so a typo can't be mistaken for a no-op:
+ *
+ *   {"command":"SET_CONFIG","data":{"max_taint_for_exec":1,"enabled":true}}
+ *
+ * default_taint_untracked is the level the hooks assume for a PID that
+ * is not in process_map (CLEAN by default, i.e. unknown processes are
+ * unrestricted). Raising it is the secure-by-default posture: a process
+ * that never registers with Cortex is still held to the thresholds.
+ *
+ * "mode" sets the enforcement mode: "enforce" denies above the
+ * thresholds, "audit" only reports (quarantine still denies), and "off"
+ * never denies anything. Events, taint updates and queries work in every
+ * mode, so "off" suits a visibility-first rollout. The older "enabled"
+ * bool maps to enforce/audit.
+ *
+ * With "validate_only":true every check runs and the config that would
+ * be written is returned, but config_map is left untouched, so CI and
+ * orchestration can vet a payload before rolling it out.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+// Enforcement modes (must match ENFORCE_* in bpf_lsm.c, stored in Config.Enabled)
+const (
+	enforceAudit uint32 = 0
+	enforceOn    uint32 = 1
+	enforceOff   uint32 = 2
+)
+
+var enforceModes = map[string]uint32{
+	"audit":   enforceAudit,
+	"enforce": enforceOn,
+	"off":     enforceOff,
+}
+
+// enforceModeName returns the flag/IPC name of an enforcement mode
+func enforceModeName(mode uint32) string {
+	for name, m := range enforceModes {
+		if m == mode {
+			return name
+		}
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", mode)
+}
+
+// configLevelFields maps config field names to their Config member
+var configLevelFields = map[string]func(*Config) *uint32{
+	"max_taint_for_exec":    func(c *Config) *uint32 { return &c.MaxTaintForExec },
+	"max_taint_for_open":    func(c *Config) *uint32 { return &c.MaxTaintForOpen },
+	"max_taint_for_connect": func(c *Config) *uint32 { return &c.MaxTaintForConnect },
+	"max_taint_for_ptrace":  func(c *Config) *uint32 { return &c.MaxTaintForPtrace },
+}
+
+// applyConfigFields overwrites the thresholds and enforcement mode
+// present in data, reporting which fields it changed
+func applyConfigFields(cfg *Config, data map[string]interface{}) ([]string, error) {
+	var changed []string
+	for field, member := range configLevelFields {
+		if _, ok := data[field]; !ok {
+			continue
+		}
+		level, err := levelArg(data, field)
+		if err != nil {
+			return nil, err
+		}
+		if *member(cfg) != level {
+			*member(cfg) = level
+			changed = append(changed, field)
+		}
+	}
+	_, hasEnabled := data["enabled"]
+	_, hasMode := data["mode"]
+	switch {
+	case hasEnabled && hasMode:
+		return nil, fmt.Errorf("give either 'enabled' or 'mode', not both")
+	case hasEnabled:
+		enabled, err := boolArg(data, "enabled")
+		if err != nil {
+			return nil, err
+		}
+		v := enforceAudit
+		if enabled {
+			v = enforceOn
+		}
+		if cfg.Enabled != v {
+			cfg.Enabled = v
+			changed = append(changed, "enabled")
+		}
+	case hasMode:
+		name, err := stringArg(data, "mode")
+		if err != nil {
+			return nil, err
+		}
+		v, ok := enforceModes[name]
+		if !ok {
+			return nil, fmt.Errorf("Invalid 'mode' %q (want enforce, audit or off)", name)
+		}
+		if cfg.Enabled != v {
+			cfg.Enabled = v
+			changed = append(changed, "mode")
+		}
+	}
+	sort.Strings(changed)
+	return changed, nil
+}
+
+// applyAllConfigFields is applyConfigFields plus exec_taint,
+// default_taint_untracked and sandbox_tighten, which depend on daemon
+// options
+func (d *TelosDaemon) applyAllConfigFields(cfg *Config, data map[string]interface{}) ([]string, error) {
+	changed, err := applyConfigFields(cfg, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, ok := data["exec_taint"]; ok {
+		name, err := stringArg(data, "exec_taint")
+		if err != nil {
+			return nil, err
+		}
+		mode, ok := execTaintModes[name]
+		if !ok {
+			return nil, fmt.Errorf("Invalid 'exec_taint' %q (want preserve, clear or reduce)", name)
+		}
+		if mode != execTaintPreserve && d.opts.MonotonicTaint {
+			return nil, fmt.Errorf("exec_taint %s lowers taint; not allowed with --monotonic", name)
+		}
+		if cfg.ExecTaint != mode {
+			cfg.ExecTaint = mode
+			changed = append(changed, "exec_taint")
+		}
+	}
+
+	if _, ok := data["default_taint_untracked"]; ok {
+		level, err := levelArg(data, "default_taint_untracked")
+		if err != nil {
+			return nil, err
+		}
+		if cfg.DefaultTaintUntracked != level {
+			cfg.DefaultTaintUntracked = level
+			changed = append(changed, "default_taint_untracked")
+		}
+	}
+
+	if _, ok := data["sandbox_tighten"]; ok {
+		n, err := uintArg(data, "sandbox_tighten", TaintCritical)
+		if err != nil {
+			return nil, err
+		}
+		if cfg.SandboxTighten != uint32(n) {
+			cfg.SandboxTighten = uint32(n)
+			changed = append(changed, "sandbox_tighten")
+		}
+	}
+	return changed, nil
+}
+
+// cmdSetConfig handles SET_CONFIG
+// ({max_taint_for_*?, enabled? | mode?, exec_taint?, default_taint_untracked?, sandbox_tighten?, validate_only?})
+func (d *TelosDaemon) cmdSetConfig(data map[string]interface{}) IPCResponse {
+	return d.setConfig(0, data)
+}
+
+// setConfig applies SET_CONFIG fields to the config at key (see
+// configkeys.go for non-zero keys)
+func (d *TelosDaemon) setConfig(key uint32, data map[string]interface{}) IPCResponse {
+	given := 0
+	for field := range data {
+		switch _, level := configLevelFields[field]; {
+		case level, field == "enabled", field == "mode", field == "exec_taint", field == "default_taint_untracked",
+			field == "sandbox_tighten":
+			given++
+		case field == "validate_only":
+		default:
+			return invalidArg("Unknown config field %q", field)
+		}
+	}
+	if given == 0 {
+		return invalidArg("No config fields given")
+	}
+	validateOnly, err := boolArg(data, "validate_only")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+
+	d.cfgMu.Lock()
+	defer d.cfgMu.Unlock()
+	// Key 0 is what the lockdown replaced; EXIT_PANIC_MODE would undo this
+	if key == 0 && d.lockdown.active {
+		return IPCResponse{Success: false, Error: "panic mode is active; EXIT_PANIC_MODE first"}
+	}
+
+	cfg, err := d.configAt(key)
+	if err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+	changed, err := d.applyAllConfigFields(&cfg, data)
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+
+	// Legal but worth a second look before it goes fleet-wide
+	warnings := []string{}
+	switch cfg.Enabled {
+	case enforceAudit:
+		warnings = append(warnings, "enforcement disabled: hooks only report (audit mode)")
+	case enforceOff:
+		warnings = append(warnings, "enforcement off: nothing is denied, quarantine included")
+	}
+	if cfg.MaxTaintForExec == TaintCritical {
+		warnings = append(warnings, "max_taint_for_exec is CRITICAL: exec is never blocked")
+	}
+	if cfg.DefaultTaintUntracked > cfg.MaxTaintForExec {
+		warnings = append(warnings, "default_taint_untracked is above max_taint_for_exec: untracked processes cannot exec")
+	}
+	if cfg.Maintenance != 0 {
+		warnings = append(warnings, "maintenance mode is active: nothing above the thresholds is denied until it ends")
+	}
+
+	result := configJSON(cfg)
+	result["exec_taint"] = execTaintName(cfg.ExecTaint)
+	resp := map[string]interface{}{
+		"config":        result,
+		"changed":       changed,
+		"warnings":      warnings,
+		"validate_only": validateOnly,
+	}
+	if key != 0 {
+		resp["key"] = key
+	}
+	if validateOnly {
+		return IPCResponse{Success: true, Data: resp}
+	}
+
+	if len(changed) > 0 {
+		if err := d.maps.ConfigMap.Put(key, cfg); err != nil {
+			return IPCResponse{Success: false, Error: fmt.Sprintf("write config: %v", err)}
+		}
+		log.Printf("[CONFIG] Key %d updated %v: exec>%s open>%s connect>%s ptrace>%s mode=%s exec_taint=%s untracked=%s",
+			key, changed, taintLevelName(cfg.MaxTaintForExec), taintLevelName(cfg.MaxTaintForOpen),
+			taintLevelName(cfg.MaxTaintForConnect), taintLevelName(cfg.MaxTaintForPtrace),
+			enforceModeName(cfg.Enabled), execTaintName(cfg.ExecTaint), taintLevelName(cfg.DefaultTaintUntracked))
+		if key == 0 {
+			d.notifyConfig(cfg, "SET_CONFIG")
+		} else {
+			d.notifyConfig(cfg, fmt.Sprintf("SET_CONFIG_KEY %d", key))
+		}
+	}
+	return IPCResponse{Success: true, Data: resp}
+}
@@ -0,0 +1,124 @@
+/*
+ * Telos Core - Config Keys
+ *
+ * config_map is an array; key 0 is the global config every hook reads.
+ * Further keys are reserved for scoped configs (per cgroup, per UID, ...)
+ * once the policy model grows:
+ *
+ *   GET_CONFIG_KEY   {key}                -> that key's config
+ *   SET_CONFIG_KEY   {key, <SET_CONFIG fields>}
+ *   LIST_CONFIG_KEYS                      -> keys holding a config
+ *
+ * A scoped key is only useful if the hooks look it up, so non-zero keys
+ * are refused unless the loaded object declares config_map with more
+ * than one entry (the current bpf_lsm.c declares one). An unset scoped
+ * key starts out as a copy of the global config, never as all-zero
+ * thresholds, which would block at any taint.
+ */
+
+package main
+
+import (
+	"fmt"
+	"math"
+)
+
+// configAt reads the config at key; an unset scoped key reads as the
+// global config
+func (d *TelosDaemon) configAt(key uint32) (Config, error) {
+	if key == 0 {
+		return d.activeConfig()
+	}
+	if err := d.checkConfigKey(key); err != nil {
+		return Config{}, err
+	}
+	var cfg Config
+	if err := d.maps.ConfigMap.Lookup(key, &cfg); err != nil {
+		return cfg, err
+	}
+	if cfg == (Config{}) {
+		return d.activeConfig()
+	}
+	return cfg, nil
+}
+
+// checkConfigKey refuses keys the loaded object cannot use
+func (d *TelosDaemon) checkConfigKey(key uint32) error {
+	max := d.maps.ConfigMap.MaxEntries()
+	if max <= 1 && key != 0 {
+		return fmt.Errorf("scoped config keys not supported: the loaded BPF object's config_map has %d entry "+
+			"and its hooks only consult key 0", max)
+	}
+	if key >= max {
+		return fmt.Errorf("config key %d out of range (config_map has %d entries)", key, max)
+	}
+	return nil
+}
+
+// configKeyArg reads the required 'key' field
+func (d *TelosDaemon) configKeyArg(data map[string]interface{}) (uint32, IPCResponse, bool) {
+	key, err := uintArg(data, "key", math.MaxUint32)
+	if err != nil {
+		return 0, invalidArg("%v", err), false
+	}
+	if err := d.checkConfigKey(uint32(key)); err != nil {
+		return 0, invalidArg("%v", err), false
+	}
+	return uint32(key), IPCResponse{}, true
+}
+
+// configKeyJSON renders one key's config
+func configKeyJSON(key uint32, cfg Config) map[string]interface{} {
+	c := configJSON(cfg)
+	c["exec_taint"] = execTaintName(cfg.ExecTaint)
+	return map[string]interface{}{"key": key, "config": c}
+}
+
+// cmdGetConfigKey handles GET_CONFIG_KEY ({key})
+func (d *TelosDaemon) cmdGetConfigKey(data map[string]interface{}) IPCResponse {
+	key, resp, ok := d.configKeyArg(data)
+	if !ok {
+		return resp
+	}
+	cfg, err := d.configAt(key)
+	if err != nil {
+		return IPCResponse{Success: false, Error: fmt.Sprintf("read config key %d: %v", key, err)}
+	}
+	return IPCResponse{Success: true, Data: configKeyJSON(key, cfg)}
+}
+
+// cmdSetConfigKey handles SET_CONFIG_KEY ({key, <SET_CONFIG fields>})
+func (d *TelosDaemon) cmdSetConfigKey(data map[string]interface{}) IPCResponse {
+	key, resp, ok := d.configKeyArg(data)
+	if !ok {
+		return resp
+	}
+	fields := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		if k != "key" {
+			fields[k] = v
+		}
+	}
+	return d.setConfig(key, fields)
+}
+
+// cmdListConfigKeys handles LIST_CONFIG_KEYS
+func (d *TelosDaemon) cmdListConfigKeys() IPCResponse {
+	max := d.maps.ConfigMap.MaxEntries()
+	keys := []interface{}{}
+	for key := uint32(0); key < max; key++ {
+		var cfg Config
+		if err := d.maps.ConfigMap.Lookup(key, &cfg); err != nil {
+			return IPCResponse{Success: false, Error: fmt.Sprintf("read config key %d: %v", key, err)}
+		}
+		if key != 0 && cfg == (Config{}) {
+			continue // Never set
+		}
+		keys = append(keys, configKeyJSON(key, cfg))
+	}
+	return IPCResponse{Success: true, Data: map[string]interface{}{
+		"keys":        keys,
+		"max_entries": max,
+		"scoped":      max > 1,
+	}}
+}
@@ -0,0 +1,191 @@
+/*
+ * Telos Core - Config Versioning
+ *
+ * telos_config_t starts with a version, so a config_map pinned by an
+ * earlier daemon is recognised instead of being decoded as garbage:
+ *
+ *   version 0   the unversioned layouts (12 to 36 bytes), told apart
+ *               by their size; each is a prefix of the next
+ *   version 1   version + the nine fields of 36-byte version 0
+ *   version 2   + report_exec
+ *   version 3   + sandbox_tighten
+ *
+ * An older config is migrated forward on reattach: the fields it has
+ * are kept, the ones added since get their fresh-config defaults
+ * (never zero thresholds, which would block at any taint) and the
+ * upgraded struct is written back (see migrate.go). A config written by
+ * a newer daemon, or in a layout this one doesn't know, is refused
+ * before anything is touched; --reset-config replaces it with defaults.
+ *
+ * When Config grows, bump configVersion and add the new field count to
+ * configVersionFields; new fields are appended, never reordered.
+ */
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/cilium/ebpf"
+)
+
+// configVersion is the telos_config_t layout this daemon reads and writes
+const configVersion uint32 = 3
+
+// configVersionFields is the number of fields after the version word,
+// per versioned layout
+var configVersionFields = map[uint32]int{
+	1: 9,
+	2: 10,
+	3: 11,
+}
+
+// configLegacyFields is the number of fields per value size of the
+// unversioned layouts
+var configLegacyFields = map[int]int{
+	12: 3, // thresholds for exec and open, enabled
+	16: 4, // + report_allowed
+	24: 6, // + thresholds for connect and ptrace
+	28: 7, // + exec_taint
+	32: 8, // + default_taint_untracked
+	36: 9, // + maintenance
+}
+
+// errConfigNewer marks a config written by a newer daemon
+var errConfigNewer = errors.New("written by a newer daemon")
+
+// configFields lists cfg's fields after Version, in layout order
+func configFields(cfg *Config) []*uint32 {
+	return []*uint32{
+		&cfg.MaxTaintForExec, &cfg.MaxTaintForOpen, &cfg.Enabled, &cfg.ReportAllowed,
+		&cfg.MaxTaintForConnect, &cfg.MaxTaintForPtrace, &cfg.ExecTaint,
+		&cfg.DefaultTaintUntracked, &cfg.Maintenance, &cfg.ReportExec, &cfg.SandboxTighten,
+	}
+}
+
+// decodeConfig reads a config_map value of any known layout as the
+// current Config and reports the layout's version. An all-zero value (a
+// slot never written) stays zero.
+func decodeConfig(raw []byte) (Config, uint32, error) {
+	allZero := true
+	for _, b := range raw {
+		if b != 0 {
+			allZero = false
+			break
+		}
+	}
+	if allZero {
+		return Config{}, configVersion, nil
+	}
+
+	words := make([]uint32, len(raw)/4)
+	for i := range words {
+		words[i] = binary.NativeEndian.Uint32(raw[i*4:])
+	}
+
+	var fields []uint32
+	var version uint32
+	if n, ok := configLegacyFields[len(raw)]; ok {
+		fields = words[:n]
+	} else {
+		if len(words) == 0 || len(raw)%4 != 0 {
+			return Config{}, 0, fmt.Errorf("unknown config layout (%d bytes)", len(raw))
+		}
+		version = words[0]
+		if version > configVersion {
+			return Config{}, version, fmt.Errorf("config version %d %w (this daemon reads up to %d)",
+				version, errConfigNewer, configVersion)
+		}
+		n, ok := configVersionFields[version]
+		if !ok || len(words) != 1+n {
+			return Config{}, version, fmt.Errorf("unknown config layout (version %d, %d bytes)", version, len(raw))
+		}
+		fields = words[1 : 1+n]
+	}
+
+	// Start from what a fresh config gets for the fields added since
+	cfg := Config{
+		Version:            configVersion,
+		MaxTaintForConnect: TaintCritical,
+		MaxTaintForPtrace:  TaintCritical,
+		SandboxTighten:     defaultSandboxTighten,
+	}
+	for i, p := range configFields(&cfg)[:len(fields)] {
+		*p = fields[i]
+	}
+	return cfg, version, nil
+}
+
+// encodeConfig renders cfg as a config_map value
+func encodeConfig(cfg Config) []byte {
+	buf := make([]byte, 4*(1+len(configFields(&cfg))))
+	binary.NativeEndian.PutUint32(buf, cfg.Version)
+	for i, p := range configFields(&cfg) {
+		binary.NativeEndian.PutUint32(buf[4*(i+1):], *p)
+	}
+	return buf
+}
+
+// checkConfigVersions verifies every config in m can be read
+func checkConfigVersions(m *ebpf.Map) error {
+	var key uint32
+	raw := make([]byte, m.ValueSize())
+	iter := m.Iterate()
+	for iter.Next(&key, raw) {
+		if _, _, err := decodeConfig(raw); err != nil {
+			return fmt.Errorf("config_map[%d]: %w", key, err)
+		}
+	}
+	return iter.Err()
+}
+
+// checkPinnedConfig refuses to start on a pinned config_map this daemon
+// can't read, before loading touches any pin
+func checkPinnedConfig(pinPath string) error {
+	path := filepath.Join(pinPath, "config_map")
+	m, err := ebpf.LoadPinnedMap(path, &ebpf.LoadPinOptions{ReadOnly: true})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open pinned config_map: %w", err)
+	}
+	defer m.Close()
+
+	if err := checkConfigVersions(m); err != nil {
+		return fmt.Errorf("pinned %s: %w; upgrade the daemon or start with --reset-config to replace it with defaults",
+			path, err)
+	}
+	return nil
+}
+
+// readConfigForMigration decodes every config in old and re-encodes it
+// in the current layout
+func readConfigForMigration(old *ebpf.Map, ms *ebpf.MapSpec) (*mapMigration, error) {
+	mig := &mapMigration{oldSize: old.ValueSize(), newSize: ms.ValueSize}
+	if int(ms.ValueSize) != binary.Size(Config{}) {
+		return nil, fmt.Errorf("object's config_map value is %d bytes, Go Config is %d", ms.ValueSize, binary.Size(Config{}))
+	}
+
+	var key uint32
+	raw := make([]byte, old.ValueSize())
+	iter := old.Iterate()
+	for iter.Next(&key, raw) {
+		cfg, _, err := decodeConfig(raw)
+		if err != nil {
+			return nil, fmt.Errorf("config_map[%d]: %w", key, err)
+		}
+		if cfg == (Config{}) || key >= ms.MaxEntries {
+			continue // Unset slot, or one the new object doesn't have
+		}
+		k := make([]byte, 4)
+		binary.NativeEndian.PutUint32(k, key)
+		mig.keys = append(mig.keys, k)
+		mig.values = append(mig.values, encodeConfig(cfg))
+	}
+	return mig, iter.Err()
+}
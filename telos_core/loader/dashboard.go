@@ -0,0 +1,229 @@
+/*
+ * Telos Core - Status Dashboard
+ *
+ * With --dashboard-addr, serves a read-only HTML status page at / for a
+ * quick look from a browser (e.g. through an SSH port forward): mode,
+ * uptime, health and attached hooks (HEALTH), processes per taint level
+ * and the most tainted processes. Server-rendered, no scripts, reloads
+ * itself every dashboardRefresh.
+ *
+ * Like --metrics-addr it takes host:port or unix:/path. The page names
+ * processes, so keep it on loopback or a Unix socket; any other address
+ * is logged as a warning at startup.
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	dashboardRefresh = 10 * time.Second
+	dashboardTop     = 20 // most tainted processes listed
+)
+
+// dashboardPage is the page template; html/template escapes every value
+var dashboardPage = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8">
+<meta http-equiv="refresh" content="{{.Refresh}}">
+<title>Telos Core</title>
+<style>
+body { font-family: monospace; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1.5em; }
+td, th { border: 1px solid #999; padding: 0.2em 0.8em; text-align: left; }
+.bad { color: #b00; font-weight: bold; }
+.ok { color: #070; }
+</style></head><body>
+<h1>Telos Core</h1>
+<table>
+<tr><th>Mode</th><td>{{.Mode}}{{if .Maintenance}} (maintenance){{end}}{{if .Panic}} <span class="bad">PANIC MODE</span>{{end}}</td></tr>
+<tr><th>Uptime</th><td>{{.Uptime}}</td></tr>
+<tr><th>Health</th><td>{{if .Healthy}}<span class="ok">healthy</span>{{else}}<span class="bad">unhealthy</span>{{end}}</td></tr>
+{{range .Problems}}<tr><th></th><td class="bad">{{.}}</td></tr>
+{{end}}<tr><th>Tracked processes</th><td>{{.Tracked}}</td></tr>
+</table>
+{{if .Hooks}}<h2>Hooks</h2>
+<table>
+{{range .Hooks}}<tr><td>{{.Name}}</td><td>{{if .Attached}}<span class="ok">attached</span>{{else}}not attached{{end}}</td></tr>
+{{end}}</table>{{end}}
+<h2>Processes by level</h2>
+<table>
+{{range .Levels}}<tr><td>{{.Name}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+<h2>Most tainted</h2>
+<table>
+<tr><th>PID</th><th>Comm</th><th>Level</th><th>Quarantined</th></tr>
+{{range .Top}}<tr><td>{{.PID}}</td><td>{{.Comm}}</td><td>{{.Level}}</td><td>{{if .Quarantined}}<span class="bad">yes</span>{{end}}</td></tr>
+{{else}}<tr><td colspan="4">none above CLEAN</td></tr>
+{{end}}</table>
+<p>Generated {{.Generated}}, refreshes every {{.Refresh}}s.</p>
+</body></html>
+`))
+
+// dashboardData is what the page renders
+type dashboardData struct {
+	Refresh     int
+	Mode        string
+	Maintenance bool
+	Panic       bool
+	Uptime      time.Duration
+	Healthy     bool
+	Problems    []string
+	Tracked     int
+	Hooks       []struct {
+		Name     string
+		Attached bool
+	}
+	Levels []struct {
+		Name  string
+		Count int
+	}
+	Top []struct {
+		PID         uint32
+		Comm        string
+		Level       string
+		Quarantined bool
+	}
+	Generated string
+}
+
+// startDashboard starts the --dashboard-addr HTTP listener
+func (d *TelosDaemon) startDashboard() error {
+	ln, err := listenMetrics(d.opts.DashboardAddr)
+	if err != nil {
+		return err
+	}
+	if host, _, err := net.SplitHostPort(d.opts.DashboardAddr); err == nil && !loopbackHost(host) {
+		log.Printf("Warning: dashboard on %s is reachable beyond this host and shows process names", d.opts.DashboardAddr)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", d.serveDashboard)
+	d.dashboard = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	go func() {
+		if err := d.dashboard.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Warning: dashboard server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// stopDashboard shuts the dashboard listener down
+func (d *TelosDaemon) stopDashboard() {
+	if d.dashboard == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	d.dashboard.Shutdown(ctx)
+}
+
+// loopbackHost reports whether a listen host only accepts local connections
+func loopbackHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// dashboardURL describes where the dashboard is served, for the startup log
+func dashboardURL(addr string) string {
+	if path, ok := strings.CutPrefix(addr, metricsUnixPrefix); ok {
+		return "unix:" + path
+	}
+	return "http://" + addr + "/"
+}
+
+// serveDashboard renders the status page
+func (d *TelosDaemon) serveDashboard(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	data := dashboardData{
+		Refresh:   int(dashboardRefresh / time.Second),
+		Uptime:    time.Since(d.started).Round(time.Second),
+		Generated: time.Now().UTC().Format(time.RFC3339),
+	}
+
+	d.cfgMu.Lock()
+	cfg, err := d.activeConfig()
+	data.Maintenance = d.maintenance.active
+	data.Panic = d.lockdown.active
+	d.cfgMu.Unlock()
+	data.Mode = "unknown"
+	if err == nil {
+		data.Mode = enforceModeName(cfg.Enabled)
+	}
+
+	// Health and hooks as HEALTH reports them
+	health := d.cmdHealth()
+	if status, ok := health.Data.(map[string]interface{}); ok {
+		data.Healthy, _ = status["healthy"].(bool)
+		data.Problems, _ = status["problems"].([]string)
+		hooks, _ := status["hooks"].(map[string]bool)
+		for name, attached := range hooks {
+			data.Hooks = append(data.Hooks, struct {
+				Name     string
+				Attached bool
+			}{name, attached})
+		}
+		sort.Slice(data.Hooks, func(i, j int) bool { return data.Hooks[i].Name < data.Hooks[j].Name })
+	}
+
+	entries, err := d.snapshotProcesses()
+	if err != nil {
+		data.Healthy = false
+		data.Problems = append(data.Problems, "read process_map: "+err.Error())
+	}
+	data.Tracked = len(entries)
+	var counts [TaintCritical + 1]int
+	for _, e := range entries {
+		if e.Info.TaintLevel <= TaintCritical {
+			counts[e.Info.TaintLevel]++
+		}
+	}
+	for level, n := range counts {
+		data.Levels = append(data.Levels, struct {
+			Name  string
+			Count int
+		}{taintLevelName(uint32(level)), n})
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Info.TaintLevel > entries[j].Info.TaintLevel })
+	for _, e := range entries {
+		if len(data.Top) == dashboardTop || e.Info.TaintLevel == TaintClean {
+			break
+		}
+		data.Top = append(data.Top, struct {
+			PID         uint32
+			Comm        string
+			Level       string
+			Quarantined bool
+		}{e.PID, commString(e.Info.Comm), taintLevelName(e.Info.TaintLevel), e.Info.Quarantined != 0})
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := dashboardPage.Execute(w, data); err != nil {
+		log.Printf("Warning: rendering dashboard: %v", err)
+	}
+}
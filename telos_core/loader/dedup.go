@@ -0,0 +1,131 @@
+/*
+ * Telos Core - Event Deduplication
+ *
+ * A process spinning on a denied syscall can produce thousands of
+ * identical events per second. With --dedup-window, the first event of a
+ * kind (same PID, action, inode, verdict and destination) goes out at
+ * once; identical ones within the window are held back and flushed as a
+ * single event whose "count" says how many it stands for. The loop stays
+ * visible, the log and sinks stay readable.
+ *
+ * Only the output (log, subscribers, forwarders) is thinned; egress
+ * checks, shadow comparison and telos_events_read_total see every event.
+ */
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultDedupWindow = time.Second
+	maxDedupEntries    = 4096 // beyond this, new kinds pass through untracked
+)
+
+// dedupKey identifies "identical" events
+type dedupKey struct {
+	PID         uint32
+	Action      string
+	Inode       uint64
+	Blocked     bool
+	Denied      bool
+	Quarantined bool
+	DestIP      string
+	DestPort    uint16
+}
+
+// dedupEntry tracks one kind of event within the current window
+type dedupEntry struct {
+	since time.Time
+	last  Event  // most recent held-back duplicate
+	held  uint32 // duplicates held back since the first was emitted
+}
+
+// eventDedup collapses identical events within a window
+type eventDedup struct {
+	window time.Duration
+	emit   func(Event)
+
+	mu      sync.Mutex
+	entries map[dedupKey]*dedupEntry
+}
+
+func newEventDedup(window time.Duration, emit func(Event)) *eventDedup {
+	return &eventDedup{
+		window:  window,
+		emit:    emit,
+		entries: make(map[dedupKey]*dedupEntry),
+	}
+}
+
+// Offer reports whether ev should be emitted now. Duplicates are held
+// and flushed later as one event.
+func (dd *eventDedup) Offer(ev Event) bool {
+	key := dedupKey{
+		PID:         ev.PID,
+		Action:      ev.Action,
+		Inode:       ev.Inode,
+		Blocked:     ev.Blocked,
+		Denied:      ev.Denied,
+		Quarantined: ev.Quarantined,
+		DestIP:      ev.DestIP.String(),
+		DestPort:    ev.DestPort,
+	}
+
+	dd.mu.Lock()
+	defer dd.mu.Unlock()
+
+	e := dd.entries[key]
+	if e == nil {
+		if len(dd.entries) < maxDedupEntries {
+			dd.entries[key] = &dedupEntry{since: ev.Time}
+		}
+		return true
+	}
+	e.last = ev
+	e.held++
+	metrics.EventsDeduplicated.Add(1)
+	return false
+}
+
+// flush emits the held duplicates of every window that has ended
+// (all of them with force)
+func (dd *eventDedup) flush(now time.Time, force bool) {
+	var out []Event
+
+	dd.mu.Lock()
+	for key, e := range dd.entries {
+		if !force && now.Sub(e.since) < dd.window {
+			continue
+		}
+		delete(dd.entries, key)
+		if e.held > 0 {
+			ev := e.last
+			ev.Count = e.held
+			out = append(out, ev)
+		}
+	}
+	dd.mu.Unlock()
+
+	for _, ev := range out {
+		dd.emit(ev)
+	}
+}
+
+// run flushes ended windows until done is closed (Stop flushes the rest
+// before the forwarders close)
+func (dd *eventDedup) run(done <-chan struct{}) {
+	ticker := time.NewTicker(dd.window / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			dd.flush(now, false)
+		case <-done:
+			return
+		}
+	}
+}
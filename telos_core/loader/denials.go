@@ -0,0 +1,89 @@
+/*
+ * Telos Core - Denial History
+ *
+ * GET_DENIALS answers "is Telos the reason my agent can't do this?" for
+ * one process, from the events buffered for SUBSCRIBE resume:
+ *
+ *   {"command":"GET_DENIALS","data":{"pid":1234,"limit":10}}
+ *
+ * Newest first, each with the hook, the action, the target (inode for
+ * files, destination for connects; the hooks record no path), the
+ * reason and the kernel's explanation. With "include_audit":true,
+ * operations that would have been denied in enforce mode are listed
+ * too. Only the last --event-buffer events of all processes are held,
+ * so "oldest_seq" tells how far back the answer reaches.
+ */
+
+package main
+
+// Denials returned when no limit is given
+const defaultDenialLimit = 20
+
+// cmdGetDenials handles GET_DENIALS ({pid, limit?, include_audit?})
+func (d *TelosDaemon) cmdGetDenials(data map[string]interface{}) IPCResponse {
+	if resp, ok := d.requireEvents("GET_DENIALS"); !ok {
+		return resp
+	}
+	pid, _, err := processArg(data)
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	limit := uint64(defaultDenialLimit)
+	if _, ok := data["limit"]; ok {
+		if limit, err = uintArg(data, "limit", uint64(d.opts.EventBufferSize)); err != nil {
+			return invalidArg("%v", err)
+		}
+	}
+	includeAudit, err := boolArg(data, "include_audit")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+
+	found, oldest := d.hub.Recent(func(ev Event) bool {
+		return ev.PID == pid && (ev.Denied || includeAudit && ev.Blocked)
+	}, int(limit))
+
+	denials := make([]map[string]interface{}, 0, len(found))
+	for _, se := range found {
+		ev := se.Event
+		hook := ev.Action
+		if names, ok := hookThresholds[ev.Action]; ok {
+			hook = names.hook
+		}
+		decision := "deny"
+		if !ev.Denied {
+			decision = "audit"
+		}
+		entry := map[string]interface{}{
+			"seq":         se.Seq,
+			"time":        ev.Time,
+			"hook":        hook,
+			"action":      ev.Action,
+			"comm":        ev.Comm,
+			"level":       taintLevelName(ev.TaintLevel),
+			"decision":    decision,
+			"reason":      ev.Reason,
+			"explanation": ev.Explanation,
+		}
+		if ev.Inode != 0 {
+			entry["inode"] = ev.Inode
+		}
+		if ev.DestIP != nil {
+			entry["dest_ip"] = ev.DestIP.String()
+			entry["dest_port"] = ev.DestPort
+		}
+		if ev.Quarantined {
+			entry["quarantined"] = true
+		}
+		if ev.Count > 1 {
+			entry["count"] = ev.Count
+		}
+		denials = append(denials, entry)
+	}
+
+	return IPCResponse{Success: true, Data: map[string]interface{}{
+		"pid":        pid,
+		"denials":    denials,
+		"oldest_seq": oldest,
+	}}
+}
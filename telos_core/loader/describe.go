@@ -0,0 +1,710 @@
+/*
+ * Telos Core - Command Schema
+ *
+ * DESCRIBE returns a machine-readable description of every registered
+ * command, so clients can validate requests before sending them:
+ *
+ *   {"command":"DESCRIBE"}
+ *   {"command":"DESCRIBE","data":{"command":"UPDATE_TAINT"}}
+ *
+ *   {"name":"UPDATE_TAINT","summary":"...","rpc_method":"telos.updateTaint",
+ *    "read_only":false,"connection":false,
+ *    "fields":[{"name":"pid","type":"pid","required":true,...}, ...],
+ *    "returns":"object","response":[{"name":"taint_level","type":"integer",...}]}
+ *
+ * Without "command" the whole document is returned: {"version", "types",
+ * "commands":[...]}, sorted by name. "types" explains the field types
+ * beyond plain JSON ones (pid, level, duration). "response" lists the
+ * top-level fields of a successful response's "data" when "returns" is
+ * "object"; "required" there means always present. "read_only" commands
+ * are the ones served under --observe; "connection" ones are handled per
+ * connection and have no JSON-RPC method.
+ *
+ * The command list comes from the registry (commands, peerCommands,
+ * connCommands), so nothing registered is ever missing; a command with
+ * no entry in commandSpecs is listed with "documented":false, and the
+ * daemon warns about it at startup. With --metrics-addr the same
+ * document is served at /v1/schema.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+)
+
+// schemaVersion is the version of the DESCRIBE document's layout
+const schemaVersion = 1
+
+// Field types beyond plain JSON ones
+const (
+	typePID      = "pid"
+	typeLevel    = "level"
+	typeDuration = "duration"
+)
+
+// schemaTypes explains the field types used in commandSpecs
+var schemaTypes = map[string]string{
+	"integer":    "non-negative JSON integer (or a decimal string, unless --numeric-strings=false)",
+	"number":     "JSON number",
+	"string":     "JSON string",
+	"boolean":    "JSON boolean",
+	"object":     "JSON object",
+	"array":      "JSON array",
+	typePID:      "non-zero integer process ID; a thread ID is mapped to its process",
+	typeLevel:    "taint level: 0..4 or CLEAN, LOW, MEDIUM, HIGH, CRITICAL (case-insensitive)",
+	typeDuration: `Go duration string ("90m") or an integer number of seconds`,
+}
+
+// commandField describes one field of a command's data or response
+type commandField struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Required    bool   `json:"required"`
+	Description string `json:"description,omitempty"`
+}
+
+// commandSpec is the documented contract of one command
+type commandSpec struct {
+	Summary  string
+	Fields   []commandField
+	Returns  string // JSON type of the response's data ("" = none)
+	Response []commandField
+}
+
+// req and opt build required and optional fields
+func req(name, typ, desc string) commandField {
+	return commandField{Name: name, Type: typ, Required: true, Description: desc}
+}
+
+func opt(name, typ, desc string) commandField {
+	return commandField{Name: name, Type: typ, Description: desc}
+}
+
+// Fields shared by many commands
+var (
+	pidField      = req("pid", typePID, "process to act on")
+	taintResponse = []commandField{
+		req("pid", "integer", ""),
+		req("taint_level", "integer", "0..4"),
+		req("level", "string", "level name"),
+		opt("thread_id", "integer", "thread ID given as pid, if any"),
+	}
+	configSpecFields = []commandField{
+		opt("max_taint_for_exec", typeLevel, "highest taint allowed to exec"),
+		opt("max_taint_for_open", typeLevel, "highest taint allowed to open protected files"),
+		opt("max_taint_for_connect", typeLevel, "highest taint allowed to connect"),
+		opt("max_taint_for_ptrace", typeLevel, "highest taint allowed to ptrace"),
+		opt("enabled", "boolean", "true = enforce, false = audit; not with mode"),
+		opt("mode", "string", "enforce, audit or off; not with enabled"),
+		opt("exec_taint", "string", "preserve, clear or reduce"),
+		opt("default_taint_untracked", typeLevel, "taint assumed for untracked processes"),
+		opt("sandbox_tighten", "integer", "levels a sandboxed process's thresholds drop, 0..4"),
+		opt("validate_only", "boolean", "check and report without writing"),
+	}
+	configResponse = []commandField{
+		req("config", "object", "the resulting config"),
+		req("changed", "array", "fields that changed"),
+		req("warnings", "array", "legal but risky settings"),
+		req("validate_only", "boolean", ""),
+	}
+	policyFields = []commandField{
+		pidField,
+		opt("executable", "string", "path the process would exec"),
+		opt("dest", "string", "IP address the process would connect to"),
+	}
+	policyResponse = []commandField{
+		req("pid", "integer", ""),
+		req("tracked", "boolean", "has a process_map entry"),
+		req("exists", "boolean", "process is running"),
+		req("exempt", "boolean", ""),
+		req("quarantined", "boolean", ""),
+		req("sandboxed", "boolean", ""),
+		req("enforcing", "boolean", ""),
+		req("mode", "string", "enforce, audit or off"),
+		req("maintenance", "boolean", ""),
+		req("hooks", "object", "per hook: level, max_taint, decision, reason"),
+		opt("comm", "string", ""),
+		opt("ppid", "integer", ""),
+	}
+)
+
+// commandSpecs documents every registered command, by native name
+var commandSpecs = map[string]commandSpec{
+	"PING": {Summary: "Check the daemon answers", Returns: "string"},
+	"DESCRIBE": {
+		Summary: "Describe the registered commands",
+		Fields:  []commandField{opt("command", "string", "describe only this command")},
+		Returns: "object",
+		Response: []commandField{
+			opt("version", "integer", "document layout version (whole document only)"),
+			opt("types", "object", "field type descriptions (whole document only)"),
+			opt("commands", "array", "one description per command (whole document only)"),
+		},
+	},
+	"UPDATE_TAINT": {
+		Summary:  "Set a process's taint level",
+		Fields:   []commandField{pidField, req("taint_level", typeLevel, "new level")},
+		Returns:  "object",
+		Response: taintResponse,
+	},
+	"INCREMENT_TAINT": {
+		Summary:  "Raise a process's taint level, capped at CRITICAL",
+		Fields:   []commandField{pidField, req("delta", "integer", "levels to add, 1..4")},
+		Returns:  "object",
+		Response: taintResponse,
+	},
+	"DECREMENT_TAINT": {
+		Summary:  "Lower a process's taint level, floored at CLEAN",
+		Fields:   []commandField{pidField, req("delta", "integer", "levels to subtract, 1..4")},
+		Returns:  "object",
+		Response: taintResponse,
+	},
+	"CLEAR_TAINT": {
+		Summary: "Remove a process's entry",
+		Fields: []commandField{
+			pidField,
+			opt("start_time", "integer", "only if the process still has this start time (ERR_CONFLICT otherwise)"),
+		},
+		Returns: "object",
+		Response: []commandField{
+			opt("pid", "integer", "present when a thread ID was given"),
+			opt("thread_id", "integer", ""),
+		},
+	},
+	"REGISTER_AGENT": {
+		Summary: "Start tracking a process; re-registering keeps its taint",
+		Fields: []commandField{
+			pidField,
+			opt("comm", "string", "name to record (default: the recorded one when re-registering, else from /proc)"),
+			opt("initial_taint", typeLevel, "default CLEAN"),
+			opt("sandboxed", "boolean", "hold the process to the tightened thresholds; never cleared by re-registering"),
+			opt("force_clean", "boolean", "when already tracked, reset taint to initial_taint instead of keeping it"),
+		},
+		Returns: "object",
+		Response: append(append([]commandField(nil), taintResponse...),
+			req("sandboxed", "boolean", ""),
+			req("re_registered", "boolean", "the PID was already tracked"),
+			opt("previous_level", "string", "level before, when re-registered"),
+			opt("start_time", "integer", "clock ticks since boot, for CLEAR_TAINT")),
+	},
+	"SET_COMM": {
+		Summary: "Change the comm recorded for a tracked process",
+		Fields:  []commandField{pidField, opt("comm", "string", "new name (default: from /proc)")},
+		Returns: "object",
+		Response: []commandField{
+			req("pid", "integer", ""),
+			req("comm", "string", ""),
+			req("previous", "string", ""),
+			req("truncated", "boolean", ""),
+		},
+	},
+	"GET_STATE": {
+		Summary: "List every process_map entry",
+		Returns: "object",
+		Response: []commandField{
+			opt("<pid>", "object", "per PID: taint_level, level, sandboxed, quarantined"),
+		},
+	},
+	"GET_PROCESS_TREE": {
+		Summary: "Tracked processes arranged by parent",
+		Returns: "object",
+		Response: []commandField{
+			req("roots", "array", ""),
+			req("tracked", "integer", ""),
+			req("placeholders", "integer", "untracked ancestors shown to connect the tree"),
+		},
+	},
+	"HEALTH": {
+		Summary: "Report whether the programs are attached and the maps usable",
+		Returns: "object",
+		Response: []commandField{
+			req("healthy", "boolean", ""),
+			opt("problems", "array", "present when unhealthy"),
+			opt("bpf_loaded", "boolean", ""),
+			opt("hooks", "object", ""),
+			opt("events_available", "boolean", ""),
+			opt("event_reader_running", "boolean", ""),
+			opt("last_event", "string", ""),
+			opt("map_writable", "boolean", ""),
+		},
+	},
+	"RELOAD_BPF": {
+		Summary:  "Load the BPF object again and swap the programs in place",
+		Fields:   []commandField{opt("path", "string", "object to load (default: --bpf-obj)")},
+		Returns:  "object",
+		Response: []commandField{req("object", "string", ""), req("hooks", "object", "per program: attached, missing or the error")},
+	},
+	"GET_MAP_INFO": {
+		Summary: "Metadata of every loaded map",
+		Returns: "object",
+		Response: []commandField{
+			opt("<map>", "object", "per map: type, key_size, value_size, max_entries, pin_path, reattached, loaded"),
+		},
+	},
+	"GET_BPF_INFO": {
+		Summary: "Loaded object, programs and maps",
+		Returns: "object",
+		Response: []commandField{
+			req("object", "string", ""),
+			req("programs", "object", "name -> type and stats"),
+			req("maps", "object", "name -> type and sizes"),
+			req("hooks", "array", "hook, required, status, attached"),
+			req("warnings", "array", ""),
+			req("events_available", "boolean", ""),
+		},
+	},
+	"FREEZE_PID": {
+		Summary: "Freeze a process with the cgroup freezer",
+		Fields:  []commandField{pidField, opt("mode", "string", "subtree (default) or cgroup")},
+		Returns: "object",
+		Response: []commandField{
+			req("pid", "integer", ""),
+			req("mode", "string", ""),
+			req("cgroup", "string", ""),
+			req("pids", "array", "processes frozen"),
+			req("cgroup_version", "integer", ""),
+		},
+	},
+	"THAW_PID": {Summary: "Thaw a process frozen with FREEZE_PID", Fields: []commandField{pidField}},
+	"LIST_FROZEN": {
+		Summary:  "Processes frozen with FREEZE_PID",
+		Returns:  "object",
+		Response: []commandField{req("frozen", "array", ""), req("cgroup_version", "integer", "")},
+	},
+	"SET_CONFIG": {
+		Summary:  "Change the global config (at least one config field)",
+		Fields:   configSpecFields,
+		Returns:  "object",
+		Response: configResponse,
+	},
+	"SET_CONFIG_KEY": {
+		Summary:  "Change the config at a config_map key (SET_CONFIG's fields)",
+		Fields:   append([]commandField{req("key", "integer", "config_map key")}, configSpecFields...),
+		Returns:  "object",
+		Response: append(append([]commandField(nil), configResponse...), opt("key", "integer", "non-zero keys only")),
+	},
+	"GET_CONFIG_KEY": {
+		Summary:  "Read the config at a config_map key",
+		Fields:   []commandField{req("key", "integer", "config_map key")},
+		Returns:  "object",
+		Response: []commandField{req("key", "integer", ""), req("config", "object", "")},
+	},
+	"LIST_CONFIG_KEYS": {
+		Summary: "Every config_map key that has been set",
+		Returns: "object",
+		Response: []commandField{
+			req("keys", "array", "key and config of each"),
+			req("max_entries", "integer", ""),
+			req("scoped", "boolean", "the object supports keys besides 0"),
+		},
+	},
+	"SET_THRESHOLD": {
+		Summary: "Set one hook's threshold",
+		Fields: []commandField{
+			req("hook", "string", "exec, file, connect or ptrace"),
+			req("max_taint", typeLevel, "highest taint allowed"),
+		},
+		Returns:  "object",
+		Response: configJSONResponse,
+	},
+	"SET_SHADOW_CONFIG": {
+		Summary: "Evaluate a candidate config alongside the active one without enforcing it",
+		Fields: []commandField{
+			opt("max_taint_for_exec", typeLevel, ""),
+			opt("max_taint_for_open", typeLevel, ""),
+			opt("max_taint_for_connect", typeLevel, ""),
+			opt("max_taint_for_ptrace", typeLevel, ""),
+			opt("enabled", "boolean", "not with mode"),
+			opt("mode", "string", "enforce, audit or off; not with enabled"),
+			opt("clear", "boolean", "drop the candidate"),
+		},
+	},
+	"GET_SHADOW_DIFF": {
+		Summary: "Where the candidate config would decide differently",
+		Fields:  []commandField{opt("reset", "boolean", "start counting afresh")},
+		Returns: "object",
+		Response: []commandField{
+			req("active", "boolean", ""),
+			opt("candidate", "object", ""),
+			opt("since", "string", ""),
+			opt("compared", "integer", ""),
+			opt("would_block", "integer", ""),
+			opt("would_allow", "integer", ""),
+			opt("by_action", "object", ""),
+			opt("recent", "array", ""),
+		},
+	},
+	"QUARANTINE_PID": {
+		Summary:  "Deny a process everything the hooks can deny, whatever its taint",
+		Fields:   []commandField{pidField},
+		Returns:  "object",
+		Response: []commandField{req("pid", "integer", ""), opt("already_quarantined", "boolean", "")},
+	},
+	"UNQUARANTINE_PID": {Summary: "Lift QUARANTINE_PID", Fields: []commandField{pidField}},
+	"SET_PATH_POLICY": {
+		Summary: "Override exec_taint for one executable",
+		Fields: []commandField{
+			req("path", "string", "absolute path of the executable"),
+			req("exec_taint", "string", "preserve, clear, reduce, or default to remove the override"),
+		},
+		Returns: "object",
+		Response: []commandField{
+			req("path", "string", ""),
+			opt("exec_taint", "string", ""),
+			opt("removed", "boolean", "with exec_taint default"),
+		},
+	},
+	"GET_PATH_POLICY": {
+		Summary:  "Every exec_taint override",
+		Returns:  "object",
+		Response: []commandField{req("paths", "object", "path -> mode"), req("exec_taint", "string", "the global mode")},
+	},
+	"GET_EFFECTIVE_POLICY": {
+		Summary:  "How each hook would decide for a process right now",
+		Fields:   policyFields,
+		Returns:  "object",
+		Response: policyResponse,
+	},
+	"SIMULATE_TAINT": {
+		Summary:  "How each hook would decide for a process at another taint level",
+		Fields:   append(append([]commandField(nil), policyFields...), req("taint_level", typeLevel, "level to simulate")),
+		Returns:  "object",
+		Response: policyResponse,
+	},
+	"SET_EGRESS_POLICY": {
+		Summary: "Replace the egress policy",
+		Fields: []commandField{
+			opt("allow", "array", "CIDRs and hostnames"),
+			opt("deny", "array", "CIDRs and hostnames"),
+			opt("deny_taint", typeLevel, "default CRITICAL"),
+			opt("unknown_min_taint", typeLevel, "default HIGH"),
+			opt("unknown_taint", typeLevel, ""),
+		},
+		Returns:  "object",
+		Response: []commandField{req("policy", "object", ""), req("resolved", "object", "hostname -> addresses")},
+	},
+	"GET_EGRESS_POLICY": {
+		Summary:  "The active egress policy",
+		Returns:  "object",
+		Response: []commandField{req("policy", "object", ""), req("resolved", "object", "hostname -> addresses")},
+	},
+	"GET_METRICS": {
+		Summary:  "The metric snapshot",
+		Returns:  "object",
+		Response: []commandField{opt("<metric>", "number", "one per series, as on /metrics")},
+	},
+	"EXPORT_CSV": {
+		Summary:  "Write process_map to a signed CSV file",
+		Fields:   []commandField{req("path", "string", "file to write")},
+		Returns:  "object",
+		Response: []commandField{req("count", "integer", "entries written")},
+	},
+	"IMPORT_CSV": {
+		Summary:  "Load process entries from an EXPORT_CSV file",
+		Fields:   []commandField{req("path", "string", "file to read")},
+		Returns:  "object",
+		Response: []commandField{req("count", "integer", "entries loaded")},
+	},
+	"DIFF_STATE": {
+		Summary: "Compare process_map with an EXPORT_CSV file",
+		Fields:  []commandField{req("path", "string", "file to compare with")},
+		Returns: "object",
+		Response: []commandField{
+			req("path", "string", ""),
+			req("before", "integer", "entries in the file"),
+			req("after", "integer", "entries in process_map"),
+			req("added", "array", ""),
+			req("removed", "array", ""),
+			req("changed", "array", "with the old values"),
+		},
+	},
+	"REPLAY": {
+		Summary: "Apply a dumped event log to the taint map",
+		Fields: []commandField{
+			req("path", "string", "event log to read"),
+			opt("dry_run", "boolean", "count without writing"),
+			opt("force", "boolean", "also apply events for PIDs no longer running"),
+		},
+		Returns: "object",
+		Response: []commandField{
+			req("applied", "integer", ""),
+			req("unchanged", "integer", ""),
+			req("skipped_missing", "integer", "processes no longer running"),
+			req("invalid", "integer", ""),
+			req("dry_run", "boolean", ""),
+		},
+	},
+	"GET_PEER_STATE": {
+		Summary:  "Taint state other hosts mirror to --state-mirror",
+		Fields:   []commandField{opt("include_self", "boolean", "include this host")},
+		Returns:  "object",
+		Response: []commandField{req("host", "string", "this host"), req("hosts", "object", "host -> state")},
+	},
+	"GET_FULL_POLICY": {
+		Summary:  "Everything enforced, as one document for SET_FULL_POLICY",
+		Returns:  "object",
+		Response: []commandField{req("policy", "object", ""), req("panic_mode", "boolean", "")},
+	},
+	"SET_FULL_POLICY": {
+		Summary: "Apply a GET_FULL_POLICY document",
+		Fields: []commandField{
+			req("policy", "object", "version, config, path_policy and egress sections"),
+			opt("validate_only", "boolean", "check without applying"),
+		},
+		Returns: "object",
+		Response: []commandField{
+			req("policy", "object", "the resulting document"),
+			req("changed", "array", "sections changed"),
+			req("validate_only", "boolean", ""),
+		},
+	},
+	"GET_OVERHEAD": {
+		Summary: "Measure the hooks' cost on exec and open",
+		Fields:  []commandField{opt("iterations", "integer", "operations of each kind, 1..10000 (default 200)")},
+		Returns: "object",
+		Response: []commandField{
+			req("iterations", "integer", ""),
+			req("mode", "string", "enforce, audit or off"),
+			req("baseline", "string", "bpf_run_time_stats (overhead_pct is hook run time over wall time, not a run with enforcement off) or none"),
+			req("exec", "object", "per_op_ns, errors, hook_ns, overhead_pct"),
+			req("open", "object", "per_op_ns, errors, hook_ns, overhead_pct"),
+			req("hooks", "object", "per hook: runs, avg_ns"),
+			req("warnings", "array", ""),
+		},
+	},
+	"REEVALUATE": {
+		Summary: "Re-check tracked processes against the current thresholds",
+		Fields: []commandField{
+			opt("pid", typePID, "one process; either pid or all"),
+			opt("all", "boolean", "every tracked process"),
+			opt("action", "string", "none (default), freeze or quarantine for processes over policy"),
+		},
+		Returns: "object",
+		Response: []commandField{
+			req("evaluated", "integer", ""),
+			req("over_policy", "array", "pid, comm, level, over, decision"),
+			req("acted", "integer", "processes the action was applied to"),
+			req("action", "string", ""),
+			req("enforcing", "boolean", ""),
+		},
+	},
+	"GET_DENIALS": {
+		Summary: "Recent denials of one process, with explanations",
+		Fields: []commandField{
+			pidField,
+			opt("limit", "integer", "at most this many (up to --event-buffer)"),
+			opt("include_audit", "boolean", "include audit-mode would-denies"),
+		},
+		Returns: "object",
+		Response: []commandField{
+			req("pid", "integer", ""),
+			req("denials", "array", "seq, time, hook, action, comm, level, decision, reason, explanation"),
+			req("oldest_seq", "integer", "oldest event still buffered"),
+		},
+	},
+	"SWAP_MAP": {
+		Summary: "Replace process_map from a snapshot in one step",
+		Fields: []commandField{
+			opt("processes", "array", "pid, taint_level, comm?, sandboxed?, quarantined?; either processes or path"),
+			opt("path", "string", "EXPORT_CSV file; either processes or path"),
+			opt("atomic", "boolean", "refuse rather than rewrite the map in place"),
+		},
+		Returns: "object",
+		Response: []commandField{
+			req("method", "string", "atomic or locked"),
+			req("count", "integer", ""),
+			req("added", "integer", ""),
+			req("changed", "integer", ""),
+			req("removed", "integer", ""),
+		},
+	},
+	"GET_PROCESS": {
+		Summary: "What the map and /proc know about a process, tracked or not",
+		Fields:  []commandField{pidField},
+		Returns: "object",
+		Response: []commandField{
+			req("pid", "integer", ""),
+			req("tracked", "boolean", "has a process_map entry"),
+			req("source", "string", "map, or proc when not tracked or the map can't be read"),
+			req("taint_level", "integer", `0..4, or "unknown" when source is proc`),
+			req("level", "string", `level name, or "unknown"`),
+			req("running", "boolean", ""),
+			opt("comm", "string", ""),
+			opt("sandboxed", "boolean", "tracked only"),
+			opt("quarantined", "boolean", "tracked only"),
+			opt("uid", "integer", "real UID"),
+			opt("ppid", "integer", ""),
+			opt("start_time", "integer", "clock ticks since boot, as CLEAR_TAINT takes it"),
+			opt("cgroup", "string", "cgroup v2 path"),
+			opt("thread_id", "integer", "thread ID given as pid, if any"),
+			opt("map_error", "string", "why process_map couldn't be read"),
+		},
+	},
+	"PANIC_MODE": {
+		Summary: "Lock down: enforce with every threshold CLEAN",
+		Returns: "object",
+		Response: []commandField{
+			req("active", "boolean", ""),
+			req("since", "string", ""),
+			req("previous", "object", "config to restore"),
+			opt("config", "object", "lockdown config"),
+			opt("already_active", "boolean", ""),
+		},
+	},
+	"EXIT_PANIC_MODE": {
+		Summary:  "Lift PANIC_MODE and restore the previous config",
+		Returns:  "object",
+		Response: []commandField{req("active", "boolean", ""), req("config", "object", "")},
+	},
+	"ENTER_MAINTENANCE": {
+		Summary: "Stop denying for a while, reporting only",
+		Fields: []commandField{
+			opt("duration", typeDuration, "default 1h, at most 24h"),
+			opt("reason", "string", ""),
+		},
+		Returns:  "object",
+		Response: maintenanceResponse,
+	},
+	"EXIT_MAINTENANCE": {
+		Summary:  "End maintenance early",
+		Returns:  "object",
+		Response: maintenanceResponse,
+	},
+	"SHUTDOWN": {Summary: "Stop the daemon (root or --admin-uids only)", Returns: "string"},
+	"SUBSCRIBE": {
+		Summary: "Turn the connection into an event stream",
+		Fields:  []commandField{opt("since_seq", "integer", "resume after this sequence number")},
+		Returns: "object",
+		Response: []commandField{
+			req("seq", "integer", "latest sequence number"),
+			req("oldest_seq", "integer", ""),
+			req("gap", "boolean", "events after since_seq were lost"),
+			req("replayed", "integer", ""),
+		},
+	},
+	"SUBSCRIBE_STATE": {
+		Summary:  "Also receive a notification for every state change",
+		Returns:  "object",
+		Response: []commandField{req("subscribed", "boolean", "")},
+	},
+	"SET_COMPRESSION": {
+		Summary: "Gzip this connection's large responses",
+		Fields: []commandField{
+			req("encoding", "string", "gzip or none"),
+			opt("min_bytes", "integer", "smallest response to compress (default 65536)"),
+		},
+		Returns:  "object",
+		Response: []commandField{req("encoding", "string", ""), opt("min_bytes", "integer", "")},
+	},
+}
+
+// Response fields of configJSON and the maintenance commands
+var configJSONResponse = []commandField{
+	req("max_taint_for_exec", "string", "level name"),
+	req("max_taint_for_open", "string", "level name"),
+	req("max_taint_for_connect", "string", "level name"),
+	req("max_taint_for_ptrace", "string", "level name"),
+	req("enabled", "boolean", ""),
+	req("mode", "string", "enforce, audit or off"),
+	req("default_taint_untracked", "string", "level name"),
+	req("sandbox_tighten", "integer", ""),
+}
+
+var maintenanceResponse = []commandField{
+	req("active", "boolean", ""),
+	opt("since", "string", ""),
+	opt("until", "string", ""),
+	opt("remaining_seconds", "integer", ""),
+	opt("reason", "string", ""),
+	opt("by", "string", ""),
+}
+
+// DESCRIBE reads the registry, so it can only be added to it at init
+func init() {
+	commands["DESCRIBE"] = (*TelosDaemon).cmdDescribe
+}
+
+// describeCommand renders one registered command
+func describeCommand(name string) map[string]interface{} {
+	desc := map[string]interface{}{
+		"name":       name,
+		"read_only":  observeCommands[name],
+		"connection": connCommands[name],
+	}
+	if !connCommands[name] {
+		desc["rpc_method"] = rpcMethodName(name)
+	}
+	spec, ok := commandSpecs[name]
+	if !ok {
+		desc["documented"] = false
+		return desc
+	}
+	fields := spec.Fields
+	if fields == nil {
+		fields = []commandField{}
+	}
+	desc["summary"] = spec.Summary
+	desc["fields"] = fields
+	desc["returns"] = spec.Returns
+	if spec.Returns == "" {
+		desc["returns"] = "none"
+	}
+	if spec.Response != nil {
+		desc["response"] = spec.Response
+	}
+	return desc
+}
+
+// describeAll renders the whole schema document
+func describeAll() map[string]interface{} {
+	names := commandNames()
+	sort.Strings(names)
+	list := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		list = append(list, describeCommand(name))
+	}
+	return map[string]interface{}{
+		"version":  schemaVersion,
+		"types":    schemaTypes,
+		"commands": list,
+	}
+}
+
+// undocumentedCommands lists registered commands without a spec
+func undocumentedCommands() []string {
+	var missing []string
+	for _, name := range commandNames() {
+		if _, ok := commandSpecs[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// cmdDescribe handles DESCRIBE ({command?})
+func (d *TelosDaemon) cmdDescribe(data map[string]interface{}) IPCResponse {
+	name, err := stringArg(data, "command")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	if name == "" {
+		return IPCResponse{Success: true, Data: describeAll()}
+	}
+	if _, ok := lookupCommand(name); !ok && !connCommands[name] {
+		return errorResponse(ErrUnknownCommand, "Unknown command: %s%s", name, d.didYouMean(name, commandNames()))
+	}
+	return IPCResponse{Success: true, Data: describeCommand(name)}
+}
+
+// serveSchema serves the DESCRIBE document at /v1/schema
+func (d *TelosDaemon) serveSchema(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(describeAll()); err != nil {
+		log.Printf("Warning: /v1/schema: %v", err)
+	}
+}
@@ -0,0 +1,278 @@
+/*
+ * Telos Core - Effective Policy
+ *
+ * GET_EFFECTIVE_POLICY answers "would this PID be blocked, and why" in
+ * one call by resolving the same layers the hooks use, in the same
+ * order:
+ *
+ *   exempt_map      -> allowed by every hook
+ *   quarantine      -> denied by every hook, even in audit mode
+ *                      (mode "off" only reports it)
+ *   taint source    -> own entry; for exec also the parent's entry;
+ *                      otherwise default_taint_untracked
+ *   thresholds      -> max_taint_for_* from config_map, lowered by
+ *                      sandbox_tighten if the taint source is sandboxed
+ *                      (see sandbox.go), enforcement mode
+ *
+ * Optional inputs refine the answer: "executable" reports which exec
+ * taint policy (global or per-path override) would apply after exec,
+ * "dest" (an IP) runs the egress policy for a connect to it.
+ *
+ *   {"command":"GET_EFFECTIVE_POLICY","data":{"pid":42,"dest":"1.2.3.4"}}
+ *
+ * Decisions are "allow", "deny", or "audit" (would be denied, but the
+ * mode is audit or off so the hook only reports).
+ *
+ * SIMULATE_TAINT takes the same inputs plus a taint_level and answers as
+ * if UPDATE_TAINT had set the PID to that level, without writing
+ * anything, so Cortex can see the effect of a level before applying it:
+ *
+ *   {"command":"SIMULATE_TAINT","data":{"pid":42,"taint_level":"HIGH"}}
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/cilium/ebpf"
+)
+
+// policyHooks lists the hooks in report order with their threshold names
+var policyHooks = []string{"exec", "file", "connect", "ptrace"}
+
+// thresholdDecision predicts a hook's verdict for taint under maxTaint
+func thresholdDecision(taint, maxTaint uint32, enforce bool) string {
+	switch {
+	case taint <= maxTaint:
+		return "allow"
+	case enforce:
+		return "deny"
+	default:
+		return "audit"
+	}
+}
+
+// trackedEntry returns pid's process_map entry and whether it exists
+func (d *TelosDaemon) trackedEntry(pid uint32) (ProcessInfo, bool, error) {
+	var info ProcessInfo
+	err := d.maps.ProcessMap.Lookup(pid, &info)
+	if errors.Is(err, ebpf.ErrKeyNotExist) {
+		return info, false, nil
+	}
+	return info, err == nil, err
+}
+
+// cmdGetEffectivePolicy handles GET_EFFECTIVE_POLICY ({pid, executable?, dest?})
+func (d *TelosDaemon) cmdGetEffectivePolicy(data map[string]interface{}) IPCResponse {
+	return d.effectivePolicy(data, nil)
+}
+
+// cmdSimulateTaint handles SIMULATE_TAINT ({pid, taint_level, executable?, dest?})
+func (d *TelosDaemon) cmdSimulateTaint(data map[string]interface{}) IPCResponse {
+	level, err := levelArg(data, "taint_level")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	return d.effectivePolicy(data, &level)
+}
+
+// effectivePolicy resolves the hooks' decisions for data's PID, at the
+// given level instead of its current taint when simulate is set
+func (d *TelosDaemon) effectivePolicy(data map[string]interface{}, simulate *uint32) IPCResponse {
+	pid, _, err := processArg(data)
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	var dest net.IP
+	if _, ok := data["dest"]; ok {
+		s, err := stringArg(data, "dest")
+		if err != nil {
+			return invalidArg("%v", err)
+		}
+		if dest = net.ParseIP(s); dest == nil {
+			return invalidArg("Invalid 'dest' %q (want an IP address)", s)
+		}
+	}
+	var executable string
+	if _, ok := data["executable"]; ok {
+		if executable, err = stringArg(data, "executable"); err != nil {
+			return invalidArg("%v", err)
+		}
+	}
+
+	cfg, err := d.activeConfig()
+	if err != nil {
+		return IPCResponse{Success: false, Error: "read config: " + err.Error()}
+	}
+	enforce := cfg.Enabled == enforceOn && cfg.Maintenance == 0
+
+	exempt := false
+	if d.maps.Exempt != nil {
+		var one uint32
+		exempt = d.maps.Exempt.Lookup(pid, &one) == nil
+	}
+
+	info, tracked, err := d.trackedEntry(pid)
+	if err != nil {
+		return IPCResponse{Success: false, Error: fmt.Sprintf("lookup PID %d: %v", pid, err)}
+	}
+
+	// Taint as each hook sees it (exec falls back to the parent first)
+	taint, source, quarantined := cfg.DefaultTaintUntracked, "default_taint_untracked", false
+	sandboxed := tracked && info.IsSandboxed != 0
+	if tracked {
+		taint, source, quarantined = info.TaintLevel, "self", info.Quarantined != 0
+	}
+	if simulate != nil {
+		// UPDATE_TAINT would create the entry, so the parent no longer counts
+		taint, source = *simulate, "simulated"
+	}
+	execTaint, execSource, execQuarantined, execSandboxed := taint, source, quarantined, sandboxed
+	var ppid uint32
+	st, statErr := readProcStat(pid)
+	if statErr == nil {
+		ppid = st.PPID
+	}
+	if !tracked && ppid != 0 && simulate == nil {
+		parent, ok, err := d.trackedEntry(ppid)
+		if err != nil {
+			return IPCResponse{Success: false, Error: fmt.Sprintf("lookup parent PID %d: %v", ppid, err)}
+		}
+		if ok {
+			execTaint, execSource, execQuarantined = parent.TaintLevel, "parent", parent.Quarantined != 0
+			execSandboxed = parent.IsSandboxed != 0
+		}
+	}
+
+	hooks := make(map[string]interface{}, len(policyHooks))
+	for _, hook := range policyHooks {
+		t, src, q, sb := taint, source, quarantined, sandboxed
+		if hook == "exec" {
+			t, src, q, sb = execTaint, execSource, execQuarantined, execSandboxed
+		}
+		configured := *thresholdFields[hook](&cfg)
+		maxTaint := sandboxMax(cfg, configured, sb)
+
+		var decision, reason string
+		switch {
+		case exempt:
+			decision, reason = "allow", "PID is in exempt_map"
+		case q && cfg.Enabled == enforceOff:
+			decision, reason = "audit", "quarantined ("+src+"), mode off"
+		case q:
+			decision, reason = "deny", "quarantined ("+src+")"
+		default:
+			decision = thresholdDecision(t, maxTaint, enforce)
+			if t > maxTaint {
+				reason = fmt.Sprintf("taint %s (%s) above max %s", taintLevelName(t), src, taintLevelName(maxTaint))
+			} else {
+				reason = fmt.Sprintf("taint %s (%s) within max %s", taintLevelName(t), src, taintLevelName(maxTaint))
+			}
+			if maxTaint != configured {
+				reason += fmt.Sprintf(" (sandboxed; configured %s)", taintLevelName(configured))
+			}
+		}
+
+		entry := map[string]interface{}{
+			"taint_level":  t,
+			"level":        taintLevelName(t),
+			"taint_source": src,
+			"max_taint":    taintLevelName(maxTaint),
+			"decision":     decision,
+			"reason":       reason,
+		}
+		if sb {
+			entry["sandboxed"] = true
+			entry["configured_max_taint"] = taintLevelName(configured)
+		}
+		if hook == "file" && decision != "allow" && !q {
+			entry["scope"] = "id_* files only (SSH keys)"
+		}
+		hooks[hook] = entry
+	}
+
+	resp := map[string]interface{}{
+		"pid":         pid,
+		"tracked":     tracked,
+		"exists":      statErr == nil,
+		"exempt":      exempt,
+		"quarantined": quarantined,
+		"sandboxed":   sandboxed,
+		"enforcing":   enforce,
+		"mode":        enforceModeName(cfg.Enabled),
+		"maintenance": cfg.Maintenance != 0,
+		"hooks":       hooks,
+	}
+	if tracked {
+		resp["comm"] = commString(info.Comm)
+	} else if statErr == nil {
+		resp["comm"] = st.Comm
+	}
+	if ppid != 0 {
+		resp["ppid"] = ppid
+	}
+	if simulate != nil {
+		resp["simulated"] = true
+		resp["current_level"] = taintLevelName(info.TaintLevel)
+		if !tracked {
+			resp["current_level"] = taintLevelName(cfg.DefaultTaintUntracked)
+		}
+	}
+
+	// Exec taint policy that would apply to the next exec
+	execPolicy := map[string]interface{}{
+		"mode":   execTaintName(cfg.ExecTaint),
+		"source": "config",
+	}
+	if executable != "" {
+		execPolicy["executable"] = executable
+		key, err := executableKey(executable)
+		if err != nil {
+			return invalidArg("Invalid 'executable': %v", err)
+		}
+		var override PathPolicy
+		if d.maps.PathPolicy != nil && d.maps.PathPolicy.Lookup(key, &override) == nil {
+			execPolicy["mode"] = execTaintName(override.ExecTaint)
+			execPolicy["source"] = "path_policy"
+		}
+	}
+	resp["exec_taint"] = execPolicy
+
+	if dest != nil {
+		resp["egress"] = d.egressVerdict(dest, taint)
+	}
+
+	return IPCResponse{Success: true, Data: resp}
+}
+
+// egressVerdict predicts what the egress policy does to a connect to dest
+// at the given taint (mirrors checkEgress)
+func (d *TelosDaemon) egressVerdict(dest net.IP, taint uint32) map[string]interface{} {
+	d.egress.mu.RLock()
+	policy := d.egress.policy
+	denyHit, denied := d.egress.deny.contains(dest)
+	allowHit, allowed := d.egress.allow.contains(dest)
+	allowListed := len(d.egress.allow.nets)+len(d.egress.allow.hosts) > 0
+	d.egress.mu.RUnlock()
+
+	v := map[string]interface{}{"dest": dest.String()}
+	switch {
+	case denied:
+		v["list"], v["match"] = "deny", denyHit
+	case allowed:
+		v["list"], v["match"] = "allow", allowHit
+	default:
+		v["list"] = "none"
+	}
+
+	switch {
+	case denied && policy.DenyTaint > 0:
+		v["escalate_to"] = taintLevelName(policy.DenyTaint)
+	case allowListed && !allowed && policy.UnknownTaint > 0 && taint >= policy.UnknownMinTaint:
+		v["escalate_to"] = taintLevelName(policy.UnknownTaint)
+	}
+	return v
+}
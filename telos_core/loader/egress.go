@@ -0,0 +1,279 @@
+/*
+ * Telos Core - Egress Policy
+ *
+ * The socket_connect hook reports every outbound connection of a tracked
+ * process. Here, in userspace and off the kernel hot path, the
+ * destination is checked against operator lists and the process's taint
+ * is escalated through the internal update path:
+ *
+ *   deny list hit                         -> raise to deny_taint
+ *   not on a non-empty allow list, while
+ *   taint >= unknown_min_taint            -> raise to unknown_taint
+ *
+ * List entries are IPs, CIDRs or hostnames. Hostnames are resolved when
+ * the policy is set and refreshed every egressRefreshInterval.
+ *
+ * SET_EGRESS_POLICY data:
+ *   {"allow": [...], "deny": [...], "deny_taint": 4,
+ *    "unknown_min_taint": 3, "unknown_taint": 4}
+ */
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	egressRefreshInterval = time.Minute
+	egressResolveTimeout  = 3 * time.Second
+)
+
+// EgressPolicy is the operator-facing policy document
+type EgressPolicy struct {
+	Allow           []string `json:"allow"`
+	Deny            []string `json:"deny"`
+	DenyTaint       uint32   `json:"deny_taint"`
+	UnknownMinTaint uint32   `json:"unknown_min_taint"`
+	UnknownTaint    uint32   `json:"unknown_taint"` // 0 disables unknown-destination escalation
+}
+
+// egressList is a compiled allow or deny list
+type egressList struct {
+	nets  []*net.IPNet
+	hosts map[string][]net.IP // hostname -> last resolved addresses
+}
+
+// egressState holds the active policy and its compiled lists
+type egressState struct {
+	mu     sync.RWMutex
+	policy EgressPolicy
+	allow  egressList
+	deny   egressList
+	gen    uint64 // bumped on every SET_EGRESS_POLICY
+}
+
+// compileEgressList parses entries into networks and hostnames
+func compileEgressList(entries []string) (egressList, error) {
+	list := egressList{hosts: make(map[string][]net.IP)}
+
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		switch {
+		case e == "":
+			return list, fmt.Errorf("empty egress entry")
+		case strings.Contains(e, "/"):
+			_, n, err := net.ParseCIDR(e)
+			if err != nil {
+				return list, fmt.Errorf("invalid CIDR %q", e)
+			}
+			list.nets = append(list.nets, n)
+		case net.ParseIP(e) != nil:
+			ip := net.ParseIP(e)
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			list.nets = append(list.nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+		default:
+			list.hosts[strings.ToLower(e)] = nil
+		}
+	}
+
+	return list, nil
+}
+
+// contains reports whether ip matches the list (and which entry)
+func (l *egressList) contains(ip net.IP) (string, bool) {
+	for _, n := range l.nets {
+		if n.Contains(ip) {
+			return n.String(), true
+		}
+	}
+	for host, addrs := range l.hosts {
+		for _, a := range addrs {
+			if a.Equal(ip) {
+				return host, true
+			}
+		}
+	}
+	return "", false
+}
+
+// resolve refreshes the addresses of every hostname in the list
+func (l *egressList) resolve() map[string][]net.IP {
+	resolved := make(map[string][]net.IP, len(l.hosts))
+	for host, old := range l.hosts {
+		ctx, cancel := context.WithTimeout(context.Background(), egressResolveTimeout)
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		cancel()
+		if err != nil {
+			log.Printf("Warning: egress: resolve %s: %v (keeping %d old addresses)", host, err, len(old))
+			resolved[host] = old
+			continue
+		}
+		ips := make([]net.IP, 0, len(addrs))
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+		resolved[host] = ips
+	}
+	return resolved
+}
+
+// checkEgress applies the egress policy to a connect event
+func (d *TelosDaemon) checkEgress(ev Event) {
+	d.egress.mu.RLock()
+	policy := d.egress.policy
+	denyHit, denied := d.egress.deny.contains(ev.DestIP)
+	_, allowed := d.egress.allow.contains(ev.DestIP)
+	allowListed := len(d.egress.allow.nets)+len(d.egress.allow.hosts) > 0
+	d.egress.mu.RUnlock()
+
+	dest := net.JoinHostPort(ev.DestIP.String(), fmt.Sprint(ev.DestPort))
+
+	var level uint32
+	var reason string
+	switch {
+	case denied && policy.DenyTaint > 0:
+		level = policy.DenyTaint
+		reason = fmt.Sprintf("egress to %s (deny: %s)", dest, denyHit)
+	case allowListed && !allowed && policy.UnknownTaint > 0 && ev.TaintLevel >= policy.UnknownMinTaint:
+		level = policy.UnknownTaint
+		reason = fmt.Sprintf("egress to unlisted %s at taint %d", dest, ev.TaintLevel)
+	default:
+		return
+	}
+
+	if _, err := d.raiseTaint(ev.PID, level, reason); err != nil {
+		log.Printf("Warning: egress escalation for PID %d failed: %v", ev.PID, err)
+	}
+}
+
+// refreshEgressHosts re-resolves policy hostnames until shutdown
+func (d *TelosDaemon) refreshEgressHosts() {
+	ticker := time.NewTicker(egressRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		}
+
+		// Resolve outside the lock; DNS can be slow
+		d.egress.mu.RLock()
+		allow, deny, gen := d.egress.allow, d.egress.deny, d.egress.gen
+		d.egress.mu.RUnlock()
+		if len(allow.hosts)+len(deny.hosts) == 0 {
+			continue
+		}
+
+		allowHosts, denyHosts := allow.resolve(), deny.resolve()
+
+		d.egress.mu.Lock()
+		if d.egress.gen == gen { // Policy not replaced meanwhile
+			d.egress.allow.hosts = allowHosts
+			d.egress.deny.hosts = denyHosts
+		}
+		d.egress.mu.Unlock()
+	}
+}
+
+// cmdSetEgressPolicy replaces the egress policy
+func (d *TelosDaemon) cmdSetEgressPolicy(data map[string]interface{}) IPCResponse {
+	if resp, ok := d.requireEvents("SET_EGRESS_POLICY"); !ok {
+		return resp
+	}
+	policy, err := parseEgressPolicy(data)
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	allow, deny, err := compileEgressPolicy(policy)
+	if err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+	d.installEgressPolicy(policy, allow, deny)
+	return d.cmdGetEgressPolicy()
+}
+
+// parseEgressPolicy reads SET_EGRESS_POLICY data; omitted levels default
+func parseEgressPolicy(data map[string]interface{}) (EgressPolicy, error) {
+	policy := EgressPolicy{
+		DenyTaint:       TaintCritical,
+		UnknownMinTaint: TaintHigh,
+	}
+
+	var err error
+	if policy.Allow, err = stringList(data, "allow"); err != nil {
+		return policy, err
+	}
+	if policy.Deny, err = stringList(data, "deny"); err != nil {
+		return policy, err
+	}
+	for field, dst := range map[string]*uint32{
+		"deny_taint":        &policy.DenyTaint,
+		"unknown_min_taint": &policy.UnknownMinTaint,
+		"unknown_taint":     &policy.UnknownTaint,
+	} {
+		if _, ok := data[field]; !ok {
+			continue
+		}
+		if *dst, err = levelArg(data, field); err != nil {
+			return policy, err
+		}
+	}
+	return policy, nil
+}
+
+// compileEgressPolicy compiles both lists and resolves their hostnames
+func compileEgressPolicy(policy EgressPolicy) (allow, deny egressList, err error) {
+	if allow, err = compileEgressList(policy.Allow); err != nil {
+		return allow, deny, fmt.Errorf("allow: %w", err)
+	}
+	if deny, err = compileEgressList(policy.Deny); err != nil {
+		return allow, deny, fmt.Errorf("deny: %w", err)
+	}
+	allow.hosts = allow.resolve()
+	deny.hosts = deny.resolve()
+	return allow, deny, nil
+}
+
+// installEgressPolicy makes a compiled policy the active one
+func (d *TelosDaemon) installEgressPolicy(policy EgressPolicy, allow, deny egressList) {
+	d.egress.mu.Lock()
+	d.egress.policy = policy
+	d.egress.allow = allow
+	d.egress.deny = deny
+	d.egress.gen++
+	d.egress.mu.Unlock()
+
+	log.Printf("[EGRESS] Policy set: %d allow, %d deny entries", len(policy.Allow), len(policy.Deny))
+}
+
+// cmdGetEgressPolicy returns the active policy and resolved hostnames
+func (d *TelosDaemon) cmdGetEgressPolicy() IPCResponse {
+	d.egress.mu.RLock()
+	defer d.egress.mu.RUnlock()
+
+	resolved := make(map[string][]string)
+	for _, l := range []egressList{d.egress.allow, d.egress.deny} {
+		for host, ips := range l.hosts {
+			for _, ip := range ips {
+				resolved[host] = append(resolved[host], ip.String())
+			}
+		}
+	}
+
+	return IPCResponse{Success: true, Data: map[string]interface{}{
+		"policy":   d.egress.policy,
+		"resolved": resolved,
+	}}
+}
@@ -0,0 +1,239 @@
+/*
+ * Telos Core - Event Reader
+ *
+ * Drains the `events` ringbuf written by the LSM hooks, decodes each
+ * record and hands it to the configured event sink (if any).
+ *
+ * Every reported event says why: "reason" is the kernel's reason code
+ * and "explanation" spells it out with the values the hook compared,
+ * e.g. "exec denied: taint HIGH > max_exec MEDIUM". "denied" is set only
+ * when the operation actually failed; a blocked event without it was let
+ * through by audit mode or --mode off.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/cilium/ebpf/ringbuf"
+)
+
+// rawEvent matches the BPF struct event_t
+type rawEvent struct {
+	PID         uint32
+	TaintLevel  uint32
+	Blocked     uint32
+	Comm        [16]byte
+	Action      [16]byte
+	_           [4]byte // padding before the 8-byte aligned cgroup_id
+	CgroupID    uint64
+	Family      uint16   // AF_INET/AF_INET6 on "connect" events
+	DPort       uint16   // network byte order
+	DAddr       [16]byte // IPv4 in the first 4 bytes
+	Quarantined uint32
+	Inode       uint64 // opened file on "open" events
+	Reason      uint32 // reason* below
+	MaxTaint    uint8  // the hook's threshold at the time
+	Denied      uint8  // the operation failed with -EPERM
+	_           [2]byte
+}
+
+// Event reasons (must match REASON_* in bpf_lsm.c)
+const (
+	reasonNone       = 0 // allowed, reported for shadow mode or egress
+	reasonThreshold  = 1
+	reasonQuarantine = 2
+)
+
+var reasonNames = map[uint32]string{
+	reasonThreshold:  "threshold",
+	reasonQuarantine: "quarantine",
+}
+
+// hookThresholds names the config threshold each action is checked against
+var hookThresholds = map[string]struct{ hook, max string }{
+	"execve":  {"exec", "max_exec"},
+	"open":    {"open", "max_open"},
+	"connect": {"connect", "max_connect"},
+	"ptrace":  {"ptrace", "max_ptrace"},
+}
+
+// explainEvent renders why the kernel reported a denial ("" if allowed)
+func explainEvent(action string, reason, taint, maxTaint uint32, denied bool) string {
+	names, ok := hookThresholds[action]
+	if !ok {
+		names.hook, names.max = action, "max_taint"
+	}
+	verdict := "denied"
+	if !denied {
+		verdict = "would be denied (not enforcing)"
+	}
+	switch reason {
+	case reasonThreshold:
+		return fmt.Sprintf("%s %s: taint %s > %s %s", names.hook, verdict,
+			taintLevelName(taint), names.max, taintLevelName(maxTaint))
+	case reasonQuarantine:
+		return fmt.Sprintf("%s %s: process quarantined", names.hook, verdict)
+	}
+	return ""
+}
+
+// Address families as reported by the kernel
+const (
+	afInet  = 2
+	afInet6 = 10
+)
+
+// Event is a decoded kernel event as exported to sinks
+type Event struct {
+	Time        time.Time `json:"time"`
+	PID         uint32    `json:"pid"`
+	TaintLevel  uint32    `json:"taint_level"`
+	Blocked     bool      `json:"blocked"`
+	Comm        string    `json:"comm"`
+	Action      string    `json:"action"`
+	CgroupID    uint64    `json:"cgroup_id,omitempty"`
+	Container   string    `json:"container,omitempty"`
+	DestIP      net.IP    `json:"dest_ip,omitempty"`
+	DestPort    uint16    `json:"dest_port,omitempty"`
+	Quarantined bool      `json:"quarantined,omitempty"`
+	Inode       uint64    `json:"inode,omitempty"`
+	Denied      bool      `json:"denied,omitempty"`
+	Reason      string    `json:"reason,omitempty"`
+	Explanation string    `json:"explanation,omitempty"`
+	Count       uint32    `json:"count,omitempty"` // flushed by dedup: identical events this one stands for
+}
+
+// decodeEvent parses a raw ringbuf sample
+func decodeEvent(sample []byte) (Event, error) {
+	// Size was verified against BTF at load; anything else is corrupt
+	if len(sample) != rawEventSize {
+		return Event{}, fmt.Errorf("decode event: %d bytes, want %d", len(sample), rawEventSize)
+	}
+
+	var raw rawEvent
+	if err := binary.Read(bytes.NewReader(sample), binary.LittleEndian, &raw); err != nil {
+		return Event{}, fmt.Errorf("decode event (%d bytes): %w", len(sample), err)
+	}
+
+	ev := Event{
+		Time:        time.Now(),
+		PID:         raw.PID,
+		TaintLevel:  raw.TaintLevel,
+		Blocked:     raw.Blocked != 0,
+		Comm:        commString(raw.Comm),
+		Action:      commString(raw.Action),
+		CgroupID:    raw.CgroupID,
+		Container:   cgroups.Name(raw.CgroupID, raw.PID),
+		Quarantined: raw.Quarantined != 0,
+		Inode:       raw.Inode,
+		Denied:      raw.Denied != 0,
+		Reason:      reasonNames[raw.Reason],
+	}
+	ev.Explanation = explainEvent(ev.Action, raw.Reason, raw.TaintLevel, uint32(raw.MaxTaint), ev.Denied)
+
+	switch raw.Family {
+	case afInet:
+		ev.DestIP = net.IP(append([]byte(nil), raw.DAddr[:4]...))
+	case afInet6:
+		ev.DestIP = net.IP(append([]byte(nil), raw.DAddr[:]...))
+	}
+	if ev.DestIP != nil {
+		ev.DestPort = raw.DPort>>8 | raw.DPort<<8 // ntohs
+	}
+
+	return ev, nil
+}
+
+// eventsAvailable reports whether the loaded object has an events ringbuf
+func (d *TelosDaemon) eventsAvailable() bool {
+	return d.maps != nil && d.maps.Events != nil
+}
+
+// requireEvents refuses commands that only work on a stream of events
+func (d *TelosDaemon) requireEvents(command string) (IPCResponse, bool) {
+	if d.eventsAvailable() {
+		return IPCResponse{}, true
+	}
+	return errorResponse(ErrUnsupported, "%s needs the events map, which %s does not define", command, d.bpfObjPath), false
+}
+
+// startEventReader opens the events ringbuf and starts draining it
+func (d *TelosDaemon) startEventReader() error {
+	rd, err := ringbuf.NewReader(d.maps.Events)
+	if err != nil {
+		return err
+	}
+	d.eventReader = rd
+
+	d.readerRunning.Store(true)
+	go d.readEvents()
+	return nil
+}
+
+// readEvents loops until the ringbuf reader is closed by Stop()
+func (d *TelosDaemon) readEvents() {
+	defer d.readerRunning.Store(false)
+
+	for {
+		rec, err := d.eventReader.Read()
+		if err != nil {
+			if errors.Is(err, ringbuf.ErrClosed) {
+				return
+			}
+			log.Printf("Event read error: %v", err)
+			continue
+		}
+
+		ev, err := decodeEvent(rec.RawSample)
+		if err != nil {
+			metrics.EventDecodeErrors.Add(1)
+			log.Printf("Warning: %v", err)
+			continue
+		}
+		metrics.EventsRead.Add(1)
+		d.lastEventAt.Store(ev.Time.UnixNano())
+		if ev.Action == binaryAction {
+			d.offerBinary(ev)
+			continue
+		}
+		recordDecision(ev)
+
+		// Policy consumers see every event; dedup only thins the output
+		if ev.DestIP != nil {
+			d.checkEgress(ev)
+		}
+		d.observeShadow(ev)
+
+		if d.dedup == nil || d.dedup.Offer(ev) {
+			d.emitEvent(ev)
+		}
+	}
+}
+
+// emitEvent logs ev and hands it to subscribers and forwarders
+func (d *TelosDaemon) emitEvent(ev Event) {
+	repeat := ""
+	if ev.Count > 1 {
+		repeat = fmt.Sprintf(" x%d", ev.Count)
+	}
+	if ev.Quarantined {
+		log.Printf("[EVENT] %s blocked for PID %d (%s, quarantined)%s",
+			ev.Action, ev.PID, ev.Comm, repeat)
+	} else if ev.Blocked {
+		log.Printf("[EVENT] %s blocked for PID %d (%s, taint %d)%s",
+			ev.Action, ev.PID, ev.Comm, ev.TaintLevel, repeat)
+	}
+
+	d.hub.Publish(ev)
+	for _, f := range d.forwarders {
+		f.Enqueue(ev)
+	}
+}
@@ -0,0 +1,383 @@
+/*
+ * Telos Core - Self Exemption
+ *
+ * If the daemon or its supervisor ever ended up tainted (say, through
+ * an inherited entry), the hooks could block the very processes needed
+ * to undo it. With --self-exempt (default on) the daemon writes its own
+ * PID and its parent's (the supervisor) into exempt_map, which all
+ * enforcing hooks honor before anything else. Ancestors further up are
+ * not exempt: started from a terminal, they would be the user's shell,
+ * sudo and sshd. The parent is re-read periodically so a restarted or
+ * changed supervisor is picked up; like an allowlisted process, it is
+ * not exempt while it has a tainted process_map entry. The daemon
+ * itself always is.
+ *
+ * The same map carries a default allowlist, so an overly aggressive
+ * policy can never block what it takes to get back into the machine:
+ * PID 1 (init/systemd) and every process whose comm is in
+ * defaultAllowlistComms (sshd, getty, login, ...) or --allowlist-comms
+ * is exempt, re-scanned from /proc on the same schedule so new sshd
+ * sessions are covered. Each PID is logged as it is exempted.
+ * --no-default-allowlist leaves only the daemon, its supervisor and
+ * --allowlist-comms.
+ *
+ * Any process can rename itself (prctl(PR_SET_NAME, "sshd")), so a comm
+ * match alone exempts nothing: the process's executable, read from
+ * /proc/<pid>/exe, must be named after the comm, live in one of
+ * allowlistBinaryDirs and be a root-owned file nobody else can write.
+ * A PID with a tainted process_map entry is never exempted, and loses
+ * its exemption at the next refresh once tainted. Refused matches are
+ * logged once per PID.
+ *
+ * With --register-self the daemon also puts its own PID in process_map,
+ * CLEAN, under a recognizable comm (--self-comm, "telos_daemon"), so
+ * dashboards watching the map can see it is there. Entries left under
+ * that comm by a previous run (reattached pinned map) are removed at
+ * startup, and the daemon's own entry is removed on shutdown.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/cilium/ebpf"
+)
+
+const (
+	exemptRefreshInterval = 10 * time.Second // how often the supervisor and allowlist are re-read
+	defaultSelfComm       = "telos_daemon"
+)
+
+// defaultAllowlistComms are the processes needed to log in and recover
+// a host
+var defaultAllowlistComms = []string{
+	"systemd", "init", "sshd", "sshd-session", "systemd-logind", "agetty", "getty", "login",
+}
+
+// allowlistBinaryDirs are the directories an allowlisted process's
+// executable may live in
+var allowlistBinaryDirs = []string{
+	"/usr/sbin", "/usr/bin", "/sbin", "/bin",
+	"/usr/lib/systemd", "/lib/systemd",
+	"/usr/lib/openssh", "/usr/libexec/openssh", "/usr/lib/ssh", "/usr/libexec",
+}
+
+// allowlistComms is the set of comms whose processes are exempt
+func (d *TelosDaemon) allowlistComms() map[string]bool {
+	comms := make(map[string]bool)
+	if d.opts.DefaultAllowlist {
+		for _, c := range defaultAllowlistComms {
+			comms[c] = true
+		}
+	}
+	for _, c := range d.opts.AllowlistComms {
+		comms[c] = true
+	}
+	return comms
+}
+
+// allowlistSummary describes what the allowlist covers, for the log
+func (d *TelosDaemon) allowlistSummary() string {
+	names := make([]string, 0, len(d.allowlistComms()))
+	for c := range d.allowlistComms() {
+		names = append(names, c)
+	}
+	sort.Strings(names)
+	if d.opts.DefaultAllowlist {
+		names = append([]string{"PID 1"}, names...)
+	}
+	return strings.Join(names, ", ")
+}
+
+// parseAllowlistComms parses --allowlist-comms
+func parseAllowlistComms(list string) ([]string, error) {
+	var comms []string
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s == "" {
+			continue
+		}
+		if len(s) > maxCommLen || !utf8.ValidString(s) {
+			return nil, fmt.Errorf("invalid comm %q (1-%d bytes of valid UTF-8, as in /proc/<pid>/comm)", s, maxCommLen)
+		}
+		comms = append(comms, s)
+	}
+	return comms, nil
+}
+
+// allowlistedPIDs returns the live processes the allowlist covers, with
+// why each is on it, and adds the matches it turned down to refused
+func (d *TelosDaemon) allowlistedPIDs(refused map[uint32]string) (map[uint32]string, error) {
+	found := make(map[uint32]string)
+	comms := d.allowlistComms()
+	if len(comms) == 0 {
+		return found, nil
+	}
+	if d.opts.DefaultAllowlist {
+		found[1] = "init"
+	}
+	pids, err := listPIDs()
+	if err != nil {
+		return nil, err
+	}
+	for _, pid := range pids {
+		st, err := readProcStat(pid)
+		if err != nil || !comms[st.Comm] {
+			continue
+		}
+		if err := verifyAllowlistExe(pid, st.Comm); err != nil {
+			refused[pid] = fmt.Sprintf("comm %q but %v", st.Comm, err)
+			continue
+		}
+		found[pid] = "allowlist: " + st.Comm
+	}
+
+	for pid := range found {
+		if why, tainted := d.taintedForExemption(pid); tainted {
+			refused[pid] = why
+			delete(found, pid)
+		}
+	}
+	return found, nil
+}
+
+// taintedForExemption reports why pid must not be exempt because of its
+// process_map entry, if it must not
+func (d *TelosDaemon) taintedForExemption(pid uint32) (string, bool) {
+	info, tracked, err := d.trackedEntry(pid)
+	switch {
+	case err != nil:
+		return fmt.Sprintf("process_map lookup failed: %v", err), true
+	case tracked && info.TaintLevel > TaintClean:
+		return "tainted " + taintLevelName(info.TaintLevel), true
+	}
+	return "", false
+}
+
+// verifyAllowlistExe checks that pid runs the real program its comm
+// names: an executable of that name in allowlistBinaryDirs, owned by
+// root and writable by no one else
+func verifyAllowlistExe(pid uint32, comm string) error {
+	link := fmt.Sprintf("/proc/%d/exe", pid)
+	exe, err := os.Readlink(link)
+	if err != nil {
+		return fmt.Errorf("executable unreadable: %w", err)
+	}
+	// Still running a binary a package upgrade replaced
+	exe = strings.TrimSuffix(exe, " (deleted)")
+
+	dir, name := filepath.Dir(exe), filepath.Base(exe)
+	if name != comm && !(len(comm) == maxCommLen && strings.HasPrefix(name, comm)) {
+		return fmt.Errorf("executable %s is not %s", exe, comm)
+	}
+	trusted := false
+	for _, bin := range allowlistBinaryDirs {
+		if dir == bin {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return fmt.Errorf("executable %s is outside the system binary directories", exe)
+	}
+
+	// Stat through the link: the inode actually running, not whatever
+	// the path names now
+	var st syscall.Stat_t
+	if err := syscall.Stat(link, &st); err != nil {
+		return fmt.Errorf("stat executable: %w", err)
+	}
+	if st.Uid != 0 || st.Mode&022 != 0 {
+		return fmt.Errorf("executable %s is not root-owned and write-protected (uid %d, mode %o)", exe, st.Uid, st.Mode&07777)
+	}
+	return nil
+}
+
+// supervisorPID returns the daemon's parent (0 if unknown)
+func supervisorPID() uint32 {
+	st, err := readProcStat(uint32(os.Getpid()))
+	if err != nil {
+		return 0
+	}
+	return st.PPID
+}
+
+// refreshExemptions makes exempt_map hold exactly the daemon, its
+// supervisor and the allowlisted processes
+func (d *TelosDaemon) refreshExemptions() error {
+	refused := make(map[uint32]string)
+	allowed, err := d.allowlistedPIDs(refused)
+	if err != nil {
+		return err
+	}
+	self := make(map[uint32]bool)
+	if d.opts.SelfExempt {
+		own := uint32(os.Getpid())
+		self[own] = true
+		delete(allowed, own)
+		if ppid := supervisorPID(); ppid != 0 {
+			delete(allowed, ppid)
+			if why, tainted := d.taintedForExemption(ppid); tainted {
+				refused[ppid] = "supervisor " + why
+			} else {
+				self[ppid] = true
+			}
+		}
+	}
+	for pid, why := range refused {
+		if d.exemptRefused[pid] != why {
+			log.Printf("[EXEMPT] PID %d not exempt: %s", pid, why)
+		}
+	}
+	d.exemptRefused = refused
+	want := make(map[uint32]bool, len(self)+len(allowed))
+	for pid := range self {
+		want[pid] = true
+	}
+	for pid := range allowed {
+		want[pid] = true
+	}
+
+	var stale []uint32
+	var pid, one uint32
+	iter := d.maps.Exempt.Iterate()
+	for iter.Next(&pid, &one) {
+		if !want[pid] {
+			stale = append(stale, pid)
+		}
+		delete(want, pid)
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+
+	for _, pid := range stale {
+		if err := d.maps.Exempt.Delete(pid); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return err
+		}
+		log.Printf("[EXEMPT] PID %d no longer the supervisor or allowlisted, exemption removed", pid)
+	}
+
+	// Daemon and supervisor first: an allowlist too big for the map must not crowd them out
+	for pid := range want {
+		if !self[pid] {
+			continue
+		}
+		if err := d.maps.Exempt.Put(pid, uint32(1)); err != nil {
+			return err
+		}
+		log.Printf("[EXEMPT] PID %d exempt from enforcement", pid)
+	}
+	dropped := 0
+	for pid := range want {
+		if self[pid] {
+			continue
+		}
+		if err := d.maps.Exempt.Put(pid, uint32(1)); err != nil {
+			dropped++
+			continue
+		}
+		log.Printf("[EXEMPT] PID %d exempt from enforcement (%s)", pid, allowed[pid])
+	}
+	if dropped > 0 && dropped != d.exemptDropped {
+		log.Printf("Warning: exempt_map full (%d entries), %d allowlisted processes not exempt",
+			d.maps.Exempt.MaxEntries(), dropped)
+	}
+	d.exemptDropped = dropped
+	return nil
+}
+
+// exemptPIDs returns the PIDs currently in exempt_map (empty if the
+// object has none or it can't be read)
+func (d *TelosDaemon) exemptPIDs() map[uint32]bool {
+	pids := make(map[uint32]bool)
+	if d.maps == nil || d.maps.Exempt == nil {
+		return pids
+	}
+	var pid, one uint32
+	iter := d.maps.Exempt.Iterate()
+	for iter.Next(&pid, &one) {
+		pids[pid] = true
+	}
+	if err := iter.Err(); err != nil {
+		log.Printf("Warning: read exempt_map: %v", err)
+	}
+	return pids
+}
+
+// runExemptions keeps exempt_map current until the daemon stops
+func (d *TelosDaemon) runExemptions() {
+	ticker := time.NewTicker(exemptRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := d.refreshExemptions(); err != nil {
+				log.Printf("Warning: refresh exemptions: %v", err)
+			}
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// registerSelf writes the daemon's own CLEAN entry, dropping entries a
+// previous run left under the same comm
+func (d *TelosDaemon) registerSelf() error {
+	self := uint32(os.Getpid())
+	comm := commBytes(d.opts.SelfComm)
+
+	snapshot, err := d.snapshotProcesses()
+	if err != nil {
+		return err
+	}
+
+	d.mapMu.Lock()
+	defer d.mapMu.Unlock()
+
+	for _, e := range snapshot {
+		if e.PID == self || e.Info.Comm != comm {
+			continue
+		}
+		// Still alive under that comm: another daemon's entry, not stale
+		if st, err := readProcStat(e.PID); err == nil && d.commMatches(st.Comm, d.opts.SelfComm) {
+			continue
+		}
+		if err := d.maps.ProcessMap.Delete(e.PID); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return err
+		}
+		d.forget(e.PID)
+		log.Printf("[EXEMPT] Removed stale self entry PID %d (%s)", e.PID, d.opts.SelfComm)
+	}
+
+	info := ProcessInfo{PID: self, TaintLevel: TaintClean, Comm: comm}
+	if err := d.maps.ProcessMap.Put(self, info); err != nil {
+		return err
+	}
+	d.touch(self)
+	return nil
+}
+
+// unregisterSelf removes the daemon's own entry
+func (d *TelosDaemon) unregisterSelf() {
+	self := uint32(os.Getpid())
+
+	d.mapMu.Lock()
+	defer d.mapMu.Unlock()
+
+	if err := d.maps.ProcessMap.Delete(self); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		log.Printf("Warning: remove self entry: %v", err)
+		return
+	}
+	d.forget(self)
+}
@@ -0,0 +1,357 @@
+/*
+ * Telos Core - Cgroup Freezer
+ *
+ * FREEZE_PID stops a process and everything it spawned, so a compromise
+ * spread over several processes is contained at once. Two modes:
+ *
+ *   subtree (default)  move the PID and its descendants into a dedicated
+ *                      quarantine cgroup and freeze that; unrelated
+ *                      processes sharing the original cgroup keep running
+ *   cgroup             freeze the PID's existing cgroup as a whole
+ *                      (e.g. its entire container)
+ *
+ * Works on cgroup v2 (cgroup.freeze) and on v1 (freezer controller,
+ * freezer.state). THAW_PID, or CLEAR_TAINT on a frozen PID, undoes it and
+ * moves quarantined processes back to their original cgroups.
+ *
+ * A frozen daemon could never serve the THAW, so the daemon itself and
+ * every exempt_map PID (its supervisor, the recovery allowlist)
+ * are never frozen: they can't be the target, a subtree sweep leaves
+ * them where they are, and cgroup mode is refused for a cgroup that
+ * holds any of them.
+ */
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+const (
+	cgroup2Magic      = 0x63677270 // CGROUP2_SUPER_MAGIC
+	cgroupV1Freezer   = "/sys/fs/cgroup/freezer"
+	quarantineCgroup  = "telos-quarantine"
+	freezeModeSubtree = "subtree"
+	freezeModeCgroup  = "cgroup"
+)
+
+// frozenEntry records how a PID was frozen so it can be undone
+type frozenEntry struct {
+	Mode    string            `json:"mode"`
+	Cgroup  string            `json:"cgroup"` // absolute dir that was frozen
+	Origins map[uint32]string `json:"-"`      // subtree: PID -> original cgroup dir
+	Origin  string            `json:"-"`      // subtree: root PID's original cgroup dir
+	PIDs    int               `json:"pids"`
+}
+
+// freezerState tracks frozen PIDs
+type freezerState struct {
+	mu     sync.Mutex
+	frozen map[uint32]*frozenEntry
+}
+
+// cgroupVersion reports 2 for the unified hierarchy, 1 for legacy
+func cgroupVersion() int {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(cgroupRoot, &st); err == nil && uint32(st.Type) == cgroup2Magic {
+		return 2
+	}
+	return 1
+}
+
+// freezerBase is the hierarchy root holding the freezer for this version
+func freezerBase(version int) string {
+	if version == 2 {
+		return cgroupRoot
+	}
+	return cgroupV1Freezer
+}
+
+// setFrozen freezes or thaws the cgroup directory dir
+func setFrozen(version int, dir string, frozen bool) error {
+	if version == 2 {
+		val := "0"
+		if frozen {
+			val = "1"
+		}
+		return os.WriteFile(filepath.Join(dir, "cgroup.freeze"), []byte(val), 0)
+	}
+
+	val := "THAWED"
+	if frozen {
+		val = "FROZEN"
+	}
+	return os.WriteFile(filepath.Join(dir, "freezer.state"), []byte(val), 0)
+}
+
+// freezerCgroupDir returns the absolute cgroup dir of pid in the freezer hierarchy
+func freezerCgroupDir(version int, pid uint32) (string, error) {
+	f, err := os.Open("/proc/" + strconv.FormatUint(uint64(pid), 10) + "/cgroup")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// "hierarchy-ID:controller-list:path"
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if version == 2 && parts[0] == "0" && parts[1] == "" {
+			return filepath.Join(cgroupRoot, parts[2]), nil
+		}
+		if version == 1 {
+			for _, c := range strings.Split(parts[1], ",") {
+				if c == "freezer" {
+					return filepath.Join(cgroupV1Freezer, parts[2]), nil
+				}
+			}
+		}
+	}
+	return "", fmt.Errorf("no freezer cgroup for PID %d", pid)
+}
+
+// cgroupContains reports whether other is the cgroup dir itself or below it
+func cgroupContains(dir, other string) bool {
+	rel, err := filepath.Rel(dir, other)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// moveToCgroup moves pid (whole thread group) into dir
+func moveToCgroup(dir string, pid uint32) error {
+	return os.WriteFile(filepath.Join(dir, "cgroup.procs"),
+		[]byte(strconv.FormatUint(uint64(pid), 10)), 0)
+}
+
+// freezePID freezes pid according to mode
+func (d *TelosDaemon) freezePID(pid uint32, mode string) (*frozenEntry, error) {
+	d.freezer.mu.Lock()
+	defer d.freezer.mu.Unlock()
+
+	if e, ok := d.freezer.frozen[pid]; ok {
+		return e, nil
+	}
+	if !pidExists(pid) {
+		return nil, fmt.Errorf("PID %d does not exist", pid)
+	}
+
+	self := uint32(os.Getpid())
+	spared := d.exemptPIDs()
+	spared[self] = true
+	if spared[pid] {
+		return nil, fmt.Errorf("PID %d is the daemon or exempt from enforcement; not freezing it", pid)
+	}
+
+	version := cgroupVersion()
+	entry := &frozenEntry{Mode: mode}
+
+	switch mode {
+	case freezeModeCgroup:
+		dir, err := freezerCgroupDir(version, pid)
+		if err != nil {
+			return nil, err
+		}
+		selfDir, err := freezerCgroupDir(version, self)
+		if err != nil {
+			return nil, fmt.Errorf("cannot tell whether %s holds the daemon: %w", dir, err)
+		}
+		if cgroupContains(dir, selfDir) {
+			return nil, fmt.Errorf("%s holds the daemon (%s); use mode %s", dir, selfDir, freezeModeSubtree)
+		}
+		for p := range spared {
+			pDir, err := freezerCgroupDir(version, p)
+			if err != nil {
+				continue // Exited meanwhile
+			}
+			if cgroupContains(dir, pDir) {
+				return nil, fmt.Errorf("%s holds exempt PID %d (%s); use mode %s", dir, p, pDir, freezeModeSubtree)
+			}
+		}
+		if err := setFrozen(version, dir, true); err != nil {
+			return nil, err
+		}
+		entry.Cgroup = dir
+		entry.PIDs = 1
+
+	case freezeModeSubtree:
+		dir := filepath.Join(freezerBase(version), quarantineCgroup, strconv.FormatUint(uint64(pid), 10))
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		entry.Cgroup = dir
+		entry.Origins = make(map[uint32]string)
+
+		// Move the root first so anything it forks from now on is born
+		// inside the quarantine cgroup, then sweep existing descendants.
+		tree, err := descendants(pid)
+		if err != nil {
+			os.Remove(dir)
+			return nil, err
+		}
+		for _, p := range tree {
+			if spared[p] {
+				log.Printf("[FREEZE] Leaving PID %d (daemon or exempt) out of PID %d's quarantine", p, pid)
+				continue
+			}
+			origin, err := freezerCgroupDir(version, p)
+			if err != nil {
+				continue // Exited meanwhile
+			}
+			if err := moveToCgroup(dir, p); err != nil {
+				if p == pid {
+					os.Remove(dir)
+					return nil, fmt.Errorf("move PID %d to quarantine: %w", p, err)
+				}
+				log.Printf("Warning: freeze: could not move PID %d: %v", p, err)
+				continue
+			}
+			entry.Origins[p] = origin
+			if p == pid {
+				entry.Origin = origin
+			}
+		}
+
+		if err := setFrozen(version, dir, true); err != nil {
+			d.restoreOrigins(entry)
+			os.Remove(dir)
+			return nil, err
+		}
+		entry.PIDs = len(entry.Origins)
+
+	default:
+		return nil, fmt.Errorf("unknown freeze mode %q (want %s or %s)", mode, freezeModeSubtree, freezeModeCgroup)
+	}
+
+	d.freezer.frozen[pid] = entry
+	log.Printf("[FREEZE] PID %d frozen (%s, cgroup v%d, %s, %d processes)",
+		pid, mode, version, entry.Cgroup, entry.PIDs)
+	return entry, nil
+}
+
+// thawPID undoes freezePID; it reports whether pid was frozen
+func (d *TelosDaemon) thawPID(pid uint32) (bool, error) {
+	d.freezer.mu.Lock()
+	defer d.freezer.mu.Unlock()
+
+	entry, ok := d.freezer.frozen[pid]
+	if !ok {
+		return false, nil
+	}
+
+	version := cgroupVersion()
+	if err := setFrozen(version, entry.Cgroup, false); err != nil && !os.IsNotExist(err) {
+		return true, err
+	}
+
+	if entry.Mode == freezeModeSubtree {
+		d.restoreOrigins(entry)
+		// Fails harmlessly if something we didn't track is still inside
+		if err := os.Remove(entry.Cgroup); err != nil && !os.IsNotExist(err) {
+			log.Printf("Warning: thaw: quarantine cgroup %s not removed: %v", entry.Cgroup, err)
+		}
+	}
+
+	delete(d.freezer.frozen, pid)
+	log.Printf("[THAW] PID %d thawed", pid)
+	return true, nil
+}
+
+// restoreOrigins moves quarantined processes back where they came from.
+// Processes born inside the quarantine go to the root PID's origin.
+func (d *TelosDaemon) restoreOrigins(entry *frozenEntry) {
+	raw, err := os.ReadFile(filepath.Join(entry.Cgroup, "cgroup.procs"))
+	if err != nil {
+		return
+	}
+
+	fallback := entry.Origin
+	if fallback == "" {
+		fallback = filepath.Dir(filepath.Dir(entry.Cgroup)) // hierarchy root
+	}
+
+	for _, field := range strings.Fields(string(raw)) {
+		p, err := strconv.ParseUint(field, 10, 32)
+		if err != nil {
+			continue
+		}
+		origin, ok := entry.Origins[uint32(p)]
+		if !ok {
+			origin = fallback
+		}
+		if err := moveToCgroup(origin, uint32(p)); err != nil {
+			log.Printf("Warning: thaw: could not move PID %d back to %s: %v", p, origin, err)
+		}
+	}
+}
+
+// cmdFreezePID handles FREEZE_PID ({pid, mode?})
+func (d *TelosDaemon) cmdFreezePID(data map[string]interface{}) IPCResponse {
+	pid, _, err := processArg(data)
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+
+	mode, err := stringArg(data, "mode")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	if mode == "" {
+		mode = freezeModeSubtree
+	}
+
+	entry, err := d.freezePID(pid, mode)
+	if err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+
+	return IPCResponse{Success: true, Data: map[string]interface{}{
+		"pid":            pid,
+		"mode":           entry.Mode,
+		"cgroup":         entry.Cgroup,
+		"pids":           entry.PIDs,
+		"cgroup_version": cgroupVersion(),
+	}}
+}
+
+// cmdThawPID handles THAW_PID ({pid})
+func (d *TelosDaemon) cmdThawPID(data map[string]interface{}) IPCResponse {
+	pid, _, err := processArg(data)
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+
+	wasFrozen, err := d.thawPID(pid)
+	if err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+	if !wasFrozen {
+		return IPCResponse{Success: false, Error: fmt.Sprintf("PID %d is not frozen", pid)}
+	}
+	return IPCResponse{Success: true}
+}
+
+// cmdListFrozen handles LIST_FROZEN
+func (d *TelosDaemon) cmdListFrozen() IPCResponse {
+	d.freezer.mu.Lock()
+	defer d.freezer.mu.Unlock()
+
+	frozen := make(map[uint32]*frozenEntry, len(d.freezer.frozen))
+	for pid, e := range d.freezer.frozen {
+		frozen[pid] = e
+	}
+
+	return IPCResponse{Success: true, Data: map[string]interface{}{
+		"cgroup_version": cgroupVersion(),
+		"frozen":         frozen,
+	}}
+}
@@ -0,0 +1,113 @@
+/*
+ * Telos Core - File Helpers
+ *
+ * Shared helpers for commands that read or write operator-supplied paths.
+ * Every such path is untrusted input coming over the socket, so:
+ *   - paths must be absolute
+ *   - symlinks are rejected (no redirecting a root-owned write elsewhere)
+ *   - writes go to a temp file in the same directory and are renamed into
+ *     place, so readers never observe a half-written file
+ */
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// checkUserPath validates a path supplied by a socket client
+func checkUserPath(path string) error {
+	if path == "" {
+		return fmt.Errorf("missing path")
+	}
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("path must be absolute: %s", path)
+	}
+
+	fi, err := os.Lstat(path)
+	if err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("refusing to follow symlink: %s", path)
+	}
+
+	return nil
+}
+
+// writeFileAtomic writes data to path via temp file + rename
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	if err := checkUserPath(path); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	// Remove the temp file on any failure path
+	ok := false
+	defer func() {
+		if !ok {
+			tmp.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	ok = true
+	return nil
+}
+
+// openFileNoFollow opens a regular file for reading, refusing symlinks
+func openFileNoFollow(path string) (*os.File, error) {
+	if err := checkUserPath(path); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		f.Close()
+		return nil, fmt.Errorf("not a regular file: %s", path)
+	}
+
+	return f, nil
+}
+
+// readFileNoFollow reads a regular file, refusing symlinks
+func readFileNoFollow(path string) ([]byte, error) {
+	f, err := openFileNoFollow(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return io.ReadAll(f)
+}
@@ -0,0 +1,332 @@
+/*
+ * Telos Core - Full Policy Document
+ *
+ * GET_FULL_POLICY assembles everything the daemon enforces into one
+ * document that can be reviewed in version control and applied
+ * elsewhere with SET_FULL_POLICY:
+ *
+ *   {"version": 1,
+ *    "config": {"mode":"enforce", "max_taint_for_exec":"MEDIUM", ...,
+ *               "exec_taint":"preserve", "default_taint_untracked":"CLEAN"},
+ *    "path_policy": {"/usr/bin/sandbox-launch":"clear"},
+ *    "egress": {"allow":[...], "deny":[...], "deny_taint":"CRITICAL", ...}}
+ *
+ *   {"command":"GET_FULL_POLICY"}  -> {"policy":{...}, "panic_mode":false}
+ *   {"command":"SET_FULL_POLICY","data":{"policy":{...},"validate_only":true}}
+ *
+ * "config" is the global config (key 0) with SET_CONFIG's fields;
+ * "path_policy" is every SET_PATH_POLICY override; "egress" is the
+ * SET_EGRESS_POLICY document. Sections the loaded BPF object can't
+ * enforce are left out. Per-level actions, UID or comm overrides and
+ * profiles don't exist in this daemon, so the document has no place for
+ * them; unknown fields are rejected rather than ignored.
+ *
+ * SET_FULL_POLICY replaces each section it is given in full (an override
+ * missing from path_policy is removed) and leaves absent sections alone.
+ * The whole document is validated before anything changes; with
+ * validate_only nothing else happens. If a map write fails midway the
+ * config is put back. It is refused during PANIC_MODE, and files in
+ * --policy-dir win again the next time they change.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// fullPolicyVersion is the document format version
+const fullPolicyVersion = 1
+
+// fullPolicySections are the document's top-level fields
+var fullPolicySections = map[string]bool{
+	"version":     true,
+	"config":      true,
+	"path_policy": true,
+	"egress":      true,
+}
+
+// fullPolicyConfigFields are the fields of the "config" section
+var fullPolicyConfigFields = map[string]bool{
+	"mode":                    true,
+	"exec_taint":              true,
+	"default_taint_untracked": true,
+}
+
+// fullPolicyEgressFields are the fields of the "egress" section
+var fullPolicyEgressFields = map[string]bool{
+	"allow":             true,
+	"deny":              true,
+	"deny_taint":        true,
+	"unknown_min_taint": true,
+	"unknown_taint":     true,
+}
+
+// fullPolicyDoc renders cfg, paths and egress as a policy document;
+// nil paths or egress leave that section out
+func fullPolicyDoc(cfg Config, paths map[string]pathPolicyEntry, egress *EgressPolicy) map[string]interface{} {
+	c := configJSON(cfg)
+	delete(c, "enabled") // mode says the same, and SET refuses both
+	c["exec_taint"] = execTaintName(cfg.ExecTaint)
+
+	doc := map[string]interface{}{
+		"version": fullPolicyVersion,
+		"config":  c,
+	}
+	if paths != nil {
+		p := make(map[string]string, len(paths))
+		for path, entry := range paths {
+			p[path] = execTaintName(entry.mode)
+		}
+		doc["path_policy"] = p
+	}
+	if egress != nil {
+		doc["egress"] = map[string]interface{}{
+			"allow":             nonNil(egress.Allow),
+			"deny":              nonNil(egress.Deny),
+			"deny_taint":        taintLevelName(egress.DenyTaint),
+			"unknown_min_taint": taintLevelName(egress.UnknownMinTaint),
+			"unknown_taint":     taintLevelName(egress.UnknownTaint),
+		}
+	}
+	return doc
+}
+
+// nonNil renders a nil list as [] rather than null
+func nonNil(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
+
+// currentPathPolicy copies the active overrides (nil without the map)
+func (d *TelosDaemon) currentPathPolicy() map[string]pathPolicyEntry {
+	if d.maps.PathPolicy == nil {
+		return nil
+	}
+	d.pathPolicy.mu.Lock()
+	defer d.pathPolicy.mu.Unlock()
+	paths := make(map[string]pathPolicyEntry, len(d.pathPolicy.byPath))
+	for path, entry := range d.pathPolicy.byPath {
+		paths[path] = entry
+	}
+	return paths
+}
+
+// currentEgressPolicy returns the active egress policy (nil without events)
+func (d *TelosDaemon) currentEgressPolicy() *EgressPolicy {
+	if !d.eventsAvailable() {
+		return nil
+	}
+	d.egress.mu.RLock()
+	defer d.egress.mu.RUnlock()
+	policy := d.egress.policy
+	return &policy
+}
+
+// cmdGetFullPolicy handles GET_FULL_POLICY
+func (d *TelosDaemon) cmdGetFullPolicy(_ map[string]interface{}) IPCResponse {
+	d.cfgMu.Lock()
+	cfg, err := d.activeConfig()
+	lockdown := d.lockdown.active
+	d.cfgMu.Unlock()
+	if err != nil {
+		return IPCResponse{Success: false, Error: "read config: " + err.Error()}
+	}
+	return IPCResponse{Success: true, Data: map[string]interface{}{
+		"policy":     fullPolicyDoc(cfg, d.currentPathPolicy(), d.currentEgressPolicy()),
+		"panic_mode": lockdown,
+	}}
+}
+
+// sectionArg reads an optional object field, rejecting fields not in allowed
+func sectionArg(data map[string]interface{}, field string, allowed func(string) bool) (map[string]interface{}, bool, error) {
+	v, ok := data[field]
+	if !ok || v == nil {
+		return nil, false, nil
+	}
+	section, isMap := v.(map[string]interface{})
+	if !isMap {
+		return nil, false, fmt.Errorf("Invalid '%s': must be an object", field)
+	}
+	if allowed != nil {
+		for name := range section {
+			if !allowed(name) {
+				return nil, false, fmt.Errorf("Unknown field %q in '%s'", name, field)
+			}
+		}
+	}
+	return section, true, nil
+}
+
+// cmdSetFullPolicy handles SET_FULL_POLICY ({policy, validate_only?})
+func (d *TelosDaemon) cmdSetFullPolicy(data map[string]interface{}) IPCResponse {
+	for field := range data {
+		if field != "policy" && field != "validate_only" {
+			return invalidArg("Unknown field %q", field)
+		}
+	}
+	validateOnly, err := boolArg(data, "validate_only")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	doc, ok, err := sectionArg(data, "policy", func(name string) bool { return fullPolicySections[name] })
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	if !ok {
+		return invalidArg("Missing 'policy'")
+	}
+	if _, ok := doc["version"]; ok {
+		version, err := uintArg(doc, "version", 1<<16)
+		if err != nil {
+			return invalidArg("%v", err)
+		}
+		if version != fullPolicyVersion {
+			return invalidArg("Unsupported policy version %d (want %d)", version, fullPolicyVersion)
+		}
+	}
+
+	// Everything that doesn't need the live config is checked first, so
+	// DNS lookups and inode resolution don't run under cfgMu
+	configFields, hasConfig, err := sectionArg(doc, "config", func(name string) bool {
+		_, level := configLevelFields[name]
+		return level || fullPolicyConfigFields[name]
+	})
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+
+	pathFields, hasPaths, err := sectionArg(doc, "path_policy", nil)
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	var wantPaths map[string]pathPolicyEntry
+	if hasPaths {
+		if d.maps.PathPolicy == nil {
+			return IPCResponse{Success: false, Error: "path_policy: BPF object has no path_policy_map"}
+		}
+		paths := make(map[string]string, len(pathFields))
+		for path := range pathFields {
+			if paths[path], err = stringArg(pathFields, path); err != nil {
+				return invalidArg("path_policy: %v", err)
+			}
+		}
+		if wantPaths, err = d.resolvePathPolicy(paths); err != nil {
+			return invalidArg("path_policy: %v", err)
+		}
+	}
+
+	egressFields, hasEgress, err := sectionArg(doc, "egress", func(name string) bool { return fullPolicyEgressFields[name] })
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	var egress EgressPolicy
+	var allow, deny egressList
+	if hasEgress {
+		if resp, ok := d.requireEvents("SET_FULL_POLICY egress"); !ok {
+			return resp
+		}
+		if egress, err = parseEgressPolicy(egressFields); err != nil {
+			return invalidArg("egress: %v", err)
+		}
+		if allow, deny, err = compileEgressPolicy(egress); err != nil {
+			return IPCResponse{Success: false, Error: "egress: " + err.Error()}
+		}
+	}
+
+	d.cfgMu.Lock()
+	defer d.cfgMu.Unlock()
+	if d.lockdown.active {
+		return IPCResponse{Success: false, Error: "panic mode is active; EXIT_PANIC_MODE first"}
+	}
+
+	old, err := d.activeConfig()
+	if err != nil {
+		return IPCResponse{Success: false, Error: "read config: " + err.Error()}
+	}
+	cfg := old
+	if hasConfig {
+		if _, err := d.applyAllConfigFields(&cfg, configFields); err != nil {
+			return invalidArg("config: %v", err)
+		}
+	}
+
+	// Report what would change, section by section
+	curPaths, curEgress := d.currentPathPolicy(), d.currentEgressPolicy()
+	changed := []string{}
+	if cfg != old {
+		changed = append(changed, "config")
+	}
+	if hasPaths && !samePathPolicy(curPaths, wantPaths) {
+		changed = append(changed, "path_policy")
+	}
+	if hasEgress && (curEgress == nil || !sameEgressPolicy(*curEgress, egress)) {
+		changed = append(changed, "egress")
+	}
+
+	resultPaths, resultEgress := curPaths, curEgress
+	if hasPaths {
+		resultPaths = wantPaths
+	}
+	if hasEgress {
+		resultEgress = &egress
+	}
+	resp := map[string]interface{}{
+		"policy":        fullPolicyDoc(cfg, resultPaths, resultEgress),
+		"changed":       changed,
+		"validate_only": validateOnly,
+	}
+	if validateOnly || len(changed) == 0 {
+		return IPCResponse{Success: true, Data: resp}
+	}
+
+	for _, section := range changed {
+		switch section {
+		case "config":
+			if err := d.maps.ConfigMap.Put(uint32(0), cfg); err != nil {
+				return IPCResponse{Success: false, Error: fmt.Sprintf("write config: %v", err)}
+			}
+		case "path_policy":
+			if _, _, _, err := d.replacePathPolicy(wantPaths); err != nil {
+				if cfg != old {
+					d.maps.ConfigMap.Put(uint32(0), old)
+				}
+				return IPCResponse{Success: false, Error: "path_policy: " + err.Error() + " (config restored)"}
+			}
+		case "egress":
+			d.installEgressPolicy(egress, allow, deny)
+		}
+	}
+
+	log.Printf("[POLICY] Full policy applied, changed %v", changed)
+	if cfg != old {
+		d.notifyConfig(cfg, "SET_FULL_POLICY")
+	}
+	return IPCResponse{Success: true, Data: resp}
+}
+
+// samePathPolicy reports whether two override sets are identical
+func samePathPolicy(a, b map[string]pathPolicyEntry) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, entry := range a {
+		if other, ok := b[path]; !ok || other != entry {
+			return false
+		}
+	}
+	return true
+}
+
+// sameEgressPolicy reports whether two egress policies are identical
+func sameEgressPolicy(a, b EgressPolicy) bool {
+	allowAdded, allowRemoved := listChanges(a.Allow, b.Allow)
+	denyAdded, denyRemoved := listChanges(a.Deny, b.Deny)
+	return len(allowAdded)+len(allowRemoved)+len(denyAdded)+len(denyRemoved) == 0 &&
+		len(a.Allow) == len(b.Allow) && len(a.Deny) == len(b.Deny) &&
+		a.DenyTaint == b.DenyTaint && a.UnknownMinTaint == b.UnknownMinTaint &&
+		a.UnknownTaint == b.UnknownTaint
+}
@@ -0,0 +1,105 @@
+/*
+ * Telos Core - Process Lookup
+ *
+ * GET_PROCESS answers "what do we know about this PID" from the map and
+ * /proc together, so one lookup works whether or not the process is
+ * tracked:
+ *
+ *   {"command":"GET_PROCESS","data":{"pid":4242}}
+ *   {"pid":4242,"tracked":true,"source":"map","taint_level":3,"level":"HIGH",
+ *    "comm":"agent","sandboxed":false,"quarantined":false,
+ *    "running":true,"uid":1000,"ppid":4200,"start_time":81234567,"cgroup":"/user.slice/..."}
+ *
+ * A PID with no process_map entry is described from /proc alone, with
+ * "taint_level":"unknown" and "source":"proc". So is a tracked one when
+ * process_map can't be read (the error is in "map_error"); under
+ * --observe the pinned map is read-only but still consulted. start_time
+ * is in clock ticks since boot, as CLEAR_TAINT's start_time takes it.
+ * /proc fields the daemon can't read are left out, and a PID that is
+ * neither tracked nor running is an error.
+ */
+
+package main
+
+import "fmt"
+
+// GET_PROCESS sources
+const (
+	processSourceMap  = "map"
+	processSourceProc = "proc"
+)
+
+// taintUnknown is GET_PROCESS's taint_level for a process not in the map
+const taintUnknown = "unknown"
+
+// cmdGetProcess handles GET_PROCESS ({pid})
+func (d *TelosDaemon) cmdGetProcess(data map[string]interface{}) IPCResponse {
+	pid, thread, err := processArg(data)
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+
+	result := map[string]interface{}{"pid": pid}
+	if thread != 0 {
+		result["thread_id"] = thread
+	}
+
+	var info ProcessInfo
+	tracked := false
+	if d.maps != nil && d.maps.ProcessMap != nil {
+		var err error
+		if info, tracked, err = d.trackedEntry(pid); err != nil {
+			d.debugf("GET_PROCESS %d: process_map lookup: %v", pid, err)
+			result["map_error"] = err.Error()
+		}
+	} else {
+		result["map_error"] = "process_map not loaded"
+	}
+
+	running := d.procDetails(pid, result)
+	if !tracked && !running {
+		return IPCResponse{Success: false, Error: fmt.Sprintf("PID %d is not tracked and not running", pid)}
+	}
+
+	result["tracked"] = tracked
+	if !tracked {
+		result["source"] = processSourceProc
+		result["taint_level"] = taintUnknown
+		result["level"] = taintUnknown
+		return IPCResponse{Success: true, Data: result}
+	}
+
+	result["source"] = processSourceMap
+	result["taint_level"] = info.TaintLevel
+	result["level"] = taintLevelName(info.TaintLevel)
+	result["comm"] = commString(info.Comm)
+	result["sandboxed"] = info.IsSandboxed != 0
+	result["quarantined"] = info.Quarantined != 0
+	return IPCResponse{Success: true, Data: result}
+}
+
+// procDetails adds what /proc says about pid to result and reports
+// whether the process is running
+func (d *TelosDaemon) procDetails(pid uint32, result map[string]interface{}) bool {
+	st, err := readProcStat(pid)
+	if err != nil {
+		result["running"] = false
+		return false
+	}
+	result["running"] = true
+	result["comm"] = st.Comm
+	result["ppid"] = st.PPID
+	result["start_time"] = st.StartTime
+
+	if uid, err := procUID(pid); err == nil {
+		result["uid"] = uid
+	} else {
+		d.debugf("GET_PROCESS %d: uid: %v", pid, err)
+	}
+	if _, path, err := pidCgroup(pid); err == nil {
+		result["cgroup"] = path
+	} else {
+		d.debugf("GET_PROCESS %d: cgroup: %v", pid, err)
+	}
+	return true
+}
@@ -2,9 +2,14 @@ module github.com/nevinshine/telos-runtime/telos_core/loader
 
 go 1.21
 
-require github.com/cilium/ebpf v0.12.3
+require (
+	github.com/cilium/ebpf v0.12.3
+	github.com/segmentio/kafka-go v0.4.47
+)
 
 require (
+	github.com/klauspost/compress v1.15.9 // indirect
+	github.com/pierrec/lz4/v4 v4.1.15 // indirect
 	golang.org/x/exp v0.0.0-20230224173230-c95f2b4c22f2 // indirect
 	golang.org/x/sys v0.14.1-0.20231108175955-e4099bfacb8c // indirect
 )
@@ -0,0 +1,87 @@
+/*
+ * Telos Core - Health Check
+ *
+ * PING only proves the socket handler runs. HEALTH checks that the host
+ * is actually protected: BPF object loaded, every required hook
+ * attached, event reader draining (when the object has an events map),
+ * process_map writable (under --observe: the pinned maps readable). Any
+ * failure returns Success:false with ERR_UNHEALTHY and the full status, so a
+ * supervisor or k8s probe can restart a degraded daemon.
+ */
+
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// healthSentinelPID is written and deleted to prove process_map is
+// writable; PID 0 is never accepted from clients (see pidArg)
+const healthSentinelPID uint32 = 0
+
+// cmdHealth handles HEALTH
+func (d *TelosDaemon) cmdHealth() IPCResponse {
+	if d.opts.Observe {
+		return d.observerHealth()
+	}
+	var problems []string
+	status := make(map[string]interface{})
+
+	// BPF object and hooks
+	d.bpfMu.Lock()
+	status["bpf_loaded"] = d.coll != nil
+	if d.coll == nil {
+		problems = append(problems, "BPF object not loaded")
+	}
+	hooks := make(map[string]bool, len(lsmHooks))
+	for _, h := range lsmHooks {
+		attached := d.links[h.Program] != nil
+		hooks[h.Hook] = attached
+		if h.Required && !attached {
+			problems = append(problems, "required hook "+h.Hook+" not attached")
+		}
+	}
+	d.bpfMu.Unlock()
+	status["hooks"] = hooks
+
+	// Event reader
+	running := d.readerRunning.Load()
+	status["events_available"] = d.eventsAvailable()
+	status["event_reader_running"] = running
+	if !running && d.eventsAvailable() {
+		problems = append(problems, "event reader not running")
+	}
+	if last := d.lastEventAt.Load(); last != 0 {
+		status["last_event"] = time.Unix(0, last).UTC().Format(time.RFC3339Nano)
+	} else {
+		status["last_event"] = nil
+	}
+
+	// Map writable
+	writable := d.maps != nil && d.maps.ProcessMap != nil
+	if writable {
+		d.mapMu.Lock()
+		err := d.maps.ProcessMap.Put(healthSentinelPID, ProcessInfo{})
+		if err == nil {
+			err = d.maps.ProcessMap.Delete(healthSentinelPID)
+		}
+		d.mapMu.Unlock()
+		if err != nil {
+			writable = false
+			problems = append(problems, "process_map not writable: "+err.Error())
+		}
+	} else {
+		problems = append(problems, "process_map not loaded")
+	}
+	status["map_writable"] = writable
+
+	status["healthy"] = len(problems) == 0
+	if len(problems) > 0 {
+		status["problems"] = problems
+		resp := errorResponse(ErrUnhealthy, "Unhealthy: %s", strings.Join(problems, "; "))
+		resp.Data = status
+		return resp
+	}
+	return IPCResponse{Success: true, Data: status}
+}
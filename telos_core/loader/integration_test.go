@@ -0,0 +1,261 @@
+//go:build linux && integration
+
+/*
+ * Telos Core - End-to-End Enforcement Test
+ *
+ * Runs the daemon against the real kernel: loads the compiled object,
+ * attaches the LSM hooks, and over the socket registers a victim
+ * process, taints it CRITICAL and checks that its exec fails with EPERM
+ * (and that a CLEAN victim's exec still succeeds), and that a sandboxed
+ * process is held to the tightened threshold. Built only with
+ * -tags integration and skipped unless running as root on a kernel
+ * with BPF LSM active and bpffs on /sys/fs/bpf:
+ *
+ *   make bpf && sudo go test -tags integration -run Integration -v .
+ *
+ * TELOS_BPF_OBJ overrides the object path (default ../../bin/bpf_lsm.o).
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const (
+	integrationVictimEnv = "TELOS_INTEGRATION_VICTIM"
+	victimExitEPERM      = 77 // victim's exit code when its exec got EPERM
+)
+
+// TestIntegrationVictim is the victim process, re-exec'd from the test
+// binary: it execs /bin/true once told to on stdin
+func TestIntegrationVictim(t *testing.T) {
+	if os.Getenv(integrationVictimEnv) == "" {
+		t.Skip("only run as the victim of TestIntegrationEnforcement")
+	}
+	bufio.NewReader(os.Stdin).ReadString('\n')
+	err := syscall.Exec("/bin/true", []string{"true"}, os.Environ())
+	if errors.Is(err, syscall.EPERM) {
+		os.Exit(victimExitEPERM)
+	}
+	fmt.Fprintf(os.Stderr, "exec /bin/true: %v\n", err)
+	os.Exit(1)
+}
+
+func TestIntegrationEnforcement(t *testing.T) {
+	d, conn, client := startIntegrationDaemon(t)
+
+	// Sanity: a CLEAN process may exec, so the object isn't denying everything
+	victim := startVictim(t)
+	send(t, conn, client, "REGISTER_AGENT", map[string]interface{}{"pid": victim.pid})
+	if code := victim.release(t); code != 0 {
+		t.Fatalf("CLEAN victim's exec: exit code %d, want 0", code)
+	}
+
+	victim = startVictim(t)
+	send(t, conn, client, "REGISTER_AGENT", map[string]interface{}{"pid": victim.pid})
+	send(t, conn, client, "UPDATE_TAINT", map[string]interface{}{"pid": victim.pid, "taint_level": TaintCritical})
+	if code := victim.release(t); code != victimExitEPERM {
+		t.Fatalf("CRITICAL victim's exec: exit code %d, want %d (EPERM)", code, victimExitEPERM)
+	}
+
+	// The denial is reported too (events are read asynchronously)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		found, _ := d.hub.Recent(func(ev Event) bool {
+			return ev.PID == victim.pid && ev.Action == "execve" && ev.Denied
+		}, 1)
+		if len(found) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("no denied execve event for PID %d", victim.pid)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	send(t, conn, client, "CLEAR_TAINT", map[string]interface{}{"pid": victim.pid})
+}
+
+// TestIntegrationSandboxed checks that at the same taint a sandboxed
+// process is denied an exec a normal one may do (max_taint_for_exec
+// MEDIUM, tightened to LOW)
+func TestIntegrationSandboxed(t *testing.T) {
+	_, conn, client := startIntegrationDaemon(t)
+
+	for _, sandboxed := range []bool{false, true} {
+		victim := startVictim(t)
+		send(t, conn, client, "REGISTER_AGENT", map[string]interface{}{
+			"pid": victim.pid, "initial_taint": TaintMedium, "sandboxed": sandboxed,
+		})
+
+		policy := send(t, conn, client, "GET_EFFECTIVE_POLICY", map[string]interface{}{"pid": victim.pid})
+		exec := policy["hooks"].(map[string]interface{})["exec"].(map[string]interface{})
+		want, wantCode := "allow", 0
+		if sandboxed {
+			want, wantCode = "deny", victimExitEPERM
+		}
+		if exec["decision"] != want {
+			t.Errorf("sandboxed=%v: GET_EFFECTIVE_POLICY exec decision %v, want %s", sandboxed, exec["decision"], want)
+		}
+		if code := victim.release(t); code != wantCode {
+			t.Errorf("sandboxed=%v: MEDIUM victim's exec: exit code %d, want %d", sandboxed, code, wantCode)
+		}
+		send(t, conn, client, "CLEAR_TAINT", map[string]interface{}{"pid": victim.pid})
+	}
+}
+
+// startIntegrationDaemon starts a daemon on a fresh pin path and
+// connects to its socket
+func startIntegrationDaemon(t *testing.T) (*TelosDaemon, net.Conn, *bufio.Reader) {
+	t.Helper()
+	bpfObj := requireEnforcementSupport(t)
+
+	pinPath, err := os.MkdirTemp("/sys/fs/bpf", "telos-it-")
+	if err != nil {
+		t.Fatalf("create pin path: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(pinPath) })
+	socketPath := filepath.Join(t.TempDir(), "telos.sock")
+
+	d := NewTelosDaemon(Options{
+		SocketPath:      socketPath,
+		BPFObjPath:      bpfObj,
+		PinPath:         pinPath,
+		EventBufferSize: defaultEventBufferSize,
+		EventQueueSize:  defaultEventQueueSize,
+		ExecTaint:       execTaintPreserve,
+		UntrackedTaint:  TaintClean,
+		MaxExecTaint:    TaintMedium,
+		MaxOpenTaint:    TaintHigh,
+		Mode:            "enforce",
+		Protocol:        protocolNative,
+		CommMatchLen:    maxCommLen,
+		SelfExempt:      true,
+		BinaryChange:    binaryChangeOff,
+		SandboxTighten:  defaultSandboxTighten,
+	})
+	if err := d.Start(); err != nil {
+		t.Fatalf("start daemon: %v", err)
+	}
+	t.Cleanup(func() {
+		d.Stop()
+		d.bpfMu.Lock()
+		if d.coll != nil {
+			d.coll.Close()
+		}
+		d.bpfMu.Unlock()
+	})
+
+	conn, err := net.Dial("unix", socketPath)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return d, conn, bufio.NewReader(conn)
+}
+
+// requireEnforcementSupport skips unless the test can load and attach
+// the object, and returns its path
+func requireEnforcementSupport(t *testing.T) string {
+	t.Helper()
+	if os.Geteuid() != 0 {
+		t.Skip("needs root to load BPF")
+	}
+	lsm, err := os.ReadFile("/sys/kernel/security/lsm")
+	if err != nil {
+		t.Skipf("cannot read active LSMs: %v", err)
+	}
+	if !strings.Contains(","+strings.TrimSpace(string(lsm))+",", ",bpf,") {
+		t.Skipf("BPF LSM not active (lsm=%s); boot with lsm=...,bpf", strings.TrimSpace(string(lsm)))
+	}
+	if fsType, err := pinFSType("/sys/fs/bpf"); err != nil || fsType != bpffsMagic {
+		t.Skip("bpffs not mounted on /sys/fs/bpf")
+	}
+	obj := os.Getenv("TELOS_BPF_OBJ")
+	if obj == "" {
+		obj = "../../bin/bpf_lsm.o"
+	}
+	if _, err := os.Stat(obj); err != nil {
+		t.Skipf("BPF object not built (%v); run make bpf or set TELOS_BPF_OBJ", err)
+	}
+	return obj
+}
+
+// victimProc is a running TestIntegrationVictim
+type victimProc struct {
+	pid   uint32
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+// startVictim starts a victim waiting to exec
+func startVictim(t *testing.T) *victimProc {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], "-test.run=^TestIntegrationVictim$")
+	cmd.Env = append(os.Environ(), integrationVictimEnv+"=1")
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start victim: %v", err)
+	}
+	t.Cleanup(func() { cmd.Process.Kill(); cmd.Wait() })
+	return &victimProc{pid: uint32(cmd.Process.Pid), cmd: cmd, stdin: stdin}
+}
+
+// release lets the victim exec and returns its exit code
+func (v *victimProc) release(t *testing.T) int {
+	t.Helper()
+	io.WriteString(v.stdin, "go\n")
+	v.stdin.Close()
+	err := v.cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+	if err != nil {
+		t.Fatalf("victim: %v", err)
+	}
+	return 0
+}
+
+// send runs one command over the socket and fails the test unless it succeeds
+func send(t *testing.T, conn net.Conn, r *bufio.Reader, command string, data map[string]interface{}) map[string]interface{} {
+	t.Helper()
+	line, _ := json.Marshal(IPCCommand{Command: command, Data: data})
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write(append(line, '\n')); err != nil {
+		t.Fatalf("%s: write: %v", command, err)
+	}
+	reply, err := r.ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("%s: read: %v", command, err)
+	}
+	var resp struct {
+		Success bool                   `json:"success"`
+		Error   string                 `json:"error"`
+		Data    map[string]interface{} `json:"data"`
+	}
+	if err := json.Unmarshal(reply, &resp); err != nil {
+		t.Fatalf("%s: decode %q: %v", command, reply, err)
+	}
+	if !resp.Success {
+		t.Fatalf("%s failed: %s", command, resp.Error)
+	}
+	return resp.Data
+}
@@ -0,0 +1,240 @@
+/*
+ * Telos Core - IPC Argument Parsing
+ *
+ * Everything in IPCCommand.Data is attacker-influenced JSON decoded into
+ * interface{}. Handlers must never type-assert it directly; they go
+ * through these helpers, which turn every malformed input into a clean
+ * ERR_INVALID_ARG response instead of a panic or a silently truncated
+ * number.
+ *
+ * Command data is decoded with UseNumber, so integers arrive exactly as
+ * sent however large. Numeric fields also accept decimal strings
+ * ("pid":"1234"), which many clients produce by accident; start with
+ * --numeric-strings=false to require real JSON numbers.
+ */
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Structured error codes carried in IPCResponse.Code
+const (
+	ErrInvalidArg     = "ERR_INVALID_ARG"
+	ErrUnknownCommand = "ERR_UNKNOWN_COMMAND"
+	ErrInternal       = "ERR_INTERNAL"
+	ErrUnhealthy      = "ERR_UNHEALTHY"
+	ErrUnsupported    = "ERR_UNSUPPORTED" // the loaded BPF object lacks what the command needs
+	ErrConflict       = "ERR_CONFLICT"    // the target no longer matches what the caller saw
+)
+
+// maxCommandLine bounds a single JSON command line
+const maxCommandLine = 1 << 20
+
+var errLineTooLong = errors.New("line too long")
+
+// readLine reads one '\n'-terminated line of at most max bytes without
+// buffering an unbounded amount of client data
+func readLine(r *bufio.Reader, max int) ([]byte, error) {
+	var line []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(line)+len(chunk) > max {
+			return nil, errLineTooLong
+		}
+		line = append(line, chunk...)
+		if err != bufio.ErrBufferFull {
+			return line, err
+		}
+	}
+}
+
+// errorResponse builds a failed response with a structured code
+func errorResponse(code, format string, args ...interface{}) IPCResponse {
+	return IPCResponse{Success: false, Code: code, Error: fmt.Sprintf(format, args...)}
+}
+
+// invalidArg builds an ERR_INVALID_ARG response
+func invalidArg(format string, args ...interface{}) IPCResponse {
+	return errorResponse(ErrInvalidArg, format, args...)
+}
+
+// numericStrings lets numeric fields be sent as decimal strings
+// (--numeric-strings)
+var numericStrings = true
+
+// decodeData unmarshals a command like json.Unmarshal, but keeps numbers
+// as json.Number so no integer is rounded through float64
+func decodeData(raw []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected data after JSON value")
+	}
+	return nil
+}
+
+// exactUint converts an integer literal ("42", "4.2e1") to uint64,
+// failing for fractions, negatives and anything float64 can't hold exactly
+func exactUint(s string) (uint64, bool) {
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return n, true
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || f < 0 || f != math.Trunc(f) || f > 1<<53 {
+		return 0, false
+	}
+	return uint64(f), true
+}
+
+// uintArg reads a required non-negative integer no larger than max, as a
+// JSON number or (with numericStrings) a decimal string. NaN/Inf,
+// fractions, negatives and out-of-range values are rejected.
+func uintArg(data map[string]interface{}, field string, max uint64) (uint64, error) {
+	var n uint64
+	ok := true
+	switch v := data[field].(type) {
+	case float64:
+		ok = !math.IsNaN(v) && !math.IsInf(v, 0) && v >= 0 && v == math.Trunc(v) && v <= 1<<53
+		n = uint64(v)
+	case json.Number:
+		n, ok = exactUint(v.String())
+	case string:
+		if !numericStrings {
+			return 0, fmt.Errorf("Invalid '%s': must be a JSON number", field)
+		}
+		n, ok = exactUint(v)
+	default:
+		return 0, fmt.Errorf("Missing or invalid '%s'", field)
+	}
+	if !ok || n > max {
+		return 0, fmt.Errorf("Invalid '%s': must be an integer in 0..%d", field, max)
+	}
+	return n, nil
+}
+
+// pidArg reads the required, non-zero 'pid' field
+func pidArg(data map[string]interface{}) (uint32, error) {
+	pid, err := uintArg(data, "pid", math.MaxUint32)
+	if err != nil {
+		return 0, err
+	}
+	if pid == 0 {
+		return 0, fmt.Errorf("Invalid 'pid': must be non-zero")
+	}
+	return uint32(pid), nil
+}
+
+// processArg is pidArg for commands that act on a process. The hooks
+// key process_map by TGID, so an entry under a thread ID would never be
+// consulted and the process would go unenforced: a thread ID is mapped
+// to its process, and returned as thread (0 when pid was a process). A
+// PID that no longer exists is passed through unchanged.
+func processArg(data map[string]interface{}) (pid, thread uint32, err error) {
+	pid, err = pidArg(data)
+	if err != nil {
+		return 0, 0, err
+	}
+	pid, thread = processOf(pid)
+	return pid, thread, nil
+}
+
+// processOf maps a thread ID to its process, as processArg does
+func processOf(pid uint32) (tgid, thread uint32) {
+	tgid, err := threadGroup(pid)
+	if err != nil || tgid == pid || tgid == 0 {
+		return pid, 0
+	}
+	log.Printf("[PID] %d is a thread of process %d; using the process", pid, tgid)
+	metrics.ThreadIDsMapped.Add(1)
+	return tgid, pid
+}
+
+// levelArg reads a required taint level, as 0..4 or a level name
+// ("CLEAN".."CRITICAL", case-insensitive)
+func levelArg(data map[string]interface{}, field string) (uint32, error) {
+	if name, ok := data[field].(string); ok && !(numericStrings && isDecimal(name)) {
+		level, known := parseTaintLevel(name)
+		if !known {
+			return 0, fmt.Errorf("Invalid '%s': unknown level %q (want %s)",
+				field, name, strings.Join(taintLevelNames[:], ", "))
+		}
+		return level, nil
+	}
+	level, err := uintArg(data, field, TaintCritical)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid '%s': must be 0..%d or a level name (%s)",
+			field, TaintCritical, strings.Join(taintLevelNames[:], ", "))
+	}
+	return uint32(level), nil
+}
+
+// isDecimal reports whether s is a non-empty run of ASCII digits
+func isDecimal(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// stringArg reads an optional string field ("" if absent)
+func stringArg(data map[string]interface{}, field string) (string, error) {
+	v, ok := data[field]
+	if !ok || v == nil {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("Invalid '%s': must be a string", field)
+	}
+	return s, nil
+}
+
+// boolArg reads an optional boolean field (false if absent)
+func boolArg(data map[string]interface{}, field string) (bool, error) {
+	v, ok := data[field]
+	if !ok || v == nil {
+		return false, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("Invalid '%s': must be a boolean", field)
+	}
+	return b, nil
+}
+
+// stringList extracts an optional JSON array of strings from data
+func stringList(data map[string]interface{}, field string) ([]string, error) {
+	raw, ok := data[field]
+	if !ok || raw == nil {
+		return nil, nil
+	}
+	items, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("'%s' must be a list of strings", field)
+	}
+	out := make([]string, 0, len(items))
+	for _, it := range items {
+		s, ok := it.(string)
+		if !ok {
+			return nil, fmt.Errorf("'%s' must be a list of strings", field)
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/cilium/ebpf"
+)
+
+// fuzzSkip are commands with effects outside the daemon (cgroups, files,
+// the network, subprocesses, BPF loads) that the fuzzer must not reach
+var fuzzSkip = map[string]bool{
+	"FREEZE_PID":        true,
+	"RELOAD_BPF":        true,
+	"EXPORT_CSV":        true,
+	"GET_OVERHEAD":      true,
+	"GET_PEER_STATE":    true,
+	"REEVALUATE":        true,
+	"SET_EGRESS_POLICY": true,
+}
+
+// fuzzDaemon is a daemon with no BPF programs: process_map and
+// config_map are small in-memory maps shaped like the object's, and the
+// optional maps are left out
+func fuzzDaemon(tb testing.TB) *TelosDaemon {
+	processMap, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.Hash,
+		KeySize:    4,
+		ValueSize:  uint32(binary.Size(ProcessInfo{})),
+		MaxEntries: 64,
+	})
+	if err != nil {
+		tb.Skipf("cannot create BPF maps: %v", err)
+	}
+	configMap, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.Array,
+		KeySize:    4,
+		ValueSize:  uint32(binary.Size(Config{})),
+		MaxEntries: 1,
+	})
+	if err != nil {
+		processMap.Close()
+		tb.Skipf("cannot create BPF maps: %v", err)
+	}
+	tb.Cleanup(func() {
+		processMap.Close()
+		configMap.Close()
+	})
+
+	d := NewTelosDaemon(Options{EventBufferSize: 16, MaxSubscribers: 1})
+	d.maps = &BPFMaps{ProcessMap: processMap, ConfigMap: configMap}
+	return d
+}
+
+// FuzzHandleCommand feeds raw client lines through the same
+// readLine -> decodeData -> handleCommand path handleConnection uses and
+// checks that no handler panics (handleCommand recovers, so a panic
+// shows up as its ERR_INTERNAL) and that malformed arguments are refused
+// with ERR_INVALID_ARG before any handler touches state
+func FuzzHandleCommand(f *testing.F) {
+	for _, seed := range []string{
+		`{"command":"PING"}`,
+		`{"command":"UPDATE_TAINT","data":{"pid":1234,"taint_level":"HIGH"}}`,
+		`{"command":"UPDATE_TAINT","data":{"pid":NaN,"taint_level":1}}`,
+		`{"command":"UPDATE_TAINT","data":{"pid":"NaN","taint_level":1}}`,
+		`{"command":"UPDATE_TAINT","data":{"pid":"Infinity","taint_level":"-Inf"}}`,
+		`{"command":"UPDATE_TAINT","data":{"pid":1e300,"taint_level":1}}`,
+		`{"command":"UPDATE_TAINT","data":{"pid":1.5,"taint_level":1}}`,
+		`{"command":"UPDATE_TAINT","data":{"pid":-1,"taint_level":1}}`,
+		`{"command":"UPDATE_TAINT","data":{"pid":4294967296,"taint_level":1}}`,
+		`{"command":"UPDATE_TAINT","data":{"pid":1,"taint_level":1e-300}}`,
+		`{"command":"INCREMENT_TAINT","data":{"pid":"12","delta":18446744073709551616}}`,
+		`{"command":"CLEAR_TAINT","data":{"pid":[1],"start_time":{}}}`,
+		`{"command":"REGISTER_AGENT","data":{"pid":null,"comm":7}}`,
+		`{"command":"SET_CONFIG_KEY","data":{"key":-0,"value":1.0000001}}`,
+		`{"command":"SET_THRESHOLD","data":{"hook":"exec","max_taint":"critical"}}`,
+		`{"command":"GET_STATE","data":{"pids":[1,2,"x"]}}`,
+		`{"command":"DESCRIBE","data":{"command":"UPDATE_TAINT"}}`,
+		`{"command":"NO_SUCH_COMMAND","data":{}}`,
+		`{"command":"PING"} trailing`,
+		`{"command":"UPDATE_TAINT","data":` + strings.Repeat(`{"a":`, 5000) + `1` + strings.Repeat(`}`, 5000) + `}`,
+		`{"command":"GET_STATE","data":{"pids":` + strings.Repeat(`[`, 5000) + strings.Repeat(`]`, 5000) + `}}`,
+	} {
+		f.Add([]byte(seed + "\n"))
+	}
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	d := fuzzDaemon(f)
+
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		line, err := readLine(bufio.NewReader(bytes.NewReader(raw)), maxCommandLine)
+		if err != nil && err != io.EOF {
+			return
+		}
+		var cmd IPCCommand
+		if err := decodeData(line, &cmd); err != nil {
+			return // handleConnection answers invalidArg("Invalid JSON")
+		}
+		if connCommands[cmd.Command] || fuzzSkip[cmd.Command] {
+			return
+		}
+
+		resp := d.handleCommand(cmd, nil)
+		if resp.Code == ErrInternal && strings.HasPrefix(resp.Error, "Internal error handling") {
+			t.Fatalf("%s panicked on %q", cmd.Command, line)
+		}
+
+		if _, ok := lookupCommand(cmd.Command); !ok {
+			if resp.Code != ErrUnknownCommand {
+				t.Fatalf("%q: got %+v, want %s", cmd.Command, resp, ErrUnknownCommand)
+			}
+			return
+		}
+		field, bad := malformedField(cmd.Command, cmd.Data)
+		if !bad || resp.Code == ErrUnsupported {
+			return
+		}
+		if resp.Success || resp.Code != ErrInvalidArg {
+			t.Fatalf("%s with malformed %q (%v): got %+v, want %s",
+				cmd.Command, field, cmd.Data[field], resp, ErrInvalidArg)
+		}
+	})
+}
+
+// malformedField returns the first required pid or level field of
+// command's schema that data fails to supply validly
+func malformedField(command string, data map[string]interface{}) (string, bool) {
+	for _, field := range commandSpecs[command].Fields {
+		if !field.Required {
+			continue
+		}
+		var err error
+		switch field.Type {
+		case typePID:
+			_, err = pidArg(map[string]interface{}{"pid": data[field.Name]})
+		case typeLevel:
+			_, err = levelArg(data, field.Name)
+		}
+		if err != nil {
+			return field.Name, true
+		}
+	}
+	return "", false
+}
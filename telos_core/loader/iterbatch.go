@@ -0,0 +1,83 @@
+/*
+ * Telos Core - Incremental Map Walks
+ *
+ * Background jobs that walk the whole process_map (the processes-by-level
+ * recount, the active-process gauge) cost time proportional to the map,
+ * every tick, holding mapMu for the key walk. With --iteration-batch N a
+ * pass handles at most N entries and the next pass resumes after the last
+ * key it saw. The mapMu hold and CPU per tick stay bounded whatever the
+ * map size.
+ *
+ * Trade-off: the gauges are only republished when a full round completes,
+ * i.e. every ceil(entries / N) ticks instead of every tick, so they
+ * converge more slowly on a large map. Commands (GET_STATE, exports,
+ * checkpoints) always take a full snapshot.
+ *
+ * Resuming from a key deleted since the last pass makes the kernel restart
+ * the walk from the beginning; keys already counted this round are
+ * skipped, and a round is cut off after visiting max_entries keys.
+ */
+
+package main
+
+import (
+	"errors"
+
+	"github.com/cilium/ebpf"
+)
+
+// mapCursor is the position of an incremental process_map walk
+type mapCursor struct {
+	key     uint32
+	started bool // key holds the last PID visited
+	seen    map[uint32]bool
+	visits  uint32
+}
+
+// reset starts a new round
+func (c *mapCursor) reset() {
+	c.started = false
+	c.seen = make(map[uint32]bool)
+	c.visits = 0
+}
+
+// nextProcessBatch returns up to n PIDs after the cursor, not yet seen
+// this round, and whether the round is complete
+func (d *TelosDaemon) nextProcessBatch(c *mapCursor, n int) ([]uint32, bool, error) {
+	if c.seen == nil {
+		c.reset()
+	}
+
+	d.mapMu.Lock()
+	defer d.mapMu.Unlock()
+
+	m := d.maps.ProcessMap
+	var pids []uint32
+	for len(pids) < n {
+		if c.visits >= m.MaxEntries() {
+			return pids, true, nil
+		}
+
+		var next uint32
+		var err error
+		if c.started {
+			err = m.NextKey(c.key, &next)
+		} else {
+			err = m.NextKey(nil, &next)
+		}
+		if errors.Is(err, ebpf.ErrKeyNotExist) {
+			return pids, true, nil
+		}
+		if err != nil {
+			return pids, false, err
+		}
+
+		c.key, c.started = next, true
+		c.visits++
+		if !c.seen[next] {
+			c.seen[next] = true
+			pids = append(pids, next)
+		}
+	}
+	return pids, false, nil
+}
@@ -0,0 +1,204 @@
+/*
+ * Telos Core - JSON-RPC 2.0 Framing
+ *
+ * With --protocol=jsonrpc the socket speaks newline-delimited JSON-RPC 2.0
+ * instead of the native {command, data} protocol. Methods map onto the
+ * command registry (UPDATE_TAINT <-> telos.updateTaint) and params must be
+ * an object, passed to the handler as its data:
+ *
+ *   {"jsonrpc":"2.0","method":"telos.updateTaint","params":{"pid":42,"taint_level":3},"id":1}
+ *   {"jsonrpc":"2.0","result":null,"id":1}
+ *
+ * Failures become standard error objects; the native ERR_* code, if any,
+ * is kept in error.data.code. Notifications (no id) and batches are
+ * supported.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"syscall"
+)
+
+const (
+	protocolNative  = "native"
+	protocolJSONRPC = "jsonrpc"
+
+	rpcMethodPrefix = "telos."
+)
+
+// Standard JSON-RPC 2.0 error codes
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+	rpcServerError    = -32000 // command ran and failed
+)
+
+// rpcCodes maps native error codes onto JSON-RPC ones
+var rpcCodes = map[string]int{
+	ErrInvalidArg:     rpcInvalidParams,
+	ErrUnknownCommand: rpcMethodNotFound,
+	ErrInternal:       rpcInternalError,
+}
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcError struct {
+	Code    int               `json:"code"`
+	Message string            `json:"message"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
+type rpcResult struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  interface{}     `json:"result"`
+	ID      json.RawMessage `json:"id"`
+}
+
+type rpcFailure struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Error   rpcError        `json:"error"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// rpcMethodName converts a command name to its method (UPDATE_TAINT -> telos.updateTaint)
+func rpcMethodName(command string) string {
+	parts := strings.Split(strings.ToLower(command), "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+	return rpcMethodPrefix + strings.Join(parts, "")
+}
+
+// rpcMethodNames lists the methods of every registered command
+func rpcMethodNames() []string {
+	var methods []string
+	for _, name := range commandNames() {
+		if !connCommands[name] {
+			methods = append(methods, rpcMethodName(name))
+		}
+	}
+	return methods
+}
+
+// rpcCommandName converts a method back to its command name ("" if unknown)
+func rpcCommandName(method string) string {
+	if !strings.HasPrefix(method, rpcMethodPrefix) {
+		return ""
+	}
+	for name := range commands {
+		if rpcMethodName(name) == method {
+			return name
+		}
+	}
+	for name := range peerCommands {
+		if rpcMethodName(name) == method {
+			return name
+		}
+	}
+	return ""
+}
+
+// rpcErrorLine encodes an error response; a nil id encodes as null
+func rpcErrorLine(id json.RawMessage, code int, message, nativeCode string) []byte {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	f := rpcFailure{JSONRPC: "2.0", Error: rpcError{Code: code, Message: message}, ID: id}
+	if nativeCode != "" {
+		f.Error.Data = map[string]string{"code": nativeCode}
+	}
+	out, _ := json.Marshal(f)
+	return out
+}
+
+// handleRPC processes one JSON-RPC line (single request or batch) and
+// returns the encoded response, or nil if nothing is to be sent
+func (d *TelosDaemon) handleRPC(line []byte, peer *syscall.Ucred) []byte {
+	line = bytes.TrimSpace(line)
+	if len(line) == 0 || line[0] != '[' {
+		return d.handleRPCMessage(line, peer)
+	}
+
+	var batch []json.RawMessage
+	if err := json.Unmarshal(line, &batch); err != nil {
+		return rpcErrorLine(nil, rpcParseError, "Parse error: "+err.Error(), "")
+	}
+	if len(batch) == 0 {
+		return rpcErrorLine(nil, rpcInvalidRequest, "Empty batch", "")
+	}
+
+	var replies []json.RawMessage
+	for _, msg := range batch {
+		if out := d.handleRPCMessage(msg, peer); out != nil {
+			replies = append(replies, out)
+		}
+	}
+	if len(replies) == 0 {
+		return nil // All notifications
+	}
+	out, _ := json.Marshal(replies)
+	return out
+}
+
+// handleRPCMessage processes a single JSON-RPC request object
+func (d *TelosDaemon) handleRPCMessage(msg []byte, peer *syscall.Ucred) []byte {
+	var req rpcRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		if json.Valid(msg) {
+			return rpcErrorLine(nil, rpcInvalidRequest, "Invalid request: "+err.Error(), ErrInvalidArg)
+		}
+		return rpcErrorLine(nil, rpcParseError, "Parse error: "+err.Error(), "")
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return rpcErrorLine(req.ID, rpcInvalidRequest, "Invalid request: want jsonrpc \"2.0\" and a method", ErrInvalidArg)
+	}
+	notification := len(req.ID) == 0
+
+	command := rpcCommandName(req.Method)
+	if command == "" {
+		if notification {
+			return nil
+		}
+		return rpcErrorLine(req.ID, rpcMethodNotFound, "Method not found: "+req.Method+d.didYouMean(req.Method, rpcMethodNames()), ErrUnknownCommand)
+	}
+
+	data := map[string]interface{}{}
+	if p := bytes.TrimSpace(req.Params); len(p) > 0 && !bytes.Equal(p, []byte("null")) {
+		if err := decodeData(p, &data); err != nil {
+			if notification {
+				return nil
+			}
+			return rpcErrorLine(req.ID, rpcInvalidParams, "Invalid params: must be an object", ErrInvalidArg)
+		}
+	}
+
+	resp := d.handleCommand(IPCCommand{Command: command, Data: data}, peer)
+	if notification {
+		return nil
+	}
+
+	if !resp.Success {
+		code, ok := rpcCodes[resp.Code]
+		if !ok {
+			code = rpcServerError
+		}
+		return rpcErrorLine(req.ID, code, resp.Error, resp.Code)
+	}
+
+	out, _ := json.Marshal(rpcResult{JSONRPC: "2.0", Result: resp.Data, ID: req.ID})
+	return out
+}
@@ -0,0 +1,156 @@
+/*
+ * Telos Core - Struct Layout Check
+ *
+ * The Go mirrors of the BPF structs (rawEvent, ProcessInfo, Config, ...)
+ * are decoded with encoding/binary, so they must match the C layout byte
+ * for byte. A field added on one side only would otherwise decode as
+ * garbage forever. checkLayouts compares every mirror against the
+ * object's BTF (field count, offset and size, with explicit `_` padding
+ * on the Go side) and against the map key/value sizes, and refuses to
+ * load an object that doesn't match.
+ */
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+)
+
+// structLayout pairs a BPF struct with its Go mirror
+type structLayout struct {
+	CType string      // struct name in BTF
+	GoVal interface{} // zero value of the Go mirror
+	Map   string      // map using it ("" for ringbuf records)
+	IsKey bool        // mirror is the map key rather than the value
+}
+
+var structLayouts = []structLayout{
+	{CType: "event_t", GoVal: rawEvent{}},
+	{CType: "process_info_t", GoVal: ProcessInfo{}, Map: "process_map"},
+	{CType: "telos_config_t", GoVal: Config{}, Map: "config_map"},
+	{CType: "path_policy_key_t", GoVal: PathPolicyKey{}, Map: "path_policy_map", IsKey: true},
+	{CType: "path_policy_t", GoVal: PathPolicy{}, Map: "path_policy_map"},
+}
+
+// rawEventSize is the exact size of one ringbuf record
+var rawEventSize = binary.Size(rawEvent{})
+
+// checkLayouts verifies every Go mirror against spec
+func checkLayouts(spec *ebpf.CollectionSpec) error {
+	var problems []string
+	for _, l := range structLayouts {
+		if err := checkLayout(spec, l); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("BPF struct layout mismatch (rebuild the object or update the Go mirror): %s",
+			strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// checkLayout verifies one Go mirror against its map and BTF struct
+func checkLayout(spec *ebpf.CollectionSpec, l structLayout) error {
+	goType := reflect.TypeOf(l.GoVal)
+	goSize := binary.Size(l.GoVal)
+
+	if l.Map != "" {
+		ms := spec.Maps[l.Map]
+		if ms == nil {
+			return nil // Optional map not in this object
+		}
+		size, side := ms.ValueSize, "value"
+		if l.IsKey {
+			size, side = ms.KeySize, "key"
+		}
+		if int(size) != goSize {
+			return fmt.Errorf("%s %s is %d bytes, Go %s is %d", l.Map, side, size, goType.Name(), goSize)
+		}
+	}
+
+	if spec.Types == nil {
+		return nil
+	}
+	var st *btf.Struct
+	if err := spec.Types.TypeByName(l.CType, &st); err != nil {
+		if errors.Is(err, btf.ErrNotFound) {
+			if l.Map == "" && spec.Maps["events"] != nil {
+				log.Printf("Warning: no BTF for struct %s, cannot verify %s", l.CType, goType.Name())
+			}
+			return nil
+		}
+		return fmt.Errorf("BTF %s: %v", l.CType, err)
+	}
+
+	if int(st.Size) != goSize {
+		return fmt.Errorf("struct %s is %d bytes, Go %s is %d", l.CType, st.Size, goType.Name(), goSize)
+	}
+
+	// Walk the Go fields in wire order, skipping explicit padding
+	var off, member int
+	for i := 0; i < goType.NumField(); i++ {
+		f := goType.Field(i)
+		size := binary.Size(reflect.Zero(f.Type).Interface())
+		if f.Name != "_" {
+			if member >= len(st.Members) {
+				return fmt.Errorf("Go %s.%s has no counterpart in struct %s", goType.Name(), f.Name, l.CType)
+			}
+			m := st.Members[member]
+			cSize, err := btf.Sizeof(m.Type)
+			if err != nil {
+				return fmt.Errorf("BTF %s.%s: %v", l.CType, m.Name, err)
+			}
+			if cOff := int(m.Offset / 8); cOff != off || cSize != size {
+				return fmt.Errorf("Go %s.%s at offset %d size %d, but %s.%s at offset %d size %d",
+					goType.Name(), f.Name, off, size, l.CType, m.Name, cOff, cSize)
+			}
+			member++
+		}
+		off += size
+	}
+	if member != len(st.Members) {
+		return fmt.Errorf("struct %s has %d fields, Go %s has %d", l.CType, len(st.Members), goType.Name(), member)
+	}
+	return nil
+}
+
+// checkValueSizes asserts, once the maps are settled, that the daemon's
+// state maps decode into ProcessInfo and Config. checkLayouts only sees
+// the spec; a reattached or pinned map is what every Lookup and Put
+// actually uses, and with the wrong value size each of them would fail
+// or misdecode.
+func (m *BPFMaps) checkValueSizes() error {
+	for _, c := range []struct {
+		name  string
+		m     *ebpf.Map
+		goVal interface{}
+	}{
+		{"process_map", m.ProcessMap, ProcessInfo{}},
+		{"config_map", m.ConfigMap, Config{}},
+	} {
+		if c.m == nil {
+			return fmt.Errorf("no %s", c.name)
+		}
+		want := binary.Size(c.goVal)
+		if int(c.m.ValueSize()) == want {
+			continue
+		}
+		source := "the object"
+		if m.Reattached[c.name] {
+			source = "the pin at " + m.Pins[c.name]
+		}
+		return fmt.Errorf("%s from %s has %d-byte values, but Go %s is %d bytes; "+
+			"the daemon and the map come from different versions of the struct",
+			c.name, source, c.m.ValueSize(), reflect.TypeOf(c.goVal).Name(), want)
+	}
+	return nil
+}
@@ -3,13 +3,38 @@
  *
  * This daemon:
  *   1. Loads the compiled eBPF LSM program
- *   2. Pins maps to /sys/fs/bpf/telos/ for persistence
+ *   2. Pins maps to /sys/fs/bpf/telos/ (--pin-path) for persistence
  *   3. Attaches LSM hooks to the kernel
  *   4. Listens on a Unix socket for commands from Cortex
  *   5. Updates BPF maps based on taint reports
  *
  * Usage:
- *   sudo ./telos_daemon [--socket /var/run/telos.sock] [--bpf-obj bin/bpf_lsm.o]
+ *   sudo ./telos_daemon [run] [--socket /var/run/telos.sock] [--bpf-obj bin/bpf_lsm.o]
+ *                       [--pin-path /sys/fs/bpf/telos] [--mount-bpffs]
+ *                       [--event-sink file:/path|http(s)://url] [--event-queue N]
+ *                       [--event-buffer N] [--max-subscribers 32] [--dedup-window 1s] [--coalesce-window 50ms]
+ *                       [--idle-timeout 5m] [--handler-workers 64] [--monotonic] [--exec-taint preserve|clear|reduce]
+ *                       [--default-taint-untracked CLEAN] [--max-exec-taint MEDIUM] [--max-open-taint HIGH]
+ *                       [--mode enforce|audit|off] [--sandbox-tighten 1]
+ *                       [--state-file /var/lib/telos/state.csv] [--checkpoint-interval 30s]
+ *                       [--state-key /etc/telos/state.key] [--seed-file /etc/telos/seed.json]
+ *                       [--policy-dir /etc/telos/policy.d]
+ *                       [--reset-config] [--protocol native|jsonrpc] [--debug] [--suggest-commands=false]
+ *                       [--numeric-strings=false]
+ *                       [--metrics-addr 127.0.0.1:9464|unix:/path] [--level-gauge-interval 15s]
+ *                       [--dashboard-addr 127.0.0.1:9465|unix:/path]
+ *                       [--nats-url nats://host:4222] [--nats-subject telos.events]
+ *                       [--kafka-brokers h1:9092,h2:9092] [--kafka-topic telos-events]
+ *                       [--state-mirror redis://host:6379/0] [--mirror-host web-1]
+ *                       [--kafka-key pid|cgroup] [--comm-match-len 15] [--self-exempt=false]
+ *                       [--no-default-allowlist] [--allowlist-comms cron,rsyslogd]
+ *                       [--register-self] [--self-comm telos_daemon]
+ *                       [--listen-retries 5] [--listen-backoff 500ms] [--admin-uids 1000,...]
+ *                       [--authz-policy /etc/telos/authz.json] [--audit-log /var/log/telos/audit.ndjson]
+ *                       [--rate-limit 50] [--rate-burst 100] [--rate-limit-exempt-uids 0,...]
+ *                       [--iteration-batch 1024] [--map-warn-threshold 90] [--observe]
+ *                       [--binary-change off|alert|escalate] [--binary-change-taint HIGH]
+ *   sudo ./telos_daemon status|reload|stop [--socket ...]   (see cli.go)
  */
 
 package main
@@ -17,18 +42,27 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
+	"time"
+	"unicode/utf8"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/link"
-	"github.com/cilium/ebpf/rlimit"
+	"github.com/cilium/ebpf/ringbuf"
 )
 
 // === CONFIGURATION ===
@@ -36,7 +70,7 @@ import (
 const (
 	defaultSocketPath = "/var/run/telos.sock"
 	defaultBPFObj     = "bin/bpf_lsm.o"
-	bpfPinPath        = "/sys/fs/bpf/telos"
+	defaultPinPath    = "/sys/fs/bpf/telos"
 )
 
 // Taint levels (must match common_maps.h)
@@ -48,21 +82,68 @@ const (
 	TaintCritical = 4
 )
 
+var taintLevelNames = [...]string{"CLEAN", "LOW", "MEDIUM", "HIGH", "CRITICAL"}
+
+// taintLevelName returns the symbolic name of a taint level
+func taintLevelName(level uint32) string {
+	if int(level) < len(taintLevelNames) {
+		return taintLevelNames[level]
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", level)
+}
+
+// parseTaintLevel resolves a level name (case-insensitive)
+func parseTaintLevel(name string) (uint32, bool) {
+	for level, n := range taintLevelNames {
+		if strings.EqualFold(name, n) {
+			return uint32(level), true
+		}
+	}
+	return 0, false
+}
+
+// parseLevelFlag parses a taint level flag given as a name or a number
+func parseLevelFlag(s string) (uint32, error) {
+	if level, ok := parseTaintLevel(s); ok {
+		return level, nil
+	}
+	n, err := strconv.ParseUint(s, 10, 32)
+	if err != nil || n > TaintCritical {
+		return 0, fmt.Errorf("%q is not a taint level (0..%d or %s)",
+			s, TaintCritical, strings.Join(taintLevelNames[:], ", "))
+	}
+	return uint32(n), nil
+}
+
 // === DATA STRUCTURES ===
 
-// ProcessInfo matches the BPF struct process_info_t
+// ProcessInfo matches the BPF struct process_info_t. process_map is keyed
+// by TGID, so PID here always means the process, never a thread.
 type ProcessInfo struct {
 	PID         uint32
 	TaintLevel  uint32
 	IsSandboxed uint32
 	Comm        [16]byte
+	Quarantined uint32
 }
 
 // Config matches the BPF struct config_t
 type Config struct {
+	Version uint32 // configVersion; first so any layout can be identified (see configversion.go)
+
 	MaxTaintForExec uint32
 	MaxTaintForOpen uint32
 	Enabled         uint32
+	ReportAllowed   uint32 // Set while a shadow config is active
+
+	MaxTaintForConnect uint32
+	MaxTaintForPtrace  uint32
+	ExecTaint          uint32 // execTaint* applied after a successful execve
+
+	DefaultTaintUntracked uint32 // taint assumed for PIDs not in process_map
+	Maintenance           uint32 // 1 between ENTER_MAINTENANCE and EXIT_MAINTENANCE
+	ReportExec            uint32 // 1 = report tracked execs for --binary-change (version 2)
+	SandboxTighten        uint32 // levels thresholds drop for sandboxed processes (version 3)
 }
 
 // IPCCommand is the JSON command from Cortex
@@ -75,6 +156,7 @@ type IPCCommand struct {
 type IPCResponse struct {
 	Success bool        `json:"success"`
 	Error   string      `json:"error,omitempty"`
+	Code    string      `json:"code,omitempty"` // ERR_* on failure (see ipc.go)
 	Data    interface{} `json:"data,omitempty"`
 }
 
@@ -85,32 +167,180 @@ type BPFMaps struct {
 	ProcessMap *ebpf.Map
 	ConfigMap  *ebpf.Map
 	Events     *ebpf.Map
+	PathPolicy *ebpf.Map // nil if the object has no path_policy_map
+	Exempt     *ebpf.Map // nil if the object has no exempt_map
+
+	Pins       map[string]string // map name -> pin path, for pinned maps
+	Reattached map[string]bool   // map name -> reused an existing pinned map
 }
 
-// Links to LSM hooks
-type BPFLinks struct {
-	CheckExec link.Link
-	CheckFile link.Link
-	TaskAlloc link.Link
+// pinnedMaps are pinned by name under --pin-path and reused across restarts
+var pinnedMaps = []string{"process_map", "config_map"}
+
+// lsmHook describes one LSM program the loader knows how to attach
+type lsmHook struct {
+	Program  string // program name in the BPF object
+	Hook     string // LSM hook it attaches to
+	Required bool   // startup fails if it cannot attach
+}
+
+var lsmHooks = []lsmHook{
+	{Program: "telos_check_exec", Hook: "bprm_check_security", Required: true},
+	{Program: "telos_check_file", Hook: "file_open"},
+	{Program: "telos_check_connect", Hook: "socket_connect"},
+	{Program: "telos_check_ptrace", Hook: "ptrace_access_check"},
+	{Program: "telos_task_alloc", Hook: "task_alloc"},
+	{Program: "telos_exec_taint", Hook: "bprm_committed_creds"},
+}
+
+// Links to LSM hooks, keyed by program name
+type BPFLinks map[string]link.Link
+
+// Close detaches every hook in the set
+func (l BPFLinks) Close() {
+	for _, lk := range l {
+		lk.Close()
+	}
 }
 
 // === MAIN DAEMON ===
 
+// Options holds the daemon's command-line configuration
+type Options struct {
+	SocketPath         string
+	BPFObjPath         string
+	PinPath            string // directory maps are pinned under (parent must be bpffs)
+	MountBPFFS         bool   // mount bpffs on PinPath's parent if it isn't one
+	EventSink          string // "" disables forwarding
+	EventQueueSize     int
+	EventBufferSize    int           // events kept for SUBSCRIBE resume
+	DedupWindow        time.Duration // 0 disables event deduplication
+	IdleTimeout        time.Duration // 0 disables
+	HandlerWorkers     int           // connection handler pool size (0 = goroutine per connection)
+	MonotonicTaint     bool          // taint may only be raised (CLEAR_TAINT still resets)
+	ExecTaint          uint32        // default exec taint policy (execTaint*)
+	UntrackedTaint     uint32        // default_taint_untracked written at startup
+	MaxExecTaint       uint32        // max_taint_for_exec of a fresh config
+	MaxOpenTaint       uint32        // max_taint_for_open of a fresh config
+	Mode               string        // enforcement mode to write at startup ("" = keep pinned, enforce if fresh)
+	StateFile          string        // "" disables persistence
+	CheckpointInterval time.Duration // 0 = save StateFile on shutdown only
+	ResetConfig        bool          // overwrite a reattached config with defaults
+	Protocol           string        // wire protocol: "native" or "jsonrpc"
+	Debug              bool          // verbose per-connection logging
+	SuggestCommands    bool          // suggest close matches for unknown commands
+	MetricsAddr        string        // "" disables the /metrics HTTP exporter
+	DashboardAddr      string        // "" disables the HTML status page
+	LevelGaugeInterval time.Duration // processes-by-level recount period
+	NATSURL            string        // "" disables the NATS publisher
+	NATSSubject        string
+	KafkaBrokers       string // comma-separated; "" disables the Kafka producer
+	KafkaTopic         string
+	KafkaKey           string        // partition key: "pid" or "cgroup"
+	StateMirror        string        // "" disables the shared state mirror
+	MirrorHost         string        // this host's name in the mirror
+	CommMatchLen       int           // comm bytes compared when validating restored PIDs
+	SelfExempt         bool          // exempt the daemon and its parent from enforcement
+	DefaultAllowlist   bool          // exempt PID 1 and defaultAllowlistComms
+	AllowlistComms     []string      // further comms whose processes are exempt
+	RegisterSelf       bool          // put the daemon's own PID in process_map as CLEAN
+	SelfComm           string        // comm of the daemon's own entry
+	ListenRetries      int           // extra socket listen attempts
+	ListenBackoff      time.Duration // delay before the first retry (doubles)
+	AdminUIDs          []uint32      // non-root UIDs allowed to run SHUTDOWN
+	RateLimit          float64       // commands per second per UID (0 = unlimited)
+	RateBurst          int           // commands a UID may send at once (0 = RateLimit, at least 1)
+	RateLimitExempt    []uint32      // UIDs never rate limited
+	Authz              *authzPolicy  // per-UID command policy (nil = everyone may run everything)
+	AuditLog           string        // "" disables the taint transition audit log
+	IterationBatch     int           // max process_map entries per background pass (0 = all)
+	MapWarnPercent     int           // warn when process_map is this % full (0 = off)
+	StateKey           []byte        // HMAC key for state files (nil = unsigned)
+	SeedFile           string        // "" = no taint seeded on start
+	PolicyDir          string        // "" = no policy files watched
+	Seed               []seedEntry   // validated entries of SeedFile
+	CoalesceWindow     time.Duration // batch UPDATE_TAINT writes per PID (0 = write at once)
+	Observe            bool          // read pinned maps only; load nothing, write nothing
+	MaxSubscribers     int           // live SUBSCRIBE streams allowed (0 = unlimited)
+	BinaryChange       string        // binaryChange*: what a tracked process's binary change does
+	BinaryChangeTaint  uint32        // level raised to by --binary-change escalate
+	SandboxTighten     uint32        // levels thresholds drop for sandboxed processes
+}
+
 type TelosDaemon struct {
 	socketPath string
 	bpfObjPath string
+	opts       Options
 	maps       *BPFMaps
-	links      *BPFLinks
 	listener   net.Listener
 	done       chan struct{}
+	stopOnce   sync.Once
+	conns      connTracker  // live socket connections (see shutdown.go)
+	pool       *handlerPool // nil = goroutine per connection (see workers.go)
+	limiter    *rateLimiter // nil = no per-UID rate limit (see ratelimit.go)
+
+	// bpfMu guards the loaded collection and its links (swapped by reload)
+	bpfMu        sync.Mutex
+	coll         *ebpf.Collection
+	links        BPFLinks
+	attachReport map[string]string // program -> "attached", "missing" or error
+
+	eventReader   *ringbuf.Reader
+	readerRunning atomic.Bool
+	lastEventAt   atomic.Int64 // UnixNano of the last decoded event
+	metricsServer *http.Server
+	dashboard     *http.Server
+	started       time.Time
+	exemptDropped int               // allowlisted PIDs exempt_map had no room for at the last refresh
+	exemptRefused map[uint32]string // allowlist matches refused at the last refresh, and why
+	forwarders    []*eventForwarder
+	hub           *eventHub
+	stateSubs     stateHub
+	fill          mapFill
+	coalesce      updateCoalescer
+	dedup         *eventDedup // nil when disabled
+	egress        egressState
+	pathPolicy    pathPolicyState
+	freezer       freezerState
+	binaries      binaryState
+	shadow        shadowState
+	audit         *auditLog    // nil when disabled
+	mirror        *stateMirror // nil when disabled
+	lockdown      panicState
+	maintenance   maintenanceState
+	policyDir     policyDirState
+
+	// mapMu serializes read-modify-write cycles on process_map
+	mapMu sync.Mutex
+
+	// cfgMu serializes read-modify-write cycles on config_map
+	cfgMu sync.Mutex
+
+	// mu guards userspace bookkeeping shared between connection handlers
+	mu        sync.Mutex
+	updatedAt map[uint32]time.Time // PID -> last time the daemon wrote its entry
+
+	// State persistence (see checkpoint.go)
+	stateGen atomic.Uint64 // bumped on every process_map write
+	stateMu  sync.Mutex    // guards savedGen, serializes saves
+	savedGen uint64
+	persist  func() error // final save at shutdown (saveState)
 }
 
-func NewTelosDaemon(socketPath, bpfObjPath string) *TelosDaemon {
-	return &TelosDaemon{
-		socketPath: socketPath,
-		bpfObjPath: bpfObjPath,
+func NewTelosDaemon(opts Options) *TelosDaemon {
+	d := &TelosDaemon{
+		socketPath: opts.SocketPath,
+		bpfObjPath: opts.BPFObjPath,
+		opts:       opts,
 		done:       make(chan struct{}),
+		updatedAt:  make(map[uint32]time.Time),
+		freezer:    freezerState{frozen: make(map[uint32]*frozenEntry)},
+		hub:        newEventHub(opts.EventBufferSize, opts.MaxSubscribers),
+		limiter:    newRateLimiter(opts.RateLimit, opts.RateBurst, opts.RateLimitExempt),
+		started:    time.Now(),
 	}
+	d.persist = d.saveState
+	return d
 }
 
 // Start loads BPF and starts the socket server
@@ -142,39 +372,248 @@ func (d *TelosDaemon) Start() error {
 	fmt.Println(Cyan + "           ╚═══════════════════════════════╝" + Reset)
 	fmt.Println()
 
-	// Remove memory lock limits for BPF
-	if err := rlimit.RemoveMemlock(); err != nil {
-		return fmt.Errorf("failed to remove memlock: %w", err)
+	// Bail out before touching BPF if another daemon is already serving
+	if err := checkExistingSocket(d.socketPath); err != nil {
+		return err
+	}
+
+	// Remove memory lock limits for BPF (see memlock.go)
+	if err := removeMemlock(); err != nil {
+		return err
+	}
+
+	var missing []string
+	if d.opts.Observe {
+		// Read-only side-car: no programs, no config or state writes (see observe.go)
+		if rejected := observeRejectedFlags(d.opts); len(rejected) > 0 {
+			return fmt.Errorf("--observe cannot be combined with %s, which change state", strings.Join(rejected, ", "))
+		}
+		if err := d.openObservedMaps(); err != nil {
+			return fmt.Errorf("failed to open pinned maps: %w", err)
+		}
+		log.Printf("✓ Observing maps pinned under %s (read-only, nothing loaded or attached)", d.opts.PinPath)
+	} else {
+		// Create pin directory
+		if err := preparePinPath(d.opts.PinPath, d.opts.MountBPFFS); err != nil {
+			return fmt.Errorf("failed to create BPF pin path: %w", err)
+		}
+
+		// Load eBPF program
+		if err := d.loadBPF(); err != nil {
+			return fmt.Errorf("failed to load BPF: %w", err)
+		}
+		log.Println("✓ eBPF program loaded and attached")
+		missing = d.missingPrograms()
+		for _, name := range missing {
+			log.Printf("Warning: %s missing from %s, its hook is not enforced", name, d.bpfObjPath)
+		}
+
+		// Initialize config
+		fresh, err := d.initConfig()
+		if err != nil {
+			return fmt.Errorf("failed to init config: %w", err)
+		}
+		if fresh {
+			log.Printf("✓ Default config initialized (exec blocked above %s, open above %s)",
+				taintLevelName(d.opts.MaxExecTaint), taintLevelName(d.opts.MaxOpenTaint))
+		} else {
+			// --max-exec-taint / --max-open-taint only shape a fresh config
+			if cfg, err := d.activeConfig(); err == nil {
+				log.Printf("✓ Preserved config from pinned config_map (exec blocked above %s, open above %s)",
+					taintLevelName(cfg.MaxTaintForExec), taintLevelName(cfg.MaxTaintForOpen))
+			} else {
+				log.Println("✓ Preserved config from pinned config_map")
+			}
+		}
+		if cfg, err := d.activeConfig(); err == nil {
+			switch cfg.Enabled {
+			case enforceAudit:
+				log.Println("Warning: audit mode: threshold violations are only reported (quarantine still denies)")
+			case enforceOff:
+				log.Println("Warning: enforcement off: nothing is denied; events, taint tracking and queries only")
+			}
+		}
+
+		if comms := d.allowlistComms(); d.opts.SelfExempt || len(comms) > 0 {
+			if d.maps.Exempt == nil {
+				log.Printf("Warning: %s has no exempt_map, daemon and allowlist are not exempt from enforcement", d.bpfObjPath)
+			} else if err := d.refreshExemptions(); err != nil {
+				return fmt.Errorf("failed to exempt daemon: %w", err)
+			} else {
+				go d.runExemptions()
+				if d.opts.SelfExempt {
+					log.Println("✓ Daemon and supervisor exempt from enforcement")
+				}
+				if len(comms) > 0 {
+					log.Printf("✓ Allowlist exempt from enforcement: %s", d.allowlistSummary())
+				}
+			}
+		}
+
+		// Restore taint state unless the pinned map already carried it over
+		if d.opts.StateFile != "" && !d.maps.Reattached["process_map"] {
+			n, err := d.restoreState()
+			if err != nil {
+				return fmt.Errorf("failed to restore state: %w", err)
+			}
+			log.Printf("✓ Restored %d processes from %s", n, d.opts.StateFile)
+		}
+
+		// Seeds go on top of whatever was reattached or restored
+		if d.opts.SeedFile != "" {
+			applied, skipped, err := d.applySeed(d.opts.Seed)
+			if err != nil {
+				return fmt.Errorf("failed to apply seed file: %w", err)
+			}
+			log.Printf("✓ Seeded %d processes from %s (%d entries matched nothing)", applied, d.opts.SeedFile, skipped)
+		}
+
+		if d.opts.RegisterSelf {
+			if err := d.registerSelf(); err != nil {
+				return fmt.Errorf("failed to register daemon in process_map: %w", err)
+			}
+			log.Printf("✓ Registered daemon PID %d as %q", os.Getpid(), d.opts.SelfComm)
+		}
+	}
+	d.resetMapFill(d.countProcesses())
+
+	if d.opts.AuditLog != "" {
+		audit, err := openAuditLog(d.opts.AuditLog)
+		if err != nil {
+			return fmt.Errorf("failed to open audit log: %w", err)
+		}
+		d.audit = audit
+		log.Printf("✓ Auditing taint transitions to %s", d.opts.AuditLog)
+	}
+
+	// Start event forwarding before the reader so no event is missed
+	if d.opts.EventSink != "" {
+		sink, err := newEventSink(d.opts.EventSink)
+		if err != nil {
+			return fmt.Errorf("failed to open event sink: %w", err)
+		}
+		d.forwarders = append(d.forwarders, newEventForwarder(sink, d.opts.EventQueueSize))
+		log.Printf("✓ Forwarding events to %s", sink.Name())
+	}
+	if d.opts.NATSURL != "" {
+		sink, err := newNATSSink(d.opts.NATSURL, d.opts.NATSSubject)
+		if err != nil {
+			return fmt.Errorf("failed to set up NATS publisher: %w", err)
+		}
+		d.forwarders = append(d.forwarders, newEventForwarder(sink, d.opts.EventQueueSize))
+		log.Printf("✓ Publishing events to %s", sink.Name())
+	}
+	if d.opts.KafkaBrokers != "" {
+		sink, err := newKafkaSink(d.opts.KafkaBrokers, d.opts.KafkaTopic, d.opts.KafkaKey)
+		if err != nil {
+			return fmt.Errorf("failed to set up Kafka producer: %w", err)
+		}
+		d.forwarders = append(d.forwarders, newEventForwarder(sink, d.opts.EventQueueSize))
+		log.Printf("✓ Producing events to %s", sink.Name())
+	}
+
+	if d.opts.StateMirror != "" {
+		backend, err := newStateMirror(d.opts.StateMirror)
+		if err != nil {
+			return fmt.Errorf("failed to set up state mirror: %w", err)
+		}
+		d.startStateMirror(backend, d.opts.MirrorHost)
+		log.Printf("✓ Mirroring taint state to %s as %q", backend.Name(), d.opts.MirrorHost)
+	}
+
+	if d.opts.DedupWindow > 0 {
+		d.dedup = newEventDedup(d.opts.DedupWindow, d.emitEvent)
+		go d.dedup.run(d.done)
+	}
+
+	if d.opts.BinaryChange != binaryChangeOff {
+		if d.eventsAvailable() {
+			d.startBinaryHashing()
+			log.Printf("✓ Hashing binaries of tracked processes (on change: %s)", d.opts.BinaryChange)
+		} else {
+			log.Printf("Warning: %s has no events map; --binary-change is inactive", d.bpfObjPath)
+		}
+	}
+
+	// Start draining the events ringbuf; a reduced object may not have one
+	if d.eventsAvailable() {
+		if err := d.startEventReader(); err != nil {
+			return fmt.Errorf("failed to start event reader: %w", err)
+		}
+		log.Println("✓ Event reader started")
+	} else if d.opts.Observe {
+		log.Println("Warning: observing: no events map, so event streaming, shadow mode and egress checks are unavailable")
+	} else {
+		log.Printf("Warning: %s has no events map; event streaming, shadow mode and egress policy are unavailable", d.bpfObjPath)
+	}
+	go d.refreshEgressHosts()
+
+	if d.opts.PolicyDir != "" {
+		if err := d.startPolicyWatch(); err != nil {
+			return fmt.Errorf("failed to watch policy directory: %w", err)
+		}
+		log.Printf("✓ Watching %s for policy files", d.opts.PolicyDir)
+	}
+
+	if d.opts.CoalesceWindow > 0 {
+		go d.runCoalescer()
+		log.Printf("✓ Coalescing taint updates every %s", d.opts.CoalesceWindow)
+	}
+
+	if d.opts.LevelGaugeInterval > 0 {
+		go d.runLevelGauges()
+		if d.batchedGauges() {
+			log.Printf("✓ Walking process_map %d entries per pass", d.opts.IterationBatch)
+		}
+	}
+
+	if missing := undocumentedCommands(); len(missing) > 0 {
+		log.Printf("Warning: no DESCRIBE schema for %s", strings.Join(missing, ", "))
 	}
-	log.Println("✓ Removed memory lock limits")
 
-	// Create pin directory
-	if err := os.MkdirAll(bpfPinPath, 0755); err != nil {
-		return fmt.Errorf("failed to create BPF pin path: %w", err)
+	if d.opts.MetricsAddr != "" {
+		if err := d.startMetricsServer(); err != nil {
+			return fmt.Errorf("failed to start metrics server: %w", err)
+		}
+		log.Printf("✓ Serving metrics on %s", metricsURL(d.opts.MetricsAddr))
 	}
 
-	// Load eBPF program
-	if err := d.loadBPF(); err != nil {
-		return fmt.Errorf("failed to load BPF: %w", err)
+	if d.opts.DashboardAddr != "" {
+		if err := d.startDashboard(); err != nil {
+			return fmt.Errorf("failed to start dashboard: %w", err)
+		}
+		log.Printf("✓ Serving status dashboard on %s", dashboardURL(d.opts.DashboardAddr))
 	}
-	log.Println("✓ eBPF program loaded and attached")
 
-	// Initialize config
-	if err := d.initConfig(); err != nil {
-		return fmt.Errorf("failed to init config: %w", err)
+	if d.opts.StateFile != "" && d.opts.CheckpointInterval > 0 {
+		go d.runCheckpoints()
+		log.Printf("✓ Checkpointing state every %s", d.opts.CheckpointInterval)
 	}
-	log.Println("✓ Default config initialized")
 
 	// Start Unix socket server
 	if err := d.startSocketServer(); err != nil {
 		return fmt.Errorf("failed to start socket server: %w", err)
 	}
 	log.Printf("✓ Listening on %s", d.socketPath)
+	if d.opts.Authz != nil {
+		log.Printf("✓ Command authorization policy: %s", d.opts.Authz.summary())
+	}
+	if d.limiter != nil {
+		log.Printf("✓ Rate limit: %g commands/s per UID (burst %g), exempt UIDs %v",
+			d.limiter.rate, d.limiter.burst, d.opts.RateLimitExempt)
+	}
 
 	fmt.Println()
 	fmt.Println(Green + "  ╔═══════════════════════════════════════════════════════╗" + Reset)
-	fmt.Println(Green + "  ║" + Bold + "        TELOS CORE ONLINE - Enforcing Security         " + Reset + Green + "║" + Reset)
+	if d.opts.Observe {
+		fmt.Println(Green + "  ║" + Bold + "       TELOS CORE ONLINE - Observing (read-only)       " + Reset + Green + "║" + Reset)
+	} else {
+		fmt.Println(Green + "  ║" + Bold + "        TELOS CORE ONLINE - Enforcing Security         " + Reset + Green + "║" + Reset)
+	}
 	fmt.Println(Green + "  ╚═══════════════════════════════════════════════════════╝" + Reset)
+	if len(missing) > 0 {
+		fmt.Println(Yellow + "  Missing programs: " + strings.Join(missing, ", ") + Reset)
+	}
 	fmt.Println()
 
 	return nil
@@ -187,107 +626,425 @@ func (d *TelosDaemon) loadBPF() error {
 	if err != nil {
 		return fmt.Errorf("load collection spec: %w", err)
 	}
+	if err := checkLayouts(spec); err != nil {
+		return err
+	}
+	if !d.opts.ResetConfig {
+		if err := checkPinnedConfig(d.opts.PinPath); err != nil {
+			return err
+		}
+	}
+
+	// Pin state maps by name so a restart reattaches to the previous
+	// run's maps (taint state and tuned config survive)
+	existing := make(map[string]bool)
+	for _, name := range pinnedMaps {
+		if ms := spec.Maps[name]; ms != nil {
+			ms.Pinning = ebpf.PinByName
+			if _, err := os.Stat(filepath.Join(d.opts.PinPath, name)); err == nil {
+				existing[name] = true
+			}
+		}
+	}
+	pinOpts := ebpf.CollectionOptions{Maps: ebpf.MapOptions{PinPath: d.opts.PinPath}}
 
 	// Load into kernel
-	coll, err := ebpf.NewCollection(spec)
+	coll, err := ebpf.NewCollectionWithOptions(spec, pinOpts)
+	var migrations map[string]*mapMigration
+	if errors.Is(err, ebpf.ErrMapIncompatible) {
+		// Layout changed since the pins were made; migrate or recreate
+		// the outdated ones (see migrate.go)
+		log.Printf("Warning: pinned maps incompatible with %s: %v", d.bpfObjPath, err)
+		if migrations, err = migratePins(spec, d.opts.PinPath); err != nil {
+			return err
+		}
+		for _, name := range pinnedMaps {
+			if _, err := os.Stat(filepath.Join(d.opts.PinPath, name)); err != nil {
+				existing[name] = false
+			}
+		}
+		coll, err = ebpf.NewCollectionWithOptions(spec, pinOpts)
+	}
 	if err != nil {
 		return fmt.Errorf("new collection: %w", err)
 	}
+	if err := applyMigrations(coll, migrations); err != nil {
+		coll.Close()
+		return err
+	}
+	// Migrated maps carry the previous run's state like reattached ones
+	for name := range migrations {
+		existing[name] = true
+	}
 
 	// Store map references
-	d.maps = &BPFMaps{
+	maps := &BPFMaps{
 		ProcessMap: coll.Maps["process_map"],
 		ConfigMap:  coll.Maps["config_map"],
 		Events:     coll.Maps["events"],
+		PathPolicy: coll.Maps["path_policy_map"],
+		Exempt:     coll.Maps["exempt_map"],
+		Pins:       make(map[string]string),
+		Reattached: make(map[string]bool),
+	}
+	for _, name := range pinnedMaps {
+		if coll.Maps[name] != nil {
+			maps.Pins[name] = filepath.Join(d.opts.PinPath, name)
+			maps.Reattached[name] = existing[name]
+			if existing[name] {
+				log.Printf("✓ Reattached pinned %s", name)
+			}
+		}
 	}
 
-	// Pin maps for external access
-	processMapPath := filepath.Join(bpfPinPath, "process_map")
-	if err := d.maps.ProcessMap.Pin(processMapPath); err != nil {
-		log.Printf("Warning: Failed to pin process_map: %v", err)
+	// The hooks and the daemon must agree on what they read and write
+	if err := maps.checkValueSizes(); err != nil {
+		coll.Close()
+		return fmt.Errorf("%s: %w", d.bpfObjPath, err)
 	}
+	d.maps = maps
 
 	// Attach LSM hooks
-	d.links = &BPFLinks{}
+	// A required program missing from the object is fatal: the daemon
+	// must not claim to enforce with no exec hook
+	links, report, err := attachHooks(coll, func(h lsmHook) bool {
+		return h.Required
+	})
+	if err != nil {
+		coll.Close()
+		return err
+	}
+
+	d.bpfMu.Lock()
+	d.coll = coll
+	d.links = links
+	d.attachReport = report
+	d.bpfMu.Unlock()
+
+	return nil
+}
+
+// attachHooks attaches every known LSM program found in coll.
+// A failure on a hook for which required() is true detaches everything
+// attached so far and returns an error; other failures are logged.
+// The returned report maps program name -> "attached", "missing" or the error.
+func attachHooks(coll *ebpf.Collection, required func(lsmHook) bool) (BPFLinks, map[string]string, error) {
+	links := BPFLinks{}
+	report := make(map[string]string)
+
+	for _, h := range lsmHooks {
+		prog := coll.Programs[h.Program]
+		if prog == nil {
+			report[h.Program] = "missing"
+			if required(h) {
+				links.Close()
+				return nil, report, fmt.Errorf("required program %s (lsm/%s) not found in object", h.Program, h.Hook)
+			}
+			continue
+		}
 
-	// Attach bprm_check_security
-	prog := coll.Programs["telos_check_exec"]
-	if prog != nil {
 		l, err := link.AttachLSM(link.LSMOptions{
 			Program: prog,
 		})
 		if err != nil {
-			return fmt.Errorf("attach check_exec: %w", err)
+			report[h.Program] = err.Error()
+			if required(h) {
+				links.Close()
+				logAttachHints(err)
+				return nil, report, fmt.Errorf("attach %s: %w", h.Program, err)
+			}
+			log.Printf("Warning: Failed to attach %s: %v", h.Program, err)
+			logAttachHints(err)
+			continue
 		}
-		d.links.CheckExec = l
-		log.Println("  → Attached lsm/bprm_check_security")
+
+		links[h.Program] = l
+		report[h.Program] = "attached"
+		log.Printf("  → Attached lsm/%s", h.Hook)
 	}
 
-	// Attach file_open
-	prog = coll.Programs["telos_check_file"]
-	if prog != nil {
-		l, err := link.AttachLSM(link.LSMOptions{
-			Program: prog,
-		})
-		if err != nil {
-			log.Printf("Warning: Failed to attach check_file: %v", err)
-		} else {
-			d.links.CheckFile = l
-			log.Println("  → Attached lsm/file_open")
+	return links, report, nil
+}
+
+// missingPrograms lists the expected programs the loaded object lacks
+func (d *TelosDaemon) missingPrograms() []string {
+	d.bpfMu.Lock()
+	defer d.bpfMu.Unlock()
+
+	var missing []string
+	for _, h := range lsmHooks {
+		if d.attachReport[h.Program] == "missing" {
+			missing = append(missing, h.Program)
 		}
 	}
+	return missing
+}
 
-	// Attach task_alloc
-	prog = coll.Programs["telos_task_alloc"]
-	if prog != nil {
-		l, err := link.AttachLSM(link.LSMOptions{
-			Program: prog,
-		})
-		if err != nil {
-			log.Printf("Warning: Failed to attach task_alloc: %v", err)
-		} else {
-			d.links.TaskAlloc = l
-			log.Println("  → Attached lsm/task_alloc")
+// bpffsMagic is BPF_FS_MAGIC from linux/magic.h
+const bpffsMagic = 0xcafe4a11
+
+// preparePinPath checks that pinPath lives on a bpffs mount and creates
+// it. Without bpffs, MkdirAll would make a plain directory and every Pin
+// would fail later, so that is caught here; with mount set, bpffs is
+// mounted on the pin path's parent instead.
+func preparePinPath(pinPath string, mount bool) error {
+	if !filepath.IsAbs(pinPath) {
+		return fmt.Errorf("pin path must be absolute: %s", pinPath)
+	}
+
+	parent := filepath.Dir(pinPath)
+	fsType, err := pinFSType(parent)
+	if err != nil {
+		return err
+	}
+	if fsType != bpffsMagic {
+		if !mount {
+			return fmt.Errorf("%s is not a bpffs mount (fs type 0x%x); mount it with "+
+				"'mount -t bpf bpffs %s' or start with --mount-bpffs", parent, fsType, parent)
 		}
+		if err := os.MkdirAll(parent, 0755); err != nil {
+			return err
+		}
+		if err := syscall.Mount("bpffs", parent, "bpf", 0, "mode=0700"); err != nil {
+			return fmt.Errorf("mount bpffs on %s: %w", parent, err)
+		}
+		log.Printf("✓ Mounted bpffs on %s", parent)
 	}
 
-	return nil
+	return os.MkdirAll(pinPath, 0700)
 }
 
-// initConfig sets default configuration
-func (d *TelosDaemon) initConfig() error {
-	config := Config{
-		MaxTaintForExec: TaintMedium, // Block HIGH and above
-		MaxTaintForOpen: TaintHigh,   // Block CRITICAL only for files
-		Enabled:         1,           // Enforce mode
+// pinFSType returns the filesystem type of dir, or of its nearest existing
+// ancestor when dir doesn't exist yet
+func pinFSType(dir string) (uint32, error) {
+	var st syscall.Statfs_t
+	for {
+		err := syscall.Statfs(dir, &st)
+		if err == nil {
+			return uint32(st.Type), nil
+		}
+		if !errors.Is(err, syscall.ENOENT) || dir == "/" {
+			return 0, fmt.Errorf("statfs %s: %w", dir, err)
+		}
+		dir = filepath.Dir(dir)
 	}
+}
 
+// initConfig writes the default configuration, unless a reattached
+// config_map already holds a live one (and --reset-config is not set).
+// It reports whether the defaults were written.
+func (d *TelosDaemon) initConfig() (bool, error) {
 	var key uint32 = 0
-	return d.maps.ConfigMap.Put(key, config)
+
+	if d.maps.Reattached["config_map"] && !d.opts.ResetConfig {
+		var live Config
+		if err := d.maps.ConfigMap.Lookup(key, &live); err != nil {
+			return false, err
+		}
+		// An array slot always exists; all-zero means never written
+		if live != (Config{}) {
+			// Shadow reporting and maintenance belong to the previous run
+			// (whose expiry timer is gone); the exec taint policy,
+			// untracked taint and sandbox tightening always follow the
+			// flags, the mode only when --mode is given
+			mode := live.Enabled
+			if d.opts.Mode != "" {
+				mode = enforceModes[d.opts.Mode]
+			}
+			if live.Maintenance != 0 {
+				log.Println("Warning: previous run left maintenance mode on; enforcement re-engaged")
+			}
+			if live.ReportAllowed != 0 || live.Maintenance != 0 || live.ExecTaint != d.opts.ExecTaint ||
+				live.DefaultTaintUntracked != d.opts.UntrackedTaint || live.Enabled != mode ||
+				live.ReportExec != d.reportExec() || live.SandboxTighten != d.opts.SandboxTighten {
+				live.ReportAllowed = 0
+				live.Maintenance = 0
+				live.ExecTaint = d.opts.ExecTaint
+				live.DefaultTaintUntracked = d.opts.UntrackedTaint
+				live.Enabled = mode
+				live.ReportExec = d.reportExec()
+				live.SandboxTighten = d.opts.SandboxTighten
+				if err := d.putConfigChecked(key, live); err != nil {
+					return false, err
+				}
+			}
+			return false, nil
+		}
+	}
+
+	mode := enforceOn
+	if d.opts.Mode != "" {
+		mode = enforceModes[d.opts.Mode]
+	}
+	config := Config{
+		Version: configVersion,
+
+		MaxTaintForExec: d.opts.MaxExecTaint, // MEDIUM: block HIGH and above
+		MaxTaintForOpen: d.opts.MaxOpenTaint, // HIGH: block CRITICAL only for files
+		Enabled:         mode,                // Enforce unless --mode
+
+		MaxTaintForConnect: TaintCritical, // Report only
+		MaxTaintForPtrace:  TaintCritical, // Never block
+		ExecTaint:          d.opts.ExecTaint,
+
+		DefaultTaintUntracked: d.opts.UntrackedTaint, // CLEAN unless --default-taint-untracked
+		ReportExec:            d.reportExec(),
+		SandboxTighten:        d.opts.SandboxTighten,
+	}
+
+	return true, d.putConfigChecked(key, config)
+}
+
+// putConfigChecked writes cfg at key and reads it back, so startup can't
+// announce enforcement with a config that never landed (the hooks would
+// see an absent or zero config and deny nothing)
+func (d *TelosDaemon) putConfigChecked(key uint32, cfg Config) error {
+	if err := d.maps.ConfigMap.Put(key, cfg); err != nil {
+		return fmt.Errorf("write config_map[%d]: %w", key, err)
+	}
+	var got Config
+	if err := d.maps.ConfigMap.Lookup(key, &got); err != nil {
+		return fmt.Errorf("read back config_map[%d]: %w", key, err)
+	}
+	if got != cfg {
+		return fmt.Errorf("config_map[%d] reads back %+v, wrote %+v", key, got, cfg)
+	}
+	return nil
+}
+
+// responseWriteTimeout bounds how long a client may stall a response
+const responseWriteTimeout = 5 * time.Second
+
+// socketProbeTimeout bounds the liveness check against an existing socket
+const socketProbeTimeout = 2 * time.Second
+
+// checkExistingSocket refuses to start if a live daemon already serves
+// socketPath. A stale socket (nobody answering PING) is left for
+// startSocketServer to remove.
+func checkExistingSocket(socketPath string) error {
+	fi, err := os.Lstat(socketPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if fi.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", socketPath)
+	}
+
+	conn, err := net.DialTimeout("unix", socketPath, socketProbeTimeout)
+	if err != nil {
+		return nil // Nobody listening: stale
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(socketProbeTimeout))
+	if _, err := conn.Write([]byte(`{"command":"PING"}` + "\n")); err != nil {
+		return nil
+	}
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil {
+		return nil
+	}
+
+	// Any JSON answer means a live daemon; a JSON-RPC one rejects the
+	// native PING but still replies
+	if json.Valid(line) {
+		return fmt.Errorf("another instance is already running on %s", socketPath)
+	}
+	return nil
 }
 
 // startSocketServer starts the Unix domain socket listener
 func (d *TelosDaemon) startSocketServer() error {
-	// Remove existing socket
-	os.Remove(d.socketPath)
+	// Refuse to clobber a live daemon's socket
+	if err := checkExistingSocket(d.socketPath); err != nil {
+		return err
+	}
+
+	// Remove stale socket
+	if err := os.Remove(d.socketPath); err == nil {
+		log.Printf("Removed stale socket %s", d.socketPath)
+	}
+
+	// At boot /var/run may not be ready yet
+	if err := os.MkdirAll(filepath.Dir(d.socketPath), 0755); err != nil {
+		return fmt.Errorf("create socket directory: %w", err)
+	}
 
-	listener, err := net.Listen("unix", d.socketPath)
+	listener, err := listenWithRetry(d.socketPath, d.opts.ListenRetries, d.opts.ListenBackoff)
 	if err != nil {
 		return err
 	}
 	d.listener = listener
 
+	// Stop removes the path itself, as its last step (see shutdown.go)
+	if ul, ok := listener.(*net.UnixListener); ok {
+		ul.SetUnlinkOnClose(false)
+	}
+
 	// Set socket permissions
 	os.Chmod(d.socketPath, 0660)
 
+	if d.opts.HandlerWorkers > 0 {
+		d.startHandlerPool(d.opts.HandlerWorkers)
+		log.Printf("✓ Serving connections with %d workers", d.opts.HandlerWorkers)
+	}
+
 	// Accept connections in goroutine
 	go d.acceptConnections()
 
 	return nil
 }
 
+// maxListenBackoff caps the doubling delay between listen attempts
+const maxListenBackoff = 10 * time.Second
+
+// listenWithRetry listens on the Unix socket path, retrying up to
+// retries more times with exponential backoff starting at backoff
+func listenWithRetry(path string, retries int, backoff time.Duration) (net.Listener, error) {
+	for attempt := 0; ; attempt++ {
+		listener, err := net.Listen("unix", path)
+		if err == nil || attempt >= retries {
+			return listener, err
+		}
+		log.Printf("Warning: listen on %s failed (attempt %d/%d), retrying in %s: %v",
+			path, attempt+1, retries+1, backoff, err)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxListenBackoff {
+			backoff = maxListenBackoff
+		}
+	}
+}
+
+// Backoff between retries of a temporarily failing Accept (e.g. out of
+// file descriptors), so the loop can't spin a core
+const (
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+)
+
+// temporaryAcceptErrnos may clear up on their own
+var temporaryAcceptErrnos = []syscall.Errno{
+	syscall.EMFILE, syscall.ENFILE, syscall.ENOBUFS, syscall.ENOMEM,
+	syscall.ECONNABORTED, syscall.EAGAIN, syscall.EPROTO,
+}
+
+// temporaryAcceptError reports whether Accept is worth retrying after err
+func temporaryAcceptError(err error) bool {
+	for _, errno := range temporaryAcceptErrnos {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
 // acceptConnections handles incoming socket connections
 func (d *TelosDaemon) acceptConnections() {
+	var backoff time.Duration
 	for {
 		conn, err := d.listener.Accept()
 		if err != nil {
@@ -295,223 +1052,1070 @@ func (d *TelosDaemon) acceptConnections() {
 			case <-d.done:
 				return
 			default:
-				log.Printf("Accept error: %v", err)
+			}
+			metrics.AcceptErrors.Add(1)
+
+			if errors.Is(err, syscall.EINTR) {
 				continue
 			}
+			if !temporaryAcceptError(err) {
+				// Nobody can reach the daemon any more; go down the same
+				// way as SIGTERM so a supervisor restarts it
+				log.Printf("Accept failed permanently: %v; shutting down", err)
+				syscall.Kill(os.Getpid(), syscall.SIGTERM)
+				return
+			}
+
+			if backoff == 0 {
+				backoff = minAcceptBackoff
+			} else if backoff *= 2; backoff > maxAcceptBackoff {
+				backoff = maxAcceptBackoff
+			}
+			log.Printf("Accept error: %v; retrying in %s", err, backoff)
+			select {
+			case <-d.done:
+				return
+			case <-time.After(backoff):
+			}
+			continue
 		}
-		go d.handleConnection(conn)
+		backoff = 0
+		if !d.conns.add(conn) {
+			conn.Close() // Accepted while Stop was draining
+			continue
+		}
+		d.dispatchConnection(conn)
 	}
 }
 
 // handleConnection processes a single socket connection
-func (d *TelosDaemon) handleConnection(conn net.Conn) {
-	defer conn.Close()
+func (d *TelosDaemon) handleConnection(raw net.Conn) {
+	conn := &syncConn{Conn: raw}
+
+	// Ends the state notification pump, if any, with the connection
+	closed := make(chan struct{})
+	var stateSub *stateSub
+	release := func() {
+		if stateSub != nil {
+			d.stateSubs.unsubscribe(stateSub)
+		}
+		close(closed)
+		conn.Close()
+		d.conns.remove(raw)
+	}
+	streaming := false // Released by the SUBSCRIBE goroutine instead
+	compressMin := 0   // SET_COMPRESSION threshold (0 = off)
+	defer func() {
+		if !streaming {
+			release()
+		}
+	}()
+
+	// Peer credentials are fixed for the connection's lifetime
+	peer := d.connPeer(conn)
 
 	reader := bufio.NewReader(conn)
 
 	for {
+		// Idle timeout is reset on every received command
+		if d.opts.IdleTimeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(d.opts.IdleTimeout))
+		}
+
 		// Read JSON line
-		line, err := reader.ReadBytes('\n')
+		line, err := readLine(reader, maxCommandLine)
+		if errors.Is(err, errLineTooLong) {
+			if d.opts.Protocol == protocolJSONRPC {
+				d.writeLine(conn, rpcErrorLine(nil, rpcInvalidRequest, fmt.Sprintf("Request exceeds %d bytes", maxCommandLine), ErrInvalidArg))
+			} else {
+				d.sendResponse(conn, invalidArg("Command exceeds %d bytes", maxCommandLine))
+			}
+			return // Can't resync mid-line
+		}
 		if err != nil {
+			var netErr net.Error
+			if d.stopping() {
+				return // Woken by Stop draining connections
+			}
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				metrics.ConnectionsClosedIdle.Add(1)
+				log.Printf("Closing connection idle for %s", d.opts.IdleTimeout)
+			}
 			return // Connection closed
 		}
 
+		// Nothing new is started once shutdown has begun
+		if d.stopping() {
+			return
+		}
+
+		if d.opts.Protocol == protocolJSONRPC {
+			if out := d.handleRPC(line, peer); out != nil {
+				if err := d.writeLine(conn, out); err != nil {
+					return
+				}
+			}
+			continue
+		}
+
 		// Parse command
 		var cmd IPCCommand
-		if err := json.Unmarshal(line, &cmd); err != nil {
-			d.sendResponse(conn, IPCResponse{
-				Success: false,
-				Error:   "Invalid JSON: " + err.Error(),
-			})
+		if err := decodeData(line, &cmd); err != nil {
+			if err := d.sendResponse(conn, invalidArg("Invalid JSON: %v", err)); err != nil {
+				return
+			}
+			continue
+		}
+
+		// Connection-level commands bypass handleCommand; limit and
+		// authorize them here
+		if connCommands[cmd.Command] {
+			resp, ok := d.rateLimit(cmd.Command, peer)
+			if ok {
+				resp, ok = d.authorize(cmd.Command, peer)
+			}
+			if !ok {
+				metrics.CommandsTotal.Add(1)
+				if err := d.sendResponse(conn, resp); err != nil {
+					return
+				}
+				continue
+			}
+		}
+
+		// SUBSCRIBE takes over the connection for streaming
+		if cmd.Command == "SUBSCRIBE" {
+			metrics.CommandsTotal.Add(1)
+			if resp, ok := d.requireEvents(cmd.Command); !ok {
+				if err := d.sendResponse(conn, resp); err != nil {
+					return
+				}
+				continue
+			}
+			sub, resp, ok := d.openSubscription(cmd.Data)
+			if !ok {
+				if err := d.sendResponse(conn, resp); err != nil {
+					return
+				}
+				continue
+			}
+			if d.pool != nil {
+				// Streams can last for hours; don't hold a worker for them
+				streaming = true
+				go func() {
+					defer release()
+					d.serveSubscription(conn, sub)
+				}()
+				return
+			}
+			d.serveSubscription(conn, sub)
+			return
+		}
+
+		// SUBSCRIBE_STATE adds notification frames to this connection
+		if cmd.Command == "SUBSCRIBE_STATE" {
+			metrics.CommandsTotal.Add(1)
+			if stateSub == nil {
+				stateSub = d.subscribeState(conn, closed)
+			}
+			if err := d.sendResponse(conn, IPCResponse{Success: true, Data: map[string]interface{}{"subscribed": true}}); err != nil {
+				return
+			}
+			continue
+		}
+
+		// SET_COMPRESSION applies to this connection's responses
+		if cmd.Command == "SET_COMPRESSION" {
+			metrics.CommandsTotal.Add(1)
+			var resp IPCResponse
+			compressMin, resp = setCompression(cmd.Data, compressMin)
+			if err := d.sendResponse(conn, resp); err != nil {
+				return
+			}
+			continue
+		}
+
+		// SHUTDOWN needs the peer's credentials (see auth.go)
+		if cmd.Command == "SHUTDOWN" {
+			metrics.CommandsTotal.Add(1)
+			if d.handleShutdown(conn) {
+				return
+			}
 			continue
 		}
 
 		// Handle command
-		resp := d.handleCommand(cmd)
-		d.sendResponse(conn, resp)
+		resp := d.handleCommand(cmd, peer)
+		if err := d.sendResponseCompressed(conn, resp, compressMin); err != nil {
+			return // Peer gone or stalled; never leave a half-written line
+		}
 	}
 }
 
-// handleCommand dispatches commands to handlers
-func (d *TelosDaemon) handleCommand(cmd IPCCommand) IPCResponse {
-	switch cmd.Command {
-	case "PING":
+// commandHandler runs one IPC command
+type commandHandler func(d *TelosDaemon, data map[string]interface{}) IPCResponse
+
+// peerCommandHandler runs an IPC command that also needs the caller's
+// credentials (nil when unknown)
+type peerCommandHandler func(d *TelosDaemon, data map[string]interface{}, peer *syscall.Ucred) IPCResponse
+
+// commands is the IPC command registry, keyed by native command name.
+// Every wire protocol dispatches through it (see jsonrpc.go).
+var commands = map[string]commandHandler{
+	"PING": func(*TelosDaemon, map[string]interface{}) IPCResponse {
 		return IPCResponse{Success: true, Data: "pong"}
+	},
+	"INCREMENT_TAINT": func(d *TelosDaemon, data map[string]interface{}) IPCResponse {
+		return d.cmdAdjustTaint(data, +1)
+	},
+	"DECREMENT_TAINT": func(d *TelosDaemon, data map[string]interface{}) IPCResponse {
+		return d.cmdAdjustTaint(data, -1)
+	},
+	"CLEAR_TAINT":    (*TelosDaemon).cmdClearTaint,
+	"REGISTER_AGENT": (*TelosDaemon).cmdRegisterAgent,
+	"SET_COMM":       (*TelosDaemon).cmdSetComm,
+	"GET_STATE": func(d *TelosDaemon, _ map[string]interface{}) IPCResponse {
+		return d.cmdGetState()
+	},
+	"GET_PROCESS_TREE": func(d *TelosDaemon, _ map[string]interface{}) IPCResponse {
+		return d.cmdGetProcessTree()
+	},
+	"HEALTH": func(d *TelosDaemon, _ map[string]interface{}) IPCResponse {
+		return d.cmdHealth()
+	},
+	"RELOAD_BPF": (*TelosDaemon).cmdReloadBPF,
+	"GET_MAP_INFO": func(d *TelosDaemon, _ map[string]interface{}) IPCResponse {
+		return d.cmdGetMapInfo()
+	},
+	"GET_BPF_INFO": func(d *TelosDaemon, _ map[string]interface{}) IPCResponse {
+		return d.cmdGetBPFInfo()
+	},
+	"FREEZE_PID": (*TelosDaemon).cmdFreezePID,
+	"THAW_PID":   (*TelosDaemon).cmdThawPID,
+	"LIST_FROZEN": func(d *TelosDaemon, _ map[string]interface{}) IPCResponse {
+		return d.cmdListFrozen()
+	},
+	"SET_CONFIG":     (*TelosDaemon).cmdSetConfig,
+	"SET_CONFIG_KEY": (*TelosDaemon).cmdSetConfigKey,
+	"GET_CONFIG_KEY": (*TelosDaemon).cmdGetConfigKey,
+	"LIST_CONFIG_KEYS": func(d *TelosDaemon, _ map[string]interface{}) IPCResponse {
+		return d.cmdListConfigKeys()
+	},
+	"SET_THRESHOLD":     (*TelosDaemon).cmdSetThreshold,
+	"SET_SHADOW_CONFIG": (*TelosDaemon).cmdSetShadowConfig,
+	"GET_SHADOW_DIFF":   (*TelosDaemon).cmdGetShadowDiff,
+	"QUARANTINE_PID":    (*TelosDaemon).cmdQuarantinePID,
+	"UNQUARANTINE_PID":  (*TelosDaemon).cmdUnquarantinePID,
+	"SET_PATH_POLICY":   (*TelosDaemon).cmdSetPathPolicy,
+	"GET_PATH_POLICY": func(d *TelosDaemon, _ map[string]interface{}) IPCResponse {
+		return d.cmdGetPathPolicy()
+	},
+	"GET_EFFECTIVE_POLICY": (*TelosDaemon).cmdGetEffectivePolicy,
+	"SIMULATE_TAINT":       (*TelosDaemon).cmdSimulateTaint,
+	"SET_EGRESS_POLICY":    (*TelosDaemon).cmdSetEgressPolicy,
+	"GET_EGRESS_POLICY": func(d *TelosDaemon, _ map[string]interface{}) IPCResponse {
+		return d.cmdGetEgressPolicy()
+	},
+	"GET_METRICS": func(d *TelosDaemon, _ map[string]interface{}) IPCResponse {
+		return d.cmdGetMetrics()
+	},
+	"EXPORT_CSV":      (*TelosDaemon).cmdExportCSV,
+	"IMPORT_CSV":      (*TelosDaemon).cmdImportCSV,
+	"DIFF_STATE":      (*TelosDaemon).cmdDiffState,
+	"REPLAY":          (*TelosDaemon).cmdReplay,
+	"GET_PEER_STATE":  (*TelosDaemon).cmdGetPeerState,
+	"GET_FULL_POLICY": (*TelosDaemon).cmdGetFullPolicy,
+	"GET_OVERHEAD":    (*TelosDaemon).cmdGetOverhead,
+	"SET_FULL_POLICY": (*TelosDaemon).cmdSetFullPolicy,
+	"REEVALUATE":      (*TelosDaemon).cmdReevaluate,
+	"GET_DENIALS":     (*TelosDaemon).cmdGetDenials,
+	"SWAP_MAP":        (*TelosDaemon).cmdSwapMap,
+	"GET_PROCESS":     (*TelosDaemon).cmdGetProcess,
+}
 
-	case "UPDATE_TAINT":
-		return d.cmdUpdateTaint(cmd.Data)
+// peerCommands are registry commands whose handlers need the caller
+var peerCommands = map[string]peerCommandHandler{
+	"UPDATE_TAINT":    (*TelosDaemon).cmdUpdateTaint,
+	"PANIC_MODE":      (*TelosDaemon).cmdPanicMode,
+	"EXIT_PANIC_MODE": (*TelosDaemon).cmdExitPanicMode,
 
-	case "CLEAR_TAINT":
-		return d.cmdClearTaint(cmd.Data)
+	"ENTER_MAINTENANCE": (*TelosDaemon).cmdEnterMaintenance,
+	"EXIT_MAINTENANCE":  (*TelosDaemon).cmdExitMaintenance,
+}
 
-	case "REGISTER_AGENT":
-		return d.cmdRegisterAgent(cmd.Data)
+// lookupCommand finds name in either registry
+func lookupCommand(name string) (peerCommandHandler, bool) {
+	if h, ok := peerCommands[name]; ok {
+		return h, true
+	}
+	h, ok := commands[name]
+	if !ok {
+		return nil, false
+	}
+	return func(d *TelosDaemon, data map[string]interface{}, _ *syscall.Ucred) IPCResponse {
+		return h(d, data)
+	}, true
+}
 
-	case "GET_STATE":
-		return d.cmdGetState()
+// handleCommand dispatches commands to handlers once the peer's
+// authorization policy allows them
+func (d *TelosDaemon) handleCommand(cmd IPCCommand, peer *syscall.Ucred) (resp IPCResponse) {
+	metrics.CommandsTotal.Add(1)
 
-	default:
+	// A handler bug must not take the daemon down with it
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Warning: panic handling %s: %v", cmd.Command, r)
+			resp = errorResponse(ErrInternal, "Internal error handling %s", cmd.Command)
+		}
+	}()
+
+	if resp, ok := d.rateLimit(cmd.Command, peer); !ok {
+		return resp
+	}
+	handler, ok := lookupCommand(cmd.Command)
+	if !ok {
+		return errorResponse(ErrUnknownCommand, "Unknown command: %s%s", cmd.Command, d.didYouMean(cmd.Command, commandNames()))
+	}
+	if resp, ok := d.authorize(cmd.Command, peer); !ok {
+		return resp
+	}
+	if resp, refused := d.readOnly(cmd.Command); refused {
+		return resp
+	}
+	return handler(d, cmd.Data, peer)
+}
+
+// cmdUpdateTaint updates taint level for a PID
+func (d *TelosDaemon) cmdUpdateTaint(data map[string]interface{}, peer *syscall.Ucred) IPCResponse {
+	pid, thread, err := processArg(data)
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+
+	level, err := levelArg(data, "taint_level")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+
+	d.mapMu.Lock()
+	defer d.mapMu.Unlock()
+
+	// Update or create entry, keeping comm/sandbox state
+	info, exists, err := d.trackedEntry(pid)
+	if err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+	if !exists {
+		info = ProcessInfo{PID: pid, TaintLevel: TaintClean}
+	}
+	current := info.TaintLevel
+	if queued, ok := d.coalesce.peek(pid); ok {
+		current = queued
+	}
+	if d.opts.MonotonicTaint && level < current {
 		return IPCResponse{
 			Success: false,
-			Error:   "Unknown command: " + cmd.Command,
+			Error:   fmt.Sprintf("monotonic mode: PID %d taint %d cannot be lowered to %d", pid, current, level),
 		}
 	}
+	result := map[string]interface{}{
+		"pid":         pid,
+		"taint_level": level,
+		"level":       taintLevelName(level),
+	}
+	if thread != 0 {
+		result["thread_id"] = thread
+	}
+
+	// Coalesced: the next flush writes the latest level (see coalesce.go)
+	if d.opts.CoalesceWindow > 0 && level < TaintCritical {
+		if d.coalesce.queue(pid, level) {
+			metrics.UpdatesCoalesced.Add(1)
+		}
+		result["queued"] = true
+		return IPCResponse{Success: true, Data: result}
+	}
+	if _, ok := d.coalesce.take(pid); ok {
+		metrics.UpdatesCoalesced.Add(1) // Superseded by this write
+	}
+
+	if err := d.putTaintLocked(info, exists, level, "UPDATE_TAINT"); err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+	d.auditTaint(info, info.TaintLevel, level, "UPDATE_TAINT", peer)
+	log.Printf("[UPDATE] PID %d taint -> %s", pid, taintLevelName(level))
+	return IPCResponse{Success: true, Data: result}
 }
 
-// cmdUpdateTaint updates taint level for a PID
-func (d *TelosDaemon) cmdUpdateTaint(data map[string]interface{}) IPCResponse {
-	pidFloat, ok := data["pid"].(float64)
-	if !ok {
-		return IPCResponse{Success: false, Error: "Missing or invalid 'pid'"}
+// putTaintLocked writes info at level and does the bookkeeping for a
+// taint change; a write that leaves the level as it was is not
+// announced. Caller holds mapMu.
+func (d *TelosDaemon) putTaintLocked(info ProcessInfo, exists bool, level uint32, source string) error {
+	oldLevel := info.TaintLevel
+	info.TaintLevel = level
+
+	if err := d.maps.ProcessMap.Put(info.PID, info); err != nil {
+		return err
+	}
+	if !exists {
+		d.noteMapInsert()
 	}
-	pid := uint32(pidFloat)
 
-	levelFloat, ok := data["taint_level"].(float64)
-	if !ok {
-		return IPCResponse{Success: false, Error: "Missing or invalid 'taint_level'"}
+	recordTaintChange(oldLevel, level)
+	d.touch(info.PID)
+	metrics.TaintUpdates.Add(1)
+	if oldLevel != level {
+		d.notifyTaint(info.PID, oldLevel, level, source)
 	}
-	level := uint32(levelFloat)
+	return nil
+}
 
-	// Update or create entry
-	info := ProcessInfo{
-		PID:        pid,
-		TaintLevel: level,
+// cmdAdjustTaint handles INCREMENT_TAINT / DECREMENT_TAINT ({pid, delta}).
+// The read-modify-write happens under mapMu so concurrent deltas compose.
+func (d *TelosDaemon) cmdAdjustTaint(data map[string]interface{}, sign int) IPCResponse {
+	pid, _, err := processArg(data)
+	if err != nil {
+		return invalidArg("%v", err)
 	}
 
-	if err := d.maps.ProcessMap.Put(pid, info); err != nil {
+	deltaArg, err := uintArg(data, "delta", TaintCritical)
+	if err != nil || deltaArg == 0 {
+		return invalidArg("Missing or invalid 'delta' (integer 1..%d)", TaintCritical)
+	}
+	delta := sign * int(deltaArg)
+
+	if delta < 0 && d.opts.MonotonicTaint {
+		return IPCResponse{Success: false, Error: "monotonic mode: taint cannot be decremented"}
+	}
+
+	d.mapMu.Lock()
+	defer d.mapMu.Unlock()
+	d.settleLocked(pid)
+
+	info, exists, err := d.trackedEntry(pid)
+	if err != nil {
 		return IPCResponse{Success: false, Error: err.Error()}
 	}
+	if !exists {
+		info = ProcessInfo{PID: pid, TaintLevel: TaintClean}
+	}
 
-	log.Printf("[UPDATE] PID %d taint -> %d", pid, level)
-	return IPCResponse{Success: true}
+	// Clamp to CLEAN..CRITICAL
+	level := int(info.TaintLevel) + delta
+	if level < TaintClean {
+		level = TaintClean
+	}
+	if level > TaintCritical {
+		level = TaintCritical
+	}
+	old := info.TaintLevel
+
+	source := "INCREMENT_TAINT"
+	if sign < 0 {
+		source = "DECREMENT_TAINT"
+	}
+	if err := d.putTaintLocked(info, exists, uint32(level), source); err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+	log.Printf("[ADJUST] PID %d taint %s -> %s (delta %+d)", pid, taintLevelName(old), taintLevelName(uint32(level)), delta)
+	return IPCResponse{Success: true, Data: map[string]interface{}{
+		"pid":         pid,
+		"taint_level": level,
+		"level":       taintLevelName(uint32(level)),
+	}}
 }
 
-// cmdClearTaint removes a PID from the taint map
+// raiseTaint lifts pid's taint to level if it is currently lower.
+// This is the internal update path for daemon-originated escalations.
+func (d *TelosDaemon) raiseTaint(pid, level uint32, reason string) (bool, error) {
+	d.mapMu.Lock()
+	defer d.mapMu.Unlock()
+	d.settleLocked(pid)
+
+	info, exists, err := d.trackedEntry(pid)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		info = ProcessInfo{PID: pid, TaintLevel: TaintClean}
+	}
+	if info.TaintLevel >= level {
+		return false, nil
+	}
+
+	old := info.TaintLevel
+	if err := d.putTaintLocked(info, exists, level, "escalation: "+reason); err != nil {
+		return false, err
+	}
+	log.Printf("[ESCALATE] PID %d taint %d -> %d (%s)", pid, old, level, reason)
+	return true, nil
+}
+
+// cmdClearTaint removes a PID from the taint map ({pid, start_time?}).
+// With start_time (field 22 of /proc/<pid>/stat) the clear only happens
+// if the PID still belongs to that process, so a late clear can't wipe
+// the taint of a new process that reused the PID.
 func (d *TelosDaemon) cmdClearTaint(data map[string]interface{}) IPCResponse {
-	pidFloat, ok := data["pid"].(float64)
-	if !ok {
-		return IPCResponse{Success: false, Error: "Missing or invalid 'pid'"}
+	pid, thread, err := processArg(data)
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	var startTime uint64
+	_, checkStart := data["start_time"]
+	if checkStart {
+		if startTime, err = uintArg(data, "start_time", math.MaxUint64); err != nil {
+			return invalidArg("%v", err)
+		}
+	}
+
+	d.mapMu.Lock()
+	defer d.mapMu.Unlock()
+	if checkStart {
+		st, err := readProcStat(pid)
+		if err != nil {
+			return errorResponse(ErrConflict, "PID %d is no longer running", pid)
+		}
+		if st.StartTime != startTime {
+			return errorResponse(ErrConflict, "PID %d was reused (start_time %d, expected %d)", pid, st.StartTime, startTime)
+		}
 	}
-	pid := uint32(pidFloat)
+	d.discardPending(pid)
 
 	if err := d.maps.ProcessMap.Delete(pid); err != nil {
 		// Ignore "not found" errors
 		log.Printf("[CLEAR] PID %d (was not tracked)", pid)
 	} else {
 		log.Printf("[CLEAR] PID %d taint cleared", pid)
+		d.noteMapDelete()
+		d.notifyClear(pid, "CLEAR_TAINT")
 	}
+	d.forget(pid)
 
+	// A cleared process no longer needs containment
+	if _, err := d.thawPID(pid); err != nil {
+		log.Printf("Warning: auto-thaw of PID %d failed: %v", pid, err)
+	}
+
+	if thread != 0 {
+		return IPCResponse{Success: true, Data: map[string]interface{}{"pid": pid, "thread_id": thread}}
+	}
 	return IPCResponse{Success: true}
 }
 
-// cmdRegisterAgent adds an agent to tracking
+// cmdRegisterAgent adds an agent to tracking ({pid, comm?, initial_taint?,
+// sandboxed?, force_clean?}). Registering a tracked PID again (a
+// controller reconnecting) only updates comm and the sandbox mark: taint
+// never drops below the current level unless force_clean is set, which
+// resets it to initial_taint.
 func (d *TelosDaemon) cmdRegisterAgent(data map[string]interface{}) IPCResponse {
-	pidFloat, ok := data["pid"].(float64)
-	if !ok {
-		return IPCResponse{Success: false, Error: "Missing or invalid 'pid'"}
+	pid, thread, err := processArg(data)
+	if err != nil {
+		return invalidArg("%v", err)
 	}
-	pid := uint32(pidFloat)
 
-	comm, _ := data["comm"].(string)
+	comm, err := stringArg(data, "comm")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	// The kernel would silently truncate; make the caller decide
+	if len(comm) > maxCommLen {
+		return invalidArg("Invalid 'comm': %d bytes, at most %d", len(comm), maxCommLen)
+	}
+	if !utf8.ValidString(comm) {
+		return invalidArg("Invalid 'comm': not valid UTF-8")
+	}
+	initial := uint32(TaintClean)
+	if _, ok := data["initial_taint"]; ok {
+		if initial, err = levelArg(data, "initial_taint"); err != nil {
+			return invalidArg("%v", err)
+		}
+	}
+	sandboxed, err := boolArg(data, "sandboxed")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	forceClean, err := boolArg(data, "force_clean")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
 
 	info := ProcessInfo{
 		PID:        pid,
-		TaintLevel: TaintClean,
+		TaintLevel: initial,
+		Comm:       commBytes(comm),
+	}
+	if sandboxed {
+		info.IsSandboxed = 1
 	}
 
-	// Copy comm name
-	if comm != "" {
-		copy(info.Comm[:], []byte(comm))
+	d.mapMu.Lock()
+	defer d.mapMu.Unlock()
+	d.discardPending(pid)
+
+	// Re-registering must not lift a quarantine or sandbox, or lower
+	// taint unless asked to (and never in monotonic mode)
+	old, exists, err := d.trackedEntry(pid)
+	if err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+	if exists {
+		info.Quarantined = old.Quarantined
+		info.IsSandboxed |= old.IsSandboxed
+		if comm == "" {
+			info.Comm = old.Comm
+		}
+		if old.TaintLevel > info.TaintLevel {
+			if forceClean && d.opts.MonotonicTaint {
+				return IPCResponse{
+					Success: false,
+					Error:   fmt.Sprintf("monotonic mode: PID %d taint %d cannot be lowered to %d", pid, old.TaintLevel, info.TaintLevel),
+				}
+			}
+			if !forceClean {
+				info.TaintLevel = old.TaintLevel
+			}
+		}
+		if forceClean {
+			log.Printf("[REGISTER] PID %d (%s) re-registered with force_clean: taint %s -> %s",
+				pid, commString(info.Comm), taintLevelName(old.TaintLevel), taintLevelName(info.TaintLevel))
+		} else {
+			log.Printf("[REGISTER] PID %d (%s) re-registered: keeping taint %s",
+				pid, commString(info.Comm), taintLevelName(info.TaintLevel))
+		}
+	} else if comm == "" {
+		if st, err := readProcStat(pid); err == nil {
+			info.Comm = commBytes(st.Comm)
+		}
 	}
 
 	if err := d.maps.ProcessMap.Put(pid, info); err != nil {
 		return IPCResponse{Success: false, Error: err.Error()}
 	}
+	if !exists {
+		d.noteMapInsert()
+	}
+	if info.TaintLevel != old.TaintLevel {
+		recordTaintChange(old.TaintLevel, info.TaintLevel)
+		d.notifyTaint(pid, old.TaintLevel, info.TaintLevel, "REGISTER_AGENT")
+	}
 
-	log.Printf("[REGISTER] Agent PID %d (%s)", pid, comm)
-	return IPCResponse{Success: true}
+	d.touch(pid)
+	if !exists {
+		log.Printf("[REGISTER] Agent PID %d (%s) at %s", pid, comm, taintLevelName(info.TaintLevel))
+	}
+	result := map[string]interface{}{
+		"pid":           pid,
+		"taint_level":   info.TaintLevel,
+		"level":         taintLevelName(info.TaintLevel),
+		"sandboxed":     info.IsSandboxed != 0,
+		"re_registered": exists,
+	}
+	if exists {
+		result["previous_level"] = taintLevelName(old.TaintLevel)
+	}
+	if thread != 0 {
+		result["thread_id"] = thread
+	}
+	// For a later CLEAR_TAINT {start_time}
+	if st, err := readProcStat(pid); err == nil {
+		result["start_time"] = st.StartTime
+	}
+	return IPCResponse{Success: true, Data: result}
 }
 
-// cmdGetState returns current map state (for debugging)
+// cmdGetState returns current map state (for debugging).
+// See snapshot.go for the consistency guarantee.
 func (d *TelosDaemon) cmdGetState() IPCResponse {
 	state := make(map[string]interface{})
 	processes := make(map[uint32]map[string]interface{})
 
-	iter := d.maps.ProcessMap.Iterate()
-	var key uint32
-	var value ProcessInfo
+	snapshot, err := d.snapshotProcesses()
+	if err != nil {
+		return IPCResponse{Success: false, Error: "snapshot process_map: " + err.Error()}
+	}
 
-	for iter.Next(&key, &value) {
-		processes[key] = map[string]interface{}{
+	for _, e := range snapshot {
+		key, value := e.PID, e.Info
+		entry := map[string]interface{}{
 			"taint_level": value.TaintLevel,
+			"level":       taintLevelName(value.TaintLevel),
 			"sandboxed":   value.IsSandboxed,
+			"quarantined": value.Quarantined != 0,
+		}
+		if id, name := cgroups.ForPID(key); id != 0 {
+			entry["cgroup_id"] = id
+			if name != "" {
+				entry["container"] = name
+			}
 		}
+		processes[key] = entry
 	}
 
 	state["processes"] = processes
 	state["count"] = len(processes)
 
+	d.cfgMu.Lock()
+	state["maintenance"] = d.maintenanceJSON()
+	d.cfgMu.Unlock()
+
 	return IPCResponse{Success: true, Data: state}
 }
 
-// sendResponse writes a JSON response to the connection
-func (d *TelosDaemon) sendResponse(conn net.Conn, resp IPCResponse) {
-	data, _ := json.Marshal(resp)
-	conn.Write(data)
-	conn.Write([]byte("\n"))
+// touch records that the daemon just wrote the entry for pid
+func (d *TelosDaemon) touch(pid uint32) {
+	d.mu.Lock()
+	d.updatedAt[pid] = time.Now()
+	d.mu.Unlock()
+	d.stateGen.Add(1)
 }
 
-// Stop gracefully shuts down the daemon
-func (d *TelosDaemon) Stop() {
-	log.Println("Shutting down Telos Core...")
+// forget drops bookkeeping for a PID removed from the map
+func (d *TelosDaemon) forget(pid uint32) {
+	d.mu.Lock()
+	delete(d.updatedAt, pid)
+	d.mu.Unlock()
+	d.forgetBinary(pid)
+	d.stateGen.Add(1)
+}
 
-	close(d.done)
+// lastUpdated returns when the daemon last wrote pid's entry (zero if unknown)
+func (d *TelosDaemon) lastUpdated(pid uint32) time.Time {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.updatedAt[pid]
+}
 
-	if d.listener != nil {
-		d.listener.Close()
+// sendResponse writes a JSON response to the connection
+func (d *TelosDaemon) sendResponse(conn net.Conn, resp IPCResponse) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		data, _ = json.Marshal(errorResponse(ErrInternal, "Encode response: %v", err))
 	}
+	return d.writeLine(conn, data)
+}
 
-	// Detach LSM hooks
-	if d.links != nil {
-		if d.links.CheckExec != nil {
-			d.links.CheckExec.Close()
-		}
-		if d.links.CheckFile != nil {
-			d.links.CheckFile.Close()
-		}
-		if d.links.TaskAlloc != nil {
-			d.links.TaskAlloc.Close()
-		}
+// sendJSON writes any JSON value as one line (used for streamed events)
+func (d *TelosDaemon) sendJSON(conn net.Conn, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return d.writeLine(conn, data)
+}
+
+// writeLine writes one newline-terminated message to the connection.
+// The message and newline go out as one buffer, looping on short writes;
+// on error the caller must drop the connection, as the stream is no
+// longer line-aligned.
+func (d *TelosDaemon) writeLine(conn net.Conn, data []byte) error {
+	if sc, ok := conn.(*syncConn); ok {
+		sc.wmu.Lock()
+		defer sc.wmu.Unlock()
 	}
 
-	// Clean up socket
-	os.Remove(d.socketPath)
+	buf := make([]byte, 0, len(data)+1)
+	buf = append(append(buf, data...), '\n')
 
-	log.Println("TELOS CORE offline")
+	total := len(buf)
+	conn.SetWriteDeadline(time.Now().Add(responseWriteTimeout))
+	for len(buf) > 0 {
+		n, err := conn.Write(buf)
+		if err != nil {
+			d.debugf("Dropping connection: write failed with %d of %d bytes unsent: %v",
+				len(buf)-n, total, err)
+			return err
+		}
+		buf = buf[n:]
+	}
+	return nil
+}
+
+// debugf logs only with --debug
+func (d *TelosDaemon) debugf(format string, args ...interface{}) {
+	if d.opts.Debug {
+		log.Printf("[DEBUG] "+format, args...)
+	}
 }
 
 // === MAIN ===
 
 func main() {
+	// Control subcommands run as a client against a live daemon
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		name := os.Args[1]
+		if sub, ok := subcommands[name]; ok {
+			os.Exit(sub(os.Args[2:]))
+		}
+		if name != "run" {
+			fmt.Fprintf(os.Stderr, "Unknown subcommand %q (want run, status, reload, stop or bench)\n", name)
+			os.Exit(clientExitUsage)
+		}
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+	}
+
 	socketPath := flag.String("socket", defaultSocketPath, "Unix socket path")
 	bpfObj := flag.String("bpf-obj", defaultBPFObj, "Path to compiled BPF object")
+	pinPath := flag.String("pin-path", defaultPinPath, "Directory to pin BPF maps under (on bpffs)")
+	mountBPFFS := flag.Bool("mount-bpffs", false, "Mount bpffs on the --pin-path parent if it is not already")
+	eventSink := flag.String("event-sink", "", "Forward events to file:<path> or http(s)://<url>")
+	eventQueue := flag.Int("event-queue", defaultEventQueueSize, "Event forwarding queue size (oldest dropped when full)")
+	eventBuffer := flag.Int("event-buffer", defaultEventBufferSize, "Events kept in memory for SUBSCRIBE resume (since_seq)")
+	maxSubscribers := flag.Int("max-subscribers", 0, "Refuse SUBSCRIBE beyond this many live event streams (0 = unlimited)")
+	binaryChange := flag.String("binary-change", binaryChangeOff, "Hash tracked processes' binaries on exec; on a change: off, alert or escalate")
+	binaryChangeTaint := flag.String("binary-change-taint", "HIGH", "Taint raised to by --binary-change escalate (name or 0-4)")
+	coalesceWindow := flag.Duration("coalesce-window", 0, "Queue UPDATE_TAINT and write the latest level per PID this often (0 = write at once; CRITICAL always at once)")
+	dedupWindow := flag.Duration("dedup-window", defaultDedupWindow, "Collapse identical events within this window into one with a count (0 = off)")
+	idleTimeout := flag.Duration("idle-timeout", 0, "Close connections idle for this long (0 = never)")
+	handlerWorkers := flag.Int("handler-workers", 0, "Serve connections with this many workers, queueing the rest (0 = a goroutine per connection)")
+	monotonic := flag.Bool("monotonic", false, "Never lower a process's taint (only CLEAR_TAINT resets)")
+	execTaint := flag.String("exec-taint", "preserve", "Taint after a successful execve: preserve, clear or reduce (one level)")
+	untrackedTaint := flag.String("default-taint-untracked", "CLEAN", "Taint assumed for processes not in process_map (name or 0-4)")
+	maxExecTaint := flag.String("max-exec-taint", "MEDIUM", "Block exec above this taint in a fresh config (name or 0-4)")
+	maxOpenTaint := flag.String("max-open-taint", "HIGH", "Block sensitive file opens above this taint in a fresh config (name or 0-4)")
+	sandboxTighten := flag.Uint("sandbox-tighten", defaultSandboxTighten, "Lower every hook's threshold by this many levels for sandboxed processes (0-4, 0 = no difference)")
+	mode := flag.String("mode", "", "Enforcement mode: enforce, audit (report, quarantine still denies) or off (never deny); default keeps the pinned config's")
+	stateFile := flag.String("state-file", "", "Persist taint state to this file (restored on start, saved on shutdown)")
+	stateKeyFile := flag.String("state-key", "", "Sign state exports/checkpoints with this key file and verify imports (HMAC-SHA256)")
+	checkpointInterval := flag.Duration("checkpoint-interval", 0, "Also save --state-file this often (0 = shutdown only)")
+	protocol := flag.String("protocol", protocolNative, "Socket wire protocol: native or jsonrpc (JSON-RPC 2.0)")
+	acceptNumericStrings := flag.Bool("numeric-strings", true, "Accept decimal strings (\"pid\":\"1234\") for numeric command fields")
+	metricsAddr := flag.String("metrics-addr", "", "Serve Prometheus metrics on this address (e.g. 127.0.0.1:9464, or unix:/run/telos/metrics.sock)")
+	dashboardAddr := flag.String("dashboard-addr", "", "Serve a read-only HTML status page on this address (e.g. 127.0.0.1:9465, or unix:/run/telos/dashboard.sock)")
+	levelGaugeInterval := flag.Duration("level-gauge-interval", defaultLevelGaugeInterval, "Recount processes per taint level this often (0 = never)")
+	natsURL := flag.String("nats-url", "", "Publish events to this NATS server (nats:// or tls://)")
+	natsSubject := flag.String("nats-subject", defaultNATSSubject, "NATS subject for published events")
+	kafkaBrokers := flag.String("kafka-brokers", "", "Produce events to these Kafka brokers (comma-separated host:port)")
+	kafkaTopic := flag.String("kafka-topic", defaultKafkaTopic, "Kafka topic for produced events")
+	stateMirror := flag.String("state-mirror", "", "Mirror taint state to this shared store (redis://[user:pass@]host:6379[/db], rediss:// for TLS)")
+	mirrorHost := flag.String("mirror-host", "", "This host's name in the state mirror (default: hostname)")
+	kafkaKey := flag.String("kafka-key", kafkaKeyPID, "Kafka message key: pid or cgroup")
+	commMatchLen := flag.Int("comm-match-len", maxCommLen, "Comm bytes that must match when restoring a PID from --state-file (1-15)")
+	listenRetries := flag.Int("listen-retries", 5, "Retry a failed socket listen this many times")
+	listenBackoff := flag.Duration("listen-backoff", 500*time.Millisecond, "Delay before the first listen retry (doubles, max 10s)")
+	mapWarnThreshold := flag.Int("map-warn-threshold", defaultMapWarnPercent, "Warn when process_map reaches this percent of capacity (0 = never)")
+	iterationBatch := flag.Int("iteration-batch", 0, "Walk at most this many process_map entries per background pass, resuming next tick (0 = whole map)")
+	adminUIDs := flag.String("admin-uids", "", "Comma-separated UIDs besides root allowed to SHUTDOWN over the socket")
+	rateLimit := flag.Float64("rate-limit", 0, "Refuse commands beyond this many per second per client UID with ERR_RATE_LIMITED (0 = unlimited)")
+	rateBurst := flag.Int("rate-burst", 0, "Commands a client UID may send at once under --rate-limit (0 = the rate, at least 1)")
+	rateExemptUIDs := flag.String("rate-limit-exempt-uids", "0", "Comma-separated UIDs never rate limited")
+	authzPolicyFile := flag.String("authz-policy", "", "JSON file mapping UIDs to the commands they may run (default: everyone may run everything)")
+	policyDir := flag.String("policy-dir", "", "Directory of policy files (egress.json, path_policy.json) applied on start and on change")
+	seedFile := flag.String("seed-file", "", "JSON or .csv file of {pid|comm, taint_level} entries to taint on start")
+	auditLog := flag.String("audit-log", "", "Append a JSON line per UPDATE_TAINT taint transition (old/new level, caller UID) to this file")
+	registerSelf := flag.Bool("register-self", false, "Add the daemon's own PID to process_map (CLEAN) so monitoring can see it")
+	selfComm := flag.String("self-comm", defaultSelfComm, "Comm of the daemon's own process_map entry (--register-self)")
+	selfExempt := flag.Bool("self-exempt", true, "Exempt the daemon and its parent (supervisor) from enforcement")
+	noDefaultAllowlist := flag.Bool("no-default-allowlist", false, "Don't exempt PID 1, sshd, getty and login from enforcement")
+	allowlistComms := flag.String("allowlist-comms", "", "Comma-separated further process names (comm) to exempt from enforcement (their executables must be root-owned, in system binary directories)")
+	debug := flag.Bool("debug", false, "Verbose per-connection logging")
+	suggestCommands := flag.Bool("suggest-commands", true, "Suggest close matches in unknown command errors")
+	resetConfig := flag.Bool("reset-config", false, "Write default config even if a pinned config_map was reattached")
+	observe := flag.Bool("observe", false, "Only read the maps pinned under --pin-path: load no programs, refuse state-changing commands")
 	flag.Parse()
 
+	if *protocol != protocolNative && *protocol != protocolJSONRPC {
+		log.Fatalf("Unknown --protocol %q (want %s or %s)", *protocol, protocolNative, protocolJSONRPC)
+	}
+	numericStrings = *acceptNumericStrings
+	execTaintMode, ok := execTaintModes[*execTaint]
+	if !ok {
+		log.Fatalf("Unknown --exec-taint %q (want preserve, clear or reduce)", *execTaint)
+	}
+	if *monotonic && execTaintMode != execTaintPreserve {
+		log.Fatalf("--exec-taint %s lowers taint and cannot be combined with --monotonic", *execTaint)
+	}
+	untrackedLevel, err := parseLevelFlag(*untrackedTaint)
+	if err != nil {
+		log.Fatalf("Invalid --default-taint-untracked: %v", err)
+	}
+	maxExecLevel, err := parseLevelFlag(*maxExecTaint)
+	if err != nil {
+		log.Fatalf("Invalid --max-exec-taint: %v", err)
+	}
+	maxOpenLevel, err := parseLevelFlag(*maxOpenTaint)
+	if err != nil {
+		log.Fatalf("Invalid --max-open-taint: %v", err)
+	}
+	if *sandboxTighten > TaintCritical {
+		log.Fatalf("Invalid --sandbox-tighten %d (want 0..%d levels)", *sandboxTighten, TaintCritical)
+	}
+	if !binaryChangeModes[*binaryChange] {
+		log.Fatalf("Unknown --binary-change %q (want off, alert or escalate)", *binaryChange)
+	}
+	binaryChangeLevel, err := parseLevelFlag(*binaryChangeTaint)
+	if err != nil {
+		log.Fatalf("Invalid --binary-change-taint: %v", err)
+	}
+	if _, ok := enforceModes[*mode]; *mode != "" && !ok {
+		log.Fatalf("Unknown --mode %q (want enforce, audit or off)", *mode)
+	}
+	admins, err := parseUIDs(*adminUIDs)
+	if err != nil {
+		log.Fatalf("Invalid --admin-uids: %v", err)
+	}
+	if *rateLimit < 0 || *rateBurst < 0 {
+		log.Fatal("--rate-limit and --rate-burst must not be negative")
+	}
+	rateExempt, err := parseUIDs(*rateExemptUIDs)
+	if err != nil {
+		log.Fatalf("Invalid --rate-limit-exempt-uids: %v", err)
+	}
+	extraComms, err := parseAllowlistComms(*allowlistComms)
+	if err != nil {
+		log.Fatalf("Invalid --allowlist-comms: %v", err)
+	}
+	if *listenRetries < 0 || *listenBackoff < 0 {
+		log.Fatal("--listen-retries and --listen-backoff must not be negative")
+	}
+	if *selfComm == "" || len(*selfComm) > maxCommLen || !utf8.ValidString(*selfComm) {
+		log.Fatalf("--self-comm must be 1-%d bytes of valid UTF-8", maxCommLen)
+	}
+	var authz *authzPolicy
+	if *authzPolicyFile != "" {
+		if authz, err = loadAuthzPolicy(*authzPolicyFile); err != nil {
+			log.Fatalf("Invalid --authz-policy: %v", err)
+		}
+	}
+	if *policyDir != "" {
+		if fi, err := os.Stat(*policyDir); err != nil || !fi.IsDir() || !filepath.IsAbs(*policyDir) {
+			log.Fatalf("--policy-dir must be an existing absolute directory: %s", *policyDir)
+		}
+	}
+	var seed []seedEntry
+	if *seedFile != "" {
+		if seed, err = loadSeedFile(*seedFile); err != nil {
+			log.Fatalf("Invalid --seed-file: %v", err)
+		}
+	}
+	var stateKey []byte
+	if *stateKeyFile != "" {
+		if stateKey, err = loadStateKey(*stateKeyFile); err != nil {
+			log.Fatalf("Invalid --state-key: %v", err)
+		}
+	}
+	if *maxSubscribers < 0 {
+		log.Fatal("--max-subscribers must not be negative")
+	}
+	if *handlerWorkers < 0 {
+		log.Fatal("--handler-workers must not be negative")
+	}
+	if *handlerWorkers > 0 && *idleTimeout == 0 {
+		log.Printf("Warning: --handler-workers without --idle-timeout: idle clients hold their worker until they disconnect")
+	}
+	if *stateMirror != "" {
+		if _, err := newStateMirror(*stateMirror); err != nil {
+			log.Fatalf("Invalid --state-mirror: %v", err)
+		}
+		if *mirrorHost == "" {
+			if *mirrorHost, err = os.Hostname(); err != nil {
+				log.Fatalf("--mirror-host not set and hostname unknown: %v", err)
+			}
+		}
+	}
+	if *coalesceWindow < 0 {
+		log.Fatal("--coalesce-window must not be negative")
+	}
+	if *mapWarnThreshold < 0 || *mapWarnThreshold > 100 {
+		log.Fatal("--map-warn-threshold must be between 0 and 100")
+	}
+	if *iterationBatch < 0 {
+		log.Fatal("--iteration-batch must not be negative")
+	}
+	if *commMatchLen < 1 || *commMatchLen > maxCommLen {
+		log.Fatalf("--comm-match-len must be between 1 and %d", maxCommLen)
+	}
+	if *checkpointInterval > 0 && *stateFile == "" {
+		log.Fatal("--checkpoint-interval requires --state-file")
+	}
+	if *stateFile != "" {
+		if err := checkUserPath(*stateFile); err != nil {
+			log.Fatalf("Invalid --state-file: %v", err)
+		}
+	}
+
 	// Check for root
 	if os.Geteuid() != 0 {
 		log.Fatal("Telos Core requires root privileges to load eBPF")
 	}
 
-	daemon := NewTelosDaemon(*socketPath, *bpfObj)
+	daemon := NewTelosDaemon(Options{
+		SocketPath:         *socketPath,
+		BPFObjPath:         *bpfObj,
+		PinPath:            *pinPath,
+		MountBPFFS:         *mountBPFFS,
+		EventSink:          *eventSink,
+		EventQueueSize:     *eventQueue,
+		EventBufferSize:    *eventBuffer,
+		DedupWindow:        *dedupWindow,
+		IdleTimeout:        *idleTimeout,
+		HandlerWorkers:     *handlerWorkers,
+		MonotonicTaint:     *monotonic,
+		ExecTaint:          execTaintMode,
+		UntrackedTaint:     untrackedLevel,
+		MaxExecTaint:       maxExecLevel,
+		MaxOpenTaint:       maxOpenLevel,
+		Mode:               *mode,
+		StateFile:          *stateFile,
+		CheckpointInterval: *checkpointInterval,
+		ResetConfig:        *resetConfig,
+		Protocol:           *protocol,
+		Debug:              *debug,
+		SuggestCommands:    *suggestCommands,
+		MetricsAddr:        *metricsAddr,
+		DashboardAddr:      *dashboardAddr,
+		LevelGaugeInterval: *levelGaugeInterval,
+		NATSURL:            *natsURL,
+		NATSSubject:        *natsSubject,
+		KafkaBrokers:       *kafkaBrokers,
+		KafkaTopic:         *kafkaTopic,
+		KafkaKey:           *kafkaKey,
+		StateMirror:        *stateMirror,
+		MirrorHost:         *mirrorHost,
+		CommMatchLen:       *commMatchLen,
+		SelfExempt:         *selfExempt,
+		DefaultAllowlist:   !*noDefaultAllowlist,
+		AllowlistComms:     extraComms,
+		RegisterSelf:       *registerSelf,
+		SelfComm:           *selfComm,
+		ListenRetries:      *listenRetries,
+		ListenBackoff:      *listenBackoff,
+		AdminUIDs:          admins,
+		RateLimit:          *rateLimit,
+		RateBurst:          *rateBurst,
+		RateLimitExempt:    rateExempt,
+		Authz:              authz,
+		AuditLog:           *auditLog,
+		SeedFile:           *seedFile,
+		PolicyDir:          *policyDir,
+		Seed:               seed,
+		IterationBatch:     *iterationBatch,
+		MapWarnPercent:     *mapWarnThreshold,
+		StateKey:           stateKey,
+		CoalesceWindow:     *coalesceWindow,
+		Observe:            *observe,
+		MaxSubscribers:     *maxSubscribers,
+		BinaryChange:       *binaryChange,
+		BinaryChangeTaint:  binaryChangeLevel,
+		SandboxTighten:     uint32(*sandboxTighten),
+	})
 
 	// Handle signals
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
 	go func() {
-		<-sigChan
-		daemon.Stop()
-		os.Exit(0)
+		for sig := range sigChan {
+			if sig == syscall.SIGHUP {
+				// Reload the BPF object in place; failures keep the old one
+				if _, err := daemon.ReloadBPF(""); err != nil {
+					log.Printf("Reload failed: %v", err)
+				}
+				continue
+			}
+			daemon.Stop()
+			os.Exit(0)
+		}
 	}()
 
 	// Start daemon
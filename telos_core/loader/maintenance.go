@@ -0,0 +1,192 @@
+/*
+ * Telos Core - Maintenance Mode
+ *
+ * For planned maintenance, ENTER_MAINTENANCE suspends denials without
+ * anyone touching the mode: it sets config.maintenance, which the hooks
+ * treat as audit (threshold violations are reported, not denied;
+ * quarantine still denies). Taint tracking and events carry on.
+ *
+ *   {"command":"ENTER_MAINTENANCE","data":{"duration":"2h","reason":"kernel patching"}}
+ *   {"command":"EXIT_MAINTENANCE"}
+ *
+ * Maintenance always expires: after "duration" (a Go duration or
+ * seconds, default defaultMaintenance, at most maxMaintenance)
+ * enforcement re-engages by itself. Entering again while active sets a
+ * new expiry. GET_STATE reports "maintenance" with the time remaining;
+ * entry, exit and expiry are logged with the caller and announced to
+ * SUBSCRIBE_STATE connections. PANIC_MODE ends maintenance, and a
+ * restarted daemon never inherits it (see initConfig).
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultMaintenance = time.Hour
+	maxMaintenance     = 24 * time.Hour
+)
+
+// maintenanceState is the active maintenance window. Guarded by cfgMu.
+type maintenanceState struct {
+	active bool
+	since  time.Time
+	until  time.Time
+	reason string
+	by     string
+	timer  *time.Timer
+	gen    uint64 // tells a stale expiry timer from the current one
+}
+
+// durationArg reads an optional duration given as "90m" or seconds
+func durationArg(data map[string]interface{}, field string, def, max time.Duration) (time.Duration, error) {
+	v, ok := data[field]
+	if !ok || v == nil {
+		return def, nil
+	}
+	var dur time.Duration
+	if s, isString := v.(string); isString && !isDecimal(s) {
+		var err error
+		if dur, err = time.ParseDuration(s); err != nil {
+			return 0, fmt.Errorf("Invalid '%s': %v", field, err)
+		}
+	} else {
+		secs, err := uintArg(data, field, math.MaxUint32)
+		if err != nil {
+			return 0, err
+		}
+		dur = time.Duration(secs) * time.Second
+	}
+	if dur <= 0 || dur > max {
+		return 0, fmt.Errorf("Invalid '%s': must be more than 0 and at most %s", field, max)
+	}
+	return dur, nil
+}
+
+// maintenanceJSON renders the maintenance status (cfgMu held)
+func (d *TelosDaemon) maintenanceJSON() map[string]interface{} {
+	m := d.maintenance
+	if !m.active {
+		return map[string]interface{}{"active": false}
+	}
+	return map[string]interface{}{
+		"active":            true,
+		"since":             m.since,
+		"until":             m.until,
+		"remaining_seconds": int64(time.Until(m.until).Round(time.Second) / time.Second),
+		"reason":            m.reason,
+		"by":                m.by,
+	}
+}
+
+// setMaintenanceFlag writes config.maintenance (cfgMu held)
+func (d *TelosDaemon) setMaintenanceFlag(on bool) (Config, error) {
+	cfg, err := d.activeConfig()
+	if err != nil {
+		return cfg, fmt.Errorf("read config: %w", err)
+	}
+	cfg.Maintenance = 0
+	if on {
+		cfg.Maintenance = 1
+	}
+	if err := d.maps.ConfigMap.Put(uint32(0), cfg); err != nil {
+		return cfg, fmt.Errorf("write config: %w", err)
+	}
+	return cfg, nil
+}
+
+// cmdEnterMaintenance handles ENTER_MAINTENANCE ({duration?, reason?})
+func (d *TelosDaemon) cmdEnterMaintenance(data map[string]interface{}, peer *syscall.Ucred) IPCResponse {
+	dur, err := durationArg(data, "duration", defaultMaintenance, maxMaintenance)
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	reason, err := stringArg(data, "reason")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+
+	d.cfgMu.Lock()
+	defer d.cfgMu.Unlock()
+	if d.lockdown.active {
+		return IPCResponse{Success: false, Error: "panic mode is active; EXIT_PANIC_MODE first"}
+	}
+
+	extended := d.maintenance.active
+	if !extended {
+		if _, err := d.setMaintenanceFlag(true); err != nil {
+			return IPCResponse{Success: false, Error: err.Error()}
+		}
+		d.maintenance.since = time.Now().UTC()
+	}
+	if d.maintenance.timer != nil {
+		d.maintenance.timer.Stop()
+	}
+	d.maintenance.gen++
+	gen := d.maintenance.gen
+	d.maintenance.active = true
+	d.maintenance.until = time.Now().UTC().Add(dur)
+	d.maintenance.reason = reason
+	d.maintenance.by = peerString(peer)
+	d.maintenance.timer = time.AfterFunc(dur, func() { d.expireMaintenance(gen) })
+
+	if extended {
+		log.Printf("[MAINTENANCE] Extended by %s until %s (%q)", d.maintenance.by,
+			d.maintenance.until.Format(time.RFC3339), reason)
+	} else {
+		log.Printf("[MAINTENANCE] Entered by %s for %s (%q): threshold violations are audited, not denied",
+			d.maintenance.by, dur, reason)
+	}
+	status := d.maintenanceJSON()
+	d.notifyMaintenance(status, "ENTER_MAINTENANCE")
+	return IPCResponse{Success: true, Data: status}
+}
+
+// cmdExitMaintenance handles EXIT_MAINTENANCE
+func (d *TelosDaemon) cmdExitMaintenance(_ map[string]interface{}, peer *syscall.Ucred) IPCResponse {
+	d.cfgMu.Lock()
+	defer d.cfgMu.Unlock()
+	if !d.maintenance.active {
+		return IPCResponse{Success: false, Error: "maintenance mode is not active"}
+	}
+	if err := d.endMaintenance("EXIT_MAINTENANCE", "ended by "+peerString(peer)); err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+	return IPCResponse{Success: true, Data: d.maintenanceJSON()}
+}
+
+// expireMaintenance ends maintenance when its window runs out
+func (d *TelosDaemon) expireMaintenance(gen uint64) {
+	d.cfgMu.Lock()
+	defer d.cfgMu.Unlock()
+	if !d.maintenance.active || d.maintenance.gen != gen {
+		return // Exited or extended meanwhile
+	}
+	if err := d.endMaintenance("expiry", "expired"); err != nil {
+		// Keep trying; enforcement must come back
+		log.Printf("Warning: ending maintenance failed: %v; retrying", err)
+		d.maintenance.timer = time.AfterFunc(time.Second, func() { d.expireMaintenance(gen) })
+	}
+}
+
+// endMaintenance clears the flag and the window (cfgMu held)
+func (d *TelosDaemon) endMaintenance(source, how string) error {
+	if _, err := d.setMaintenanceFlag(false); err != nil {
+		return err
+	}
+	if d.maintenance.timer != nil {
+		d.maintenance.timer.Stop()
+	}
+	lasted := time.Since(d.maintenance.since).Round(time.Second)
+	d.maintenance = maintenanceState{gen: d.maintenance.gen + 1}
+
+	log.Printf("[MAINTENANCE] %s after %s: enforcement re-engaged", how, lasted)
+	d.notifyMaintenance(d.maintenanceJSON(), source)
+	return nil
+}
@@ -0,0 +1,86 @@
+/*
+ * Telos Core - Process Map Fill Warning
+ *
+ * A full process_map only shows up as failing updates (ENOSPC/E2BIG).
+ * The daemon keeps an estimate of the entry count so it can warn early:
+ * once the count reaches --map-warn-threshold percent of max_entries
+ * (90 by default), a warning is logged (at most once per
+ * mapWarnInterval) and telos_process_map_near_full goes to 1.
+ *
+ * The estimate is adjusted on each UPDATE_TAINT / REGISTER_AGENT that
+ * creates an entry and each CLEAR_TAINT that removes one, so the check
+ * costs no map walk. Entries the BPF side adds or the daemon removes
+ * elsewhere make it drift; every full count (startup, level gauge
+ * refresh) resets it to the true value.
+ */
+
+package main
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMapWarnPercent = 90
+	mapWarnInterval       = time.Minute
+)
+
+// mapFill tracks the estimated process_map entry count
+type mapFill struct {
+	entries  atomic.Int64
+	nearFull atomic.Bool
+	lastWarn atomic.Int64 // unix nanos of the last warning
+}
+
+// resetMapFill replaces the estimate with a true count
+func (d *TelosDaemon) resetMapFill(n int) {
+	d.fill.entries.Store(int64(n))
+	d.checkMapFill()
+}
+
+// noteMapInsert records a new process_map entry
+func (d *TelosDaemon) noteMapInsert() {
+	d.fill.entries.Add(1)
+	d.checkMapFill()
+}
+
+// noteMapDelete records a removed process_map entry
+func (d *TelosDaemon) noteMapDelete() {
+	if d.fill.entries.Add(-1) < 0 {
+		d.fill.entries.Store(0)
+	}
+	d.checkMapFill()
+}
+
+// checkMapFill updates the near-full gauge and warns when crossing
+func (d *TelosDaemon) checkMapFill() {
+	if d.opts.MapWarnPercent <= 0 || d.maps == nil || d.maps.ProcessMap == nil {
+		return
+	}
+	max := int64(d.maps.ProcessMap.MaxEntries())
+	if max == 0 {
+		return
+	}
+
+	n := d.fill.entries.Load()
+	near := n*100 >= max*int64(d.opts.MapWarnPercent)
+	was := d.fill.nearFull.Swap(near)
+	if !near {
+		if was {
+			log.Printf("[MAP] process_map back to %d/%d entries", n, max)
+		}
+		return
+	}
+
+	now := time.Now().UnixNano()
+	last := d.fill.lastWarn.Load()
+	if was && now-last < int64(mapWarnInterval) {
+		return
+	}
+	if d.fill.lastWarn.CompareAndSwap(last, now) {
+		log.Printf("Warning: process_map at %d/%d entries (%d%%, warn at %d%%); clear stale PIDs before updates fail",
+			n, max, n*100/max, d.opts.MapWarnPercent)
+	}
+}
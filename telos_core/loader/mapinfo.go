@@ -0,0 +1,73 @@
+/*
+ * Telos Core - Map Metadata
+ *
+ * GET_MAP_INFO reports type, sizes, capacity and live entry count for
+ * each loaded map, to help right-size maps and diagnose "map full".
+ */
+
+package main
+
+import (
+	"github.com/cilium/ebpf"
+)
+
+// cmdGetMapInfo returns metadata for every loaded map
+func (d *TelosDaemon) cmdGetMapInfo() IPCResponse {
+	result := make(map[string]interface{})
+
+	for name, m := range map[string]*ebpf.Map{
+		"process_map": d.maps.ProcessMap,
+		"config_map":  d.maps.ConfigMap,
+		"events":      d.maps.Events,
+	} {
+		if m == nil {
+			result[name] = map[string]interface{}{"loaded": false}
+			continue
+		}
+
+		entry := map[string]interface{}{
+			"loaded":      true,
+			"type":        m.Type().String(),
+			"key_size":    m.KeySize(),
+			"value_size":  m.ValueSize(),
+			"max_entries": m.MaxEntries(),
+			"pin_path":    d.maps.Pins[name],
+			"reattached":  d.maps.Reattached[name],
+		}
+
+		if info, err := m.Info(); err == nil {
+			if id, ok := info.ID(); ok {
+				entry["id"] = id
+			}
+			entry["flags"] = info.Flags
+		}
+
+		if count, ok := countEntries(m); ok {
+			entry["count"] = count
+		}
+
+		result[name] = entry
+	}
+
+	return IPCResponse{Success: true, Data: result}
+}
+
+// countEntries counts entries of iterable map types
+func countEntries(m *ebpf.Map) (int, bool) {
+	switch m.Type() {
+	case ebpf.Hash, ebpf.LRUHash, ebpf.Array:
+	default:
+		return 0, false // e.g. ringbuf: no entries to count
+	}
+
+	iter := m.Iterate()
+	var key, value []byte
+	n := 0
+	for iter.Next(&key, &value) {
+		n++
+	}
+	if iter.Err() != nil {
+		return 0, false
+	}
+	return n, true
+}
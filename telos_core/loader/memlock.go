@@ -0,0 +1,63 @@
+/*
+ * Telos Core - Memlock Limit
+ *
+ * Before Linux 5.11, BPF maps and programs are charged against
+ * RLIMIT_MEMLOCK, whose default is far too small, so the limit has to be
+ * lifted before loading. From 5.11 on they are charged to the memory
+ * cgroup and the limit no longer matters; lifting it can still fail in a
+ * restricted container (no CAP_SYS_RESOURCE), which must not stop the
+ * daemon there.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"syscall"
+
+	"github.com/cilium/ebpf/rlimit"
+)
+
+// memcgAccountingVersion is the first kernel charging BPF memory to memcg
+var memcgAccountingVersion = [2]int{5, 11}
+
+// kernelVersion returns the running kernel's major and minor version
+func kernelVersion() ([2]int, error) {
+	var uts syscall.Utsname
+	if err := syscall.Uname(&uts); err != nil {
+		return [2]int{}, err
+	}
+	release := make([]byte, 0, len(uts.Release))
+	for _, c := range uts.Release {
+		if c == 0 {
+			break
+		}
+		release = append(release, byte(c))
+	}
+	var v [2]int
+	if _, err := fmt.Sscanf(string(release), "%d.%d", &v[0], &v[1]); err != nil {
+		return v, fmt.Errorf("parse kernel release %q: %w", release, err)
+	}
+	return v, nil
+}
+
+// versionAtLeast reports whether v >= min
+func versionAtLeast(v, min [2]int) bool {
+	return v[0] > min[0] || v[0] == min[0] && v[1] >= min[1]
+}
+
+// removeMemlock lifts RLIMIT_MEMLOCK where BPF still needs it
+func removeMemlock() error {
+	err := rlimit.RemoveMemlock()
+	if err == nil {
+		log.Println("✓ Removed memory lock limits")
+		return nil
+	}
+	v, verr := kernelVersion()
+	if verr != nil || !versionAtLeast(v, memcgAccountingVersion) {
+		return fmt.Errorf("failed to remove memlock: %w", err)
+	}
+	log.Printf("Warning: could not remove memlock limit (%v); continuing, kernel %d.%d accounts BPF memory to memcg", err, v[0], v[1])
+	return nil
+}
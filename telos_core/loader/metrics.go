@@ -0,0 +1,280 @@
+/*
+ * Telos Core - Metrics
+ *
+ * Process-wide counters. Every exporter reads from this single store so
+ * the numbers always agree.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// defaultLevelGaugeInterval is how often processes-by-level is recounted
+const defaultLevelGaugeInterval = 15 * time.Second
+
+// Metrics holds daemon counters (Prometheus names in comments)
+type Metrics struct {
+	CommandsTotal     atomic.Uint64 // telos_commands_total
+	CommandsForbidden atomic.Uint64 // telos_commands_forbidden_total
+	TaintUpdates      atomic.Uint64 // telos_taint_updates_total
+	ThreadIDsMapped   atomic.Uint64 // telos_thread_ids_mapped_total
+
+	UpdatesCoalesced atomic.Uint64 // telos_taint_updates_coalesced_total
+	CoalesceFlushes  atomic.Uint64 // telos_coalesce_flushes_total
+
+	EventsRead          atomic.Uint64 // telos_events_read_total
+	EventForwardDropped atomic.Uint64 // telos_event_forward_dropped_total
+	EventForwardFailed  atomic.Uint64 // telos_event_forward_failed_total
+	EventForwardRetries atomic.Uint64 // telos_event_forward_retries_total
+	EventDecodeErrors   atomic.Uint64 // telos_event_decode_errors_total
+	EventsDeduplicated  atomic.Uint64 // telos_events_deduplicated_total
+
+	MirrorDropped atomic.Uint64 // telos_state_mirror_dropped_total
+	MirrorFailed  atomic.Uint64 // telos_state_mirror_failed_total
+
+	SubscribersRejected     atomic.Uint64 // telos_subscribers_rejected_total
+	SubscriberEventsDropped atomic.Uint64 // telos_subscriber_events_dropped_total
+	ResponsesCompressed     atomic.Uint64 // telos_responses_compressed_total
+	CompressedBytesSaved    atomic.Uint64 // telos_compressed_bytes_saved_total
+	BinaryHashes            atomic.Uint64 // telos_binary_hashes_total (cache misses)
+	BinaryHashesDropped     atomic.Uint64 // telos_binary_hashes_dropped_total
+	BinaryChanges           atomic.Uint64 // telos_binary_changes_total
+
+	ConnectionsClosedIdle atomic.Uint64 // telos_connections_closed_idle_total
+	AcceptErrors          atomic.Uint64 // telos_accept_errors_total
+}
+
+var metrics Metrics
+
+// processesByLevel holds the last telos_processes_by_level{level} counts.
+// Recounting walks the whole map, so it runs on a timer rather than per
+// scrape.
+var processesByLevel [TaintCritical + 1]atomic.Uint64
+
+// Decisions counted per hook in telos_decisions_total{hook,decision}:
+// "deny" was enforced, "audit" would have been denied but the mode let it
+// through, "allow" passed. Allowed operations are only reported while
+// shadow mode or egress reporting asks for them, so "allow" undercounts.
+var (
+	decisionHooks = [...]string{"exec", "open", "connect", "ptrace"}
+	decisionNames = [...]string{"allow", "audit", "deny"}
+	decisions     [len(decisionHooks)][len(decisionNames)]atomic.Uint64
+)
+
+// recordDecision counts ev in telos_decisions_total
+func recordDecision(ev Event) {
+	names, ok := hookThresholds[ev.Action]
+	if !ok {
+		return
+	}
+	for h, hook := range decisionHooks {
+		if hook != names.hook {
+			continue
+		}
+		decision := 0
+		switch {
+		case ev.Denied:
+			decision = 2
+		case ev.Blocked:
+			decision = 1
+		}
+		decisions[h][decision].Add(1)
+		return
+	}
+}
+
+// walkedProcesses is the process_map size seen by the last completed
+// incremental round (--iteration-batch), used instead of a per-scrape count
+var walkedProcesses atomic.Uint64
+
+// collectMetrics snapshots counters plus map-derived gauges
+func (d *TelosDaemon) collectMetrics() map[string]float64 {
+	m := map[string]float64{
+		"telos_commands_total":                  float64(metrics.CommandsTotal.Load()),
+		"telos_commands_forbidden_total":        float64(metrics.CommandsForbidden.Load()),
+		"telos_taint_updates_total":             float64(metrics.TaintUpdates.Load()),
+		"telos_taint_updates_coalesced_total":   float64(metrics.UpdatesCoalesced.Load()),
+		"telos_thread_ids_mapped_total":         float64(metrics.ThreadIDsMapped.Load()),
+		"telos_coalesce_flushes_total":          float64(metrics.CoalesceFlushes.Load()),
+		"telos_events_read_total":               float64(metrics.EventsRead.Load()),
+		"telos_event_forward_dropped_total":     float64(metrics.EventForwardDropped.Load()),
+		"telos_event_forward_failed_total":      float64(metrics.EventForwardFailed.Load()),
+		"telos_event_forward_retries_total":     float64(metrics.EventForwardRetries.Load()),
+		"telos_event_decode_errors_total":       float64(metrics.EventDecodeErrors.Load()),
+		"telos_events_deduplicated_total":       float64(metrics.EventsDeduplicated.Load()),
+		"telos_state_mirror_dropped_total":      float64(metrics.MirrorDropped.Load()),
+		"telos_state_mirror_failed_total":       float64(metrics.MirrorFailed.Load()),
+		"telos_connections_closed_idle_total":   float64(metrics.ConnectionsClosedIdle.Load()),
+		"telos_accept_errors_total":             float64(metrics.AcceptErrors.Load()),
+		"telos_subscribers_rejected_total":      float64(metrics.SubscribersRejected.Load()),
+		"telos_subscriber_events_dropped_total": float64(metrics.SubscriberEventsDropped.Load()),
+		"telos_responses_compressed_total":      float64(metrics.ResponsesCompressed.Load()),
+		"telos_compressed_bytes_saved_total":    float64(metrics.CompressedBytesSaved.Load()),
+		"telos_binary_hashes_total":             float64(metrics.BinaryHashes.Load()),
+		"telos_binary_hashes_dropped_total":     float64(metrics.BinaryHashesDropped.Load()),
+		"telos_binary_changes_total":            float64(metrics.BinaryChanges.Load()),
+		"telos_event_subscribers":               float64(d.hub.Subscribers()),
+	}
+
+	d.poolMetrics(m)
+	d.rateLimitMetrics(m)
+
+	for _, f := range d.forwarders {
+		name := fmt.Sprintf(`telos_sink_circuit_open{sink="%s"}`, f.sink.Name())
+		m[name] = 0
+		if f.breaker.isOpen() {
+			m[name] = 1
+		}
+	}
+
+	now := time.Now()
+	for level := uint32(TaintLow); level <= TaintCritical; level++ {
+		for _, w := range rateWindows {
+			name := fmt.Sprintf(`telos_taint_escalations{level="%s",window="%s"}`, taintLevelName(level), w.label)
+			m[name] = float64(escalations.Count(level, w.span, now))
+		}
+	}
+
+	for h, hook := range decisionHooks {
+		for i, decision := range decisionNames {
+			name := fmt.Sprintf(`telos_decisions_total{hook="%s",decision="%s"}`, hook, decision)
+			m[name] = float64(decisions[h][i].Load())
+		}
+	}
+
+	for level := range processesByLevel {
+		name := fmt.Sprintf(`telos_processes_by_level{level="%s"}`, taintLevelName(uint32(level)))
+		m[name] = float64(processesByLevel[level].Load())
+	}
+
+	if d.maps != nil && d.maps.ProcessMap != nil {
+		var active int
+		if d.batchedGauges() {
+			active = int(walkedProcesses.Load())
+		} else {
+			active = d.countProcesses()
+			d.resetMapFill(active)
+		}
+		m["telos_active_processes"] = float64(active)
+		if max := d.maps.ProcessMap.MaxEntries(); max > 0 {
+			m["telos_process_map_utilization"] = float64(active) / float64(max)
+		}
+		m["telos_process_map_near_full"] = 0
+		if d.fill.nearFull.Load() {
+			m["telos_process_map_near_full"] = 1
+		}
+	}
+
+	return m
+}
+
+// countProcesses returns the number of entries in process_map
+func (d *TelosDaemon) countProcesses() int {
+	iter := d.maps.ProcessMap.Iterate()
+	var key uint32
+	var value ProcessInfo
+	n := 0
+	for iter.Next(&key, &value) {
+		n++
+	}
+	return n
+}
+
+// refreshLevelGauges recounts processes per taint level
+func (d *TelosDaemon) refreshLevelGauges() error {
+	snapshot, err := d.snapshotProcesses()
+	if err != nil {
+		return err
+	}
+
+	var counts [TaintCritical + 1]uint64
+	for _, e := range snapshot {
+		if e.Info.TaintLevel <= TaintCritical {
+			counts[e.Info.TaintLevel]++
+		}
+	}
+	for level := range counts {
+		processesByLevel[level].Store(counts[level])
+	}
+	d.resetMapFill(len(snapshot))
+	return nil
+}
+
+// batchedGauges reports whether the gauges are walked incrementally
+func (d *TelosDaemon) batchedGauges() bool {
+	return d.opts.IterationBatch > 0 && d.opts.LevelGaugeInterval > 0
+}
+
+// levelGaugeWalk accumulates one incremental processes-by-level round
+type levelGaugeWalk struct {
+	cursor mapCursor
+	counts [TaintCritical + 1]uint64
+	total  uint64
+}
+
+// stepLevelGauges counts the next --iteration-batch entries and publishes
+// the gauges when the round completes (see iterbatch.go)
+func (d *TelosDaemon) stepLevelGauges(w *levelGaugeWalk) error {
+	pids, done, err := d.nextProcessBatch(&w.cursor, d.opts.IterationBatch)
+	if err != nil {
+		w.cursor.reset()
+		w.counts, w.total = [TaintCritical + 1]uint64{}, 0
+		return err
+	}
+
+	for _, pid := range pids {
+		var info ProcessInfo
+		if err := d.maps.ProcessMap.Lookup(pid, &info); err != nil {
+			continue // Deleted since the key walk
+		}
+		if info.TaintLevel <= TaintCritical {
+			w.counts[info.TaintLevel]++
+		}
+		w.total++
+	}
+
+	if done {
+		for level := range w.counts {
+			processesByLevel[level].Store(w.counts[level])
+		}
+		walkedProcesses.Store(w.total)
+		d.resetMapFill(int(w.total))
+		w.cursor.reset()
+		w.counts, w.total = [TaintCritical + 1]uint64{}, 0
+	}
+	return nil
+}
+
+// runLevelGauges refreshes processes-by-level every LevelGaugeInterval until Stop()
+func (d *TelosDaemon) runLevelGauges() {
+	ticker := time.NewTicker(d.opts.LevelGaugeInterval)
+	defer ticker.Stop()
+
+	var walk levelGaugeWalk
+	for {
+		var err error
+		if d.batchedGauges() {
+			err = d.stepLevelGauges(&walk)
+		} else {
+			err = d.refreshLevelGauges()
+		}
+		if err != nil {
+			log.Printf("Warning: processes-by-level refresh failed: %v", err)
+		}
+		select {
+		case <-d.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cmdGetMetrics returns the metric snapshot over the socket
+func (d *TelosDaemon) cmdGetMetrics() IPCResponse {
+	return IPCResponse{Success: true, Data: d.collectMetrics()}
+}
@@ -0,0 +1,157 @@
+/*
+ * Telos Core - Pinned Map Migration
+ *
+ * When a struct grows, the pinned maps left by the previous version no
+ * longer match the object, and reattaching fails with
+ * ErrMapIncompatible. Instead of dropping all state, each pin is checked
+ * on its own:
+ *
+ *   - still matching the object           -> kept and reattached
+ *   - same type and key, and the old value size is a known earlier
+ *     layout of the struct (a prefix of the current one)
+ *                                         -> entries read out, widened
+ *                                            with zeroed new fields, the
+ *                                            pin recreated and refilled
+ *   - anything else                       -> logged, recreated empty
+ *
+ * Only layouts whose new fields are correct as zero are listed in
+ * valueMigrations. config_map is deliberately absent: a zeroed threshold
+ * would mean "block at any taint", so an outdated config is decoded by
+ * its version and given the fresh-config defaults for new fields instead
+ * (see configversion.go).
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/cilium/ebpf"
+)
+
+// valueMigrations lists, per pinned map, earlier value sizes that are a
+// prefix of the current struct and safe to zero-extend
+var valueMigrations = map[string][]uint32{
+	"process_map": {28}, // process_info_t before quarantined
+}
+
+// mapMigration holds the widened entries of an outdated pinned map
+type mapMigration struct {
+	oldSize, newSize uint32
+	keys, values     [][]byte
+}
+
+// pinMatches reports whether a pinned map can be reattached as ms
+func pinMatches(m *ebpf.Map, ms *ebpf.MapSpec) bool {
+	return m.Type() == ms.Type && m.KeySize() == ms.KeySize &&
+		m.ValueSize() == ms.ValueSize && m.MaxEntries() == ms.MaxEntries &&
+		m.Flags() == ms.Flags
+}
+
+// migratable reports whether valueSize is a known earlier layout of name
+func migratable(name string, valueSize uint32) bool {
+	for _, size := range valueMigrations[name] {
+		if size == valueSize {
+			return true
+		}
+	}
+	return false
+}
+
+// migratePins handles pins that no longer match spec: migratable ones
+// are read out, and every mismatched pin is removed so the collection
+// recreates it. Returns the migrations to apply to the new maps.
+func migratePins(spec *ebpf.CollectionSpec, pinPath string) (map[string]*mapMigration, error) {
+	migrations := make(map[string]*mapMigration)
+
+	for _, name := range pinnedMaps {
+		ms := spec.Maps[name]
+		if ms == nil {
+			continue
+		}
+		path := filepath.Join(pinPath, name)
+		old, err := ebpf.LoadPinnedMap(path, nil)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("open pinned %s: %w", name, err)
+		}
+
+		if pinMatches(old, ms) {
+			old.Close()
+			continue
+		}
+
+		if name == "config_map" && old.Type() == ms.Type && old.KeySize() == ms.KeySize {
+			// Versioned: decoded and re-encoded rather than zero-extended
+			mig, err := readConfigForMigration(old, ms)
+			if err == nil {
+				migrations[name] = mig
+			} else {
+				log.Printf("Warning: pinned config_map cannot be migrated (%v); recreating it with defaults", err)
+			}
+		} else if old.Type() == ms.Type && old.KeySize() == ms.KeySize &&
+			old.ValueSize() < ms.ValueSize && migratable(name, old.ValueSize()) {
+			mig, err := readForMigration(old, ms)
+			if err != nil {
+				old.Close()
+				return nil, fmt.Errorf("read pinned %s for migration: %w", name, err)
+			}
+			migrations[name] = mig
+		} else {
+			log.Printf("Warning: pinned %s (%s, key %d, value %d bytes) is incompatible with the object "+
+				"(%s, key %d, value %d bytes) and has no known migration; recreating it empty",
+				name, old.Type(), old.KeySize(), old.ValueSize(), ms.Type, ms.KeySize, ms.ValueSize)
+		}
+		old.Close()
+
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("remove outdated pin %s: %w", path, err)
+		}
+	}
+	return migrations, nil
+}
+
+// readForMigration copies every entry of old, zero-extended to ms's value size
+func readForMigration(old *ebpf.Map, ms *ebpf.MapSpec) (*mapMigration, error) {
+	mig := &mapMigration{oldSize: old.ValueSize(), newSize: ms.ValueSize}
+
+	key := make([]byte, old.KeySize())
+	value := make([]byte, old.ValueSize())
+	iter := old.Iterate()
+	for iter.Next(key, value) {
+		widened := make([]byte, ms.ValueSize)
+		copy(widened, value)
+		mig.keys = append(mig.keys, append([]byte(nil), key...))
+		mig.values = append(mig.values, widened)
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	if uint32(len(mig.keys)) > ms.MaxEntries {
+		return nil, fmt.Errorf("%d entries exceed the new max_entries %d", len(mig.keys), ms.MaxEntries)
+	}
+	return mig, nil
+}
+
+// applyMigrations refills the recreated maps in coll
+func applyMigrations(coll *ebpf.Collection, migrations map[string]*mapMigration) error {
+	for name, mig := range migrations {
+		m := coll.Maps[name]
+		if m == nil {
+			continue
+		}
+		for i := range mig.keys {
+			if err := m.Put(mig.keys[i], mig.values[i]); err != nil {
+				return fmt.Errorf("migrate %s entry %d: %w", name, i, err)
+			}
+		}
+		log.Printf("✓ Migrated %d %s entries (value %d -> %d bytes)", len(mig.keys), name, mig.oldSize, mig.newSize)
+	}
+	return nil
+}
@@ -0,0 +1,307 @@
+/*
+ * Telos Core - State Mirror
+ *
+ * With --state-mirror the daemon mirrors its taint state to a shared
+ * store so several hosts can be looked at together. Every taint change
+ * is queued and written by a background goroutine as
+ *
+ *   {"host":"web-1","pid":4242,"comm":"python3","level":"HIGH","time":"..."}
+ *
+ * Only tainted processes are mirrored: a change to CLEAN, CLEAR_TAINT or
+ * a removed entry deletes the record. The queue is bounded like the
+ * event forwarders' (oldest dropped, telos_state_mirror_dropped_total),
+ * so a slow or unreachable store never holds up a command.
+ *
+ * A dropped or failed write leaves the store behind; the host's records
+ * are then replaced with a fresh snapshot of process_map as soon as a
+ * write succeeds again, and every mirrorResyncInterval regardless
+ * (processes exiting leave process_map without a notification).
+ *
+ * GET_PEER_STATE reads every host's records back for display:
+ *
+ *   {"command":"GET_PEER_STATE"}
+ *   -> {"host":"web-1","hosts":{"web-2":[{...}],...}}
+ *
+ * Backends implement StateMirror; redis.go is the reference one.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	mirrorQueueSize      = 1024
+	mirrorResyncInterval = 5 * time.Minute
+	mirrorPeerTimeout    = 5 * time.Second
+	mirrorRetryDelay     = time.Second // between resync attempts while failing
+)
+
+// mirrorRecord is one mirrored process
+type mirrorRecord struct {
+	Host  string    `json:"host"`
+	PID   uint32    `json:"pid"`
+	Comm  string    `json:"comm"`
+	Level string    `json:"level"`
+	Time  time.Time `json:"time"`
+}
+
+// StateMirror is a shared store of taint state, keyed by host and PID
+type StateMirror interface {
+	Name() string
+	// Put writes or replaces one record
+	Put(rec mirrorRecord) error
+	// Delete removes a host's record for pid, if any
+	Delete(host string, pid uint32) error
+	// Replace makes recs the host's complete set of records
+	Replace(host string, recs []mirrorRecord) error
+	// Peers returns every host's records
+	Peers() (map[string][]mirrorRecord, error)
+	Close() error
+}
+
+// newStateMirror builds a backend from its --state-mirror spec
+func newStateMirror(spec string) (StateMirror, error) {
+	switch {
+	case strings.HasPrefix(spec, "redis://"), strings.HasPrefix(spec, "rediss://"):
+		return newRedisMirror(spec)
+	default:
+		return nil, fmt.Errorf("unsupported state mirror %q (want redis:// or rediss://)", spec)
+	}
+}
+
+// mirrorOp is a queued change: a PID's new level, or a full resync
+type mirrorOp struct {
+	pid    uint32
+	level  uint32
+	resync bool
+}
+
+// stateMirror queues taint changes for a StateMirror backend
+type stateMirror struct {
+	backend StateMirror
+	host    string
+	queue   chan mirrorOp
+	wg      sync.WaitGroup
+
+	mu     sync.RWMutex // guards closed against enqueue
+	closed bool
+}
+
+// startStateMirror starts mirroring to backend as host
+func (d *TelosDaemon) startStateMirror(backend StateMirror, host string) {
+	m := &stateMirror{
+		backend: backend,
+		host:    host,
+		queue:   make(chan mirrorOp, mirrorQueueSize),
+	}
+	d.mirror = m
+	m.enqueue(mirrorOp{resync: true})
+
+	m.wg.Add(1)
+	go d.runStateMirror(m)
+	go func() {
+		ticker := time.NewTicker(mirrorResyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-d.done:
+				return
+			case <-ticker.C:
+				m.enqueue(mirrorOp{resync: true})
+			}
+		}
+	}()
+}
+
+// enqueue never blocks; on a full queue the oldest change is dropped
+func (m *stateMirror) enqueue(op mirrorOp) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if m.closed {
+		return
+	}
+	for {
+		select {
+		case m.queue <- op:
+			return
+		default:
+		}
+		select {
+		case <-m.queue:
+			metrics.MirrorDropped.Add(1) // runStateMirror resyncs
+		default:
+		}
+	}
+}
+
+// mirrorTaint queues a PID's new taint level
+func (d *TelosDaemon) mirrorTaint(pid, level uint32) {
+	if d.mirror != nil {
+		d.mirror.enqueue(mirrorOp{pid: pid, level: level})
+	}
+}
+
+// runStateMirror writes queued changes. After a failure or a drop the
+// next write is a full resync instead, which also covers every change
+// queued meanwhile.
+func (d *TelosDaemon) runStateMirror(m *stateMirror) {
+	defer m.wg.Done()
+	dropped := metrics.MirrorDropped.Load()
+	inSync, failing := false, false
+	for op := range m.queue {
+		if n := metrics.MirrorDropped.Load(); n != dropped {
+			dropped = n
+			inSync = false
+		}
+
+		var err error
+		if op.resync || !inSync {
+			m.discardQueued()
+			err = d.resyncMirror(m)
+		} else {
+			err = d.writeMirror(m, op)
+		}
+		inSync = err == nil
+		if err == nil {
+			if failing {
+				failing = false
+				log.Printf("[MIRROR] %s recovered, state resynced", m.backend.Name())
+			}
+			continue
+		}
+
+		metrics.MirrorFailed.Add(1)
+		// Logged once per outage, not per change
+		if !failing && !errors.Is(err, errSinkUnavailable) {
+			log.Printf("Warning: state mirror %s: %v; resyncing once it recovers", m.backend.Name(), err)
+		}
+		failing = true
+		select {
+		case <-d.done:
+		case <-time.After(mirrorRetryDelay):
+		}
+	}
+}
+
+// discardQueued drops the changes a resync is about to cover
+func (m *stateMirror) discardQueued() {
+	for {
+		select {
+		case _, ok := <-m.queue:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// writeMirror applies one change; the comm comes from process_map
+func (d *TelosDaemon) writeMirror(m *stateMirror, op mirrorOp) error {
+	var info ProcessInfo
+	if op.level == TaintClean || d.maps.ProcessMap.Lookup(op.pid, &info) != nil {
+		return m.backend.Delete(m.host, op.pid)
+	}
+	return m.backend.Put(mirrorRecord{
+		Host:  m.host,
+		PID:   op.pid,
+		Comm:  commString(info.Comm),
+		Level: taintLevelName(op.level),
+		Time:  time.Now().UTC(),
+	})
+}
+
+// resyncMirror replaces the host's records with every tainted process
+func (d *TelosDaemon) resyncMirror(m *stateMirror) error {
+	snapshot, err := d.snapshotProcesses()
+	if err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	recs := make([]mirrorRecord, 0, len(snapshot))
+	for _, e := range snapshot {
+		if e.Info.TaintLevel == TaintClean {
+			continue
+		}
+		recs = append(recs, mirrorRecord{
+			Host:  m.host,
+			PID:   e.PID,
+			Comm:  commString(e.Info.Comm),
+			Level: taintLevelName(e.Info.TaintLevel),
+			Time:  now,
+		})
+	}
+	return m.backend.Replace(m.host, recs)
+}
+
+// Close stops accepting changes, drains the queue (bounded by
+// sinkDrainTimeout) and closes the backend
+func (m *stateMirror) Close() {
+	m.mu.Lock()
+	m.closed = true
+	close(m.queue)
+	m.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(sinkDrainTimeout):
+		log.Printf("Warning: state mirror %s: gave up draining %d queued changes",
+			m.backend.Name(), len(m.queue))
+	}
+	m.backend.Close()
+}
+
+// cmdGetPeerState handles GET_PEER_STATE ({include_self?})
+func (d *TelosDaemon) cmdGetPeerState(data map[string]interface{}) IPCResponse {
+	if d.mirror == nil {
+		return IPCResponse{Success: false, Error: "no state mirror configured (--state-mirror)"}
+	}
+	includeSelf, err := boolArg(data, "include_self")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+
+	type result struct {
+		hosts map[string][]mirrorRecord
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		hosts, err := d.mirror.backend.Peers()
+		done <- result{hosts, err}
+	}()
+	var res result
+	select {
+	case res = <-done:
+	case <-time.After(mirrorPeerTimeout):
+		res.err = fmt.Errorf("timed out after %s", mirrorPeerTimeout)
+	}
+	if res.err != nil {
+		return IPCResponse{Success: false, Error: fmt.Sprintf("read state mirror: %v", res.err)}
+	}
+
+	if !includeSelf {
+		delete(res.hosts, d.mirror.host)
+	}
+	for _, recs := range res.hosts {
+		sort.Slice(recs, func(i, j int) bool { return recs[i].PID < recs[j].PID })
+	}
+	return IPCResponse{Success: true, Data: map[string]interface{}{
+		"host":  d.mirror.host,
+		"hosts": res.hosts,
+	}}
+}
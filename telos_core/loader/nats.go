@@ -0,0 +1,213 @@
+/*
+ * Telos Core - NATS Publisher
+ *
+ * With --nats-url every event is published as JSON to --nats-subject.
+ * It is an EventSink behind its own bounded forwarder, so an unreachable
+ * NATS server only ever drops the oldest queued events.
+ *
+ * Speaks the (small, text) NATS client protocol directly: INFO/CONNECT
+ * handshake, PUB, and PING/PONG keepalive. A lost connection is redialed
+ * with exponential backoff; while backing off, events fail fast.
+ *
+ *   --nats-url nats://[user:pass@]host:4222   (tls:// for TLS)
+ */
+
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultNATSSubject = "telos.events"
+	natsDialTimeout    = 2 * time.Second
+	natsWriteTimeout   = 2 * time.Second
+	natsBackoffMin     = time.Second
+	natsBackoffMax     = 30 * time.Second
+)
+
+// errSinkUnavailable is returned while a sink is backing off; the
+// forwarder counts it as a failure without logging every event
+var errSinkUnavailable = errors.New("sink unavailable")
+
+// natsSink publishes events to a NATS subject
+type natsSink struct {
+	url     *url.URL
+	subject string
+
+	mu       sync.Mutex // guards conn writes and reconnect state
+	conn     net.Conn
+	nextDial time.Time
+	backoff  time.Duration
+}
+
+func newNATSSink(rawURL, subject string) (*natsSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid NATS URL: %w", err)
+	}
+	if u.Scheme != "nats" && u.Scheme != "tls" {
+		return nil, fmt.Errorf("unsupported NATS URL scheme %q (want nats:// or tls://)", u.Scheme)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "4222")
+	}
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return nil, fmt.Errorf("invalid NATS subject %q", subject)
+	}
+	return &natsSink{url: u, subject: subject}, nil
+}
+
+func (s *natsSink) Name() string { return "nats://" + s.url.Host + "/" + s.subject }
+
+func (s *natsSink) Send(ev Event) error {
+	payload, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn == nil {
+		if time.Now().Before(s.nextDial) {
+			return errSinkUnavailable
+		}
+		if err := s.connect(); err != nil {
+			s.scheduleRedial()
+			return fmt.Errorf("connect: %w", err)
+		}
+		s.backoff = 0
+		log.Printf("[NATS] Connected to %s", s.url.Host)
+	}
+
+	msg := fmt.Sprintf("PUB %s %d\r\n%s\r\n", s.subject, len(payload), payload)
+	s.conn.SetWriteDeadline(time.Now().Add(natsWriteTimeout))
+	if _, err := s.conn.Write([]byte(msg)); err != nil {
+		s.dropConn()
+		return err
+	}
+	return nil
+}
+
+func (s *natsSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropConn()
+	return nil
+}
+
+// connect dials and performs the INFO/CONNECT/PING handshake (mu held)
+func (s *natsSink) connect() error {
+	dialer := &net.Dialer{Timeout: natsDialTimeout}
+	var conn net.Conn
+	var err error
+	if s.url.Scheme == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", s.url.Host, &tls.Config{ServerName: s.url.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", s.url.Host)
+	}
+	if err != nil {
+		return err
+	}
+
+	conn.SetDeadline(time.Now().Add(natsDialTimeout))
+	r := bufio.NewReader(conn)
+
+	line, err := r.ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("expected INFO from server, got %q (%v)", strings.TrimSpace(line), err)
+	}
+
+	opts := map[string]interface{}{
+		"verbose":  false,
+		"pedantic": false,
+		"name":     "telos-core",
+		"lang":     "go",
+		"protocol": 0,
+	}
+	if user := s.url.User; user != nil {
+		opts["user"] = user.Username()
+		if pass, ok := user.Password(); ok {
+			opts["pass"] = pass
+		}
+	}
+	connect, _ := json.Marshal(opts)
+	if _, err := conn.Write([]byte("CONNECT " + string(connect) + "\r\nPING\r\n")); err != nil {
+		conn.Close()
+		return err
+	}
+
+	// The server answers PONG, or -ERR (e.g. authorization violation)
+	line, err = r.ReadString('\n')
+	if err != nil || strings.TrimSpace(line) != "PONG" {
+		conn.Close()
+		return fmt.Errorf("handshake failed: %q (%v)", strings.TrimSpace(line), err)
+	}
+
+	conn.SetDeadline(time.Time{})
+	s.conn = conn
+	go s.readLoop(conn, r)
+	return nil
+}
+
+// readLoop answers server PINGs and notices disconnects
+func (s *natsSink) readLoop(conn net.Conn, r *bufio.Reader) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		switch {
+		case strings.HasPrefix(line, "PING"):
+			s.mu.Lock()
+			if s.conn == conn {
+				conn.SetWriteDeadline(time.Now().Add(natsWriteTimeout))
+				conn.Write([]byte("PONG\r\n"))
+			}
+			s.mu.Unlock()
+		case strings.HasPrefix(line, "-ERR"):
+			log.Printf("Warning: NATS %s: %s", s.url.Host, strings.TrimSpace(line))
+		}
+	}
+
+	s.mu.Lock()
+	if s.conn == conn {
+		log.Printf("Warning: NATS %s disconnected, reconnecting", s.url.Host)
+		s.dropConn()
+	}
+	s.mu.Unlock()
+}
+
+// dropConn closes the current connection; the next Send redials (mu held)
+func (s *natsSink) dropConn() {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// scheduleRedial backs off exponentially after a failed dial (mu held)
+func (s *natsSink) scheduleRedial() {
+	switch {
+	case s.backoff == 0:
+		s.backoff = natsBackoffMin
+	case s.backoff < natsBackoffMax:
+		s.backoff *= 2
+		if s.backoff > natsBackoffMax {
+			s.backoff = natsBackoffMax
+		}
+	}
+	s.nextDial = time.Now().Add(s.backoff)
+}
@@ -0,0 +1,153 @@
+/*
+ * Telos Core - Observer Mode
+ *
+ * With --observe the daemon loads no programs and writes nothing: it
+ * opens the process_map and config_map pinned under --pin-path by the
+ * daemon (or other tool) that owns them, read-only, and serves queries
+ * and metrics from them. A side-car can watch a deployment this way
+ * without any risk of interfering with enforcement.
+ *
+ * Only the commands in observeCommands are served; everything else
+ * fails with ERR_READONLY, so a command added later is refused until it
+ * is known to be safe. The events ringbuf isn't pinned, so SUBSCRIBE,
+ * shadow mode and egress checks have nothing to consume, and flags that
+ * would write at startup (--mode, --seed-file, ...) are rejected.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/cilium/ebpf"
+)
+
+// ErrReadOnly is returned for state-changing commands under --observe
+const ErrReadOnly = "ERR_READONLY"
+
+// observeCommands are the commands that only read state
+var observeCommands = map[string]bool{
+	"PING":                 true,
+	"HEALTH":               true,
+	"GET_STATE":            true,
+	"GET_PROCESS_TREE":     true,
+	"GET_MAP_INFO":         true,
+	"GET_BPF_INFO":         true,
+	"GET_METRICS":          true,
+	"GET_CONFIG_KEY":       true,
+	"LIST_CONFIG_KEYS":     true,
+	"LIST_FROZEN":          true,
+	"GET_PATH_POLICY":      true,
+	"GET_EGRESS_POLICY":    true,
+	"GET_FULL_POLICY":      true,
+	"GET_EFFECTIVE_POLICY": true,
+	"SIMULATE_TAINT":       true,
+	"GET_SHADOW_DIFF":      true,
+	"GET_PEER_STATE":       true,
+	"EXPORT_CSV":           true,
+	"DIFF_STATE":           true,
+	"GET_DENIALS":          true,
+	"DESCRIBE":             true,
+	"GET_PROCESS":          true,
+}
+
+// observeRejectedFlags are the flags that write state at startup
+func observeRejectedFlags(opts Options) []string {
+	var rejected []string
+	for name, set := range map[string]bool{
+		"--mode":            opts.Mode != "",
+		"--reset-config":    opts.ResetConfig,
+		"--seed-file":       opts.SeedFile != "",
+		"--policy-dir":      opts.PolicyDir != "",
+		"--register-self":   opts.RegisterSelf,
+		"--coalesce-window": opts.CoalesceWindow > 0,
+		"--binary-change":   opts.BinaryChange != binaryChangeOff,
+		"--allowlist-comms": len(opts.AllowlistComms) > 0,
+	} {
+		if set {
+			rejected = append(rejected, name)
+		}
+	}
+	sort.Strings(rejected)
+	return rejected
+}
+
+// readOnly refuses command if the daemon is only observing
+func (d *TelosDaemon) readOnly(command string) (IPCResponse, bool) {
+	if !d.opts.Observe || observeCommands[command] {
+		return IPCResponse{}, false
+	}
+	return errorResponse(ErrReadOnly, "%s changes state; the daemon is in --observe mode", command), true
+}
+
+// openObservedMaps opens the pinned state maps read-only in place of loadBPF
+func (d *TelosDaemon) openObservedMaps() error {
+	maps := &BPFMaps{
+		Pins:       make(map[string]string),
+		Reattached: make(map[string]bool),
+	}
+	opened := make(map[string]*ebpf.Map, len(pinnedMaps))
+	for _, name := range pinnedMaps {
+		path := filepath.Join(d.opts.PinPath, name)
+		m, err := ebpf.LoadPinnedMap(path, &ebpf.LoadPinOptions{ReadOnly: true})
+		if err != nil {
+			closeMaps(opened)
+			return fmt.Errorf("open %s: %w", path, err)
+		}
+		opened[name] = m
+		maps.Pins[name] = path
+		maps.Reattached[name] = true
+	}
+	maps.ProcessMap = opened["process_map"]
+	maps.ConfigMap = opened["config_map"]
+
+	err := maps.checkValueSizes()
+	if err == nil {
+		err = checkConfigVersions(maps.ConfigMap)
+	}
+	if err != nil {
+		closeMaps(opened)
+		return err
+	}
+	d.maps = maps
+	return nil
+}
+
+// closeMaps closes every map in opened
+func closeMaps(opened map[string]*ebpf.Map) {
+	for _, m := range opened {
+		m.Close()
+	}
+}
+
+// observerHealth is HEALTH under --observe: nothing is attached here, so
+// healthy means the pinned maps can still be read
+func (d *TelosDaemon) observerHealth() IPCResponse {
+	var problems []string
+	var key uint32
+	err := d.maps.ProcessMap.NextKey(nil, &key)
+	readable := err == nil || errors.Is(err, ebpf.ErrKeyNotExist)
+	if !readable {
+		problems = append(problems, "process_map not readable: "+err.Error())
+	}
+	if _, err := d.activeConfig(); err != nil {
+		problems = append(problems, "config_map not readable: "+err.Error())
+	}
+
+	status := map[string]interface{}{
+		"observe":      true,
+		"map_readable": readable,
+		"healthy":      len(problems) == 0,
+	}
+	if len(problems) > 0 {
+		status["problems"] = problems
+		resp := errorResponse(ErrUnhealthy, "Unhealthy: %s", strings.Join(problems, "; "))
+		resp.Data = status
+		return resp
+	}
+	return IPCResponse{Success: true, Data: status}
+}
@@ -0,0 +1,264 @@
+/*
+ * Telos Core - Enforcement Overhead
+ *
+ * GET_OVERHEAD measures what the LSM hooks cost, on this host, with the
+ * loaded object:
+ *
+ *   {"command":"GET_OVERHEAD","data":{"iterations":500}}
+ *   -> {"baseline":"bpf_run_time_stats",
+ *       "exec":{"per_op_ns":812000,"hook_ns":2100,"overhead_pct":0.26},
+ *       "open":{...}, "hooks":{"lsm/file_open":{"runs":..,"avg_ns":..}}}
+ *
+ * The hooks run in every mode (audit and off still look up taint and
+ * report), so flipping the mode gives no baseline, and detaching them
+ * would leave the host unprotected while measuring. Instead the kernel's
+ * BPF run-time statistics are switched on for the duration and the hook
+ * time is read per program, while a child process ("telos_daemon bench")
+ * forks and execs a trivial binary and opens a file N times.
+ *
+ * hook_ns is the average time of the hooks one operation fires (exec:
+ * task_alloc, bprm_check_security, file_open, bprm_committed_creds) and
+ * per_op_ns the child's wall time per operation, so overhead_pct is the
+ * hooks' share of it, not a comparison against a run with enforcement
+ * off; "baseline" says so ("bpf_run_time_stats"). Averages cover every
+ * invocation on the host during the run, not only the child's. Run-time
+ * stats need Linux 5.8; without them, or if the object is reloaded
+ * mid-run, only the wall times are reported ("baseline":"none"). The
+ * object lock is held only to read the stats, not while the child runs,
+ * so RELOAD_BPF and shutdown are never held up. One measurement at a
+ * time.
+ */
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync/atomic"
+	"time"
+
+	"github.com/cilium/ebpf"
+)
+
+const (
+	defaultOverheadIterations = 200
+	maxOverheadIterations     = 10000
+	overheadTimeout           = 2 * time.Minute
+	overheadTarget            = "/bin/true"
+	bpfStatsRunTime           = 0 // BPF_STATS_RUN_TIME
+)
+
+// GET_OVERHEAD baselines: what overhead_pct is measured against
+const (
+	overheadBaselineStats = "bpf_run_time_stats" // hook run time vs. the operation's wall time
+	overheadBaselineNone  = "none"               // hook time not measured
+)
+
+// execHooks and openHooks are the hooks one exec or open fires
+var (
+	execHooks = []string{"task_alloc", "bprm_check_security", "file_open", "bprm_committed_creds"}
+	openHooks = []string{"file_open"}
+)
+
+// overheadRunning allows one GET_OVERHEAD at a time
+var overheadRunning atomic.Bool
+
+// benchResult is what "telos_daemon bench" prints
+type benchResult struct {
+	ExecNs     int64 `json:"exec_ns"` // wall time per fork+exec+wait
+	OpenNs     int64 `json:"open_ns"` // wall time per open+close
+	ExecErrors int   `json:"exec_errors"`
+	OpenErrors int   `json:"open_errors"`
+}
+
+// cliBench runs the microbenchmark and prints a benchResult as JSON
+func cliBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	n := fs.Int("n", defaultOverheadIterations, "Operations of each kind")
+	target := fs.String("target", overheadTarget, "Binary to exec, and file to open")
+	if err := fs.Parse(args); err != nil {
+		return clientExitUsage
+	}
+	if *n < 1 {
+		fmt.Fprintln(os.Stderr, "-n must be at least 1")
+		return clientExitUsage
+	}
+
+	var res benchResult
+	start := time.Now()
+	for i := 0; i < *n; i++ {
+		if err := exec.Command(*target).Run(); err != nil {
+			res.ExecErrors++
+		}
+	}
+	res.ExecNs = time.Since(start).Nanoseconds() / int64(*n)
+
+	start = time.Now()
+	for i := 0; i < *n; i++ {
+		f, err := os.Open(*target)
+		if err != nil {
+			res.OpenErrors++
+			continue
+		}
+		f.Close()
+	}
+	res.OpenNs = time.Since(start).Nanoseconds() / int64(*n)
+
+	if err := json.NewEncoder(os.Stdout).Encode(res); err != nil {
+		return clientExitFailure
+	}
+	return clientExitOK
+}
+
+// progStats is a program's cumulative run count and run time
+type progStats struct {
+	runs uint64
+	time time.Duration
+}
+
+// readProgStats reads the run-time stats of every attached hook program
+func (d *TelosDaemon) readProgStats() map[string]progStats {
+	stats := make(map[string]progStats, len(lsmHooks))
+	for _, h := range lsmHooks {
+		prog := d.coll.Programs[h.Program]
+		if prog == nil || d.links[h.Program] == nil {
+			continue
+		}
+		info, err := prog.Info()
+		if err != nil {
+			continue
+		}
+		runs, ok1 := info.RunCount()
+		runtime, ok2 := info.Runtime()
+		if ok1 && ok2 {
+			stats[h.Hook] = progStats{runs: runs, time: runtime}
+		}
+	}
+	return stats
+}
+
+// cmdGetOverhead handles GET_OVERHEAD ({iterations?})
+func (d *TelosDaemon) cmdGetOverhead(data map[string]interface{}) IPCResponse {
+	iterations := uint64(defaultOverheadIterations)
+	if _, ok := data["iterations"]; ok {
+		var err error
+		if iterations, err = uintArg(data, "iterations", maxOverheadIterations); err != nil {
+			return invalidArg("%v", err)
+		}
+		if iterations == 0 {
+			return invalidArg("Invalid 'iterations': must be at least 1")
+		}
+	}
+	if !overheadRunning.CompareAndSwap(false, true) {
+		return IPCResponse{Success: false, Error: "an overhead measurement is already running"}
+	}
+	defer overheadRunning.Store(false)
+
+	self, err := os.Executable()
+	if err != nil {
+		return IPCResponse{Success: false, Error: "locate daemon binary: " + err.Error()}
+	}
+	cfg, err := d.activeConfig()
+	if err != nil {
+		return IPCResponse{Success: false, Error: "read config: " + err.Error()}
+	}
+
+	d.bpfMu.Lock()
+	coll := d.coll
+	if coll == nil {
+		d.bpfMu.Unlock()
+		return IPCResponse{Success: false, Error: "BPF object not loaded"}
+	}
+	warnings := []string{}
+	stats, err := ebpf.EnableStats(bpfStatsRunTime)
+	if err != nil {
+		warnings = append(warnings, fmt.Sprintf("BPF run-time stats unavailable (%v): hook times not measured", err))
+	}
+	before := d.readProgStats()
+	d.bpfMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), overheadTimeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, self, "bench", "-n", fmt.Sprint(iterations), "-target", overheadTarget)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	runErr := cmd.Run()
+
+	// Stats only compare within one set of programs
+	d.bpfMu.Lock()
+	reloaded := d.coll != coll
+	after := d.readProgStats()
+	d.bpfMu.Unlock()
+	if stats != nil {
+		stats.Close()
+		if reloaded {
+			warnings = append(warnings, "BPF object reloaded during the run: hook times not measured")
+			stats = nil
+		}
+	}
+	if runErr != nil {
+		return IPCResponse{Success: false, Error: fmt.Sprintf("benchmark failed: %v %s", runErr, bytes.TrimSpace(stderr.Bytes()))}
+	}
+	var bench benchResult
+	if err := json.Unmarshal(stdout.Bytes(), &bench); err != nil {
+		return IPCResponse{Success: false, Error: "decode benchmark result: " + err.Error()}
+	}
+
+	// Average cost per invocation of each hook over the run
+	avg := make(map[string]float64)
+	hooks := make(map[string]interface{})
+	for hook, b := range before {
+		a, ok := after[hook]
+		if !ok || a.runs <= b.runs {
+			continue
+		}
+		runs := a.runs - b.runs
+		avg[hook] = float64(a.time-b.time) / float64(runs)
+		hooks["lsm/"+hook] = map[string]interface{}{
+			"runs":   runs,
+			"avg_ns": int64(avg[hook]),
+		}
+	}
+
+	operation := func(perOp int64, fired []string, errors int) map[string]interface{} {
+		op := map[string]interface{}{
+			"per_op_ns": perOp,
+			"errors":    errors,
+		}
+		if stats == nil {
+			return op
+		}
+		var hookNs float64
+		for _, hook := range fired {
+			hookNs += avg[hook]
+		}
+		op["hook_ns"] = int64(hookNs)
+		if perOp > 0 {
+			op["overhead_pct"] = hookNs / float64(perOp) * 100
+		}
+		return op
+	}
+	if bench.ExecErrors > 0 {
+		warnings = append(warnings, fmt.Sprintf("%d of %d execs of %s failed (denied?): exec timing is not representative",
+			bench.ExecErrors, iterations, overheadTarget))
+	}
+
+	baseline := overheadBaselineStats
+	if stats == nil {
+		baseline = overheadBaselineNone
+	}
+	return IPCResponse{Success: true, Data: map[string]interface{}{
+		"iterations": iterations,
+		"mode":       enforceModeName(cfg.Enabled),
+		"baseline":   baseline,
+		"exec":       operation(bench.ExecNs, execHooks, bench.ExecErrors),
+		"open":       operation(bench.OpenNs, openHooks, bench.OpenErrors),
+		"hooks":      hooks,
+		"warnings":   warnings,
+	}}
+}
@@ -0,0 +1,124 @@
+/*
+ * Telos Core - Panic Mode
+ *
+ * PANIC_MODE is the incident "break glass": one command that switches the
+ * live config (key 0) to the strictest enforcement, and EXIT_PANIC_MODE
+ * puts back exactly what was there before:
+ *
+ *   {"command":"PANIC_MODE"}       -> {"active":true, "previous":{...}}
+ *   {"command":"EXIT_PANIC_MODE"}  -> {"active":false, "config":{...}}
+ *
+ * While active, mode is enforce and every max_taint_for_* threshold is
+ * CLEAN, so any process at LOW or above is denied exec, sensitive opens,
+ * connect and ptrace. The BPF program has no per-level actions, so
+ * CRITICAL processes are denied like the rest rather than killed.
+ *
+ * Both switches are one config_map write under cfgMu, are logged with the
+ * caller's UID and PID, and announced to SUBSCRIBE_STATE connections.
+ * PANIC_MODE ends maintenance mode, and ENTER_MAINTENANCE is refused
+ * while the lockdown is on, as are SET_CONFIG (key 0), SET_THRESHOLD and
+ * SET_FULL_POLICY: a change under the lockdown would weaken it while
+ * panic still reports active, and be lost on EXIT_PANIC_MODE.
+ * PANIC_MODE while already active keeps the original saved config. The
+ * saved config lives in the daemon; after a restart with a reattached
+ * config_map the lockdown stays and is lifted with SET_CONFIG.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"syscall"
+	"time"
+)
+
+// panicState remembers the config PANIC_MODE replaced. Guarded by cfgMu.
+type panicState struct {
+	active bool
+	saved  Config
+	since  time.Time
+}
+
+// peerString describes a connection's caller for log lines
+func peerString(peer *syscall.Ucred) string {
+	if peer == nil {
+		return "unknown caller"
+	}
+	return fmt.Sprintf("UID %d (PID %d)", peer.Uid, peer.Pid)
+}
+
+// cmdPanicMode handles PANIC_MODE
+func (d *TelosDaemon) cmdPanicMode(_ map[string]interface{}, peer *syscall.Ucred) IPCResponse {
+	d.cfgMu.Lock()
+	defer d.cfgMu.Unlock()
+
+	if d.lockdown.active {
+		return IPCResponse{Success: true, Data: map[string]interface{}{
+			"active":         true,
+			"already_active": true,
+			"since":          d.lockdown.since,
+			"previous":       configJSON(d.lockdown.saved),
+		}}
+	}
+
+	// The lockdown must not be audit-only, nor resume as such
+	if d.maintenance.active {
+		if err := d.endMaintenance("PANIC_MODE", "ended by PANIC_MODE"); err != nil {
+			return IPCResponse{Success: false, Error: err.Error()}
+		}
+	}
+
+	cfg, err := d.activeConfig()
+	if err != nil {
+		return IPCResponse{Success: false, Error: "read config: " + err.Error()}
+	}
+	strict := cfg
+	strict.Enabled = enforceOn
+	for _, member := range configLevelFields {
+		*member(&strict) = TaintClean
+	}
+	if err := d.maps.ConfigMap.Put(uint32(0), strict); err != nil {
+		return IPCResponse{Success: false, Error: fmt.Sprintf("write config: %v", err)}
+	}
+	d.lockdown = panicState{active: true, saved: cfg, since: time.Now().UTC()}
+
+	log.Printf("[PANIC] Lockdown enabled by %s: enforcing, every threshold CLEAN", peerString(peer))
+	d.notifyConfig(strict, "PANIC_MODE")
+	return IPCResponse{Success: true, Data: map[string]interface{}{
+		"active":   true,
+		"since":    d.lockdown.since,
+		"config":   configJSON(strict),
+		"previous": configJSON(cfg),
+	}}
+}
+
+// cmdExitPanicMode handles EXIT_PANIC_MODE
+func (d *TelosDaemon) cmdExitPanicMode(_ map[string]interface{}, peer *syscall.Ucred) IPCResponse {
+	d.cfgMu.Lock()
+	defer d.cfgMu.Unlock()
+
+	if !d.lockdown.active {
+		return IPCResponse{Success: false, Error: "panic mode is not active"}
+	}
+
+	// A shadow config may have been started or stopped meanwhile
+	cfg, err := d.activeConfig()
+	if err != nil {
+		return IPCResponse{Success: false, Error: "read config: " + err.Error()}
+	}
+	restored := d.lockdown.saved
+	restored.ReportAllowed = cfg.ReportAllowed
+	if err := d.maps.ConfigMap.Put(uint32(0), restored); err != nil {
+		return IPCResponse{Success: false, Error: fmt.Sprintf("write config: %v", err)}
+	}
+	lasted := time.Since(d.lockdown.since).Round(time.Second)
+	d.lockdown = panicState{}
+
+	log.Printf("[PANIC] Lockdown lifted by %s after %s", peerString(peer), lasted)
+	d.notifyConfig(restored, "EXIT_PANIC_MODE")
+	return IPCResponse{Success: true, Data: map[string]interface{}{
+		"active": false,
+		"config": configJSON(restored),
+	}}
+}
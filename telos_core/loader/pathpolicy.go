@@ -0,0 +1,250 @@
+/*
+ * Telos Core - Exec Taint Policy
+ *
+ * What happens to a process's taint when it successfully execs a new
+ * program (applied by the bprm_committed_creds hook):
+ *
+ *   preserve  keep the level (default). The safe choice: whatever the
+ *             process picked up (secrets, attacker input) may well have
+ *             been handed to the new program via argv, env or open fds.
+ *   reduce    drop one level. A middle ground for pipelines that exec
+ *             helpers; repeated execs still walk taint down to CLEAN, so
+ *             an attacker who can exec arbitrary binaries can launder it.
+ *   clear     reset to CLEAN. Only sound for binaries that are trusted to
+ *             ignore what they inherit; as a global default it makes
+ *             "exec anything" a taint reset.
+ *
+ * The global mode comes from --exec-taint. SET_PATH_POLICY overrides it
+ * per executable, e.g. clear for a trusted sandbox launcher while the
+ * rest preserve. Overrides are keyed by (device, inode) in
+ * path_policy_map, so symlinks, hardlinks and relative paths resolve to
+ * the same entry; replacing the binary (new inode) drops the override.
+ * Quarantined processes and --monotonic never lose taint on exec.
+ *
+ * SET_PATH_POLICY data: {"path": "/usr/bin/x", "exec_taint": "clear"}
+ * ("default" removes the override)
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+)
+
+// Exec taint modes (must match EXEC_TAINT_* in bpf_lsm.c)
+const (
+	execTaintPreserve uint32 = 0
+	execTaintClear    uint32 = 1
+	execTaintReduce   uint32 = 2
+)
+
+var execTaintModes = map[string]uint32{
+	"preserve": execTaintPreserve,
+	"clear":    execTaintClear,
+	"reduce":   execTaintReduce,
+}
+
+// execTaintName returns the flag/IPC name of an exec taint mode
+func execTaintName(mode uint32) string {
+	for name, m := range execTaintModes {
+		if m == mode {
+			return name
+		}
+	}
+	return fmt.Sprintf("UNKNOWN(%d)", mode)
+}
+
+// PathPolicyKey matches struct path_policy_key_t
+type PathPolicyKey struct {
+	Dev uint64 // kernel s_dev encoding
+	Ino uint64
+}
+
+// PathPolicy matches struct path_policy_t
+type PathPolicy struct {
+	ExecTaint uint32
+}
+
+// pathPolicyState remembers which path each override was set for
+type pathPolicyState struct {
+	mu     sync.Mutex
+	byPath map[string]pathPolicyEntry
+}
+
+type pathPolicyEntry struct {
+	key  PathPolicyKey
+	mode uint32
+}
+
+// executableKey resolves path to the (device, inode) the kernel sees
+func executableKey(path string) (PathPolicyKey, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return PathPolicyKey{}, err
+	}
+	if !fi.Mode().IsRegular() {
+		return PathPolicyKey{}, fmt.Errorf("not a regular file: %s", path)
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return PathPolicyKey{}, fmt.Errorf("no inode information for %s", path)
+	}
+
+	// Userspace dev_t -> kernel s_dev (MKDEV: 12-bit major, 20-bit minor)
+	dev := uint64(st.Dev)
+	major := (dev>>8)&0xfff | (dev>>32)&^uint64(0xfff)
+	minor := dev&0xff | (dev>>12)&^uint64(0xff)
+	return PathPolicyKey{Dev: major<<20 | minor, Ino: st.Ino}, nil
+}
+
+// cmdSetPathPolicy handles SET_PATH_POLICY ({path, exec_taint})
+func (d *TelosDaemon) cmdSetPathPolicy(data map[string]interface{}) IPCResponse {
+	path, err := stringArg(data, "path")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	if path == "" || !filepath.IsAbs(path) {
+		return invalidArg("Invalid 'path': must be an absolute path")
+	}
+	modeName, err := stringArg(data, "exec_taint")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	mode, known := execTaintModes[modeName]
+	if !known && modeName != "default" {
+		return invalidArg("Invalid 'exec_taint': want preserve, clear, reduce or default")
+	}
+	if known && mode != execTaintPreserve && d.opts.MonotonicTaint {
+		return IPCResponse{Success: false, Error: "exec_taint " + modeName + " lowers taint; not allowed with --monotonic"}
+	}
+	if d.maps.PathPolicy == nil {
+		return IPCResponse{Success: false, Error: "BPF object has no path_policy_map"}
+	}
+
+	d.pathPolicy.mu.Lock()
+	defer d.pathPolicy.mu.Unlock()
+
+	if !known {
+		entry, ok := d.pathPolicy.byPath[path]
+		if ok {
+			if err := d.maps.PathPolicy.Delete(entry.key); err != nil {
+				return IPCResponse{Success: false, Error: "delete path policy: " + err.Error()}
+			}
+			delete(d.pathPolicy.byPath, path)
+			log.Printf("[PATH_POLICY] %s: override removed", path)
+		}
+		return IPCResponse{Success: true, Data: map[string]interface{}{"path": path, "removed": ok}}
+	}
+
+	key, err := executableKey(path)
+	if err != nil {
+		return invalidArg("Invalid 'path': %v", err)
+	}
+	// The path may now name a different inode than when it was first set
+	if old, ok := d.pathPolicy.byPath[path]; ok && old.key != key {
+		d.maps.PathPolicy.Delete(old.key)
+	}
+	if err := d.maps.PathPolicy.Put(key, PathPolicy{ExecTaint: mode}); err != nil {
+		return IPCResponse{Success: false, Error: "update path policy: " + err.Error()}
+	}
+	if d.pathPolicy.byPath == nil {
+		d.pathPolicy.byPath = make(map[string]pathPolicyEntry)
+	}
+	d.pathPolicy.byPath[path] = pathPolicyEntry{key: key, mode: mode}
+
+	log.Printf("[PATH_POLICY] %s: exec_taint=%s", path, modeName)
+	return IPCResponse{Success: true, Data: map[string]interface{}{"path": path, "exec_taint": modeName}}
+}
+
+// cmdGetPathPolicy handles GET_PATH_POLICY
+func (d *TelosDaemon) cmdGetPathPolicy() IPCResponse {
+	cfg, err := d.activeConfig()
+	if err != nil {
+		return IPCResponse{Success: false, Error: "read config: " + err.Error()}
+	}
+
+	d.pathPolicy.mu.Lock()
+	paths := make(map[string]string, len(d.pathPolicy.byPath))
+	for path, entry := range d.pathPolicy.byPath {
+		paths[path] = execTaintName(entry.mode)
+	}
+	d.pathPolicy.mu.Unlock()
+
+	return IPCResponse{Success: true, Data: map[string]interface{}{
+		"exec_taint": execTaintName(cfg.ExecTaint),
+		"paths":      paths,
+	}}
+}
+
+// resolvePathPolicy validates a complete {path: exec_taint} set and
+// resolves every path, without touching path_policy_map
+func (d *TelosDaemon) resolvePathPolicy(paths map[string]string) (map[string]pathPolicyEntry, error) {
+	want := make(map[string]pathPolicyEntry, len(paths))
+	for path, name := range paths {
+		if !filepath.IsAbs(path) {
+			return nil, fmt.Errorf("%q: path must be absolute", path)
+		}
+		mode, ok := execTaintModes[name]
+		if !ok {
+			return nil, fmt.Errorf("%s: invalid exec_taint %q (want preserve, clear or reduce)", path, name)
+		}
+		if mode != execTaintPreserve && d.opts.MonotonicTaint {
+			return nil, fmt.Errorf("%s: exec_taint %s lowers taint; not allowed with --monotonic", path, name)
+		}
+		key, err := executableKey(path)
+		if err != nil {
+			return nil, err
+		}
+		want[path] = pathPolicyEntry{key: key, mode: mode}
+	}
+	return want, nil
+}
+
+// replacePathPolicy makes path_policy_map hold exactly the overrides in
+// want (see resolvePathPolicy)
+func (d *TelosDaemon) replacePathPolicy(want map[string]pathPolicyEntry) (added, changed, removed int, err error) {
+	if d.maps.PathPolicy == nil {
+		return 0, 0, 0, fmt.Errorf("BPF object has no path_policy_map")
+	}
+	d.pathPolicy.mu.Lock()
+	defer d.pathPolicy.mu.Unlock()
+
+	for path, entry := range want {
+		old, ok := d.pathPolicy.byPath[path]
+		if ok && old == entry {
+			continue
+		}
+		if err := d.maps.PathPolicy.Put(entry.key, PathPolicy{ExecTaint: entry.mode}); err != nil {
+			return added, changed, removed, fmt.Errorf("update path policy %s: %w", path, err)
+		}
+		if ok {
+			changed++
+		} else {
+			added++
+		}
+	}
+	keep := make(map[PathPolicyKey]bool, len(want))
+	for _, entry := range want {
+		keep[entry.key] = true
+	}
+	// Drop removed paths, and old keys of paths that now name a new inode
+	for path, old := range d.pathPolicy.byPath {
+		entry, ok := want[path]
+		if ok && entry.key == old.key {
+			continue
+		}
+		if !keep[old.key] {
+			d.maps.PathPolicy.Delete(old.key)
+		}
+		if !ok {
+			removed++
+		}
+	}
+	d.pathPolicy.byPath = want
+	return added, changed, removed, nil
+}
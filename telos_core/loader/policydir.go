@@ -0,0 +1,248 @@
+/*
+ * Telos Core - Policy Directory
+ *
+ * With --policy-dir the daemon loads policy files from a directory on
+ * start and reloads them whenever they change (inotify), so policy
+ * rendered onto the host by GitOps tooling takes effect without commands:
+ *
+ *   egress.json       SET_EGRESS_POLICY data:
+ *                     {"allow": [...], "deny": [...], "deny_taint": 4, ...}
+ *   path_policy.json  the complete set of exec taint overrides:
+ *                     {"/usr/bin/sandbox-launch": "clear", ...}
+ *
+ * Changes are debounced by policyDebounce, and a file whose content did
+ * not change is not reapplied. Each file is validated in full before
+ * anything is applied; an invalid file is logged and the previous good
+ * policy stays in force. Removing a file also leaves its policy as it
+ * is. path_policy.json owns path_policy_map: overrides it doesn't list,
+ * including ones set with SET_PATH_POLICY, are removed on reload.
+ *
+ * Events are matched against the whole directory rather than by name,
+ * so files replaced by rename or symlink swap (Kubernetes ConfigMaps)
+ * are picked up too.
+ */
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// policyDebounce is how long the directory must be quiet before reloading
+const policyDebounce = 500 * time.Millisecond
+
+// policyWatchMask covers writes, renames and symlink swaps in the directory
+const policyWatchMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE | syscall.IN_ONLYDIR
+
+// policyLoaders maps each file in --policy-dir to the function applying it
+var policyLoaders = map[string]func(d *TelosDaemon, raw []byte) error{
+	"egress.json":      (*TelosDaemon).applyEgressFile,
+	"path_policy.json": (*TelosDaemon).applyPathPolicyFile,
+}
+
+// policyDirState remembers what was last applied from each file
+type policyDirState struct {
+	mu      sync.Mutex
+	applied map[string][sha256.Size]byte
+}
+
+// startPolicyWatch loads the policy files and watches for changes
+func (d *TelosDaemon) startPolicyWatch() error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("inotify: %w", err)
+	}
+	// Nonblocking, so the runtime poller can interrupt reads on Close
+	f := os.NewFile(uintptr(fd), "inotify")
+	if _, err := syscall.InotifyAddWatch(fd, d.opts.PolicyDir, policyWatchMask); err != nil {
+		f.Close()
+		return fmt.Errorf("watch %s: %w", d.opts.PolicyDir, err)
+	}
+
+	// Watch first so a change during the initial load is not missed
+	d.reloadPolicyDir()
+
+	changed := make(chan struct{}, 1)
+	go func() {
+		<-d.done
+		f.Close()
+	}()
+	go d.readPolicyEvents(f, changed)
+	go d.runPolicyReloads(changed)
+	return nil
+}
+
+// readPolicyEvents signals changed for every event in the directory
+func (d *TelosDaemon) readPolicyEvents(f *os.File, changed chan<- struct{}) {
+	defer close(changed)
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := f.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				log.Printf("Warning: policy dir watch stopped: %v", err)
+			}
+			return
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			nameLen := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			off += syscall.SizeofInotifyEvent + nameLen
+			if mask&syscall.IN_IGNORED != 0 {
+				log.Printf("Warning: %s was removed; policy files are no longer watched", d.opts.PolicyDir)
+				return
+			}
+		}
+		select {
+		case changed <- struct{}{}:
+		default: // A reload is already pending
+		}
+	}
+}
+
+// runPolicyReloads reloads once the directory has been quiet for
+// policyDebounce
+func (d *TelosDaemon) runPolicyReloads(changed <-chan struct{}) {
+	for range changed {
+	quiet:
+		for {
+			select {
+			case _, ok := <-changed:
+				if !ok {
+					return
+				}
+			case <-time.After(policyDebounce):
+				break quiet
+			}
+		}
+		d.reloadPolicyDir()
+	}
+}
+
+// reloadPolicyDir applies every policy file whose content changed
+func (d *TelosDaemon) reloadPolicyDir() {
+	d.policyDir.mu.Lock()
+	defer d.policyDir.mu.Unlock()
+	if d.policyDir.applied == nil {
+		d.policyDir.applied = make(map[string][sha256.Size]byte)
+	}
+
+	names := make([]string, 0, len(policyLoaders))
+	for name := range policyLoaders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		path := filepath.Join(d.opts.PolicyDir, name)
+		raw, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Warning: policy %s: %v", path, err)
+			continue
+		}
+		sum := sha256.Sum256(raw)
+		if last, ok := d.policyDir.applied[name]; ok && last == sum {
+			continue
+		}
+		if err := policyLoaders[name](d, raw); err != nil {
+			log.Printf("Warning: policy %s rejected, keeping the previous policy: %v", path, err)
+			continue
+		}
+		d.policyDir.applied[name] = sum
+	}
+}
+
+// applyEgressFile applies egress.json through SET_EGRESS_POLICY
+func (d *TelosDaemon) applyEgressFile(raw []byte) error {
+	var data map[string]interface{}
+	if err := decodeData(raw, &data); err != nil {
+		return err
+	}
+	for field := range data {
+		switch field {
+		case "allow", "deny", "deny_taint", "unknown_min_taint", "unknown_taint":
+		default:
+			return fmt.Errorf("unknown field %q", field)
+		}
+	}
+
+	d.egress.mu.RLock()
+	before := d.egress.policy
+	d.egress.mu.RUnlock()
+
+	resp := d.cmdSetEgressPolicy(data)
+	if !resp.Success {
+		return errors.New(resp.Error)
+	}
+
+	d.egress.mu.RLock()
+	after := d.egress.policy
+	d.egress.mu.RUnlock()
+	allowAdded, allowRemoved := listChanges(before.Allow, after.Allow)
+	denyAdded, denyRemoved := listChanges(before.Deny, after.Deny)
+	log.Printf("[POLICY] egress.json: allow +%v -%v, deny +%v -%v",
+		allowAdded, allowRemoved, denyAdded, denyRemoved)
+	return nil
+}
+
+// listChanges returns the entries only in after, and only in before
+func listChanges(before, after []string) (added, removed []string) {
+	had := make(map[string]bool, len(before))
+	for _, e := range before {
+		had[e] = true
+	}
+	has := make(map[string]bool, len(after))
+	for _, e := range after {
+		has[e] = true
+		if !had[e] {
+			added = append(added, e)
+		}
+	}
+	for _, e := range before {
+		if !has[e] {
+			removed = append(removed, e)
+		}
+	}
+	return added, removed
+}
+
+// applyPathPolicyFile makes path_policy_map hold exactly the overrides in
+// path_policy.json. Every entry is resolved before the map is touched.
+func (d *TelosDaemon) applyPathPolicyFile(raw []byte) error {
+	if d.maps.PathPolicy == nil {
+		return fmt.Errorf("BPF object has no path_policy_map")
+	}
+	var file map[string]string
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return err
+	}
+
+	want, err := d.resolvePathPolicy(file)
+	if err != nil {
+		return err
+	}
+	added, changed, removed, err := d.replacePathPolicy(want)
+	if err != nil {
+		return err
+	}
+	log.Printf("[POLICY] path_policy.json: %d added, %d changed, %d removed (%d overrides)",
+		added, changed, removed, len(want))
+	return nil
+}
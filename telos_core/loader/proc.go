@@ -0,0 +1,146 @@
+/*
+ * Telos Core - /proc Helpers
+ *
+ * Small readers for per-process information the BPF maps don't carry.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// pidExists reports whether a process with this PID is currently running
+func pidExists(pid uint32) bool {
+	_, err := os.Stat("/proc/" + strconv.FormatUint(uint64(pid), 10))
+	return err == nil
+}
+
+// threadGroup returns the TGID (process ID) of a PID or thread ID.
+// Thread IDs have no /proc/<tid> listing but can still be opened.
+func threadGroup(pid uint32) (uint32, error) {
+	v, err := procStatusField(pid, "Tgid")
+	if err != nil {
+		return 0, err
+	}
+	tgid, err := strconv.ParseUint(v, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("malformed Tgid for PID %d", pid)
+	}
+	return uint32(tgid), nil
+}
+
+// procUID returns the real UID of a process
+func procUID(pid uint32) (uint32, error) {
+	v, err := procStatusField(pid, "Uid")
+	if err != nil {
+		return 0, err
+	}
+	// "Uid:" lists real, effective, saved and filesystem UIDs
+	fields := strings.Fields(v)
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("malformed Uid for PID %d", pid)
+	}
+	uid, err := strconv.ParseUint(fields[0], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("malformed Uid for PID %d", pid)
+	}
+	return uint32(uid), nil
+}
+
+// procStatusField returns one field of /proc/<pid>/status, trimmed
+func procStatusField(pid uint32, name string) (string, error) {
+	raw, err := os.ReadFile("/proc/" + strconv.FormatUint(uint64(pid), 10) + "/status")
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(raw), "\n") {
+		if v, ok := strings.CutPrefix(line, name+":"); ok {
+			return strings.TrimSpace(v), nil
+		}
+	}
+	return "", fmt.Errorf("no %s for PID %d", name, pid)
+}
+
+// procStat holds the /proc/<pid>/stat fields the daemon uses
+type procStat struct {
+	Comm      string
+	PPID      uint32
+	StartTime uint64 // clock ticks since boot (field 22)
+}
+
+// readProcStat parses /proc/<pid>/stat
+func readProcStat(pid uint32) (procStat, error) {
+	raw, err := os.ReadFile("/proc/" + strconv.FormatUint(uint64(pid), 10) + "/stat")
+	if err != nil {
+		return procStat{}, err
+	}
+	line := string(raw)
+
+	// comm is wrapped in parens and may itself contain spaces or parens
+	lp, rp := strings.IndexByte(line, '('), strings.LastIndexByte(line, ')')
+	if lp < 0 || rp < lp {
+		return procStat{}, fmt.Errorf("malformed stat for PID %d", pid)
+	}
+
+	// Fields after comm start at field 3 (state)
+	fields := strings.Fields(line[rp+1:])
+	if len(fields) < 20 {
+		return procStat{}, fmt.Errorf("short stat for PID %d", pid)
+	}
+
+	ppid, err := strconv.ParseUint(fields[1], 10, 32)
+	if err != nil {
+		return procStat{}, err
+	}
+	start, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return procStat{}, err
+	}
+
+	return procStat{
+		Comm:      cleanComm(line[lp+1 : rp]),
+		PPID:      uint32(ppid),
+		StartTime: start,
+	}, nil
+}
+
+// listPIDs returns every PID currently visible in /proc
+func listPIDs() ([]uint32, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	var pids []uint32
+	for _, e := range entries {
+		if pid, err := strconv.ParseUint(e.Name(), 10, 32); err == nil {
+			pids = append(pids, uint32(pid))
+		}
+	}
+	return pids, nil
+}
+
+// descendants returns root followed by all of its live descendants
+func descendants(root uint32) ([]uint32, error) {
+	pids, err := listPIDs()
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[uint32][]uint32)
+	for _, pid := range pids {
+		if st, err := readProcStat(pid); err == nil {
+			children[st.PPID] = append(children[st.PPID], pid)
+		}
+	}
+
+	tree := []uint32{root}
+	for i := 0; i < len(tree); i++ {
+		tree = append(tree, children[tree[i]]...)
+	}
+	return tree, nil
+}
@@ -0,0 +1,140 @@
+/*
+ * Telos Core - Prometheus Exporter
+ *
+ * With --metrics-addr, serves collectMetrics() at /metrics in the
+ * Prometheus text exposition format. Series ending in _total are
+ * counters, everything else is a gauge. /v1/schema serves the DESCRIBE
+ * document (see describe.go).
+ *
+ * --metrics-addr unix:/run/telos/metrics.sock serves the same endpoint on
+ * a Unix socket instead of a TCP port, with the control socket's
+ * permissions (0660), for hosts where no port may be opened:
+ *
+ *   curl --unix-socket /run/telos/metrics.sock http://localhost/metrics
+ */
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// metricsUnixPrefix selects a Unix socket for --metrics-addr
+const metricsUnixPrefix = "unix:"
+
+// listenMetrics opens the TCP or Unix listener for addr
+func listenMetrics(addr string) (net.Listener, error) {
+	path, isUnix := strings.CutPrefix(addr, metricsUnixPrefix)
+	if !isUnix {
+		return net.Listen("tcp", addr)
+	}
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("metrics socket path must be absolute: %s", path)
+	}
+
+	// Only ever replace a stale socket, never some other file
+	if fi, err := os.Lstat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("create metrics socket directory: %w", err)
+	}
+
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil // Closing the listener unlinks the socket
+}
+
+// metricsURL describes where metrics are served, for the startup log
+func metricsURL(addr string) string {
+	if path, ok := strings.CutPrefix(addr, metricsUnixPrefix); ok {
+		return "unix:" + path + " (/metrics)"
+	}
+	return "http://" + addr + "/metrics"
+}
+
+// startMetricsServer starts the /metrics HTTP listener
+func (d *TelosDaemon) startMetricsServer() error {
+	ln, err := listenMetrics(d.opts.MetricsAddr)
+	if err != nil {
+		return err
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", d.serveMetrics)
+	mux.HandleFunc("/v1/schema", d.serveSchema)
+	d.metricsServer = &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+
+	go func() {
+		if err := d.metricsServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Warning: metrics server stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// stopMetricsServer shuts the /metrics listener down
+func (d *TelosDaemon) stopMetricsServer() {
+	if d.metricsServer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	d.metricsServer.Shutdown(ctx)
+}
+
+// serveMetrics renders the metric snapshot as Prometheus text
+func (d *TelosDaemon) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	m := d.collectMetrics()
+
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	typed := make(map[string]bool)
+	for _, name := range names {
+		base := name
+		if i := strings.IndexByte(name, '{'); i >= 0 {
+			base = name[:i]
+		}
+		if !typed[base] {
+			kind := "gauge"
+			if strings.HasSuffix(base, "_total") {
+				kind = "counter"
+			}
+			fmt.Fprintf(&b, "# TYPE %s %s\n", base, kind)
+			typed[base] = true
+		}
+		fmt.Fprintf(&b, "%s %g\n", name, m[name])
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write([]byte(b.String()))
+}
@@ -0,0 +1,102 @@
+/*
+ * Telos Core - Quarantine
+ *
+ * QUARANTINE_PID is an explicit incident-response lockdown, separate from
+ * the graduated taint policy: every hook denies exec, file open and
+ * connect for a quarantined PID before looking at its taint level, even
+ * in audit-only mode. UNQUARANTINE_PID lifts it and leaves taint as is.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// setQuarantine sets or clears the quarantine flag on pid's map entry.
+// An untracked PID gets a fresh CLEAN entry; it reports the previous state.
+func (d *TelosDaemon) setQuarantine(pid uint32, on bool) (bool, error) {
+	d.mapMu.Lock()
+	defer d.mapMu.Unlock()
+	d.settleLocked(pid)
+
+	info, exists, err := d.trackedEntry(pid)
+	if err != nil {
+		return false, err
+	}
+	if !exists {
+		info = ProcessInfo{PID: pid, TaintLevel: TaintClean}
+	}
+	was := info.Quarantined != 0
+	if was == on {
+		return was, nil
+	}
+
+	if on {
+		info.Quarantined = 1
+		if info.Comm[0] == 0 {
+			if st, err := readProcStat(pid); err == nil {
+				info.Comm = commBytes(st.Comm)
+			}
+		}
+	} else {
+		info.Quarantined = 0
+	}
+
+	if err := d.maps.ProcessMap.Put(pid, info); err != nil {
+		return was, err
+	}
+	if !exists {
+		d.noteMapInsert()
+	}
+	d.touch(pid)
+	source := "QUARANTINE_PID"
+	if !on {
+		source = "UNQUARANTINE_PID"
+	}
+	d.notifyQuarantine(pid, on, source)
+	return was, nil
+}
+
+// cmdQuarantinePID handles QUARANTINE_PID ({pid})
+func (d *TelosDaemon) cmdQuarantinePID(data map[string]interface{}) IPCResponse {
+	pid, _, err := processArg(data)
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	if !pidExists(pid) {
+		return IPCResponse{Success: false, Error: fmt.Sprintf("PID %d does not exist", pid)}
+	}
+
+	was, err := d.setQuarantine(pid, true)
+	if err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+	if !was {
+		log.Printf("[QUARANTINE] PID %d quarantined", pid)
+	}
+	return IPCResponse{Success: true, Data: map[string]interface{}{
+		"pid":                 pid,
+		"already_quarantined": was,
+	}}
+}
+
+// cmdUnquarantinePID handles UNQUARANTINE_PID ({pid})
+func (d *TelosDaemon) cmdUnquarantinePID(data map[string]interface{}) IPCResponse {
+	pid, _, err := processArg(data)
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+
+	was, err := d.setQuarantine(pid, false)
+	if err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+	if !was {
+		return IPCResponse{Success: false, Error: fmt.Sprintf("PID %d is not quarantined", pid)}
+	}
+
+	log.Printf("[QUARANTINE] PID %d released", pid)
+	return IPCResponse{Success: true}
+}
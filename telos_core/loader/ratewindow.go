@@ -0,0 +1,87 @@
+/*
+ * Telos Core - Taint Escalation Rate
+ *
+ * Sliding-window counts of taint escalations per level, so a spike in new
+ * HIGH/CRITICAL taints over the last minute is visible immediately.
+ *
+ * Memory is fixed: a ring of rateBuckets buckets, each rateBucketWidth
+ * wide, covering the longest reported window (15m). Old buckets are
+ * recycled lazily when their slot comes around again.
+ */
+
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	rateBucketWidth = 5 * time.Second
+	rateBuckets     = int(15 * time.Minute / rateBucketWidth)
+	numTaintLevels  = TaintCritical + 1
+)
+
+// rateWindows are the windows exported as metrics
+var rateWindows = []struct {
+	label string
+	span  time.Duration
+}{
+	{"1m", time.Minute},
+	{"5m", 5 * time.Minute},
+	{"15m", 15 * time.Minute},
+}
+
+// escalationRate counts escalations per taint level in time buckets
+type escalationRate struct {
+	mu      sync.Mutex
+	epochs  [rateBuckets]int64 // bucket number each slot currently holds
+	buckets [rateBuckets][numTaintLevels]uint64
+}
+
+var escalations escalationRate
+
+// Add records one escalation into level at time now
+func (r *escalationRate) Add(level uint32, now time.Time) {
+	if level >= numTaintLevels {
+		return
+	}
+	epoch := now.UnixNano() / int64(rateBucketWidth)
+	slot := int(epoch % int64(rateBuckets))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.epochs[slot] != epoch {
+		r.epochs[slot] = epoch
+		r.buckets[slot] = [numTaintLevels]uint64{}
+	}
+	r.buckets[slot][level]++
+}
+
+// Count returns escalations into level during the last span
+func (r *escalationRate) Count(level uint32, span time.Duration, now time.Time) uint64 {
+	if level >= numTaintLevels {
+		return 0
+	}
+	epoch := now.UnixNano() / int64(rateBucketWidth)
+	oldest := epoch - int64(span/rateBucketWidth) + 1
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var n uint64
+	for slot := range r.epochs {
+		if e := r.epochs[slot]; e >= oldest && e <= epoch {
+			n += r.buckets[slot][level]
+		}
+	}
+	return n
+}
+
+// recordTaintChange feeds an old -> new transition into the rate window
+func recordTaintChange(oldLevel, newLevel uint32) {
+	if newLevel > oldLevel {
+		escalations.Add(newLevel, time.Now())
+	}
+}
@@ -0,0 +1,372 @@
+/*
+ * Telos Core - Redis State Mirror
+ *
+ * The reference StateMirror backend. Each host's records live in one
+ * hash, so a host's state is replaced atomically and read in one call:
+ *
+ *   telos:hosts          set of mirroring hosts
+ *   telos:taint:<host>   hash: PID -> mirrorRecord JSON
+ *
+ * Speaks RESP directly (like nats.go speaks NATS): AUTH and SELECT from
+ * the URL on connect, then pipelined commands, MULTI/EXEC for Replace.
+ * A lost connection is redialed with exponential backoff; while backing
+ * off, writes fail fast with errSinkUnavailable.
+ *
+ *   --state-mirror redis://[user:pass@]host:6379[/db]   (rediss:// for TLS)
+ */
+
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	redisHostsKey     = "telos:hosts"
+	redisTaintPrefix  = "telos:taint:"
+	redisDialTimeout  = 2 * time.Second
+	redisIOTimeout    = 5 * time.Second
+	maxRedisBulkReply = 64 << 20
+)
+
+// redisError is an error reply from the server (-ERR ...)
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+// redisMirror mirrors taint state into Redis hashes
+type redisMirror struct {
+	url *url.URL
+	db  int
+
+	mu       sync.Mutex // guards the connection and reconnect state
+	conn     net.Conn
+	r        *bufio.Reader
+	nextDial time.Time
+	backoff  time.Duration
+}
+
+func newRedisMirror(rawURL string) (*redisMirror, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("unsupported Redis URL scheme %q (want redis:// or rediss://)", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("Redis URL has no host: %s", rawURL)
+	}
+	if u.Port() == "" {
+		u.Host = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	m := &redisMirror{url: u}
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if m.db, err = strconv.Atoi(path); err != nil || m.db < 0 {
+			return nil, fmt.Errorf("invalid Redis database %q", path)
+		}
+	}
+	return m, nil
+}
+
+func (m *redisMirror) Name() string {
+	return fmt.Sprintf("%s://%s/%d", m.url.Scheme, m.url.Host, m.db)
+}
+
+func (m *redisMirror) Put(rec mirrorRecord) error {
+	value, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	_, err = m.do(
+		[]string{"HSET", redisTaintPrefix + rec.Host, strconv.FormatUint(uint64(rec.PID), 10), string(value)},
+		[]string{"SADD", redisHostsKey, rec.Host},
+	)
+	return err
+}
+
+func (m *redisMirror) Delete(host string, pid uint32) error {
+	_, err := m.do([]string{"HDEL", redisTaintPrefix + host, strconv.FormatUint(uint64(pid), 10)})
+	return err
+}
+
+func (m *redisMirror) Replace(host string, recs []mirrorRecord) error {
+	key := redisTaintPrefix + host
+	cmds := [][]string{{"MULTI"}, {"DEL", key}}
+	if len(recs) > 0 {
+		hset := make([]string, 0, 2+2*len(recs))
+		hset = append(hset, "HSET", key)
+		for _, rec := range recs {
+			value, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			hset = append(hset, strconv.FormatUint(uint64(rec.PID), 10), string(value))
+		}
+		cmds = append(cmds, hset)
+	}
+	cmds = append(cmds, []string{"SADD", redisHostsKey, host}, []string{"EXEC"})
+
+	replies, err := m.do(cmds...)
+	if err != nil {
+		return err
+	}
+	// A command rejected inside MULTI aborts the transaction
+	if replies[len(replies)-1] == nil {
+		return errors.New("transaction aborted")
+	}
+	return nil
+}
+
+func (m *redisMirror) Peers() (map[string][]mirrorRecord, error) {
+	replies, err := m.do([]string{"SMEMBERS", redisHostsKey})
+	if err != nil {
+		return nil, err
+	}
+	members, _ := replies[0].([]interface{})
+	hosts := make([]string, 0, len(members))
+	cmds := make([][]string, 0, len(members))
+	for _, member := range members {
+		host, ok := member.(string)
+		if !ok {
+			continue
+		}
+		hosts = append(hosts, host)
+		cmds = append(cmds, []string{"HGETALL", redisTaintPrefix + host})
+	}
+
+	peers := make(map[string][]mirrorRecord, len(hosts))
+	if len(cmds) == 0 {
+		return peers, nil
+	}
+	if replies, err = m.do(cmds...); err != nil {
+		return nil, err
+	}
+	for i, host := range hosts {
+		fields, _ := replies[i].([]interface{})
+		recs := make([]mirrorRecord, 0, len(fields)/2)
+		for j := 1; j < len(fields); j += 2 {
+			value, _ := fields[j].(string)
+			var rec mirrorRecord
+			if err := json.Unmarshal([]byte(value), &rec); err != nil {
+				continue // Not written by a daemon; skip
+			}
+			recs = append(recs, rec)
+		}
+		peers[host] = recs
+	}
+	return peers, nil
+}
+
+func (m *redisMirror) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.dropConn()
+	return nil
+}
+
+// do pipelines cmds and returns one reply per command. An error reply
+// to any of them is returned as a redisError.
+func (m *redisMirror) do(cmds ...[]string) ([]interface{}, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.conn == nil {
+		if time.Now().Before(m.nextDial) {
+			return nil, errSinkUnavailable
+		}
+		if err := m.connect(); err != nil {
+			m.scheduleRedial()
+			return nil, fmt.Errorf("connect: %w", err)
+		}
+		m.backoff = 0
+		log.Printf("[MIRROR] Connected to %s", m.Name())
+	}
+
+	replies, err := m.roundTrip(cmds)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		m.dropConn() // The stream may be out of step; start over
+	}
+	return replies, err
+}
+
+// roundTrip writes cmds and reads their replies (mu held)
+func (m *redisMirror) roundTrip(cmds [][]string) ([]interface{}, error) {
+	m.conn.SetDeadline(time.Now().Add(redisIOTimeout))
+	defer m.conn.SetDeadline(time.Time{})
+
+	var buf []byte
+	for _, cmd := range cmds {
+		buf = appendRESPCommand(buf, cmd)
+	}
+	if _, err := m.conn.Write(buf); err != nil {
+		return nil, err
+	}
+
+	replies := make([]interface{}, len(cmds))
+	var firstErr error
+	for i := range cmds {
+		reply, err := readRESP(m.r)
+		var replyErr redisError
+		if errors.As(err, &replyErr) {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("%s: %w", cmds[i][0], err)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		replies[i] = reply
+	}
+	return replies, firstErr
+}
+
+// connect dials and authenticates (mu held)
+func (m *redisMirror) connect() error {
+	dialer := &net.Dialer{Timeout: redisDialTimeout}
+	var conn net.Conn
+	var err error
+	if m.url.Scheme == "rediss" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", m.url.Host, &tls.Config{ServerName: m.url.Hostname()})
+	} else {
+		conn, err = dialer.Dial("tcp", m.url.Host)
+	}
+	if err != nil {
+		return err
+	}
+	m.conn = conn
+	m.r = bufio.NewReader(conn)
+
+	var setup [][]string
+	if user := m.url.User; user != nil {
+		pass, ok := user.Password()
+		switch {
+		case ok && user.Username() != "":
+			setup = append(setup, []string{"AUTH", user.Username(), pass})
+		case ok:
+			setup = append(setup, []string{"AUTH", pass})
+		}
+	}
+	if m.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(m.db)})
+	}
+	if len(setup) > 0 {
+		if _, err := m.roundTrip(setup); err != nil {
+			m.dropConn()
+			return err
+		}
+	}
+	return nil
+}
+
+// dropConn closes the current connection; the next call redials (mu held)
+func (m *redisMirror) dropConn() {
+	if m.conn != nil {
+		m.conn.Close()
+		m.conn = nil
+		m.r = nil
+	}
+}
+
+// scheduleRedial backs off exponentially after a failed dial (mu held)
+func (m *redisMirror) scheduleRedial() {
+	switch {
+	case m.backoff == 0:
+		m.backoff = natsBackoffMin
+	case m.backoff < natsBackoffMax:
+		m.backoff = min(m.backoff*2, natsBackoffMax)
+	}
+	m.nextDial = time.Now().Add(m.backoff)
+}
+
+// appendRESPCommand encodes cmd as a RESP array of bulk strings
+func appendRESPCommand(buf []byte, cmd []string) []byte {
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(cmd)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range cmd {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	return buf
+}
+
+// readRESP reads one reply: string, int64, nil or []interface{}. An
+// error reply is returned as a redisError, after the whole reply is read.
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("malformed reply %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, redisError(body)
+	case ':':
+		return strconv.ParseInt(body, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(body)
+		if err != nil || n > maxRedisBulkReply {
+			return nil, fmt.Errorf("malformed bulk length %q", body)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("malformed array length %q", body)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]interface{}, n)
+		var firstErr error
+		for i := range items {
+			item, err := readRESP(r)
+			var replyErr redisError
+			if errors.As(err, &replyErr) {
+				// EXEC reports per-command errors inside its array
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, firstErr
+	default:
+		return nil, fmt.Errorf("unexpected reply type %q", kind)
+	}
+}
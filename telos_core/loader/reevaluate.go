@@ -0,0 +1,157 @@
+/*
+ * Telos Core - Re-evaluation
+ *
+ * The hooks judge a process when it next acts, so tightening thresholds
+ * changes nothing for a process that is already running and sitting
+ * still. REEVALUATE checks tracked processes against the current config
+ * now and can contain the ones that no longer pass:
+ *
+ *   {"command":"REEVALUATE","data":{"pid":4242}}
+ *   {"command":"REEVALUATE","data":{"all":true,"action":"freeze"}}
+ *
+ * A process is over policy when its taint is above any max_taint_for_*
+ * threshold. The daemon has no per-level action policy, so what happens
+ * to such a process is the caller's "action": "none" (default, report
+ * only), "freeze" (FREEZE_PID, subtree) or "quarantine"
+ * (QUARANTINE_PID). Actions are only taken while enforcing; in audit,
+ * off or maintenance mode the report says they were skipped. Exempt,
+ * exited and already quarantined processes are reported but left alone.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+// reevaluateActions are the accepted "action" values
+var reevaluateActions = map[string]bool{"none": true, "freeze": true, "quarantine": true}
+
+// cmdReevaluate handles REEVALUATE ({pid | all, action?})
+func (d *TelosDaemon) cmdReevaluate(data map[string]interface{}) IPCResponse {
+	all, err := boolArg(data, "all")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	_, hasPID := data["pid"]
+	if all == hasPID {
+		return invalidArg("Give either 'pid' or 'all':true")
+	}
+	action := "none"
+	if _, ok := data["action"]; ok {
+		if action, err = stringArg(data, "action"); err != nil {
+			return invalidArg("%v", err)
+		}
+		if !reevaluateActions[action] {
+			return invalidArg("Invalid 'action' %q (want none, freeze or quarantine)", action)
+		}
+	}
+
+	var targets []processEntry
+	if all {
+		if targets, err = d.snapshotProcesses(); err != nil {
+			return IPCResponse{Success: false, Error: err.Error()}
+		}
+	} else {
+		pid, _, err := processArg(data)
+		if err != nil {
+			return invalidArg("%v", err)
+		}
+		info, tracked, err := d.trackedEntry(pid)
+		if err != nil {
+			return IPCResponse{Success: false, Error: err.Error()}
+		}
+		if !tracked {
+			return IPCResponse{Success: false, Error: fmt.Sprintf("PID %d is not tracked", pid)}
+		}
+		targets = []processEntry{{PID: pid, Info: info}}
+	}
+
+	cfg, err := d.activeConfig()
+	if err != nil {
+		return IPCResponse{Success: false, Error: "read config: " + err.Error()}
+	}
+	enforce := cfg.Enabled == enforceOn && cfg.Maintenance == 0
+
+	results := []map[string]interface{}{}
+	acted := 0
+	for _, e := range targets {
+		over := []string{}
+		for _, hook := range policyHooks {
+			if e.Info.TaintLevel > sandboxMax(cfg, *thresholdFields[hook](&cfg), e.Info.IsSandboxed != 0) {
+				over = append(over, hook)
+			}
+		}
+		if len(over) == 0 {
+			continue
+		}
+
+		decision := "audit"
+		if enforce {
+			decision = "deny"
+		}
+		r := map[string]interface{}{
+			"pid":      e.PID,
+			"comm":     commString(e.Info.Comm),
+			"level":    taintLevelName(e.Info.TaintLevel),
+			"over":     over,
+			"decision": decision,
+		}
+		exempt := false
+		if d.maps.Exempt != nil {
+			var one uint32
+			exempt = d.maps.Exempt.Lookup(e.PID, &one) == nil
+		}
+		switch {
+		case action == "none":
+		case exempt:
+			r["skipped"] = "exempt"
+		case !pidExists(e.PID):
+			r["skipped"] = "not running"
+		case !enforce:
+			r["skipped"] = "not enforcing (" + enforceModeName(cfg.Enabled) + maintenanceSuffix(cfg) + ")"
+		case action == "quarantine" && e.Info.Quarantined != 0:
+			r["skipped"] = "already quarantined"
+		default:
+			if err := d.reevaluateAction(e.PID, action); err != nil {
+				r["error"] = err.Error()
+				break
+			}
+			r["action"] = action
+			acted++
+			log.Printf("[REEVALUATE] PID %d (%s) at %s is over %v: %s", e.PID, commString(e.Info.Comm),
+				taintLevelName(e.Info.TaintLevel), over, action)
+		}
+		results = append(results, r)
+	}
+
+	return IPCResponse{Success: true, Data: map[string]interface{}{
+		"evaluated":   len(targets),
+		"over_policy": results,
+		"acted":       acted,
+		"action":      action,
+		"enforcing":   enforce,
+	}}
+}
+
+// reevaluateAction contains pid with the REEVALUATE action
+func (d *TelosDaemon) reevaluateAction(pid uint32, action string) error {
+	switch action {
+	case "freeze":
+		_, err := d.freezePID(pid, freezeModeSubtree)
+		return err
+	case "quarantine":
+		_, err := d.setQuarantine(pid, true)
+		return err
+	}
+	return nil
+}
+
+// maintenanceSuffix notes maintenance mode in a mode description
+func maintenanceSuffix(cfg Config) string {
+	if cfg.Maintenance != 0 {
+		return ", maintenance"
+	}
+	return ""
+}
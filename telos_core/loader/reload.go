@@ -0,0 +1,134 @@
+/*
+ * Telos Core - BPF Object Reload
+ *
+ * Swaps the loaded BPF object (SIGHUP or RELOAD_BPF) without ever leaving
+ * the host unprotected:
+ *
+ *   1. load the new object, reusing the live maps so taint state survives
+ *   2. attach all of its hooks into a temporary link set
+ *   3. only if every required hook attached, detach the old links and
+ *      release the old programs; otherwise tear down the new attempt and
+ *      keep the old set serving
+ *
+ * A hook is required if it is marked Required or is attached right now,
+ * so a reload can never silently drop an enforcement point.
+ */
+
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/cilium/ebpf"
+)
+
+// ReloadBPF swaps in the object at path (or the current object path).
+// It returns the per-program attach report of the new object.
+// Reloads are serialized by bpfMu.
+func (d *TelosDaemon) ReloadBPF(path string) (map[string]string, error) {
+	if d.opts.Observe {
+		return nil, fmt.Errorf("nothing is loaded in --observe mode")
+	}
+	d.bpfMu.Lock()
+	defer d.bpfMu.Unlock()
+
+	if path == "" {
+		path = d.bpfObjPath
+	}
+	return d.reloadLocked(path, nil)
+}
+
+// reloadLocked swaps in the object at path, with the live maps except
+// where override names another. Caller holds bpfMu.
+func (d *TelosDaemon) reloadLocked(path string, override map[string]*ebpf.Map) (map[string]string, error) {
+	log.Printf("[RELOAD] Loading %s", path)
+
+	spec, err := ebpf.LoadCollectionSpec(path)
+	if err != nil {
+		return nil, fmt.Errorf("load collection spec: %w", err)
+	}
+	if err := checkLayouts(spec); err != nil {
+		return nil, err
+	}
+
+	// Reuse the live maps so the new programs see existing state
+	replacements := make(map[string]*ebpf.Map)
+	for name, m := range map[string]*ebpf.Map{
+		"process_map":     d.maps.ProcessMap,
+		"config_map":      d.maps.ConfigMap,
+		"events":          d.maps.Events,
+		"path_policy_map": d.maps.PathPolicy,
+		"exempt_map":      d.maps.Exempt,
+	} {
+		if m != nil && spec.Maps[name] != nil {
+			replacements[name] = m
+		}
+	}
+	for name, m := range override {
+		replacements[name] = m
+	}
+
+	coll, err := ebpf.NewCollectionWithOptions(spec, ebpf.CollectionOptions{
+		MapReplacements: replacements,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("new collection: %w", err)
+	}
+
+	links, report, err := attachHooks(coll, func(h lsmHook) bool {
+		return h.Required || d.links[h.Program] != nil
+	})
+	if err != nil {
+		coll.Close()
+		log.Printf("[RELOAD] Rolled back, keeping current object: %v", err)
+		return report, err
+	}
+
+	// New set is fully attached; retire the old one. The old collection's
+	// maps stay open because d.maps still refers to them.
+	d.links.Close()
+	if d.coll != nil {
+		for _, prog := range d.coll.Programs {
+			prog.Close()
+		}
+	}
+	d.coll = coll
+	d.links = links
+	d.attachReport = report
+	d.bpfObjPath = path
+
+	log.Printf("[RELOAD] Now running %s", path)
+	return report, nil
+}
+
+// cmdReloadBPF handles RELOAD_BPF ({path?})
+func (d *TelosDaemon) cmdReloadBPF(data map[string]interface{}) IPCResponse {
+	path, err := stringArg(data, "path")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	if path != "" {
+		if err := checkUserPath(path); err != nil {
+			return IPCResponse{Success: false, Error: err.Error()}
+		}
+	}
+
+	report, err := d.ReloadBPF(path)
+
+	d.bpfMu.Lock()
+	object := d.bpfObjPath
+	d.bpfMu.Unlock()
+
+	resp := IPCResponse{
+		Success: err == nil,
+		Data: map[string]interface{}{
+			"object": object,
+			"hooks":  report,
+		},
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp
+}
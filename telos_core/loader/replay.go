@@ -0,0 +1,118 @@
+/*
+ * Telos Core - Event Log Replay
+ *
+ * REPLAY re-applies a newline-delimited event log (as written by the
+ * file event sink) to process_map, as if each event had just occurred:
+ * an event's taint level is raised onto its PID, never lowered. An
+ * event for a thread is applied to its process, and every write goes
+ * through the same bookkeeping and notifications as UPDATE_TAINT.
+ *
+ * Request data:
+ *   path     absolute path of the NDJSON log (required)
+ *   dry_run  only log what would change
+ *   force    also apply events for PIDs that are no longer running
+ */
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"log"
+)
+
+const maxReplayLine = 1 << 20
+
+// cmdReplay applies a dumped event log to the taint map
+func (d *TelosDaemon) cmdReplay(data map[string]interface{}) IPCResponse {
+	path, err := stringArg(data, "path")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	dryRun, err := boolArg(data, "dry_run")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	force, err := boolArg(data, "force")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+
+	f, err := openFileNoFollow(path)
+	if err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+	defer f.Close()
+
+	var applied, unchanged, missing, invalid int
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxReplayLine)
+
+	for scanner.Scan() {
+		var ev Event
+		if err := json.Unmarshal(scanner.Bytes(), &ev); err != nil ||
+			ev.PID == 0 || ev.TaintLevel > TaintCritical {
+			invalid++
+			continue
+		}
+
+		// process_map is keyed by process; a thread's event is its process's
+		ev.PID, _ = processOf(ev.PID)
+		if !force && !pidExists(ev.PID) {
+			missing++
+			continue
+		}
+
+		changed, err := d.replayEvent(ev, dryRun)
+		if err != nil {
+			return IPCResponse{Success: false, Error: err.Error()}
+		}
+		if changed {
+			applied++
+		} else {
+			unchanged++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+
+	return IPCResponse{Success: true, Data: map[string]interface{}{
+		"applied":         applied,
+		"unchanged":       unchanged,
+		"skipped_missing": missing,
+		"invalid":         invalid,
+		"dry_run":         dryRun,
+	}}
+}
+
+// replayEvent raises ev.PID's taint to the event's level if it is lower
+func (d *TelosDaemon) replayEvent(ev Event, dryRun bool) (bool, error) {
+	d.mapMu.Lock()
+	defer d.mapMu.Unlock()
+	if !dryRun {
+		d.settleLocked(ev.PID)
+	}
+
+	info, exists, err := d.trackedEntry(ev.PID)
+	switch {
+	case err != nil:
+		return false, err
+	case !exists:
+		info = ProcessInfo{PID: ev.PID, Comm: commBytes(ev.Comm)}
+	case info.TaintLevel >= ev.TaintLevel:
+		return false, nil
+	}
+
+	if dryRun {
+		log.Printf("[REPLAY] (dry-run) PID %d taint %d -> %d", ev.PID, info.TaintLevel, ev.TaintLevel)
+		return true, nil
+	}
+
+	if err := d.putTaintLocked(info, exists, ev.TaintLevel, "REPLAY"); err != nil {
+		return false, err
+	}
+	log.Printf("[REPLAY] PID %d taint -> %d", ev.PID, ev.TaintLevel)
+	return true, nil
+}
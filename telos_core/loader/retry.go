@@ -0,0 +1,135 @@
+/*
+ * Telos Core - Sink Retries
+ *
+ * Every forwarder delivers through the same retry policy and circuit
+ * breaker, so an unreachable endpoint can't turn into a retry storm:
+ *
+ *   - a failed delivery is retried up to sinkMaxAttempts times in all,
+ *     sleeping an exponential backoff with full jitter in between
+ *   - after sinkBreakerThreshold deliveries in a row fail, the breaker
+ *     opens: events fail fast (counted, not logged) for sinkBreakerCooldown
+ *   - then it half-opens: the next delivery is a single probe, which
+ *     closes the breaker on success or reopens it on failure
+ *
+ * telos_sink_circuit_open{sink} is 1 while a sink's breaker is not
+ * closed. All of this runs on the forwarder's goroutine; the event reader
+ * only ever enqueues (see sink.go).
+ */
+
+package main
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	sinkMaxAttempts      = 3
+	sinkRetryBase        = 100 * time.Millisecond
+	sinkRetryMax         = 2 * time.Second
+	sinkBreakerThreshold = 5
+	sinkBreakerCooldown  = 30 * time.Second
+)
+
+// retryDelay is the jittered backoff before retry number attempt (1-based)
+func retryDelay(attempt int) time.Duration {
+	d := sinkRetryBase << (attempt - 1)
+	if d <= 0 || d > sinkRetryMax {
+		d = sinkRetryMax
+	}
+	return time.Duration(rand.Int63n(int64(d)) + 1)
+}
+
+// Breaker states
+const (
+	breakerClosed = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// circuitBreaker pauses deliveries to a sink that keeps failing
+type circuitBreaker struct {
+	mu        sync.Mutex
+	state     int
+	failures  int // consecutive failed deliveries
+	openUntil time.Time
+}
+
+// allow reports whether a delivery may be attempted now; after the
+// cooldown it lets one probe through (half-open)
+func (b *circuitBreaker) allow(now time.Time) (ok, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen && !now.Before(b.openUntil) {
+		b.state = breakerHalfOpen
+		return true, true
+	}
+	return b.state == breakerClosed, false
+}
+
+// record notes a delivery's outcome and reports a state change:
+// "open" when the breaker trips (or a probe fails), "closed" on recovery
+func (b *circuitBreaker) record(ok bool, now time.Time) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if ok {
+		b.failures = 0
+		if b.state != breakerClosed {
+			b.state = breakerClosed
+			return "closed"
+		}
+		return ""
+	}
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= sinkBreakerThreshold {
+		b.state = breakerOpen
+		b.openUntil = now.Add(sinkBreakerCooldown)
+		return "open"
+	}
+	return ""
+}
+
+// isOpen reports whether deliveries are currently paused or probing
+func (b *circuitBreaker) isOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != breakerClosed
+}
+
+// deliver runs send under the retry policy and the forwarder's breaker.
+// Retries stop early once the forwarder is closing.
+func (f *eventForwarder) deliver(send func() error) error {
+	ok, probe := f.breaker.allow(time.Now())
+	if !ok {
+		return errSinkUnavailable
+	}
+	attempts := sinkMaxAttempts
+	if probe {
+		attempts = 1
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = send(); err == nil || errors.Is(err, errSinkUnavailable) || attempt >= attempts {
+			break
+		}
+		metrics.EventForwardRetries.Add(1)
+		select {
+		case <-f.closing:
+			attempts = attempt + 1 // One last try, no more waiting
+		case <-time.After(retryDelay(attempt)):
+		}
+	}
+
+	switch f.breaker.record(err == nil, time.Now()) {
+	case "open":
+		log.Printf("Warning: event sink %s: failing (%v); pausing deliveries for %s",
+			f.sink.Name(), err, sinkBreakerCooldown)
+	case "closed":
+		log.Printf("[SINK] %s recovered, resuming deliveries", f.sink.Name())
+	}
+	return err
+}
@@ -0,0 +1,39 @@
+/*
+ * Telos Core - Sandboxed Processes
+ *
+ * process_info_t.is_sandboxed marks a process that runs confined (an
+ * agent in a container, a tool runner under a sandbox launcher). Such a
+ * process is held to stricter thresholds: every hook's max_taint drops
+ * by config.sandbox_tighten levels (--sandbox-tighten, default 1,
+ * never below CLEAN), so with the default thresholds
+ *
+ *                 exec     file       connect    ptrace
+ *   normal        MEDIUM   HIGH       CRITICAL   CRITICAL
+ *   sandboxed     LOW      MEDIUM     HIGH       HIGH
+ *
+ * and a sandboxed process at HIGH is denied connect and ptrace that a
+ * normal one at HIGH may still do. 0 turns the distinction off.
+ *
+ * A process is marked with REGISTER_AGENT {"sandboxed":true}; re-
+ * registering never clears the mark, not even with force_clean (only
+ * CLEAR_TAINT removing the entry does). Children inherit it with their
+ * parent's taint. GET_EFFECTIVE_POLICY and SIMULATE_TAINT report the
+ * tightened thresholds, and REEVALUATE applies them.
+ */
+
+package main
+
+// Levels a sandboxed process's thresholds drop by default
+const defaultSandboxTighten = 1
+
+// sandboxMax is a hook's threshold for a process, tightened for a
+// sandboxed one (mirrors hook_max in bpf_lsm.c)
+func sandboxMax(cfg Config, maxTaint uint32, sandboxed bool) uint32 {
+	if !sandboxed {
+		return maxTaint
+	}
+	if maxTaint > cfg.SandboxTighten {
+		return maxTaint - cfg.SandboxTighten
+	}
+	return TaintClean
+}
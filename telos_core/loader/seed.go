@@ -0,0 +1,240 @@
+/*
+ * Telos Core - Seed File
+ *
+ * --seed-file bootstraps taint on start without a running Cortex, e.g.
+ * known-bad PIDs or programs computed ahead of an air-gapped boot. Each
+ * entry names either a PID or a comm, and a level (number or name):
+ *
+ *   [{"pid": 4242, "taint_level": "HIGH"},
+ *    {"comm": "nc", "taint_level": 3}]
+ *
+ * or, for a .csv file, the same with a header:
+ *
+ *   pid,comm,taint_level
+ *   4242,,HIGH
+ *   ,nc,3
+ *
+ * The file is validated when the flag is parsed. Entries are applied
+ * after the pinned map was reattached or --state-file restored: a comm
+ * entry taints every running process whose comm matches (first
+ * --comm-match-len bytes), PIDs that don't exist are skipped, and a seed
+ * never lowers a level the map already holds.
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// seedEntry is one validated seed file entry (PID or Comm set)
+type seedEntry struct {
+	PID   uint32
+	Comm  string
+	Level uint32
+}
+
+// seedCSVHeader is the required header of a .csv seed file
+var seedCSVHeader = []string{"pid", "comm", "taint_level"}
+
+// loadSeedFile reads and validates a seed file; .csv selects CSV, anything
+// else is parsed as JSON
+func loadSeedFile(path string) ([]seedEntry, error) {
+	if err := checkUserPath(path); err != nil {
+		return nil, err
+	}
+	raw, err := readFileNoFollow(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []seedEntry
+	if strings.EqualFold(filepath.Ext(path), ".csv") {
+		entries, err = parseSeedCSV(raw)
+	} else {
+		entries, err = parseSeedJSON(raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entries, nil
+}
+
+// newSeedEntry checks that exactly one of pid/comm was given
+func newSeedEntry(pid uint32, comm string, level uint32) (seedEntry, error) {
+	if (pid == 0) == (comm == "") {
+		return seedEntry{}, fmt.Errorf("need exactly one of 'pid' or 'comm'")
+	}
+	if len(comm) > maxCommLen {
+		return seedEntry{}, fmt.Errorf("comm %q longer than %d bytes", comm, maxCommLen)
+	}
+	return seedEntry{PID: pid, Comm: comm, Level: level}, nil
+}
+
+func parseSeedJSON(raw []byte) ([]seedEntry, error) {
+	var items []map[string]interface{}
+	if err := json.Unmarshal(raw, &items); err != nil {
+		return nil, err
+	}
+	entries := make([]seedEntry, 0, len(items))
+	for i, item := range items {
+		for field := range item {
+			if field != "pid" && field != "comm" && field != "taint_level" {
+				return nil, fmt.Errorf("entry %d: unknown field %q", i, field)
+			}
+		}
+		var pid uint64
+		if _, ok := item["pid"]; ok {
+			var err error
+			if pid, err = uintArg(item, "pid", math.MaxUint32); err != nil || pid == 0 {
+				return nil, fmt.Errorf("entry %d: invalid 'pid'", i)
+			}
+		}
+		comm, err := stringArg(item, "comm")
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %v", i, err)
+		}
+		level, err := levelArg(item, "taint_level")
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %v", i, err)
+		}
+		e, err := newSeedEntry(uint32(pid), comm, level)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+func parseSeedCSV(raw []byte) ([]seedEntry, error) {
+	r := csv.NewReader(bytes.NewReader(raw))
+	r.FieldsPerRecord = len(seedCSVHeader)
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if strings.Join(header, ",") != strings.Join(seedCSVHeader, ",") {
+		return nil, fmt.Errorf("unexpected header %q (want %q)",
+			strings.Join(header, ","), strings.Join(seedCSVHeader, ","))
+	}
+
+	var entries []seedEntry
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		var pid uint64
+		if rec[0] != "" {
+			if pid, err = strconv.ParseUint(rec[0], 10, 32); err != nil || pid == 0 {
+				return nil, fmt.Errorf("line %d: invalid pid %q", line, rec[0])
+			}
+		}
+		level, err := parseLevelFlag(rec[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		e, err := newSeedEntry(uint32(pid), rec[1], level)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// applySeed raises process_map entries to the seeded levels. Returns how
+// many processes were tainted and how many entries matched nothing.
+func (d *TelosDaemon) applySeed(entries []seedEntry) (applied, skipped int, err error) {
+	// comm entries are matched against one /proc scan
+	var running map[uint32]string
+	for _, e := range entries {
+		if e.Comm != "" {
+			pids, err := listPIDs()
+			if err != nil {
+				return 0, 0, err
+			}
+			running = make(map[uint32]string, len(pids))
+			for _, pid := range pids {
+				if st, err := readProcStat(pid); err == nil {
+					running[pid] = st.Comm
+				}
+			}
+			break
+		}
+	}
+
+	// Highest level per PID, so overlapping entries apply once
+	levels := make(map[uint32]uint32)
+	comms := make(map[uint32]string)
+	for _, e := range entries {
+		matched := false
+		if e.PID != 0 {
+			pid := e.PID
+			if tgid, err := threadGroup(pid); err == nil && tgid != 0 {
+				pid = tgid // A thread ID seeds its whole process
+			}
+			if st, err := readProcStat(pid); err == nil {
+				matched = true
+				comms[pid] = st.Comm
+				levels[pid] = max(levels[pid], e.Level)
+			}
+		} else {
+			for pid, comm := range running {
+				if d.commMatches(e.Comm, comm) {
+					matched = true
+					comms[pid] = comm
+					levels[pid] = max(levels[pid], e.Level)
+				}
+			}
+		}
+		if !matched {
+			skipped++
+			d.debugf("[SEED] No running process for %s", seedTarget(e))
+		}
+	}
+
+	d.mapMu.Lock()
+	defer d.mapMu.Unlock()
+
+	for pid, level := range levels {
+		info, exists, err := d.trackedEntry(pid)
+		if err != nil {
+			return applied, skipped, err
+		}
+		if exists && info.TaintLevel >= level {
+			continue // Never lowered
+		}
+		if !exists {
+			info = ProcessInfo{PID: pid, TaintLevel: TaintClean, Comm: commBytes(comms[pid])}
+		}
+		if err := d.putTaintLocked(info, exists, level, "SEED"); err != nil {
+			return applied, skipped, fmt.Errorf("PID %d: %w", pid, err)
+		}
+		log.Printf("[SEED] PID %d (%s) taint -> %s", pid, comms[pid], taintLevelName(level))
+		applied++
+	}
+	return applied, skipped, nil
+}
+
+// seedTarget describes an entry for log lines
+func seedTarget(e seedEntry) string {
+	if e.PID != 0 {
+		return fmt.Sprintf("PID %d", e.PID)
+	}
+	return fmt.Sprintf("comm %q", e.Comm)
+}
@@ -0,0 +1,264 @@
+/*
+ * Telos Core - Shadow Enforcement
+ *
+ * SET_SHADOW_CONFIG installs a candidate config next to the active one.
+ * While it is set, the exec hook also reports allowed execs of tracked
+ * processes (config report_allowed), and every enforcement-relevant event
+ * is re-decided under the candidate. Differences are logged
+ * ("would now BLOCK ...") and aggregated for GET_SHADOW_DIFF, so a
+ * stricter policy can be validated against real traffic first.
+ *
+ * Decisions are modelled on bpf_lsm.c: each hook blocks above its
+ * max_taint_for_* threshold. Allowed execs (in shadow mode) and all
+ * connects of tracked processes are reported, so a stricter candidate is
+ * visible there; file_open and ptrace are only reported when blocked, so
+ * for them only a looser candidate shows up. Quarantine does not depend
+ * on config and is skipped.
+ */
+
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+// shadowRecentMax bounds the list of recent differing decisions
+const shadowRecentMax = 100
+
+// shadowDiff is one decision that differs under the candidate
+type shadowDiff struct {
+	Time       time.Time `json:"time"`
+	PID        uint32    `json:"pid"`
+	Comm       string    `json:"comm"`
+	Action     string    `json:"action"`
+	TaintLevel uint32    `json:"taint_level"`
+	Verdict    string    `json:"verdict"` // "BLOCK" or "ALLOW" under the candidate
+}
+
+// shadowCounts aggregates differences for one action
+type shadowCounts struct {
+	Compared   uint64 `json:"compared"`
+	WouldBlock uint64 `json:"would_block"`
+	WouldAllow uint64 `json:"would_allow"`
+}
+
+// shadowState holds the candidate config and its comparison results
+type shadowState struct {
+	mu        sync.Mutex
+	candidate *Config
+	since     time.Time
+	byAction  map[string]*shadowCounts
+	recent    []shadowDiff
+}
+
+// reset clears accumulated results (caller holds mu)
+func (s *shadowState) reset() {
+	s.since = time.Now()
+	s.byAction = make(map[string]*shadowCounts)
+	s.recent = nil
+}
+
+// shadowDecision reports whether cfg would block ev, and whether cfg
+// influences the decision for this kind of event at all
+func shadowDecision(cfg Config, ev Event) (blocked, applies bool) {
+	if ev.Quarantined {
+		return false, false
+	}
+	switch ev.Action {
+	case "execve":
+		blocked = ev.TaintLevel > cfg.MaxTaintForExec
+	case "open":
+		blocked = ev.TaintLevel > cfg.MaxTaintForOpen
+	case "connect":
+		blocked = ev.TaintLevel > cfg.MaxTaintForConnect
+	case "ptrace":
+		blocked = ev.TaintLevel > cfg.MaxTaintForPtrace
+	default:
+		return false, false
+	}
+	return blocked && cfg.Enabled == enforceOn, true
+}
+
+// observeShadow compares ev's actual outcome with the candidate config
+func (d *TelosDaemon) observeShadow(ev Event) {
+	d.shadow.mu.Lock()
+	defer d.shadow.mu.Unlock()
+
+	if d.shadow.candidate == nil {
+		return
+	}
+	wouldBlock, applies := shadowDecision(*d.shadow.candidate, ev)
+	if !applies {
+		return
+	}
+
+	counts := d.shadow.byAction[ev.Action]
+	if counts == nil {
+		counts = &shadowCounts{}
+		d.shadow.byAction[ev.Action] = counts
+	}
+	counts.Compared++
+
+	// The kernel reports blocked=1 even in audit mode; fold in `enabled`
+	// so both sides mean "would actually be denied"
+	active, err := d.activeConfig()
+	if err != nil {
+		return
+	}
+	if wouldBlock == (ev.Blocked && active.Enabled == enforceOn && active.Maintenance == 0) {
+		return
+	}
+
+	verdict := "ALLOW"
+	if wouldBlock {
+		verdict = "BLOCK"
+		counts.WouldBlock++
+	} else {
+		counts.WouldAllow++
+	}
+	log.Printf("[SHADOW] would now %s %s for PID %d (%s, taint %d)",
+		verdict, ev.Action, ev.PID, ev.Comm, ev.TaintLevel)
+
+	if len(d.shadow.recent) >= shadowRecentMax {
+		d.shadow.recent = d.shadow.recent[1:]
+	}
+	d.shadow.recent = append(d.shadow.recent, shadowDiff{
+		Time:       ev.Time,
+		PID:        ev.PID,
+		Comm:       ev.Comm,
+		Action:     ev.Action,
+		TaintLevel: ev.TaintLevel,
+		Verdict:    verdict,
+	})
+}
+
+// activeConfig reads the live config from config_map
+func (d *TelosDaemon) activeConfig() (Config, error) {
+	var cfg Config
+	err := d.maps.ConfigMap.Lookup(uint32(0), &cfg)
+	return cfg, err
+}
+
+// setReportAllowed toggles allowed-exec reporting in the live config
+func (d *TelosDaemon) setReportAllowed(on bool) error {
+	d.cfgMu.Lock()
+	defer d.cfgMu.Unlock()
+
+	cfg, err := d.activeConfig()
+	if err != nil {
+		return err
+	}
+	cfg.ReportAllowed = 0
+	if on {
+		cfg.ReportAllowed = 1
+	}
+	return d.maps.ConfigMap.Put(uint32(0), cfg)
+}
+
+// cmdSetShadowConfig handles SET_SHADOW_CONFIG
+// ({max_taint_for_exec?, max_taint_for_open?, enabled? | mode?} or {clear: true}).
+// Omitted fields default to the active config.
+func (d *TelosDaemon) cmdSetShadowConfig(data map[string]interface{}) IPCResponse {
+	if resp, ok := d.requireEvents("SET_SHADOW_CONFIG"); !ok {
+		return resp
+	}
+	clearShadow, err := boolArg(data, "clear")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+
+	d.shadow.mu.Lock()
+	defer d.shadow.mu.Unlock()
+
+	if clearShadow {
+		if d.shadow.candidate == nil {
+			return IPCResponse{Success: true}
+		}
+		if err := d.setReportAllowed(false); err != nil {
+			return IPCResponse{Success: false, Error: err.Error()}
+		}
+		d.shadow.candidate = nil
+		log.Println("[SHADOW] Candidate config cleared")
+		return IPCResponse{Success: true}
+	}
+
+	candidate, err := d.activeConfig()
+	if err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+	if _, err := applyConfigFields(&candidate, data); err != nil {
+		return invalidArg("%v", err)
+	}
+
+	if err := d.setReportAllowed(true); err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+	d.shadow.candidate = &candidate
+	d.shadow.reset()
+
+	log.Printf("[SHADOW] Candidate config: exec>%d open>%d connect>%d ptrace>%d mode=%s",
+		candidate.MaxTaintForExec, candidate.MaxTaintForOpen,
+		candidate.MaxTaintForConnect, candidate.MaxTaintForPtrace, enforceModeName(candidate.Enabled))
+	return IPCResponse{Success: true}
+}
+
+// cmdGetShadowDiff handles GET_SHADOW_DIFF ({reset?})
+func (d *TelosDaemon) cmdGetShadowDiff(data map[string]interface{}) IPCResponse {
+	reset, err := boolArg(data, "reset")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+
+	active, err := d.activeConfig()
+	if err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+
+	d.shadow.mu.Lock()
+	defer d.shadow.mu.Unlock()
+
+	if d.shadow.candidate == nil {
+		return IPCResponse{Success: false, Error: "No shadow config set"}
+	}
+
+	total := shadowCounts{}
+	byAction := make(map[string]shadowCounts, len(d.shadow.byAction))
+	for action, c := range d.shadow.byAction {
+		byAction[action] = *c
+		total.Compared += c.Compared
+		total.WouldBlock += c.WouldBlock
+		total.WouldAllow += c.WouldAllow
+	}
+
+	result := map[string]interface{}{
+		"active":      configJSON(active),
+		"candidate":   configJSON(*d.shadow.candidate),
+		"since":       d.shadow.since.UTC().Format(time.RFC3339),
+		"compared":    total.Compared,
+		"would_block": total.WouldBlock,
+		"would_allow": total.WouldAllow,
+		"by_action":   byAction,
+		"recent":      append([]shadowDiff(nil), d.shadow.recent...),
+	}
+	if reset {
+		d.shadow.reset()
+	}
+	return IPCResponse{Success: true, Data: result}
+}
+
+// configJSON renders a Config for IPC responses
+func configJSON(cfg Config) map[string]interface{} {
+	return map[string]interface{}{
+		"max_taint_for_exec":    taintLevelName(cfg.MaxTaintForExec),
+		"max_taint_for_open":    taintLevelName(cfg.MaxTaintForOpen),
+		"max_taint_for_connect": taintLevelName(cfg.MaxTaintForConnect),
+		"max_taint_for_ptrace":  taintLevelName(cfg.MaxTaintForPtrace),
+		"enabled":               cfg.Enabled == enforceOn,
+		"mode":                  enforceModeName(cfg.Enabled),
+
+		"default_taint_untracked": taintLevelName(cfg.DefaultTaintUntracked),
+		"sandbox_tighten":         cfg.SandboxTighten,
+	}
+}
@@ -0,0 +1,169 @@
+/*
+ * Telos Core - Shutdown
+ *
+ * Stop runs once (SIGTERM, SIGINT and SHUTDOWN all end up here), in a
+ * fixed order where each step starts only after the previous finished:
+ *
+ *   1. stop accepting    done is closed and the listener shut; a
+ *                        connection accepted concurrently is closed
+ *                        without being served
+ *   2. drain handlers    every connection finishes the command it is
+ *                        running and serves no further one; blocked
+ *                        reads are woken. Waits up to shutdownDrainTimeout
+ *   3. detach hooks      from here on nothing but Stop touches the maps
+ *   4. persist state     coalesced updates flushed, the daemon's own
+ *                        entry dropped, --state-file saved once
+ *   5. event pipeline    reader closed, dedup, sinks and the state
+ *                        mirror drained
+ *   6. remove socket     the path stays until now so a new daemon can't
+ *                        start while this one is still persisting
+ */
+
+package main
+
+import (
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// shutdownDrainTimeout bounds how long Stop waits for handlers
+const shutdownDrainTimeout = 5 * time.Second
+
+// connTracker counts live connections so Stop can wait for them
+type connTracker struct {
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	conns   map[net.Conn]struct{}
+	closing bool
+}
+
+// add registers an accepted connection; false once draining has begun
+func (t *connTracker) add(conn net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closing {
+		return false
+	}
+	if t.conns == nil {
+		t.conns = make(map[net.Conn]struct{})
+	}
+	t.conns[conn] = struct{}{}
+	t.wg.Add(1)
+	return true
+}
+
+// remove is called when a connection's handler returns
+func (t *connTracker) remove(conn net.Conn) {
+	t.mu.Lock()
+	delete(t.conns, conn)
+	t.mu.Unlock()
+	t.wg.Done()
+}
+
+// drain refuses new connections, wakes handlers blocked reading the next
+// command and waits for all of them. Reports whether they finished in time.
+func (t *connTracker) drain(timeout time.Duration) bool {
+	t.mu.Lock()
+	t.closing = true
+	for conn := range t.conns {
+		// Shutting the read side down can't be undone by the handler
+		// re-arming its idle deadline; responses can still be written
+		if cr, ok := conn.(interface{ CloseRead() error }); ok {
+			cr.CloseRead()
+		} else {
+			conn.SetReadDeadline(time.Now())
+		}
+	}
+	t.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+// stopping reports whether shutdown has begun
+func (d *TelosDaemon) stopping() bool {
+	select {
+	case <-d.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Stop gracefully shuts down the daemon
+func (d *TelosDaemon) Stop() {
+	d.stopOnce.Do(d.stop)
+}
+
+func (d *TelosDaemon) stop() {
+	log.Println("Shutting down Telos Core...")
+
+	// 1. Stop accepting
+	close(d.done)
+	if d.listener != nil {
+		d.listener.Close()
+	}
+	d.stopMetricsServer()
+	d.stopDashboard()
+
+	// 2. Drain handlers
+	if !d.conns.drain(shutdownDrainTimeout) {
+		log.Printf("Warning: connections still busy after %s, continuing shutdown", shutdownDrainTimeout)
+	}
+
+	// 3. Detach LSM hooks
+	d.bpfMu.Lock()
+	d.links.Close()
+	d.links = nil
+	d.bpfMu.Unlock()
+
+	// 4. Persist state
+	if d.maps != nil {
+		// The entry names this process; don't persist or leave it behind
+		if d.opts.RegisterSelf {
+			d.unregisterSelf()
+		}
+		// Queued updates belong in the map (and the saved state)
+		if d.opts.CoalesceWindow > 0 {
+			d.flushCoalesced()
+		}
+		// The checkpoint goroutine has seen d.done and stopped
+		if d.opts.StateFile != "" {
+			if err := d.persist(); err != nil {
+				log.Printf("Warning: saving state failed: %v", err)
+			}
+		}
+	}
+
+	// 5. Stop the event pipeline (reader first, then drain the sink)
+	if d.eventReader != nil {
+		d.eventReader.Close()
+	}
+	if d.dedup != nil {
+		d.dedup.flush(time.Now(), true)
+	}
+	closeForwarders(d.forwarders)
+	if d.mirror != nil {
+		d.mirror.Close()
+	}
+	if d.audit != nil {
+		d.audit.Close()
+	}
+
+	// 6. Clean up socket
+	os.Remove(d.socketPath)
+
+	log.Println("TELOS CORE offline")
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeConn is a connection whose reads are fed by the test and whose
+// writes are recorded
+type fakeConn struct {
+	lines chan []byte // each is returned by one Read; closed = EOF
+
+	mu        sync.Mutex
+	written   bytes.Buffer
+	closedRd  bool
+	closedAll bool
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{lines: make(chan []byte, 1)}
+}
+
+func (c *fakeConn) Read(p []byte) (int, error) {
+	line, ok := <-c.lines
+	if !ok {
+		return 0, io.EOF
+	}
+	return copy(p, line), nil
+}
+
+func (c *fakeConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.written.Write(p)
+}
+
+// CloseRead is what drain uses to wake a handler. It only records the
+// call, so a line the test feeds afterwards still arrives, as one could
+// if the client wrote it just before shutdown began.
+func (c *fakeConn) CloseRead() error {
+	c.mu.Lock()
+	c.closedRd = true
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *fakeConn) Close() error {
+	c.mu.Lock()
+	c.closedAll = true
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *fakeConn) output() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.written.String()
+}
+
+func (c *fakeConn) wasReadClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closedRd
+}
+
+func (c *fakeConn) wasClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closedAll
+}
+
+func (c *fakeConn) LocalAddr() net.Addr              { return nil }
+func (c *fakeConn) RemoteAddr() net.Addr             { return nil }
+func (c *fakeConn) SetDeadline(time.Time) error      { return nil }
+func (c *fakeConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *fakeConn) SetWriteDeadline(time.Time) error { return nil }
+
+func TestConnTrackerDrain(t *testing.T) {
+	var tracker connTracker
+	conn := newFakeConn()
+	if !tracker.add(conn) {
+		t.Fatal("add refused before drain")
+	}
+
+	if tracker.drain(10 * time.Millisecond) {
+		t.Fatal("drain reported finished with a connection still registered")
+	}
+	if !conn.wasReadClosed() {
+		t.Fatal("drain did not wake the connection's reader")
+	}
+	if tracker.add(newFakeConn()) {
+		t.Fatal("add accepted a connection after drain began")
+	}
+
+	finished := make(chan bool)
+	go func() { finished <- tracker.drain(time.Second) }()
+	tracker.remove(conn)
+	if !<-finished {
+		t.Fatal("drain timed out after the last connection was removed")
+	}
+}
+
+func TestStopServesNothingAfterShutdownBegins(t *testing.T) {
+	d := fuzzDaemon(t)
+	d.opts.StateFile = t.TempDir() + "/state.csv"
+	saves := 0
+	d.persist = func() error {
+		saves++
+		return d.saveState()
+	}
+
+	conn := newFakeConn()
+	if !d.conns.add(conn) {
+		t.Fatal("add refused before shutdown")
+	}
+	served := make(chan struct{})
+	go func() {
+		d.handleConnection(conn)
+		close(served)
+	}()
+
+	// A command before shutdown is answered
+	conn.lines <- []byte(`{"command":"UPDATE_TAINT","data":{"pid":4242,"taint_level":"HIGH"}}` + "\n")
+	deadline := time.Now().Add(time.Second)
+	for !bytes.Contains([]byte(conn.output()), []byte(`"success":true`)) {
+		if time.Now().After(deadline) {
+			t.Fatalf("UPDATE_TAINT not answered: %q", conn.output())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	answered := conn.output()
+
+	stopped := make(chan struct{})
+	go func() {
+		d.Stop()
+		close(stopped)
+	}()
+	<-d.done
+
+	// One arriving once shutdown has begun is not
+	conn.lines <- []byte(`{"command":"UPDATE_TAINT","data":{"pid":4343,"taint_level":"HIGH"}}` + "\n")
+	select {
+	case <-served:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handler still running after shutdown began")
+	}
+	<-stopped
+	d.Stop()
+
+	if out := conn.output(); out != answered {
+		t.Fatalf("response written after shutdown began: %q", out[len(answered):])
+	}
+	if !conn.wasClosed() {
+		t.Fatal("connection left open")
+	}
+	if _, tracked, err := d.trackedEntry(4343); err != nil || tracked {
+		t.Fatalf("command after shutdown reached process_map (tracked=%v, err=%v)", tracked, err)
+	}
+	if saves != 1 {
+		t.Fatalf("state persisted %d times, want 1", saves)
+	}
+	restored, err := d.parseSignedState(mustRead(t, d.opts.StateFile))
+	if err != nil || len(restored) != 1 || restored[0].PID != 4242 {
+		t.Fatalf("state file holds %+v (err %v), want PID 4242 only", restored, err)
+	}
+}
+
+func mustRead(t *testing.T, path string) []byte {
+	t.Helper()
+	raw, err := readFileNoFollow(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
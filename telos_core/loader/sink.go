@@ -0,0 +1,263 @@
+/*
+ * Telos Core - Event Sinks
+ *
+ * Forwards kernel events to external sinks (SIEM, log shipper, ...)
+ * without ever blocking the event reader: each sink has its own bounded
+ * queue, and when it falls behind the OLDEST queued events are dropped
+ * and counted in telos_event_forward_dropped_total.
+ *
+ * Sink spec (--event-sink):
+ *   file:/var/log/telos/events.ndjson   append NDJSON lines
+ *   http://collector:8080/ingest        POST one JSON event per request
+ *   https://...                         same, over TLS
+ *
+ * Failed deliveries are retried with backoff behind a per-sink circuit
+ * breaker (see retry.go).
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultEventQueueSize = 1024
+	httpSinkTimeout       = 5 * time.Second
+	sinkDrainTimeout      = 5 * time.Second
+)
+
+// EventSink is a destination for forwarded events
+type EventSink interface {
+	Name() string
+	Send(ev Event) error
+	Close() error
+}
+
+// batchSink is an EventSink that prefers to receive queued events in bulk
+type batchSink interface {
+	EventSink
+	SendBatch(events []Event) error
+}
+
+// maxForwardBatch bounds one SendBatch call
+const maxForwardBatch = 100
+
+// newEventSink builds a sink from its --event-sink spec
+func newEventSink(spec string) (EventSink, error) {
+	switch {
+	case strings.HasPrefix(spec, "file:"):
+		return newFileSink(strings.TrimPrefix(spec, "file:"))
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return newHTTPSink(spec), nil
+	default:
+		return nil, fmt.Errorf("unsupported event sink %q (want file:<path> or http(s)://<url>)", spec)
+	}
+}
+
+// === FILE SINK ===
+
+// fileSink appends one JSON event per line
+type fileSink struct {
+	path string
+	f    *os.File
+}
+
+func newFileSink(path string) (*fileSink, error) {
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("file sink path must be absolute: %s", path)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE|syscall.O_NOFOLLOW, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &fileSink{path: path, f: f}, nil
+}
+
+func (s *fileSink) Name() string { return "file:" + s.path }
+
+func (s *fileSink) Send(ev Event) error {
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = s.f.Write(append(line, '\n'))
+	return err
+}
+
+func (s *fileSink) Close() error { return s.f.Close() }
+
+// === HTTP SINK ===
+
+// httpSink POSTs each event as a JSON body
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func newHTTPSink(url string) *httpSink {
+	return &httpSink{
+		url:    url,
+		client: &http.Client{Timeout: httpSinkTimeout},
+	}
+}
+
+func (s *httpSink) Name() string { return s.url }
+
+func (s *httpSink) Send(ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("sink returned %s", resp.Status)
+	}
+	return nil
+}
+
+func (s *httpSink) Close() error {
+	s.client.CloseIdleConnections()
+	return nil
+}
+
+// === FORWARDER ===
+
+// eventForwarder decouples the event reader from a (possibly slow) sink
+type eventForwarder struct {
+	sink    EventSink
+	queue   chan Event
+	wg      sync.WaitGroup
+	breaker circuitBreaker
+	closing chan struct{} // closed by Close; cuts retry waits short
+}
+
+func newEventForwarder(sink EventSink, queueSize int) *eventForwarder {
+	if queueSize <= 0 {
+		queueSize = defaultEventQueueSize
+	}
+	f := &eventForwarder{
+		sink:    sink,
+		queue:   make(chan Event, queueSize),
+		closing: make(chan struct{}),
+	}
+	f.wg.Add(1)
+	go f.run()
+	return f
+}
+
+// Enqueue never blocks; on a full queue the oldest event is dropped.
+// Only the event reader calls Enqueue, so the retry loop is bounded.
+func (f *eventForwarder) Enqueue(ev Event) {
+	for {
+		select {
+		case f.queue <- ev:
+			return
+		default:
+		}
+
+		select {
+		case <-f.queue:
+			metrics.EventForwardDropped.Add(1)
+		default:
+		}
+	}
+}
+
+func (f *eventForwarder) run() {
+	defer f.wg.Done()
+
+	if bs, ok := f.sink.(batchSink); ok {
+		f.runBatches(bs)
+		return
+	}
+
+	for ev := range f.queue {
+		if err := f.deliver(func() error { return f.sink.Send(ev) }); err != nil {
+			metrics.EventForwardFailed.Add(1)
+			if !errors.Is(err, errSinkUnavailable) {
+				log.Printf("Warning: event sink %s: %v", f.sink.Name(), err)
+			}
+		}
+	}
+}
+
+// runBatches sends whatever has queued up (up to maxForwardBatch) at once
+func (f *eventForwarder) runBatches(bs batchSink) {
+	batch := make([]Event, 0, maxForwardBatch)
+	for ev := range f.queue {
+		batch = append(batch[:0], ev)
+	fill:
+		for len(batch) < maxForwardBatch {
+			select {
+			case ev, ok := <-f.queue:
+				if !ok {
+					break fill
+				}
+				batch = append(batch, ev)
+			default:
+				break fill
+			}
+		}
+
+		if err := f.deliver(func() error { return bs.SendBatch(batch) }); err != nil {
+			metrics.EventForwardFailed.Add(uint64(len(batch)))
+			if !errors.Is(err, errSinkUnavailable) {
+				log.Printf("Warning: event sink %s: %d events: %v", f.sink.Name(), len(batch), err)
+			}
+		}
+	}
+}
+
+// Close stops accepting events, drains the queue (bounded by
+// sinkDrainTimeout) and closes the sink. Must only be called after the
+// event reader has stopped.
+func (f *eventForwarder) Close() {
+	close(f.closing)
+	close(f.queue)
+
+	drained := make(chan struct{})
+	go func() {
+		f.wg.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-time.After(sinkDrainTimeout):
+		log.Printf("Warning: event sink %s: gave up draining %d queued events",
+			f.sink.Name(), len(f.queue))
+	}
+	f.sink.Close()
+}
+
+// closeForwarders closes all forwarders in parallel, so shutdown waits
+// at most one sinkDrainTimeout however many sinks are configured
+func closeForwarders(forwarders []*eventForwarder) {
+	var wg sync.WaitGroup
+	for _, f := range forwarders {
+		wg.Add(1)
+		go func(f *eventForwarder) {
+			defer wg.Done()
+			f.Close()
+		}(f)
+	}
+	wg.Wait()
+}
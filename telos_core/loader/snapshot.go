@@ -0,0 +1,81 @@
+/*
+ * Telos Core - Process Map Snapshot
+ *
+ * Iterating a BPF hash map while it is modified can skip or repeat
+ * entries. snapshotProcesses avoids that in two phases:
+ *
+ *   1. under mapMu (so no daemon write can delete or insert), walk the
+ *      keys only - this is fast and sees a stable key set
+ *   2. with the lock released, look each key up, dropping keys deleted
+ *      in between
+ *
+ * Guarantee: every PID appears at most once, sorted by PID; every PID
+ * present for the whole call is included; each value is a consistent
+ * copy as of its own lookup (values of different PIDs may be from
+ * slightly different moments).
+ */
+
+package main
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/cilium/ebpf"
+)
+
+// processEntry is one PID's entry in a snapshot
+type processEntry struct {
+	PID  uint32
+	Info ProcessInfo
+}
+
+// processKeys returns the PIDs currently in process_map, sorted
+func (d *TelosDaemon) processKeys() ([]uint32, error) {
+	d.mapMu.Lock()
+	defer d.mapMu.Unlock()
+
+	m := d.maps.ProcessMap
+	seen := make(map[uint32]bool)
+	var keys []uint32
+
+	var key, next uint32
+	err := m.NextKey(nil, &next)
+	// Bounded by capacity so a misbehaving walk cannot loop forever
+	for i := uint32(0); err == nil && i < m.MaxEntries(); i++ {
+		if !seen[next] {
+			seen[next] = true
+			keys = append(keys, next)
+		}
+		key = next
+		err = m.NextKey(key, &next)
+	}
+	if err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+		return nil, err
+	}
+
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys, nil
+}
+
+// snapshotProcesses returns a consistent, PID-ordered copy of process_map
+func (d *TelosDaemon) snapshotProcesses() ([]processEntry, error) {
+	keys, err := d.processKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]processEntry, 0, len(keys))
+	for _, pid := range keys {
+		var info ProcessInfo
+		err := d.maps.ProcessMap.Lookup(pid, &info)
+		if errors.Is(err, ebpf.ErrKeyNotExist) {
+			continue // Deleted since phase 1
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, processEntry{PID: pid, Info: info})
+	}
+	return entries, nil
+}
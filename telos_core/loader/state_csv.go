@@ -0,0 +1,236 @@
+/*
+ * Telos Core - CSV State Export/Import
+ *
+ * EXPORT_CSV / IMPORT_CSV move process_map contents in and out of a
+ * spreadsheet-friendly file:
+ *
+ *   pid,comm,taint_level,sandboxed,updated,quarantined
+ *   4242,python3,3,0,2026-01-02T15:04:05Z,0
+ *
+ * `updated` is the last time this daemon wrote the entry (RFC 3339), or
+ * empty if the entry predates the daemon. Files without the trailing
+ * `quarantined` column (older exports) still import, as not quarantined.
+ *
+ * With --state-key, exports are signed and imports verified (see
+ * statesign.go).
+ */
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var csvHeader = []string{"pid", "comm", "taint_level", "sandboxed", "updated", "quarantined"}
+
+// csvLegacyColumns is the column count of exports predating quarantine
+const csvLegacyColumns = 5
+
+// isFormulaLead reports whether a spreadsheet would evaluate a cell
+// starting with c as a formula (CSV injection)
+func isFormulaLead(c byte) bool {
+	switch c {
+	case '=', '+', '-', '@', '\t', '\r':
+		return true
+	}
+	return false
+}
+
+// csvEscapeComm neutralizes a comm that a spreadsheet would evaluate.
+// Comm is attacker-controlled (prctl PR_SET_NAME), so exports must be safe.
+func csvEscapeComm(comm string) string {
+	if comm != "" && isFormulaLead(comm[0]) {
+		return "'" + comm
+	}
+	return comm
+}
+
+// csvUnescapeComm reverses csvEscapeComm and rejects raw formula cells
+func csvUnescapeComm(comm string) (string, error) {
+	if len(comm) >= 2 && comm[0] == '\'' && isFormulaLead(comm[1]) {
+		return comm[1:], nil
+	}
+	if comm != "" && isFormulaLead(comm[0]) {
+		return "", fmt.Errorf("comm %q looks like a spreadsheet formula", comm)
+	}
+	return comm, nil
+}
+
+// cmdExportCSV writes process_map to a CSV file
+func (d *TelosDaemon) cmdExportCSV(data map[string]interface{}) IPCResponse {
+	path, err := stringArg(data, "path")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	if err := checkUserPath(path); err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+
+	raw, count, err := d.encodeStateCSV()
+	if err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+	raw = d.sealState(raw, count)
+
+	if err := writeFileAtomic(path, raw, 0600); err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+
+	log.Printf("[EXPORT] %d processes -> %s", count, path)
+	return IPCResponse{Success: true, Data: map[string]interface{}{"count": count}}
+}
+
+// encodeStateCSV renders a snapshot of process_map as CSV
+func (d *TelosDaemon) encodeStateCSV() ([]byte, int, error) {
+	snapshot, err := d.snapshotProcesses()
+	if err != nil {
+		return nil, 0, fmt.Errorf("snapshot process_map: %w", err)
+	}
+
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write(csvHeader)
+	count := 0
+
+	for _, e := range snapshot {
+		key, value := e.PID, e.Info
+		updated := ""
+		if t := d.lastUpdated(key); !t.IsZero() {
+			updated = t.UTC().Format(time.RFC3339)
+		}
+		w.Write([]string{
+			strconv.FormatUint(uint64(key), 10),
+			csvEscapeComm(commString(value.Comm)),
+			strconv.FormatUint(uint64(value.TaintLevel), 10),
+			strconv.FormatUint(uint64(value.IsSandboxed), 10),
+			updated,
+			strconv.FormatUint(uint64(value.Quarantined), 10),
+		})
+		count++
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, 0, err
+	}
+	return buf.Bytes(), count, nil
+}
+
+// cmdImportCSV loads process entries from a CSV file.
+// The whole file is validated before anything is written to the map.
+func (d *TelosDaemon) cmdImportCSV(data map[string]interface{}) IPCResponse {
+	path, err := stringArg(data, "path")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	raw, err := readFileNoFollow(path)
+	if err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+
+	entries, err := d.parseSignedState(raw)
+	if errors.Is(err, errIntegrity) {
+		return errorResponse(ErrIntegrity, "%s: %v", path, err)
+	}
+	if err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+
+	d.mapMu.Lock()
+	defer d.mapMu.Unlock()
+
+	for _, info := range entries {
+		d.discardPending(info.PID)
+		prev, exists, err := d.trackedEntry(info.PID)
+		if err != nil {
+			return IPCResponse{Success: false, Error: fmt.Sprintf("PID %d: %v", info.PID, err)}
+		}
+		// Written as a taint change from the entry's current level, so
+		// notifications, the mirror and map-fill tracking see it
+		next := info
+		next.TaintLevel = prev.TaintLevel
+		if err := d.putTaintLocked(next, exists, info.TaintLevel, "IMPORT_CSV"); err != nil {
+			return IPCResponse{Success: false, Error: fmt.Sprintf("PID %d: %v", info.PID, err)}
+		}
+	}
+
+	log.Printf("[IMPORT] %d processes <- %s", len(entries), path)
+	return IPCResponse{Success: true, Data: map[string]interface{}{"count": len(entries)}}
+}
+
+// parseStateCSV validates and decodes an exported CSV file
+func parseStateCSV(raw []byte) ([]ProcessInfo, error) {
+	r := csv.NewReader(bytes.NewReader(raw))
+	r.FieldsPerRecord = 0 // All records must match the header's width
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	if strings.Join(header, ",") != strings.Join(csvHeader, ",") &&
+		strings.Join(header, ",") != strings.Join(csvHeader[:csvLegacyColumns], ",") {
+		return nil, fmt.Errorf("unexpected header %q (want %q)",
+			strings.Join(header, ","), strings.Join(csvHeader, ","))
+	}
+
+	var entries []ProcessInfo
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		pid, err := strconv.ParseUint(rec[0], 10, 32)
+		if err != nil || pid == 0 {
+			return nil, fmt.Errorf("line %d: invalid pid %q", line, rec[0])
+		}
+
+		comm, err := csvUnescapeComm(rec[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if len(comm) > maxCommLen {
+			return nil, fmt.Errorf("line %d: comm %q longer than %d bytes", line, comm, maxCommLen)
+		}
+
+		level, err := strconv.ParseUint(rec[2], 10, 32)
+		if err != nil || level > TaintCritical {
+			return nil, fmt.Errorf("line %d: invalid taint_level %q", line, rec[2])
+		}
+
+		sandboxed, err := strconv.ParseUint(rec[3], 10, 32)
+		if err != nil || sandboxed > 1 {
+			return nil, fmt.Errorf("line %d: invalid sandboxed %q", line, rec[3])
+		}
+
+		var quarantined uint64
+		if len(rec) > csvLegacyColumns {
+			quarantined, err = strconv.ParseUint(rec[csvLegacyColumns], 10, 32)
+			if err != nil || quarantined > 1 {
+				return nil, fmt.Errorf("line %d: invalid quarantined %q", line, rec[csvLegacyColumns])
+			}
+		}
+
+		info := ProcessInfo{
+			PID:         uint32(pid),
+			TaintLevel:  uint32(level),
+			IsSandboxed: uint32(sandboxed),
+			Quarantined: uint32(quarantined),
+			Comm:        commBytes(comm),
+		}
+		entries = append(entries, info)
+	}
+
+	return entries, nil
+}
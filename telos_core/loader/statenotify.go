@@ -0,0 +1,184 @@
+/*
+ * Telos Core - State Change Notifications
+ *
+ * Several controllers (Cortex instances, dashboards) may share one
+ * daemon. A connection that sends SUBSCRIBE_STATE keeps working as a
+ * normal command connection, and additionally receives a frame for
+ * every state change made by anyone:
+ *
+ *   {"notification":"taint","pid":42,"taint_level":3,"level":"HIGH",
+ *    "previous":"LOW","source":"UPDATE_TAINT","time":"..."}
+ *   {"notification":"clear","pid":42,...}
+ *   {"notification":"quarantine","pid":42,"quarantined":true,...}
+ *   {"notification":"config","config":{...},"source":"SET_CONFIG",...}
+ *   {"notification":"maintenance","maintenance":{"active":true,...},...}
+ *
+ * Frames carry "notification" and never "success", so clients can tell
+ * them from command responses on the same connection. A subscriber that
+ * falls behind gets {"notification":"overflow"} and is unsubscribed; it
+ * should re-sync with GET_STATE and subscribe again. Native protocol
+ * only.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+// stateQueueSize bounds the frames queued for one subscriber
+const stateQueueSize = 256
+
+// syncConn serializes whole-line writes on a connection that both
+// answers commands and receives notifications
+type syncConn struct {
+	net.Conn
+	wmu sync.Mutex
+}
+
+// stateSub is one SUBSCRIBE_STATE connection
+type stateSub struct {
+	ch       chan []byte
+	closed   bool
+	overflow bool
+}
+
+// stateHub fans state changes out to subscribers
+type stateHub struct {
+	mu   sync.Mutex
+	subs map[*stateSub]struct{}
+}
+
+func (h *stateHub) subscribe() *stateSub {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs == nil {
+		h.subs = make(map[*stateSub]struct{})
+	}
+	sub := &stateSub{ch: make(chan []byte, stateQueueSize)}
+	h.subs[sub] = struct{}{}
+	return sub
+}
+
+func (h *stateHub) unsubscribe(sub *stateSub) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dropLocked(sub)
+}
+
+func (h *stateHub) dropLocked(sub *stateSub) {
+	delete(h.subs, sub)
+	if !sub.closed {
+		sub.closed = true
+		close(sub.ch)
+	}
+}
+
+// publish queues frame for every subscriber without blocking
+func (h *stateHub) publish(frame map[string]interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.subs) == 0 {
+		return
+	}
+
+	frame["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	data, err := json.Marshal(frame)
+	if err != nil {
+		log.Printf("Warning: encode state notification: %v", err)
+		return
+	}
+	for sub := range h.subs {
+		select {
+		case sub.ch <- data:
+		default:
+			sub.overflow = true
+			h.dropLocked(sub)
+		}
+	}
+}
+
+// notifyTaint announces a taint level change
+func (d *TelosDaemon) notifyTaint(pid, previous, level uint32, source string) {
+	d.stateSubs.publish(map[string]interface{}{
+		"notification": "taint",
+		"pid":          pid,
+		"taint_level":  level,
+		"level":        taintLevelName(level),
+		"previous":     taintLevelName(previous),
+		"source":       source,
+	})
+	d.mirrorTaint(pid, level)
+}
+
+// notifyClear announces that a PID left the taint map
+func (d *TelosDaemon) notifyClear(pid uint32, source string) {
+	d.stateSubs.publish(map[string]interface{}{
+		"notification": "clear",
+		"pid":          pid,
+		"source":       source,
+	})
+	d.mirrorTaint(pid, TaintClean)
+}
+
+// notifyQuarantine announces a quarantine change
+func (d *TelosDaemon) notifyQuarantine(pid uint32, on bool, source string) {
+	d.stateSubs.publish(map[string]interface{}{
+		"notification": "quarantine",
+		"pid":          pid,
+		"quarantined":  on,
+		"source":       source,
+	})
+}
+
+// notifyConfig announces a config_map change
+func (d *TelosDaemon) notifyConfig(cfg Config, source string) {
+	c := configJSON(cfg)
+	c["exec_taint"] = execTaintName(cfg.ExecTaint)
+	d.stateSubs.publish(map[string]interface{}{
+		"notification": "config",
+		"config":       c,
+		"source":       source,
+	})
+}
+
+// notifyMaintenance announces entering, extending or leaving maintenance
+func (d *TelosDaemon) notifyMaintenance(status map[string]interface{}, source string) {
+	d.stateSubs.publish(map[string]interface{}{
+		"notification": "maintenance",
+		"maintenance":  status,
+		"source":       source,
+	})
+}
+
+// subscribeState handles SUBSCRIBE_STATE on conn. Frames are written
+// by a pump goroutine until the connection ends (done closed) or the
+// subscriber overflows.
+func (d *TelosDaemon) subscribeState(conn *syncConn, done <-chan struct{}) *stateSub {
+	sub := d.stateSubs.subscribe()
+
+	go func() {
+		for {
+			select {
+			case frame, ok := <-sub.ch:
+				if !ok {
+					if sub.overflow {
+						d.writeLine(conn, []byte(`{"notification":"overflow"}`))
+					}
+					return
+				}
+				if d.writeLine(conn, frame) != nil {
+					conn.Close() // Stream no longer line-aligned
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	return sub
+}
@@ -0,0 +1,343 @@
+/*
+ * Telos Core - Event Subscriptions
+ *
+ * SUBSCRIBE turns a connection into a live event stream. Every event gets
+ * a sequence number, monotonically increasing for the daemon's lifetime,
+ * and the last --event-buffer events are kept in memory so a client that
+ * reconnects can resume where it left off:
+ *
+ *   -> {"command":"SUBSCRIBE","data":{"since_seq":1041}}
+ *   <- {"success":true,"data":{"seq":1050,"oldest_seq":… ,"gap":false,"replayed":9}}
+ *   <- {"seq":1042,"time":…,"pid":…}        replayed, then live
+ *
+ * If events after since_seq were already evicted (or since_seq is from a
+ * previous daemon run), the response says "gap":true and streaming starts
+ * from the oldest buffered event; the client should re-sync with
+ * GET_STATE. The connection accepts no further commands.
+ *
+ * Ordering: sequence numbers are assigned under one lock as events are
+ * published, and every subscriber's queue is filled in that order, so
+ * all subscribers see the same events in the same order, replay
+ * included. Publishing never waits for a subscriber. One whose queue is
+ * full misses events instead, and before the next event it does get, it
+ * receives a gap marker naming exactly what it missed:
+ *
+ *   <- {"gap":true,"from_seq":2001,"to_seq":2040,"dropped":40}
+ *
+ * Event frames never carry "gap". A client that needs the missed events
+ * can reconnect with since_seq = from_seq - 1 while they are buffered.
+ *
+ * A stream is exempt from --idle-timeout, so a quiet one is kept honest
+ * with a keepalive frame every 30s (or every --idle-timeout, if shorter):
+ *
+ *   <- {"keepalive":true}
+ *
+ * Event frames never carry "keepalive" either. A stream whose keepalive
+ * can't be written (the client is gone or has stopped reading) is
+ * closed and counted in telos_connections_closed_idle_total.
+ *
+ * With --max-subscribers, SUBSCRIBE beyond that many live streams fails
+ * with ERR_TOO_MANY_SUBSCRIBERS and the connection stays usable for
+ * commands. telos_event_subscribers reports the current count.
+ */
+
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	defaultEventBufferSize = 4096
+	subscriberQueueSize    = 256
+	subscriptionKeepalive  = 30 * time.Second
+)
+
+// ErrTooManySubscribers is returned for SUBSCRIBE beyond --max-subscribers
+const ErrTooManySubscribers = "ERR_TOO_MANY_SUBSCRIBERS"
+
+var errTooManySubscribers = errors.New("too many subscribers")
+
+// streamEvent is an event as sent to subscribers
+type streamEvent struct {
+	Seq uint64 `json:"seq"`
+	Event
+}
+
+// streamGap tells a subscriber which events it missed
+type streamGap struct {
+	Gap     bool   `json:"gap"`
+	FromSeq uint64 `json:"from_seq"`
+	ToSeq   uint64 `json:"to_seq"`
+	Dropped uint64 `json:"dropped"`
+}
+
+// streamKeepalive is sent on a stream that has been quiet for a while
+type streamKeepalive struct {
+	Keepalive bool `json:"keepalive"`
+}
+
+// streamFrame is one queued frame: an event, or a gap marker
+type streamFrame struct {
+	event streamEvent
+	gap   *streamGap
+}
+
+// subscriber is one SUBSCRIBE connection
+type subscriber struct {
+	ch       chan streamFrame
+	closed   bool   // queue closed by Unsubscribe
+	lostFrom uint64 // first missed seq of an unannounced gap (0 = none)
+}
+
+// eventHub numbers events, keeps a replay ring and fans out to subscribers
+type eventHub struct {
+	mu   sync.Mutex
+	seq  uint64        // last assigned sequence number
+	ring []streamEvent // circular, ring[(seq-1) % len] holds seq
+	size int           // number of valid entries in ring
+	subs map[*subscriber]struct{}
+	max  int // live subscribers allowed (0 = unlimited)
+}
+
+func newEventHub(bufferSize, maxSubscribers int) *eventHub {
+	if bufferSize <= 0 {
+		bufferSize = defaultEventBufferSize
+	}
+	return &eventHub{
+		ring: make([]streamEvent, bufferSize),
+		subs: make(map[*subscriber]struct{}),
+		max:  maxSubscribers,
+	}
+}
+
+// Subscribers returns the number of live subscribers
+func (h *eventHub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// Publish numbers ev, buffers it and hands it to every subscriber.
+// Never blocks: a subscriber whose queue is full misses ev, and gets a
+// gap marker for everything it missed ahead of its next delivered event.
+func (h *eventHub) Publish(ev Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	se := streamEvent{Seq: h.seq, Event: ev}
+	h.ring[(h.seq-1)%uint64(len(h.ring))] = se
+	if h.size < len(h.ring) {
+		h.size++
+	}
+
+	for sub := range h.subs {
+		deliverLocked(sub, se)
+	}
+}
+
+// deliverLocked queues se for sub without blocking, announcing any
+// earlier gap first so sub never sees an event out of order
+func deliverLocked(sub *subscriber, se streamEvent) {
+	if sub.lostFrom != 0 {
+		gap := &streamGap{Gap: true, FromSeq: sub.lostFrom, ToSeq: se.Seq - 1, Dropped: se.Seq - sub.lostFrom}
+		select {
+		case sub.ch <- streamFrame{gap: gap}:
+			sub.lostFrom = 0
+		default:
+			metrics.SubscriberEventsDropped.Add(1) // Still full; se joins the gap
+			return
+		}
+	}
+	select {
+	case sub.ch <- streamFrame{event: se}:
+	default:
+		sub.lostFrom = se.Seq
+		metrics.SubscriberEventsDropped.Add(1)
+	}
+}
+
+// oldestLocked returns the oldest buffered sequence number (0 if none)
+func (h *eventHub) oldestLocked() uint64 {
+	if h.size == 0 {
+		return 0
+	}
+	return h.seq - uint64(h.size) + 1
+}
+
+// Subscribe registers a subscriber. With resume set, buffered events
+// after sinceSeq are returned as backlog; gap reports that some of them
+// were already evicted. Registration and backlog are taken atomically,
+// so no event is lost or duplicated between replay and live. Fails with
+// errTooManySubscribers at the cap.
+func (h *eventHub) Subscribe(resume bool, sinceSeq uint64) (sub *subscriber, backlog []streamEvent, gap bool, latest, oldest uint64, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.max > 0 && len(h.subs) >= h.max {
+		return nil, nil, false, 0, 0, errTooManySubscribers
+	}
+	sub = &subscriber{ch: make(chan streamFrame, subscriberQueueSize)}
+	h.subs[sub] = struct{}{}
+	latest, oldest = h.seq, h.oldestLocked()
+
+	if !resume {
+		return sub, nil, false, latest, oldest, nil
+	}
+
+	from := sinceSeq + 1
+	if sinceSeq > h.seq {
+		// From a previous daemon run: everything buffered is new to the client
+		gap, from = true, oldest
+	} else if h.size > 0 && from < oldest {
+		gap, from = true, oldest
+	}
+
+	if h.size > 0 {
+		for s := from; s <= h.seq; s++ {
+			backlog = append(backlog, h.ring[(s-1)%uint64(len(h.ring))])
+		}
+	}
+	return sub, backlog, gap, latest, oldest, nil
+}
+
+// Recent returns up to limit buffered events matching match, newest
+// first, and the oldest sequence number still buffered
+func (h *eventHub) Recent(match func(Event) bool, limit int) ([]streamEvent, uint64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var found []streamEvent
+	oldest := h.oldestLocked()
+	for s := h.seq; h.size > 0 && s >= oldest && len(found) < limit; s-- {
+		if se := h.ring[(s-1)%uint64(len(h.ring))]; match(se.Event) {
+			found = append(found, se)
+		}
+	}
+	return found, oldest
+}
+
+// Unsubscribe removes sub (no-op if already removed)
+func (h *eventHub) Unsubscribe(sub *subscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[sub]; ok {
+		h.dropLocked(sub)
+	}
+}
+
+// dropLocked removes sub and closes its queue (caller holds mu)
+func (h *eventHub) dropLocked(sub *subscriber) {
+	delete(h.subs, sub)
+	if !sub.closed {
+		sub.closed = true
+		close(sub.ch)
+	}
+}
+
+// subscription is a registered SUBSCRIBE, not yet streaming
+type subscription struct {
+	sub      *subscriber
+	backlog  []streamEvent
+	gap      bool
+	sinceSeq uint64
+	latest   uint64
+	oldest   uint64
+}
+
+// openSubscription registers a subscriber for SUBSCRIBE's data. On
+// failure the response is returned and the connection is left as it was.
+func (d *TelosDaemon) openSubscription(data map[string]interface{}) (*subscription, IPCResponse, bool) {
+	_, resume := data["since_seq"]
+	var sinceSeq uint64
+	if resume {
+		var err error
+		if sinceSeq, err = uintArg(data, "since_seq", 1<<53); err != nil {
+			return nil, invalidArg("%v", err), false
+		}
+	}
+
+	sub, backlog, gap, latest, oldest, err := d.hub.Subscribe(resume, sinceSeq)
+	if err != nil {
+		metrics.SubscribersRejected.Add(1)
+		return nil, errorResponse(ErrTooManySubscribers, "%d event subscribers already connected (--max-subscribers)", d.hub.max), false
+	}
+	return &subscription{sub: sub, backlog: backlog, gap: gap, sinceSeq: sinceSeq, latest: latest, oldest: oldest}, IPCResponse{}, true
+}
+
+// serveSubscription streams events on conn until the client goes away
+// or the daemon stops
+func (d *TelosDaemon) serveSubscription(conn net.Conn, s *subscription) {
+	sub, backlog, gap, latest, oldest, sinceSeq := s.sub, s.backlog, s.gap, s.latest, s.oldest, s.sinceSeq
+	defer d.hub.Unsubscribe(sub)
+
+	// Streams are long-lived; the idle timeout applies to command traffic
+	// and a quiet stream gets keepalives instead
+	conn.SetReadDeadline(time.Time{})
+
+	if gap {
+		log.Printf("[SUBSCRIBE] Resume from seq %d not possible (oldest buffered %d), gap signalled", sinceSeq, oldest)
+	}
+	err := d.sendResponse(conn, IPCResponse{Success: true, Data: map[string]interface{}{
+		"seq":        latest,
+		"oldest_seq": oldest,
+		"gap":        gap,
+		"replayed":   len(backlog),
+	}})
+	if err != nil {
+		return
+	}
+
+	for _, se := range backlog {
+		if d.sendJSON(conn, se) != nil {
+			return
+		}
+	}
+
+	// Notice the client hanging up; it sends nothing after SUBSCRIBE
+	gone := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, conn)
+		close(gone)
+	}()
+
+	interval := subscriptionKeepalive
+	if d.opts.IdleTimeout > 0 && d.opts.IdleTimeout < interval {
+		interval = d.opts.IdleTimeout
+	}
+	keepalive := time.NewTicker(interval)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-keepalive.C:
+			if err := d.sendJSON(conn, streamKeepalive{Keepalive: true}); err != nil {
+				metrics.ConnectionsClosedIdle.Add(1)
+				log.Printf("[SUBSCRIBE] Closing stream: keepalive failed: %v", err)
+				return
+			}
+		case f, ok := <-sub.ch:
+			if !ok {
+				return
+			}
+			var frame interface{} = f.event
+			if f.gap != nil {
+				d.debugf("[SUBSCRIBE] Subscriber missed seq %d-%d", f.gap.FromSeq, f.gap.ToSeq)
+				frame = f.gap
+			}
+			if d.sendJSON(conn, frame) != nil {
+				return
+			}
+		case <-gone:
+			return
+		case <-d.done:
+			return
+		}
+	}
+}
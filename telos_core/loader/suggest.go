@@ -0,0 +1,88 @@
+/*
+ * Telos Core - Command Suggestions
+ *
+ * Unknown commands (and JSON-RPC methods) are answered with the closest
+ * registered names, so a typo is obvious from the error alone:
+ *
+ *   Unknown command: UPDATE_TAIN (did you mean UPDATE_TAINT?)
+ *
+ * Only close matches are offered: at most maxSuggestDistance edits, and
+ * fewer than a third of the name's length. Case is ignored. Disabled
+ * with --suggest-commands=false.
+ */
+
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxSuggestDistance caps the edit distance of a suggestion
+const maxSuggestDistance = 2
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// closestNames returns the candidates nearest to name, if close enough
+func closestNames(name string, candidates []string) []string {
+	limit := min(maxSuggestDistance, (len(name)-1)/3)
+	best := limit + 1
+	var matches []string
+	for _, c := range candidates {
+		dist := editDistance(strings.ToUpper(name), strings.ToUpper(c))
+		switch {
+		case dist < best:
+			best, matches = dist, []string{c}
+		case dist == best:
+			matches = append(matches, c)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// commandNames lists every command a client can send
+func commandNames() []string {
+	names := make([]string, 0, len(commands)+len(peerCommands)+len(connCommands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	for name := range peerCommands {
+		names = append(names, name)
+	}
+	for name := range connCommands {
+		names = append(names, name)
+	}
+	return names
+}
+
+// didYouMean formats suggestions for name as an error suffix ("" if none)
+func (d *TelosDaemon) didYouMean(name string, candidates []string) string {
+	if !d.opts.SuggestCommands {
+		return ""
+	}
+	matches := closestNames(name, candidates)
+	if len(matches) == 0 {
+		return ""
+	}
+	return " (did you mean " + strings.Join(matches, " or ") + "?)"
+}
@@ -0,0 +1,330 @@
+/*
+ * Telos Core - Process Map Swap
+ *
+ * SWAP_MAP replaces the whole taint state in one step, for a full
+ * re-seed or a clear-and-reimport that must never be seen half done:
+ *
+ *   {"command":"SWAP_MAP","data":{"processes":[{"pid":42,"taint_level":"HIGH","comm":"agent"}]}}
+ *   {"command":"SWAP_MAP","data":{"path":"/var/lib/telos/state.csv"}}
+ *
+ * "processes" entries take pid and taint_level, and optionally comm
+ * (default: from /proc), sandboxed and quarantined; "path" is an
+ * EXPORT_CSV file, verified like IMPORT_CSV. PIDs missing from the
+ * snapshot lose their entry.
+ *
+ * The programs read process_map directly, so the swap goes through the
+ * reload path (reload.go):
+ *
+ *   1. a fresh, unpinned process_map is filled from the snapshot
+ *   2. the object is reloaded against it, so each hook switches from
+ *      the complete old state to the complete new one (while both
+ *      program sets are attached an operation is denied if either
+ *      denies)
+ *   3. the live map is rewritten to match, the object is reloaded back
+ *      onto it, and entries the hooks wrote to the fresh map meanwhile
+ *      (exec taint, new children) are copied over
+ *
+ * The pinned map, and everything holding it, never changes identity.
+ * Socket writers wait on the map lock for the whole swap.
+ *
+ * Where the object can't be reloaded (it is gone from disk, or fails to
+ * attach) the swap falls back to rewriting the live map under the lock:
+ * snapshot entries are written first, then the others deleted. For the
+ * length of that pass the hooks may see one PID's new level next to
+ * another's old one, and removed PIDs keep their entry until the end.
+ * "atomic":true refuses instead of falling back. "method" in the
+ * response says which was used.
+ */
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"unicode/utf8"
+
+	"github.com/cilium/ebpf"
+)
+
+// SWAP_MAP methods
+const (
+	swapAtomic = "atomic"
+	swapLocked = "locked"
+)
+
+// errSwapStranded marks a swap that left the programs on the temporary
+// map, which the in-place fallback must not paper over
+var errSwapStranded = errors.New("programs still read the temporary map")
+
+// cmdSwapMap handles SWAP_MAP ({processes | path, atomic?})
+func (d *TelosDaemon) cmdSwapMap(data map[string]interface{}) IPCResponse {
+	_, hasList := data["processes"]
+	_, hasPath := data["path"]
+	if hasList == hasPath {
+		return invalidArg("Give either 'processes' or 'path'")
+	}
+	requireAtomic, err := boolArg(data, "atomic")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+
+	var entries []ProcessInfo
+	if hasPath {
+		path, err := stringArg(data, "path")
+		if err != nil {
+			return invalidArg("%v", err)
+		}
+		raw, err := readFileNoFollow(path)
+		if err != nil {
+			return IPCResponse{Success: false, Error: err.Error()}
+		}
+		entries, err = d.parseSignedState(raw)
+		if errors.Is(err, errIntegrity) {
+			return errorResponse(ErrIntegrity, "%s: %v", path, err)
+		}
+		if err != nil {
+			return IPCResponse{Success: false, Error: err.Error()}
+		}
+	} else if entries, err = parseSwapEntries(data["processes"]); err != nil {
+		return invalidArg("%v", err)
+	}
+
+	next := make(map[uint32]ProcessInfo, len(entries))
+	for _, info := range entries {
+		if _, dup := next[info.PID]; dup {
+			return invalidArg("PID %d appears twice in the snapshot", info.PID)
+		}
+		next[info.PID] = info
+	}
+	if capacity := d.maps.ProcessMap.MaxEntries(); uint32(len(next)) > capacity {
+		return invalidArg("%d entries exceed process_map's %d", len(next), capacity)
+	}
+
+	d.mapMu.Lock()
+	defer d.mapMu.Unlock()
+
+	// The snapshot supersedes anything queued
+	if pending := d.coalesce.drain(); len(pending) > 0 {
+		metrics.UpdatesCoalesced.Add(uint64(len(pending)))
+	}
+	prev, err := readProcessMap(d.maps.ProcessMap)
+	if err != nil {
+		return IPCResponse{Success: false, Error: "read process_map: " + err.Error()}
+	}
+
+	method := swapAtomic
+	if err := d.swapAtomicLocked(next); err != nil {
+		if requireAtomic || errors.Is(err, errSwapStranded) {
+			return errorResponse(ErrInternal, "SWAP_MAP: %v", err)
+		}
+		log.Printf("Warning: SWAP_MAP cannot swap atomically (%v), rewriting process_map in place", err)
+		method = swapLocked
+		if err := rewriteProcessMapFrom(d.maps.ProcessMap, prev, next); err != nil {
+			return IPCResponse{Success: false, Error: "SWAP_MAP: " + err.Error()}
+		}
+	}
+
+	added, changed, removed := d.noteSwapLocked(prev, next)
+	log.Printf("[SWAP] process_map replaced (%s): %d entries, %d added, %d changed, %d removed",
+		method, len(next), added, changed, removed)
+	return IPCResponse{Success: true, Data: map[string]interface{}{
+		"method":  method,
+		"count":   len(next),
+		"added":   added,
+		"changed": changed,
+		"removed": removed,
+	}}
+}
+
+// parseSwapEntries decodes SWAP_MAP's "processes" list
+func parseSwapEntries(v interface{}) ([]ProcessInfo, error) {
+	list, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("Invalid 'processes': must be a list")
+	}
+	entries := make([]ProcessInfo, 0, len(list))
+	for i, item := range list {
+		e, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("processes[%d]: must be an object", i)
+		}
+		pid, err := uintArg(e, "pid", math.MaxUint32)
+		if err != nil || pid == 0 {
+			return nil, fmt.Errorf("processes[%d]: missing or invalid 'pid'", i)
+		}
+		level, err := levelArg(e, "taint_level")
+		if err != nil {
+			return nil, fmt.Errorf("processes[%d]: %v", i, err)
+		}
+		comm, err := stringArg(e, "comm")
+		if err != nil {
+			return nil, fmt.Errorf("processes[%d]: %v", i, err)
+		}
+		if len(comm) > maxCommLen || !utf8.ValidString(comm) {
+			return nil, fmt.Errorf("processes[%d]: 'comm' must be at most %d bytes of valid UTF-8", i, maxCommLen)
+		}
+		if comm == "" {
+			if st, err := readProcStat(uint32(pid)); err == nil {
+				comm = st.Comm
+			}
+		}
+		sandboxed, err := boolArg(e, "sandboxed")
+		if err != nil {
+			return nil, fmt.Errorf("processes[%d]: %v", i, err)
+		}
+		quarantined, err := boolArg(e, "quarantined")
+		if err != nil {
+			return nil, fmt.Errorf("processes[%d]: %v", i, err)
+		}
+
+		info := ProcessInfo{PID: uint32(pid), TaintLevel: level, Comm: commBytes(comm)}
+		if sandboxed {
+			info.IsSandboxed = 1
+		}
+		if quarantined {
+			info.Quarantined = 1
+		}
+		entries = append(entries, info)
+	}
+	return entries, nil
+}
+
+// readProcessMap returns every entry of a process_map
+func readProcessMap(m *ebpf.Map) (map[uint32]ProcessInfo, error) {
+	entries := make(map[uint32]ProcessInfo)
+	var pid uint32
+	var info ProcessInfo
+	iter := m.Iterate()
+	for iter.Next(&pid, &info) {
+		entries[pid] = info
+	}
+	return entries, iter.Err()
+}
+
+// swapAtomicLocked moves the programs onto a map holding next, rewrites
+// the live map to match and moves them back. Caller holds mapMu.
+func (d *TelosDaemon) swapAtomicLocked(next map[uint32]ProcessInfo) error {
+	d.bpfMu.Lock()
+	defer d.bpfMu.Unlock()
+	if d.coll == nil {
+		return fmt.Errorf("no BPF object loaded")
+	}
+
+	live := d.maps.ProcessMap
+	tmp, err := ebpf.NewMap(&ebpf.MapSpec{
+		Name:       "process_map",
+		Type:       live.Type(),
+		KeySize:    live.KeySize(),
+		ValueSize:  live.ValueSize(),
+		MaxEntries: live.MaxEntries(),
+		Flags:      live.Flags(),
+	})
+	if err != nil {
+		return fmt.Errorf("create map: %w", err)
+	}
+	defer tmp.Close()
+	for pid, info := range next {
+		if err := tmp.Put(pid, info); err != nil {
+			return fmt.Errorf("fill map: PID %d: %w", pid, err)
+		}
+	}
+
+	path := d.bpfObjPath
+	if _, err := d.reloadLocked(path, map[string]*ebpf.Map{"process_map": tmp}); err != nil {
+		return err // Rolled back, the old programs still read live
+	}
+	onTmp := d.coll
+
+	// The new state is enforced; bring live up to it and move back
+	copied, err := readProcessMap(tmp)
+	if err == nil {
+		err = rewriteProcessMap(live, copied)
+	}
+	if err == nil {
+		_, err = d.reloadLocked(path, nil)
+	}
+	if err != nil {
+		log.Printf("Warning: SWAP_MAP stranded the programs on a temporary process_map: %v; RELOAD_BPF to recover", err)
+		return fmt.Errorf("%w: %v", errSwapStranded, err)
+	}
+	onTmp.Close()
+
+	// Pick up what the hooks wrote while they were on tmp
+	final, err := readProcessMap(tmp)
+	if err != nil {
+		return nil // Swapped; the hooks' writes in between are lost
+	}
+	for pid, info := range final {
+		if was, ok := copied[pid]; ok && was == info {
+			continue
+		}
+		if err := live.Put(pid, info); err != nil {
+			log.Printf("Warning: SWAP_MAP: carry over PID %d: %v", pid, err)
+		}
+	}
+	return nil
+}
+
+// rewriteProcessMap makes m hold exactly next
+func rewriteProcessMap(m *ebpf.Map, next map[uint32]ProcessInfo) error {
+	prev, err := readProcessMap(m)
+	if err != nil {
+		return err
+	}
+	return rewriteProcessMapFrom(m, prev, next)
+}
+
+// rewriteProcessMapFrom makes m, holding prev, hold exactly next:
+// writes first, so no PID in next is ever briefly absent
+func rewriteProcessMapFrom(m *ebpf.Map, prev, next map[uint32]ProcessInfo) error {
+	for pid, info := range next {
+		if old, ok := prev[pid]; ok && old == info {
+			continue
+		}
+		if err := m.Put(pid, info); err != nil {
+			return fmt.Errorf("PID %d: %w", pid, err)
+		}
+	}
+	for pid := range prev {
+		if _, keep := next[pid]; keep {
+			continue
+		}
+		if err := m.Delete(pid); err != nil && !errors.Is(err, ebpf.ErrKeyNotExist) {
+			return fmt.Errorf("PID %d: %w", pid, err)
+		}
+	}
+	return nil
+}
+
+// noteSwapLocked does the per-PID bookkeeping for a swap from prev to
+// next and counts the differences. Caller holds mapMu.
+func (d *TelosDaemon) noteSwapLocked(prev, next map[uint32]ProcessInfo) (added, changed, removed int) {
+	for pid, info := range next {
+		old, ok := prev[pid]
+		switch {
+		case !ok:
+			added++
+			recordTaintChange(TaintClean, info.TaintLevel)
+			d.notifyTaint(pid, TaintClean, info.TaintLevel, "SWAP_MAP")
+		case old != info:
+			changed++
+			if old.TaintLevel != info.TaintLevel {
+				recordTaintChange(old.TaintLevel, info.TaintLevel)
+				d.notifyTaint(pid, old.TaintLevel, info.TaintLevel, "SWAP_MAP")
+			}
+		}
+		d.touch(pid)
+	}
+	for pid := range prev {
+		if _, ok := next[pid]; ok {
+			continue
+		}
+		removed++
+		d.forget(pid)
+		d.notifyClear(pid, "SWAP_MAP")
+	}
+	d.resetMapFill(len(next))
+	return added, changed, removed
+}
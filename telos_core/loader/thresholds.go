@@ -0,0 +1,73 @@
+/*
+ * Telos Core - Per-Hook Thresholds
+ *
+ * SET_THRESHOLD tunes one hook's limit in the live config_map without
+ * touching the others:
+ *
+ *   {"command":"SET_THRESHOLD","data":{"hook":"connect","max_taint":2}}
+ *
+ * A hook blocks a process whose taint is above its max_taint, so
+ * max_taint CRITICAL (4) never blocks.
+ */
+
+package main
+
+import (
+	"log"
+	"sort"
+	"strings"
+)
+
+// thresholdFields maps hook names to their Config field
+var thresholdFields = map[string]func(*Config) *uint32{
+	"exec":    func(c *Config) *uint32 { return &c.MaxTaintForExec },
+	"file":    func(c *Config) *uint32 { return &c.MaxTaintForOpen },
+	"connect": func(c *Config) *uint32 { return &c.MaxTaintForConnect },
+	"ptrace":  func(c *Config) *uint32 { return &c.MaxTaintForPtrace },
+}
+
+// thresholdHooks lists valid hook names for error messages
+func thresholdHooks() string {
+	names := make([]string, 0, len(thresholdFields))
+	for name := range thresholdFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// cmdSetThreshold handles SET_THRESHOLD ({hook, max_taint})
+func (d *TelosDaemon) cmdSetThreshold(data map[string]interface{}) IPCResponse {
+	hook, err := stringArg(data, "hook")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+	field, ok := thresholdFields[hook]
+	if !ok {
+		return invalidArg("Invalid 'hook' %q (want one of %s)", hook, thresholdHooks())
+	}
+	maxTaint, err := levelArg(data, "max_taint")
+	if err != nil {
+		return invalidArg("%v", err)
+	}
+
+	d.cfgMu.Lock()
+	defer d.cfgMu.Unlock()
+	if d.lockdown.active {
+		return IPCResponse{Success: false, Error: "panic mode is active; EXIT_PANIC_MODE first"}
+	}
+
+	cfg, err := d.activeConfig()
+	if err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+	old := *field(&cfg)
+	*field(&cfg) = maxTaint
+	if err := d.maps.ConfigMap.Put(uint32(0), cfg); err != nil {
+		return IPCResponse{Success: false, Error: err.Error()}
+	}
+
+	log.Printf("[THRESHOLD] %s max taint %s -> %s", hook, taintLevelName(old), taintLevelName(maxTaint))
+	d.notifyConfig(cfg, "SET_THRESHOLD")
+	return IPCResponse{Success: true, Data: configJSON(cfg)}
+}
@@ -0,0 +1,81 @@
+/*
+ * Telos Core - Connection Workers
+ *
+ * By default every accepted connection gets its own goroutine. With
+ * --handler-workers N, connections are served by N workers instead, fed
+ * from a queue of handlerQueueFactor*N accepted connections; when the
+ * queue is full the accept loop waits, so a connection storm backs up
+ * into the kernel's listen backlog rather than into goroutines contending
+ * on mapMu.
+ *
+ * A worker serves one connection until it closes, so persistent clients
+ * each hold a worker; pair the pool with --idle-timeout. SUBSCRIBE
+ * streams are handed to a goroutine of their own once the subscription
+ * starts, so long-lived streams never pin workers.
+ *
+ * telos_handler_queue_depth and telos_handler_workers_busy (out of
+ * telos_handler_workers) show how loaded the pool is.
+ */
+
+package main
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// handlerQueueFactor sizes the accepted-connection queue per worker
+const handlerQueueFactor = 4
+
+// handlerPool runs connection handlers on a fixed set of workers
+type handlerPool struct {
+	queue chan net.Conn
+	size  int
+	busy  atomic.Int64
+}
+
+// startHandlerPool starts n workers serving connections from the queue
+func (d *TelosDaemon) startHandlerPool(n int) {
+	d.pool = &handlerPool{
+		queue: make(chan net.Conn, n*handlerQueueFactor),
+		size:  n,
+	}
+	for i := 0; i < n; i++ {
+		go d.runHandlerWorker()
+	}
+}
+
+// runHandlerWorker serves queued connections one at a time. Workers
+// outlive Stop so connections still queued are drained, not leaked.
+func (d *TelosDaemon) runHandlerWorker() {
+	for conn := range d.pool.queue {
+		d.pool.busy.Add(1)
+		d.handleConnection(conn)
+		d.pool.busy.Add(-1)
+	}
+}
+
+// dispatchConnection hands an accepted connection to a handler,
+// waiting for queue space when the pool is saturated
+func (d *TelosDaemon) dispatchConnection(conn net.Conn) {
+	if d.pool == nil {
+		go d.handleConnection(conn)
+		return
+	}
+	select {
+	case d.pool.queue <- conn:
+	case <-d.done:
+		conn.Close()
+		d.conns.remove(conn)
+	}
+}
+
+// poolMetrics adds the worker pool gauges to m
+func (d *TelosDaemon) poolMetrics(m map[string]float64) {
+	if d.pool == nil {
+		return
+	}
+	m["telos_handler_workers"] = float64(d.pool.size)
+	m["telos_handler_workers_busy"] = float64(d.pool.busy.Load())
+	m["telos_handler_queue_depth"] = float64(len(d.pool.queue))
+}
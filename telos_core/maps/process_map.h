@@ -16,7 +16,8 @@
  * Map pinning paths
  *
  * Maps are pinned to the BPF filesystem for persistence
- * and access from userspace (Go loader).
+ * and access from userspace (Go loader). These are the
+ * defaults; the loader's --pin-path flag overrides the base.
  */
 #define TELOS_BPF_PATH "/sys/fs/bpf/telos"
 #define PROCESS_MAP_PATH TELOS_BPF_PATH "/process_map"
@@ -8,6 +8,29 @@
  * Hooks:
  *   - lsm/bprm_check_security: Block execve() for tainted processes
  *   - lsm/file_open: Block sensitive file access for tainted processes
+ *   - lsm/socket_connect: Report outbound connections for egress policy
+ *   - lsm/ptrace_access_check: Block ptrace/process_vm_* by tainted tracers
+ *   - lsm/bprm_committed_creds: Apply the exec taint policy after execve()
+ *
+ * A quarantined process (QUARANTINE_PID) is denied by every hook before
+ * taint is even looked at, and is denied even in audit-only mode.
+ *
+ * config->enabled selects the mode: ENFORCE_ON denies, ENFORCE_AUDIT
+ * only reports threshold violations (quarantine still denies), and
+ * ENFORCE_OFF never denies anything. Events are emitted in every mode,
+ * so "off" is a pure visibility deployment. config->maintenance
+ * (ENTER_MAINTENANCE) makes ENFORCE_ON behave like ENFORCE_AUDIT without
+ * touching the configured mode.
+ *
+ * A PID absent from process_map (and, for exec, whose parent is absent
+ * too) is checked as if at default_taint_untracked, CLEAN by default.
+ * Raising it makes unknown processes subject to the thresholds, so a
+ * process can't escape enforcement just by never registering.
+ *
+ * PIDs in exempt_map (the daemon and its supervisor chain, plus the
+ * allowlist: init, sshd, getty, ...) are allowed by every hook
+ * unconditionally, so Telos can never lock out the processes that
+ * manage it or the way back into the host.
  *
  * Build:
  *   clang -O2 -g -target bpf -c bpf_lsm.c -o bpf_lsm.o
@@ -28,25 +51,49 @@
 #define EPERM 1
 #endif
 
+// Address families (from linux/socket.h, not in vmlinux.h)
+#ifndef AF_INET
+#define AF_INET 2
+#endif
+#ifndef AF_INET6
+#define AF_INET6 10
+#endif
+
 // === LICENSE ===
 char LICENSE[] SEC("license") = "GPL";
 
 // === MAPS ===
 
 // Process taint map: PID -> process_info_t
+// "PID" is the TGID (upper half of bpf_get_current_pid_tgid), so every
+// thread of a process shares one entry; the daemon maps thread IDs it is
+// given to their TGID before writing.
 struct {
   __uint(type, BPF_MAP_TYPE_HASH);
   __uint(max_entries, 4096);
-  __type(key, __u32); // PID
+  __type(key, __u32); // TGID
   __type(value, struct process_info_t);
 } process_map SEC(".maps");
 
 // Configuration map: index -> config value
 // Note: Named telos_config_t to avoid conflict with vmlinux.h's config_t
+// The loader migrates pinned configs by version, so fields are only
+// ever appended, with TELOS_CONFIG_VERSION bumped (loader/configversion.go)
+#define TELOS_CONFIG_VERSION 3
+
 struct telos_config_t {
+  __u32 version;            // TELOS_CONFIG_VERSION of the writer
   __u32 max_taint_for_exec; // Threshold for blocking execve
   __u32 max_taint_for_open; // Threshold for blocking file open
-  __u32 enabled;            // 0 = audit only, 1 = enforce
+  __u32 enabled;            // ENFORCE_*: 0 = audit, 1 = enforce, 2 = off
+  __u32 report_allowed;     // 1 = also report allowed execs (shadow mode)
+  __u32 max_taint_for_connect; // Threshold for blocking socket connect
+  __u32 max_taint_for_ptrace;  // Threshold for blocking ptrace by the tracer
+  __u32 exec_taint;            // EXEC_TAINT_* applied after a successful execve
+  __u32 default_taint_untracked; // Taint assumed for PIDs not in process_map
+  __u32 maintenance;             // 1 = audit-only until EXIT_MAINTENANCE
+  __u32 report_exec;             // 1 = report tracked execs for binary hashing
+  __u32 sandbox_tighten;         // Levels every threshold drops for is_sandboxed
 };
 
 struct {
@@ -56,6 +103,44 @@ struct {
   __type(value, struct telos_config_t);
 } config_map SEC(".maps");
 
+// Enforcement modes (config->enabled)
+#define ENFORCE_AUDIT 0 // report threshold violations, deny quarantined
+#define ENFORCE_ON 1    // deny (default)
+#define ENFORCE_OFF 2   // report only, quarantine included
+
+// Exec taint policy: what a successful execve does to the taint level
+#define EXEC_TAINT_PRESERVE 0 // keep the level (default)
+#define EXEC_TAINT_CLEAR 1    // reset to CLEAN
+#define EXEC_TAINT_REDUCE 2   // drop one level
+
+// Path policy map: executable (device, inode) -> per-binary override.
+// Userspace resolves paths, so symlinks and relative paths can't dodge it.
+struct path_policy_key_t {
+  __u64 dev; // kernel encoding of the superblock's s_dev
+  __u64 ino;
+};
+
+struct path_policy_t {
+  __u32 exec_taint; // EXEC_TAINT_*, overrides config->exec_taint
+};
+
+struct {
+  __uint(type, BPF_MAP_TYPE_HASH);
+  __uint(max_entries, 1024);
+  __type(key, struct path_policy_key_t);
+  __type(value, struct path_policy_t);
+} path_policy_map SEC(".maps");
+
+// Exemption set: PID -> 1. Written by the daemon for itself, its
+// ancestors and allowlisted processes; checked before anything else in
+// every enforcing hook.
+struct {
+  __uint(type, BPF_MAP_TYPE_HASH);
+  __uint(max_entries, 1024);
+  __type(key, __u32); // PID
+  __type(value, __u32);
+} exempt_map SEC(".maps");
+
 // Ringbuf for sending events to userspace (audit log)
 struct event_t {
   __u32 pid;
@@ -63,8 +148,22 @@ struct event_t {
   __u32 blocked;
   char comm[16];
   char action[16]; // "execve" or "open"
+  __u64 cgroup_id; // cgroup v2 ID of the task (userspace resolves names)
+  __u16 family;    // AF_INET/AF_INET6 for "connect", 0 otherwise
+  __u16 dport;     // Destination port (network byte order)
+  __u8 daddr[16];  // Destination address (IPv4 uses the first 4 bytes)
+  __u32 quarantined; // 1 if denied because the process is quarantined
+  __u64 inode;       // Inode of the opened file for "open", 0 otherwise
+  __u32 reason;      // REASON_*: why the event was reported
+  __u8 max_taint;    // The hook's threshold when the event was reported
+  __u8 denied;       // 1 if the operation actually failed with -EPERM
 };
 
+// Event reasons (event->reason)
+#define REASON_NONE 0       // allowed, reported for shadow mode / egress
+#define REASON_THRESHOLD 1  // taint above the hook's max_taint_for_*
+#define REASON_QUARANTINE 2 // process is quarantined
+
 struct {
   __uint(type, BPF_MAP_TYPE_RINGBUF);
   __uint(max_entries, 256 * 1024); // 256 KB
@@ -77,7 +176,46 @@ static __always_inline struct telos_config_t *get_config(void) {
   return bpf_map_lookup_elem(&config_map, &key);
 }
 
+// Taint assumed for a PID absent from process_map
+static __always_inline __u32 untracked_taint(struct telos_config_t *config) {
+  return config ? config->default_taint_untracked : TAINT_CLEAN;
+}
+
+// Whether threshold violations are denied (maintenance audits instead)
+static __always_inline __u32 enforcing(struct telos_config_t *config) {
+  return config ? config->enabled == ENFORCE_ON && !config->maintenance : 1;
+}
+
+// Whether quarantined processes are denied (every mode but off)
+static __always_inline __u32 quarantine_enforced(struct telos_config_t *config) {
+  return config ? config->enabled != ENFORCE_OFF : 1;
+}
+
+// A hook's threshold for info's process: sandboxed processes are held
+// sandbox_tighten levels stricter (never below CLEAN)
+static __always_inline __u32 hook_max(struct telos_config_t *config,
+                                      __u32 max_taint,
+                                      struct process_info_t *info) {
+  if (!config || !info || !info->is_sandboxed)
+    return max_taint;
+  return max_taint > config->sandbox_tighten
+             ? max_taint - config->sandbox_tighten
+             : TAINT_CLEAN;
+}
+
+static __always_inline int is_exempt(__u32 pid) {
+  return bpf_map_lookup_elem(&exempt_map, &pid) != NULL;
+}
+
+static __always_inline __u32 event_reason(__u32 blocked, __u32 quarantined) {
+  if (quarantined)
+    return REASON_QUARANTINE;
+  return blocked ? REASON_THRESHOLD : REASON_NONE;
+}
+
 static __always_inline void emit_event(__u32 pid, __u32 taint, __u32 blocked,
+                                       __u32 quarantined, __u64 inode,
+                                       __u32 max_taint, __u32 denied,
                                        const char *action) {
   struct event_t *event;
 
@@ -89,6 +227,13 @@ static __always_inline void emit_event(__u32 pid, __u32 taint, __u32 blocked,
   event->taint_level = taint;
   event->blocked = blocked;
   bpf_get_current_comm(&event->comm, sizeof(event->comm));
+  event->cgroup_id = bpf_get_current_cgroup_id();
+  event->family = 0;
+  event->quarantined = quarantined;
+  event->inode = inode;
+  event->reason = event_reason(blocked, quarantined);
+  event->max_taint = max_taint;
+  event->denied = denied;
 
   // Copy action string (max 15 chars + null)
   __builtin_memcpy(event->action, action, 7);
@@ -96,6 +241,48 @@ static __always_inline void emit_event(__u32 pid, __u32 taint, __u32 blocked,
   bpf_ringbuf_submit(event, 0);
 }
 
+static __always_inline void emit_connect_event(__u32 pid, __u32 taint,
+                                               __u32 blocked, __u32 quarantined,
+                                               __u32 max_taint, __u32 denied,
+                                               struct sockaddr *address) {
+  struct event_t *event;
+  __u16 family = BPF_CORE_READ(address, sa_family);
+
+  if (family != AF_INET && family != AF_INET6)
+    return;
+
+  event = bpf_ringbuf_reserve(&events, sizeof(*event), 0);
+  if (!event)
+    return;
+
+  event->pid = pid;
+  event->taint_level = taint;
+  event->blocked = blocked;
+  event->quarantined = quarantined;
+  event->inode = 0;
+  event->reason = event_reason(blocked, quarantined);
+  event->max_taint = max_taint;
+  event->denied = denied;
+  bpf_get_current_comm(&event->comm, sizeof(event->comm));
+  event->cgroup_id = bpf_get_current_cgroup_id();
+  __builtin_memset(event->action, 0, sizeof(event->action));
+  __builtin_memcpy(event->action, "connect", 8);
+  __builtin_memset(event->daddr, 0, sizeof(event->daddr));
+  event->family = family;
+
+  if (family == AF_INET) {
+    struct sockaddr_in *sin = (struct sockaddr_in *)address;
+    event->dport = BPF_CORE_READ(sin, sin_port);
+    bpf_probe_read_kernel(event->daddr, 4, &sin->sin_addr);
+  } else {
+    struct sockaddr_in6 *sin6 = (struct sockaddr_in6 *)address;
+    event->dport = BPF_CORE_READ(sin6, sin6_port);
+    bpf_probe_read_kernel(event->daddr, 16, &sin6->sin6_addr);
+  }
+
+  bpf_ringbuf_submit(event, 0);
+}
+
 // === LSM HOOKS ===
 
 /*
@@ -114,16 +301,24 @@ int BPF_PROG(telos_check_exec, struct linux_binprm *bprm) {
   __u32 pid = bpf_get_current_pid_tgid() >> 32;
   struct process_info_t *info = NULL;
   __u32 effective_taint = TAINT_CLEAN;
+  __u32 quarantined = 0;
+  __u32 tracked = 0;
+
+  if (is_exempt(pid))
+    return 0;
 
   // Get config
   struct telos_config_t *config = get_config();
   __u32 max_taint = config ? config->max_taint_for_exec : TAINT_MEDIUM;
-  __u32 enforce = config ? config->enabled : 1;
+  __u32 enforce = enforcing(config);
 
   // First, check if THIS process is tracked
   info = bpf_map_lookup_elem(&process_map, &pid);
   if (info) {
     effective_taint = info->taint_level;
+    quarantined = info->quarantined;
+    max_taint = hook_max(config, max_taint, info);
+    tracked = 1;
   } else {
     // Not tracked directly - check PARENT process
     // This catches forked children of tainted processes
@@ -136,23 +331,109 @@ int BPF_PROG(telos_check_exec, struct linux_binprm *bprm) {
           bpf_map_lookup_elem(&process_map, &ppid);
       if (parent_info) {
         effective_taint = parent_info->taint_level;
+        quarantined = parent_info->quarantined;
+        max_taint = hook_max(config, max_taint, parent_info);
+        tracked = 1;
       }
     }
   }
+  if (!tracked)
+    effective_taint = untracked_taint(config);
+
+  // Quarantine is a hard deny, independent of taint and audit mode
+  // (only ENFORCE_OFF lets it through, still reported)
+  if (quarantined) {
+    emit_event(pid, effective_taint, 1, 1, 0, max_taint,
+               quarantine_enforced(config), "execve");
+    return quarantine_enforced(config) ? -EPERM : 0;
+  }
 
   // Check if taint exceeds threshold
   if (effective_taint > max_taint) {
     // Emit to ringbuf for userspace logging (lightweight)
-    emit_event(pid, effective_taint, 1, "execve");
+    emit_event(pid, effective_taint, 1, 0, 0, max_taint, enforce, "execve");
 
     if (enforce) {
       return -EPERM; // Permission denied
     }
+  } else if (tracked && config && config->report_allowed) {
+    // Shadow mode: userspace compares against a candidate config
+    emit_event(pid, effective_taint, 0, 0, 0, max_taint, 0, "execve");
   }
 
   return 0; // Allow
 }
 
+/*
+ * Hook: bprm_committed_creds
+ *
+ * Called once execve() can no longer fail, so a blocked or failed exec
+ * never changes taint. Applies the exec taint policy (global, or the
+ * executable's path_policy_map override) to the new program. A child
+ * that only inherited its parent's taint gets its own entry, so a
+ * trusted binary run by a tainted parent can start from a lower level.
+ * Quarantined processes are never touched.
+ *
+ * With report_exec set, a tracked process's new binary is also reported
+ * ("binary", with its inode) so userspace can hash it.
+ */
+SEC("lsm/bprm_committed_creds")
+int BPF_PROG(telos_exec_taint, struct linux_binprm *bprm) {
+  __u32 pid = bpf_get_current_pid_tgid() >> 32;
+  struct process_info_t *info = bpf_map_lookup_elem(&process_map, &pid);
+  struct process_info_t *parent_info = NULL;
+  struct telos_config_t *config = get_config();
+
+  if (info && config && config->report_exec)
+    emit_event(pid, info->taint_level, 0, info->quarantined,
+               BPF_CORE_READ(bprm, file, f_inode, i_ino), 0, 0, "binary");
+
+  if (!info) {
+    struct task_struct *current_task =
+        (struct task_struct *)bpf_get_current_task();
+    __u32 ppid = BPF_CORE_READ(current_task, real_parent, tgid);
+    parent_info = bpf_map_lookup_elem(&process_map, &ppid);
+    if (!parent_info)
+      return 0; // Not tracked
+  }
+
+  struct process_info_t *src = info ? info : parent_info;
+  if (src->quarantined)
+    return 0;
+
+  __u32 mode = config ? config->exec_taint : EXEC_TAINT_PRESERVE;
+
+  struct path_policy_key_t key = {};
+  key.dev = BPF_CORE_READ(bprm, file, f_inode, i_sb, s_dev);
+  key.ino = BPF_CORE_READ(bprm, file, f_inode, i_ino);
+  struct path_policy_t *policy = bpf_map_lookup_elem(&path_policy_map, &key);
+  if (policy)
+    mode = policy->exec_taint;
+
+  __u32 taint = src->taint_level;
+  if (mode == EXEC_TAINT_CLEAR)
+    taint = TAINT_CLEAN;
+  else if (mode == EXEC_TAINT_REDUCE && taint > TAINT_CLEAN)
+    taint--;
+
+  if (taint == src->taint_level)
+    return 0;
+
+  if (info) {
+    info->taint_level = taint;
+    bpf_get_current_comm(&info->comm, sizeof(info->comm));
+    return 0;
+  }
+
+  struct process_info_t child = {};
+  child.pid = pid;
+  child.taint_level = taint;
+  child.is_sandboxed = parent_info->is_sandboxed;
+  bpf_get_current_comm(&child.comm, sizeof(child.comm));
+  bpf_map_update_elem(&process_map, &pid, &child, BPF_NOEXIST);
+  return 0;
+}
+
 /*
  * Hook: file_open
  *
@@ -163,21 +444,36 @@ SEC("lsm/file_open")
 int BPF_PROG(telos_check_file, struct file *file) {
   __u32 pid = bpf_get_current_pid_tgid() >> 32;
 
+  if (is_exempt(pid))
+    return 0;
+
+  // Get config
+  struct telos_config_t *config = get_config();
+  __u32 max_taint = config ? config->max_taint_for_open : TAINT_HIGH;
+  __u32 enforce = enforcing(config);
+
   // Lookup process in taint map
   struct process_info_t *info = bpf_map_lookup_elem(&process_map, &pid);
-  if (!info) {
+  __u32 taint = info ? info->taint_level : untracked_taint(config);
+  if (!info && taint == TAINT_CLEAN) {
     // Not a tracked process - allow
     return 0;
   }
+  max_taint = hook_max(config, max_taint, info);
 
-  // Get config
-  struct telos_config_t *config = get_config();
-  __u32 max_taint = config ? config->max_taint_for_open : TAINT_HIGH;
-  __u32 enforce = config ? config->enabled : 1;
+  __u64 ino = BPF_CORE_READ(file, f_inode, i_ino);
+
+  // Quarantine is a hard deny, independent of taint and audit mode
+  // (only ENFORCE_OFF lets it through, still reported)
+  if (info && info->quarantined) {
+    emit_event(pid, taint, 1, 1, ino, max_taint, quarantine_enforced(config),
+               "open");
+    return quarantine_enforced(config) ? -EPERM : 0;
+  }
 
-  // For now, we only block if taint is CRITICAL
+  // Only taint above the threshold (CRITICAL by default) is checked
   // More granular file path checking would require more complex logic
-  if (info->taint_level >= TAINT_CRITICAL) {
+  if (taint > max_taint) {
     // Get the dentry to check path
     struct dentry *dentry = BPF_CORE_READ(file, f_path.dentry);
     if (!dentry)
@@ -197,7 +493,7 @@ int BPF_PROG(telos_check_file, struct file *file) {
     // Check for SSH keys
     if (filename[0] == 'i' && filename[1] == 'd' && filename[2] == '_') {
       // Matches id_* (id_rsa, id_ed25519, etc.)
-      emit_event(pid, info->taint_level, 1, "open");
+      emit_event(pid, taint, 1, 0, ino, max_taint, enforce, "open");
 
       if (enforce) {
         return -EPERM;
@@ -208,6 +504,87 @@ int BPF_PROG(telos_check_file, struct file *file) {
   return 0; // Allow
 }
 
+/*
+ * Hook: socket_connect
+ *
+ * Reports outbound connections of tracked processes to userspace, which
+ * checks the destination against the egress policy and may escalate
+ * taint. Blocks quarantined processes and taint above
+ * max_taint_for_connect (CRITICAL by default, i.e. never); the egress
+ * policy decision stays off the kernel hot path.
+ */
+SEC("lsm/socket_connect")
+int BPF_PROG(telos_check_connect, struct socket *sock,
+             struct sockaddr *address, int addrlen) {
+  __u32 pid = bpf_get_current_pid_tgid() >> 32;
+
+  if (is_exempt(pid))
+    return 0;
+
+  struct telos_config_t *config = get_config();
+  __u32 max_taint = config ? config->max_taint_for_connect : TAINT_CRITICAL;
+  __u32 enforce = enforcing(config);
+
+  struct process_info_t *info = bpf_map_lookup_elem(&process_map, &pid);
+  __u32 taint = info ? info->taint_level : untracked_taint(config);
+  max_taint = hook_max(config, max_taint, info);
+  __u32 blocked = taint > max_taint;
+  if (!info && !blocked) {
+    return 0; // Not tracked, nothing to report
+  }
+
+  if (info && info->quarantined) {
+    emit_connect_event(pid, taint, 1, 1, max_taint, quarantine_enforced(config),
+                       address);
+    return quarantine_enforced(config) ? -EPERM : 0;
+  }
+
+  emit_connect_event(pid, taint, blocked, 0, max_taint, blocked && enforce,
+                     address);
+  return blocked && enforce ? -EPERM : 0;
+}
+
+/*
+ * Hook: ptrace_access_check
+ *
+ * Called when the current task tries to ptrace (or process_vm_readv)
+ * another. A tainted tracer must not read or rewrite other processes'
+ * memory, e.g. to steal secrets or inject into an untainted process.
+ */
+SEC("lsm/ptrace_access_check")
+int BPF_PROG(telos_check_ptrace, struct task_struct *child, unsigned int mode) {
+  __u32 pid = bpf_get_current_pid_tgid() >> 32;
+
+  if (is_exempt(pid))
+    return 0;
+
+  struct telos_config_t *config = get_config();
+  __u32 max_taint = config ? config->max_taint_for_ptrace : TAINT_CRITICAL;
+  __u32 enforce = enforcing(config);
+
+  struct process_info_t *info = bpf_map_lookup_elem(&process_map, &pid);
+  __u32 taint = info ? info->taint_level : untracked_taint(config);
+  if (!info && taint == TAINT_CLEAN) {
+    return 0; // Not tracked
+  }
+  max_taint = hook_max(config, max_taint, info);
+
+  if (info && info->quarantined) {
+    emit_event(pid, taint, 1, 1, 0, max_taint, quarantine_enforced(config),
+               "ptrace");
+    return quarantine_enforced(config) ? -EPERM : 0;
+  }
+
+  if (taint > max_taint) {
+    emit_event(pid, taint, 1, 0, 0, max_taint, enforce, "ptrace");
+    if (enforce) {
+      return -EPERM;
+    }
+  }
+
+  return 0;
+}
+
 /*
  * Hook: task_alloc (optional)
  *